@@ -0,0 +1,186 @@
+package extractor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"path"
+	"sort"
+	"unicode"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Anonymization methods of a profile.
+const (
+	AnonymizeKeep     = "keep"
+	AnonymizeHash     = "hash"
+	AnonymizeTruncate = "truncate"
+	AnonymizeFake     = "fake"
+	AnonymizeDrop     = "drop"
+)
+
+var anonymizeFlag = cli.StringFlag{
+	Name: "anonymize",
+	Usage: "Anonymization profile for example values of fields without a tag in the -config file: " +
+		"\"keep\", \"hash\", \"truncate\", \"fake\", \"drop\" or a profile of the config file",
+}
+
+// anonymizeProfile describes how values are anonymized.
+type anonymizeProfile struct {
+	Method string `yaml:"method"`
+	// Length is the number of characters kept by "truncate", 4 by default.
+	Length int `yaml:"length"`
+	// Retention notes how long the values of the fields of the tag are
+	// kept, for -format pii-report.
+	Retention string `yaml:"retention"`
+}
+
+// anonymizeConfig is the "anonymize" section of the -config file. Fields
+// match "collection.field" or "field" glob patterns and name the tag, i.e.
+// the profile, applied to them:
+//
+//	anonymize:
+//	  salt: change-me
+//	  profiles:
+//	    pii: {method: fake, retention: 2 years after account closure}
+//	    secret: {method: drop}
+//	  fields:
+//	    "users.email": pii
+//	    "*.password": secret
+type anonymizeConfig struct {
+	// Salt keys the hashes, so that values cannot be recovered by hashing
+	// guesses without it.
+	Salt     string                      `yaml:"salt"`
+	Default  string                      `yaml:"default"`
+	Profiles map[string]anonymizeProfile `yaml:"profiles"`
+	Fields   map[string]string           `yaml:"fields"`
+}
+
+// anonymizer applies the anonymization policy to every example value written
+// to the output: -deep top values and values quoted in findings.
+type anonymizer struct {
+	salt     []byte
+	fallback anonymizeProfile
+	profiles map[string]anonymizeProfile
+	patterns []string // sorted for a deterministic choice among matches
+	tags     map[string]string
+}
+
+// valueAnonymizer is the policy of the run; nil keeps values as they are.
+var valueAnonymizer *anonymizer
+
+func newAnonymizer(cfg anonymizeConfig, defaultProfile string) (*anonymizer, error) {
+	a := &anonymizer{salt: []byte(cfg.Salt), profiles: make(map[string]anonymizeProfile), tags: cfg.Fields}
+	for _, method := range []string{AnonymizeKeep, AnonymizeHash, AnonymizeTruncate, AnonymizeFake, AnonymizeDrop} {
+		a.profiles[method] = anonymizeProfile{Method: method}
+	}
+	for name, p := range cfg.Profiles {
+		switch p.Method {
+		case AnonymizeKeep, AnonymizeHash, AnonymizeTruncate, AnonymizeFake, AnonymizeDrop:
+		default:
+			return nil, fmt.Errorf("profile %v: unknown method %q", name, p.Method)
+		}
+		a.profiles[name] = p
+	}
+	for pattern, tag := range cfg.Fields {
+		if _, ok := a.profiles[tag]; !ok {
+			return nil, fmt.Errorf("field %v: unknown profile %q", pattern, tag)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("field %v: %v", pattern, err)
+		}
+		a.patterns = append(a.patterns, pattern)
+	}
+	sort.Strings(a.patterns)
+	if defaultProfile == "" {
+		defaultProfile = cfg.Default
+	}
+	if defaultProfile == "" {
+		defaultProfile = AnonymizeKeep
+	}
+	p, ok := a.profiles[defaultProfile]
+	if !ok {
+		return nil, fmt.Errorf("unknown anonymization profile %q", defaultProfile)
+	}
+	a.fallback = p
+	return a, nil
+}
+
+// tag returns the tag the config gives the field, "" when none.
+func (a *anonymizer) tag(collection, field string) string {
+	if a == nil {
+		return ""
+	}
+	for _, pattern := range a.patterns {
+		if matchAny([]string{pattern}, collection+"."+field) || matchAny([]string{pattern}, field) {
+			return a.tags[pattern]
+		}
+	}
+	return ""
+}
+
+func (a *anonymizer) profile(collection, field string) anonymizeProfile {
+	if tag := a.tag(collection, field); tag != "" {
+		return a.profiles[tag]
+	}
+	return a.fallback
+}
+
+// anonymize returns the value to write for a value of the field, or false
+// when it must be left out. Equal values give equal results, so that outputs
+// stay consistent with each other.
+func anonymize(collection, field, value string) (string, bool) {
+	a := valueAnonymizer
+	if a == nil {
+		return value, true
+	}
+	p := a.profile(collection, field)
+	switch p.Method {
+	case AnonymizeHash:
+		return "h:" + hex.EncodeToString(a.digest(value))[:16], true
+	case AnonymizeTruncate:
+		length := p.Length
+		if length <= 0 {
+			length = 4
+		}
+		runes := []rune(value)
+		if len(runes) <= length {
+			return value, true
+		}
+		return string(runes[:length]) + "…", true
+	case AnonymizeFake:
+		return a.fake(value), true
+	case AnonymizeDrop:
+		return "", false
+	}
+	return value, true
+}
+
+func (a *anonymizer) digest(value string) []byte {
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// fake replaces letters and digits with random ones of the same kind and
+// case, keeping punctuation, so that emails still look like emails. The
+// replacement is derived from the value.
+func (a *anonymizer) fake(value string) string {
+	r := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(a.digest(value)))))
+	runes := []rune(value)
+	for i, c := range runes {
+		switch {
+		case unicode.IsDigit(c):
+			runes[i] = rune('0' + r.Intn(10))
+		case unicode.IsUpper(c):
+			runes[i] = rune('A' + r.Intn(26))
+		case unicode.IsLetter(c):
+			runes[i] = rune('a' + r.Intn(26))
+		}
+	}
+	return string(runes)
+}
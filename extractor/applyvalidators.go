@@ -0,0 +1,149 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	validatorsFlag = cli.StringSliceFlag{
+		Name:  "validators",
+		Usage: "collMod command written by -format mongo-validator, or a glob pattern of them, e.g. \"validators/*.json\". Repeatable",
+	}
+	validationLevelFlag = cli.StringFlag{
+		Name:  "validation-level",
+		Usage: "validationLevel to apply: \"strict\", \"moderate\" or \"off\". Default is that of the files, \"moderate\"",
+	}
+	validationActionFlag = cli.StringFlag{
+		Name:  "validation-action",
+		Usage: "validationAction to apply: \"error\" or \"warn\". Default is that of the files, \"warn\"",
+	}
+	dryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print the commands as mongosh statements instead of running them, without connecting",
+	}
+
+	applyValidatorsCommand = cli.Command{
+		Name: "apply-validators",
+		Usage: "Set the $jsonSchema validators written by -format mongo-validator on the collections of the " +
+			"-database with collMod",
+		Flags:  []cli.Flag{validatorsFlag, validationLevelFlag, validationActionFlag, dryRunFlag},
+		Action: applyValidators,
+	}
+)
+
+// readValidators reads the collMod commands of the files matching the
+// patterns, sorted by collection.
+func readValidators(patterns []string) ([]*collModCommand, error) {
+	var commands []*collModCommand
+	seen := make(map[string]string)
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no file matches %v", pattern)
+		}
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			command := new(collModCommand)
+			if err := json.Unmarshal(data, command); err != nil {
+				return nil, fmt.Errorf("%v: %v", path, err)
+			}
+			if command.CollMod == "" || command.Validator == nil {
+				return nil, fmt.Errorf("%v is not a collMod command setting a validator", path)
+			}
+			if other, ok := seen[command.CollMod]; ok {
+				if other == path {
+					continue
+				}
+				return nil, fmt.Errorf("%v and %v both hold the validator of %v", other, path, command.CollMod)
+			}
+			seen[command.CollMod] = path
+			commands = append(commands, command)
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].CollMod < commands[j].CollMod })
+	return commands, nil
+}
+
+func applyValidators(ctx *cli.Context) error {
+	patterns := ctx.StringSlice(validatorsFlag.Name)
+	if len(patterns) == 0 {
+		return cli.NewExitError(fmt.Sprintf("%s is mandatory!", validatorsFlag.Name), 1)
+	}
+	level, action := ctx.String(validationLevelFlag.Name), ctx.String(validationActionFlag.Name)
+	switch level {
+	case "", "strict", "moderate", "off":
+	default:
+		return cli.NewExitError(fmt.Sprintf("Unknown %s value %q", validationLevelFlag.Name, level), 1)
+	}
+	switch action {
+	case "", "error", "warn":
+	default:
+		return cli.NewExitError(fmt.Sprintf("Unknown %s value %q", validationActionFlag.Name, action), 1)
+	}
+	commands, err := readValidators(patterns)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	for _, command := range commands {
+		if level != "" {
+			command.ValidationLevel = level
+		}
+		if action != "" {
+			command.ValidationAction = action
+		}
+	}
+	if ctx.Bool(dryRunFlag.Name) {
+		for _, command := range commands {
+			data, err := json.MarshalIndent(command, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Printf("db.runCommand(%s)\n", data)
+		}
+		return nil
+	}
+	cmdInfo := &commandInfo{readOnly: ctx.GlobalBool(assertReadOnlyFlag.Name), applyValidators: true}
+	if err := checkReadOnly(cmdInfo); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	cmdInfo.urls = databaseURLs(ctx)
+	session, err := connect(cmdInfo)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer session.Close()
+	db := session.DB(cmdInfo.dbName)
+	failed := 0
+	for _, command := range commands {
+		err := db.Run(bson.D{
+			{Name: "collMod", Value: command.CollMod},
+			{Name: "validator", Value: command.Validator},
+			{Name: "validationLevel", Value: command.ValidationLevel},
+			{Name: "validationAction", Value: command.ValidationAction},
+		}, nil)
+		if err != nil {
+			fmt.Printf("%v.%v: FAILED: %v\n", cmdInfo.dbName, command.CollMod, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%v.%v: validator set, level %v, action %v\n", cmdInfo.dbName, command.CollMod,
+			command.ValidationLevel, command.ValidationAction)
+	}
+	if failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("%v of %v validators failed", failed, len(commands)), 1)
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package extractor
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emmansun/extract-mgo-schema/mgoschema"
+	cli "gopkg.in/urfave/cli.v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// ApprovalsAudit is the file of the approvals directory the approvals
+	// are appended to as JSON lines.
+	ApprovalsAudit = "audit.jsonl"
+	// ApprovalsLock is the file of the approvals directory held while an
+	// approval is published, by serve and approve alike.
+	ApprovalsLock = ".lock"
+	// ApprovalsLockTimeout bounds the wait for the lock of another approval.
+	ApprovalsLockTimeout = 10 * time.Second
+)
+
+var (
+	approvalsFlag = cli.StringFlag{
+		Name: "approvals",
+		Usage: "Directory of the published baselines, <database>.json, and of the audit trail of their approvals. " +
+			"Drift from the published baseline is pending until approved",
+	}
+	approverFlag = cli.StringFlag{
+		Name:  "approver",
+		Usage: "Name recorded as the approver; defaults to the current user",
+	}
+	commentFlag = cli.StringFlag{
+		Name:  "comment",
+		Usage: "Comment recorded with the approval",
+	}
+	approversFlag = cli.StringFlag{
+		Name: "approvers",
+		Usage: "YAML file mapping each approver to the SHA-256 hex digest of their token, mandatory with -approvals and -jobs. " +
+			"POST /api/approve/<database> and /api/extract/... must send \"Authorization: Bearer <token>\", and record the approver of the token",
+	}
+
+	approveCommand = cli.Command{
+		Name:      "approve",
+		Usage:     "Approve the drift of a run report, publishing its schema as the baseline of its database",
+		ArgsUsage: "report.json",
+		Flags:     []cli.Flag{approvalsFlag, approverFlag, commentFlag},
+		Action:    approve,
+	}
+
+	errNothingPending = errors.New("no pending changes to approve")
+	errStaleReport    = errors.New("the report is older than the last approved one")
+)
+
+// approval is an entry of the audit trail: who approved which changes of
+// which report, and when.
+type approval struct {
+	Database          string      `json:"database"`
+	Approver          string      `json:"approver"`
+	Comment           string      `json:"comment,omitempty"`
+	ApprovedAt        time.Time   `json:"approvedAt"`
+	ReportGeneratedAt time.Time   `json:"reportGeneratedAt"`
+	Diff              *schemaDiff `json:"diff"`
+}
+
+// publishedPath returns the path of the published baseline of a database,
+// refusing names that would escape the directory.
+func publishedPath(dir, database string) (string, error) {
+	if database == "" || strings.ContainsAny(database, `/\`) || strings.HasPrefix(database, ".") {
+		return "", fmt.Errorf("invalid database name %q", database)
+	}
+	return filepath.Join(dir, database+".json"), nil
+}
+
+// pendingChanges returns the drift of a schema from the published baseline
+// of its database, or nil when there is none. Without a published baseline
+// the whole schema is pending.
+func pendingChanges(dir, database string, schema map[string]docSchema) (*schemaDiff, error) {
+	path, err := publishedPath(dir, database)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := readSchemaFile(path)
+	if err != nil {
+		return nil, err
+	}
+	diff := diffSchema(path, baseline, schema)
+	if len(diff.AddedCollections) == 0 && len(diff.RemovedCollections) == 0 && len(diff.Collections) == 0 {
+		return nil, nil
+	}
+	return diff, nil
+}
+
+// loadApprovers reads the -approvers file, the token digests by approver.
+func loadApprovers(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	approvers := make(map[string]string)
+	if err := yaml.UnmarshalStrict(data, &approvers); err != nil {
+		return nil, err
+	}
+	for name, digest := range approvers {
+		if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("the token digest of %v is not a SHA-256 hex digest", name)
+		}
+		approvers[name] = strings.ToLower(digest)
+	}
+	return approvers, nil
+}
+
+// approverOf returns the approver whose token the request bears, or "".
+func (s *summaryServer) approverOf(r *http.Request) string {
+	const scheme = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, scheme) {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.TrimPrefix(header, scheme)))
+	digest := []byte(hex.EncodeToString(sum[:]))
+	found := ""
+	for name, want := range s.approvers {
+		if subtle.ConstantTimeCompare(digest, []byte(want)) == 1 {
+			found = name
+		}
+	}
+	return found
+}
+
+// lockApprovals takes the lock of the approvals directory, waiting for
+// another approval to finish, and returns its release.
+func lockApprovals(dir string) (func(), error) {
+	path := filepath.Join(dir, ApprovalsLock)
+	deadline := time.Now().Add(ApprovalsLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%v is held by another approval; remove it if none is running", path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// approveReport publishes the schema of a report as the baseline of its
+// database and appends the approval to the audit trail. A report older
+// than the last approved one is refused, so that it cannot replace a newer
+// baseline.
+func approveReport(dir string, report *runReport, approver, comment string) (*approval, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	unlock, err := lockApprovals(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	approvals, err := readApprovals(dir, report.Database)
+	if err != nil {
+		return nil, err
+	}
+	if len(approvals) > 0 && report.GeneratedAt.Before(approvals[0].ReportGeneratedAt) {
+		return nil, errStaleReport
+	}
+	diff, err := pendingChanges(dir, report.Database, report.Schema)
+	if err != nil {
+		return nil, err
+	}
+	if diff == nil {
+		return nil, errNothingPending
+	}
+	data, err := json.Marshal(schemaFile{
+		FormatVersion: mgoschema.FormatVersion,
+		Database:      report.Database,
+		Collections:   report.Schema,
+	})
+	if err != nil {
+		return nil, err
+	}
+	path, _ := publishedPath(dir, report.Database)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	entry := &approval{
+		Database:          report.Database,
+		Approver:          approver,
+		Comment:           comment,
+		ApprovedAt:        time.Now().UTC(),
+		ReportGeneratedAt: report.GeneratedAt,
+		Diff:              diff,
+	}
+	f, err := os.OpenFile(filepath.Join(dir, ApprovalsAudit), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// readApprovals returns the approvals of a database in the audit trail,
+// newest first.
+func readApprovals(dir, database string) ([]*approval, error) {
+	f, err := os.Open(filepath.Join(dir, ApprovalsAudit))
+	if os.IsNotExist(err) {
+		return []*approval{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	list := []*approval{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		entry := new(approval)
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("%v: %v", f.Name(), err)
+		}
+		if entry.Database == database {
+			list = append(list, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].ApprovedAt.After(list[j].ApprovedAt) })
+	return list, nil
+}
+
+// handlePending serves the drift of the newest report of a database from
+// its published baseline; the diff is absent when nothing is pending.
+func (s *summaryServer) handlePending(w http.ResponseWriter, r *http.Request) {
+	database := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/pending"), "/")
+	report, err := s.reportOf(database, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		http.NotFound(w, r)
+		return
+	}
+	diff, err := pendingChanges(s.approvals, database, report.Schema)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Database    string      `json:"database"`
+		GeneratedAt time.Time   `json:"generatedAt"`
+		Diff        *schemaDiff `json:"diff,omitempty"`
+	}{database, report.GeneratedAt, diff})
+}
+
+// handleApprove approves the drift of the newest report of a database on a
+// POST by an approver of -approvers, with an optional comment as form value.
+// When generatedAt is given, it must be that of the newest report, so that
+// changes are only approved as reviewed.
+func (s *summaryServer) handleApprove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "approvals must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	database := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/approve"), "/")
+	approver := s.approverOf(r)
+	if approver == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="approvals"`)
+		http.Error(w, "the token of an approver is mandatory", http.StatusUnauthorized)
+		return
+	}
+	s.approveLock.Lock()
+	defer s.approveLock.Unlock()
+	report, err := s.reportOf(database, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if at := r.FormValue("generatedAt"); at != "" {
+		want, err := time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !want.Equal(report.GeneratedAt) {
+			http.Error(w, fmt.Sprintf("the newest report was generated at %v", report.GeneratedAt.Format(time.RFC3339Nano)),
+				http.StatusConflict)
+			return
+		}
+	}
+	entry, err := approveReport(s.approvals, report, approver, r.FormValue("comment"))
+	switch {
+	case err == errNothingPending, err == errStaleReport:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, entry)
+}
+
+// handleApprovals serves the audit trail of a database, newest first.
+func (s *summaryServer) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	database := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/approvals"), "/")
+	list, err := readApprovals(s.approvals, database)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list)
+}
+
+// approve approves the drift of a report file from the command line.
+func approve(ctx *cli.Context) error {
+	dir := ctx.String(approvalsFlag.Name)
+	if dir == "" {
+		return cli.NewExitError(fmt.Sprintf("%s is mandatory!", approvalsFlag.Name), 1)
+	}
+	if ctx.NArg() != 1 {
+		return cli.NewExitError("approve needs a run report", 1)
+	}
+	approver := ctx.String(approverFlag.Name)
+	if approver == "" {
+		if u, err := user.Current(); err == nil {
+			approver = u.Username
+		}
+	}
+	if approver == "" {
+		return cli.NewExitError(fmt.Sprintf("%s is mandatory!", approverFlag.Name), 1)
+	}
+	data, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	report := new(runReport)
+	if err := json.Unmarshal(data, report); err != nil {
+		return cli.NewExitError(fmt.Sprintf("%v: %v", ctx.Args().First(), err), 1)
+	}
+	entry, err := approveReport(dir, report, approver, ctx.String(commentFlag.Name))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	fmt.Printf("Approved %v added, %v removed and %v changed collections of %v for %v\n",
+		len(entry.Diff.AddedCollections), len(entry.Diff.RemovedCollections), len(entry.Diff.Collections),
+		entry.Database, entry.Approver)
+	return nil
+}
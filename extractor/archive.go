@@ -0,0 +1,121 @@
+package extractor
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// LiveSource tags the fields sampled from -database when archives are
+// sampled too.
+const LiveSource = "live"
+
+var archiveFlag = cli.StringSliceFlag{
+	Name: "archive",
+	Usage: "Connection string of an archive database, as \"[name=]mongodb://...\", whose collections named as " +
+		"extracted ones are sampled too and merged into their schemas, so that fields only archived documents " +
+		"still have are kept. Fields list the sources they were seen in, \"live\" or the archive name, which " +
+		"defaults to the connection string without password. Can be repeated",
+}
+
+// archiveSource is an -archive database.
+type archiveSource struct {
+	name string
+	url  string
+}
+
+// parseArchive parses an -archive value. The options of a connection
+// string hold "=" too, so a name is only split off before its scheme.
+func parseArchive(value string) archiveSource {
+	if i := strings.Index(value, "="); i > 0 && !strings.Contains(value[:i], "://") {
+		return archiveSource{name: value[:i], url: value[i+1:]}
+	}
+	return archiveSource{name: maskPassword(value), url: value}
+}
+
+// collectionPattern matches the collection name exactly in -collections
+// filters.
+func collectionPattern(name string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(name)
+}
+
+// tagSource adds a source to the field.
+func (field *docField) tagSource(source string) {
+	if !containsString(field.Sources, source) {
+		field.Sources = append(field.Sources, source)
+	}
+}
+
+// sampleArchives samples the collections of schema in every -archive with
+// the options of the run and merges what they hold into schema and stats.
+// Collections only archived are left out: they are not the application's
+// any more.
+func sampleArchives(cmdInfo *commandInfo, schema map[string]docSchema, stats map[string]*collectionStats) error {
+	if len(cmdInfo.archives) == 0 || len(schema) == 0 {
+		return nil
+	}
+	for _, colSchema := range schema {
+		for i := range colSchema {
+			colSchema[i].tagSource(LiveSource)
+		}
+	}
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, collectionPattern(name))
+	}
+	for _, archive := range cmdInfo.archives {
+		archiveInfo := *cmdInfo
+		archiveInfo.urls = []string{archive.url}
+		archiveInfo.snapshotURL = ""
+		archiveInfo.collections = names
+		archiveInfo.excludeCollections = nil
+		reader := *cmdInfo.reader
+		archiveInfo.reader = &reader
+		session, err := connect(&archiveInfo)
+		if err != nil {
+			return fmt.Errorf("archive %v: %v", archive.name, err)
+		}
+		db := session.DB(archiveInfo.dbName)
+		if err := archiveInfo.reader.start(session, db); err != nil {
+			session.Close()
+			return fmt.Errorf("archive %v: %v", archive.name, err)
+		}
+		log.Printf("Sample archive %v\n", archive.name)
+		archived, archivedStats, err := getDbSchema(db, &archiveInfo)
+		session.Close()
+		if err != nil {
+			return fmt.Errorf("archive %v: %v", archive.name, err)
+		}
+		for name, colSchema := range archived {
+			if _, ok := schema[name]; !ok {
+				continue
+			}
+			schema[name] = mergeArchive(schema[name], colSchema, archive.name)
+			if s, total := archivedStats[name], stats[name]; s != nil && total != nil {
+				total.Documents += s.Documents
+				total.Sampled += s.Sampled
+				total.Excluded += s.Excluded
+				total.Fields = len(schema[name])
+			}
+		}
+	}
+	return nil
+}
+
+// mergeArchive merges the schema of an archived collection into the live
+// one, tagging the fields the archive holds with its name.
+func mergeArchive(colSchema, archived docSchema, source string) docSchema {
+	index := make(map[string]int, len(colSchema))
+	for i := range colSchema {
+		index[colSchema[i].Name] = i
+	}
+	merged := mergeShape(colSchema, index, archived)
+	for _, f := range archived {
+		merged[index[f.Name]].tagSource(source)
+	}
+	sort.Sort(merged)
+	return merged
+}
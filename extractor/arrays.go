@@ -0,0 +1,78 @@
+package extractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// recordElementTypes counts the sampled elements of an array by type, path
+// naming the elements.
+func (field *docField) recordElementTypes(path string, elements []interface{}) {
+	for i, v := range elements {
+		if i >= MaxTryRecords {
+			break
+		}
+		if v == nil {
+			continue
+		}
+		if field.ElementTypes == nil {
+			field.ElementTypes = make(map[string]int)
+		}
+		field.ElementTypes[valueType(path, v)]++
+	}
+}
+
+func (field *docField) mergeElementTypes(other *docField) {
+	for t, n := range other.ElementTypes {
+		if field.ElementTypes == nil {
+			field.ElementTypes = make(map[string]int)
+		}
+		field.ElementTypes[t] += n
+	}
+}
+
+// elementDistribution renders the share of each element type, most common
+// first, e.g. "95% DOCUMENT, 5% STRING".
+func elementDistribution(elementTypes map[string]int) string {
+	types := make([]string, 0, len(elementTypes))
+	total := 0
+	for t, n := range elementTypes {
+		types = append(types, t)
+		total += n
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if elementTypes[types[i]] != elementTypes[types[j]] {
+			return elementTypes[types[i]] > elementTypes[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = fmt.Sprintf("%.4g%% %v", float64(elementTypes[t])*100/float64(total), t)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// reportArrayHomogeneity marks the arrays with elements whether they hold a
+// single element type, the condition for mapping them to typed lists, and
+// reports the distribution of the mixed ones.
+func reportArrayHomogeneity(collection string, colSchema docSchema) {
+	for i := range colSchema {
+		f := &colSchema[i]
+		if len(f.ElementTypes) == 0 {
+			continue
+		}
+		homogeneous := len(f.ElementTypes) == 1
+		f.Homogeneous = &homogeneous
+		if homogeneous {
+			continue
+		}
+		addFinding(finding{
+			Collection: collection,
+			Field:      f.Name,
+			Kind:       "mixed-array",
+			Message:    fmt.Sprintf("%v.%v holds mixed elements: %v", collection, f.Name, elementDistribution(f.ElementTypes)),
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// AvroFormat writes an Avro schema (.avsc) per collection.
+const AvroFormat = "avro"
+
+var avroDecimalFlag = cli.StringFlag{
+	Name: "avro-decimal",
+	Usage: "Precision and scale, e.g. \"38,9\", of the Avro decimal logical type that DECIMAL fields map to " +
+		"with -format avro. Without it they are doubles",
+}
+
+// avroTypes are the Avro types of the base types, TIME as a timestamp and
+// ObjectIds as their hex strings.
+var avroTypes = map[string]interface{}{
+	"INTEGER":  "long",
+	"DECIMAL":  "double",
+	"STRING":   "string",
+	"BOOL":     "boolean",
+	"TIME":     map[string]interface{}{"type": "long", "logicalType": "timestamp-millis"},
+	"OBJECTID": "string",
+	"BINARY":   "bytes",
+}
+
+// avroDecimal is the precision and scale of the decimal logical type.
+type avroDecimal struct {
+	precision, scale int
+}
+
+func parseAvroDecimal(value string) (*avroDecimal, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("want precision,scale")
+	}
+	precision, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, err
+	}
+	scale, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, err
+	}
+	if precision < 1 || scale < 0 || scale > precision {
+		return nil, fmt.Errorf("want a precision of at least 1 and a scale between 0 and the precision")
+	}
+	return &avroDecimal{precision: precision, scale: scale}, nil
+}
+
+// avroWriter names the records of a schema, which must be unique within it.
+type avroWriter struct {
+	decimal *avroDecimal
+	names   map[string]bool
+}
+
+// avroType returns the Avro type of a node. Embedded documents with known
+// fields become records named after name, -dynamic documents maps, and
+// mixed types unions; integers mixed with decimals are decimals.
+func (w *avroWriter) avroType(name string, n *modelNode) interface{} {
+	types := n.Types
+	if n.Numeric {
+		types = []string{"DECIMAL"}
+	}
+	var union []interface{}
+	for _, t := range types {
+		var avroType interface{}
+		switch t {
+		case "DOCUMENT":
+			switch {
+			case n.Properties != nil:
+				avroType = w.record(name, n)
+			case n.Rest != nil:
+				avroType = map[string]interface{}{"type": "map", "values": w.avroType(name+"_value", n.Rest)}
+			default:
+				avroType = map[string]interface{}{"type": "map", "values": "string"}
+			}
+		case "ARRAY":
+			var items interface{} = "string"
+			if n.Items != nil {
+				items = w.avroType(name+"_item", n.Items)
+			}
+			avroType = map[string]interface{}{"type": "array", "items": items}
+		case "DECIMAL":
+			avroType = "double"
+			if w.decimal != nil {
+				avroType = map[string]interface{}{
+					"type":        "bytes",
+					"logicalType": "decimal",
+					"precision":   w.decimal.precision,
+					"scale":       w.decimal.scale,
+				}
+			}
+		default:
+			var ok bool
+			if avroType, ok = avroTypes[t]; !ok {
+				// Other types are written as strings of their relaxed JSON.
+				avroType = "string"
+			}
+		}
+		if !containsAvroType(union, avroType) {
+			union = append(union, avroType)
+		}
+	}
+	switch len(union) {
+	case 0:
+		return "null"
+	case 1:
+		return union[0]
+	}
+	return union
+}
+
+// containsAvroType reports whether a union holds a type of the same kind
+// already: Avro unions take one type of each kind, a logical type counting
+// as its underlying type, but any number of named records.
+func containsAvroType(union []interface{}, avroType interface{}) bool {
+	kind := func(t interface{}) interface{} {
+		if m, ok := t.(map[string]interface{}); ok {
+			return m["type"]
+		}
+		return t
+	}
+	if kind(avroType) == "record" {
+		return false
+	}
+	for _, t := range union {
+		if kind(t) == kind(avroType) {
+			return true
+		}
+	}
+	return false
+}
+
+// record returns the record of a document. Optional fields are unions with
+// null, defaulting to null; the summarized keys of a document mixing known
+// fields and -dynamic keys are left out.
+func (w *avroWriter) record(name string, n *modelNode) map[string]interface{} {
+	name = uniqueName(w.names, name)
+	taken := make(map[string]bool)
+	fields := make([]interface{}, 0, len(n.Properties))
+	for _, child := range n.Properties {
+		fieldName := uniqueName(taken, plainName(child.Name))
+		field := map[string]interface{}{"name": fieldName}
+		fieldType := w.avroType(name+"_"+fieldName, child)
+		if !child.Required && fieldType != "null" {
+			union, ok := fieldType.([]interface{})
+			if !ok {
+				union = []interface{}{fieldType}
+			}
+			fieldType = append([]interface{}{"null"}, union...)
+			field["default"] = nil
+		}
+		field["type"] = fieldType
+		if fieldName != child.Name {
+			field["doc"] = child.Name
+		}
+		fields = append(fields, field)
+	}
+	return map[string]interface{}{"type": "record", "name": name, "fields": fields}
+}
+
+// collectionAvroSchema returns the Avro schema of the documents of a
+// collection, a record in the namespace of the database.
+func collectionAvroSchema(database string, c *collectionModel, decimal *avroDecimal) map[string]interface{} {
+	w := &avroWriter{decimal: decimal, names: make(map[string]bool)}
+	schema := w.record(plainName(c.Name), c.Document)
+	schema["namespace"] = plainName(database)
+	return schema
+}
+
+// exportAvro writes the Avro schema of the only collection of m.
+func exportAvro(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	for _, c := range m.Collections {
+		data, err := json.MarshalIndent(collectionAvroSchema(m.Database, c, cmdInfo.avroDecimal), "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// BigQueryFormat writes the BigQuery table schema of each collection, as
+// read by bq mk --schema.
+const BigQueryFormat = "bigquery"
+
+// bigQueryTypes are the column types of the base types.
+var bigQueryTypes = map[string]string{
+	"INTEGER":  "INTEGER",
+	"DECIMAL":  "FLOAT",
+	"STRING":   "STRING",
+	"BOOL":     "BOOLEAN",
+	"TIME":     "TIMESTAMP",
+	"OBJECTID": "STRING",
+	"BINARY":   "BYTES",
+}
+
+// bigQueryField is a column of a BigQuery table schema.
+type bigQueryField struct {
+	Name        string           `json:"name"`
+	Type        string           `json:"type"`
+	Mode        string           `json:"mode"`
+	Description string           `json:"description,omitempty"`
+	Fields      []*bigQueryField `json:"fields,omitempty"`
+}
+
+// plainName turns a field name into one of ASCII letters, digits and
+// underscores not starting with a digit, as BigQuery columns and Avro names
+// take.
+func plainName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+// bigQueryFields returns the columns of the properties of a document.
+func bigQueryFields(n *modelNode) []*bigQueryField {
+	taken := make(map[string]bool)
+	fields := make([]*bigQueryField, 0, len(n.Properties))
+	for _, child := range n.Properties {
+		field := bigQueryColumn(child)
+		field.Name = uniqueName(taken, plainName(child.Name))
+		if field.Name != child.Name {
+			field.Description = child.Name
+		}
+		switch {
+		case field.Mode == "REPEATED":
+		case child.Required:
+			field.Mode = "REQUIRED"
+		default:
+			field.Mode = "NULLABLE"
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// bigQueryColumn returns the unnamed column of a node. Embedded documents
+// with known fields become RECORDs and arrays REPEATED columns of their
+// elements; what BigQuery cannot type, such as mixed types, -dynamic
+// documents and arrays of arrays, goes into JSON columns.
+func bigQueryColumn(n *modelNode) *bigQueryField {
+	types := n.Types
+	switch {
+	case n.Numeric:
+		return &bigQueryField{Type: "FLOAT"}
+	case len(types) != 1:
+		return &bigQueryField{Type: "JSON"}
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		if n.Properties == nil || n.Rest != nil {
+			return &bigQueryField{Type: "JSON"}
+		}
+		return &bigQueryField{Type: "RECORD", Fields: bigQueryFields(n)}
+	case "ARRAY":
+		if n.Items == nil {
+			return &bigQueryField{Type: "JSON"}
+		}
+		item := bigQueryColumn(n.Items)
+		if item.Mode == "REPEATED" {
+			return &bigQueryField{Type: "JSON"}
+		}
+		item.Mode = "REPEATED"
+		return item
+	}
+	if t, ok := bigQueryTypes[types[0]]; ok {
+		return &bigQueryField{Type: t}
+	}
+	return &bigQueryField{Type: "JSON"}
+}
+
+// exportBigQuery writes the BigQuery table schema of the only collection of
+// m.
+func exportBigQuery(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	for _, c := range m.Collections {
+		data, err := json.MarshalIndent(bigQueryFields(c.Document), "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	return nil
+}
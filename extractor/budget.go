@@ -0,0 +1,85 @@
+package extractor
+
+import (
+	"sync"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var perCollectionBudgetFlag = cli.DurationFlag{
+	Name: "per-collection-budget",
+	Usage: "Time a collection may spend on -deep and -dependencies profiling, e.g. 30s. Past it the rest of its " +
+		"sample only informs the structure, with a warning, keeping the run time predictable. 0 never stops",
+}
+
+// perCollectionBudget is set by -per-collection-budget.
+var perCollectionBudget time.Duration
+
+// profilingBudget stops the value profiling of a collection once its time
+// is up. It is shared by the scans of its partitions and safe for
+// concurrent use.
+type profilingBudget struct {
+	lock     sync.Mutex
+	deadline time.Time
+	profiled int // documents profiled
+	stopped  bool
+}
+
+var (
+	budgetsLock sync.Mutex
+	budgets     = make(map[string]*profilingBudget)
+)
+
+// startProfilingBudget starts the budget of a collection, nil without
+// -per-collection-budget or profiling to limit.
+func startProfilingBudget(collection string) *profilingBudget {
+	if perCollectionBudget <= 0 || valueProfiling == nil && !dependencyAnalysis {
+		return nil
+	}
+	b := &profilingBudget{deadline: time.Now().Add(perCollectionBudget)}
+	budgetsLock.Lock()
+	budgets[collection] = b
+	budgetsLock.Unlock()
+	return b
+}
+
+// profilingBudgetOf returns the running budget of a collection, if any.
+func profilingBudgetOf(collection string) *profilingBudget {
+	budgetsLock.Lock()
+	defer budgetsLock.Unlock()
+	return budgets[collection]
+}
+
+// allows tells whether the values of the next document may be profiled.
+func (b *profilingBudget) allows() bool {
+	if b == nil {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.stopped && time.Now().After(b.deadline) {
+		b.stopped = true
+	}
+	if b.stopped {
+		return false
+	}
+	b.profiled++
+	return true
+}
+
+// end removes the budget of a collection once sampled, noting a downgrade
+// in a warning, and tells whether the budget was exceeded.
+func (b *profilingBudget) end(collection string, sampled int) bool {
+	if b == nil {
+		return false
+	}
+	budgetsLock.Lock()
+	delete(budgets, collection)
+	budgetsLock.Unlock()
+	if b.stopped {
+		addWarning(collection, "", "value profiling exceeded the per-collection budget of %v and stopped after %v of %v "+
+			"sampled documents; the rest only informed the structure", perCollectionBudget, publishedCount(b.profiled), publishedCount(sampled))
+	}
+	return b.stopped
+}
@@ -0,0 +1,315 @@
+package extractor
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/emmansun/extract-mgo-schema/mgoschema"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// BundleVersion is the version of the bundle layout.
+	BundleVersion = 1
+	// BundleManifest is the entry describing the others, first in the
+	// archive.
+	BundleManifest = "manifest.json"
+)
+
+var (
+	bundleFlag = cli.StringFlag{
+		Name: "bundle",
+		Usage: "Also package the schema, report, data dictionary, diff and findings of the run into this tar.gz " +
+			"with a manifest of checksums, to archive one artifact per run. May use the -output template variables, " +
+			"e.g. \"bundles/{{.Database}}-{{.Timestamp}}.tar.gz\". An existing bundle is never overwritten",
+	}
+
+	bundleCommand = cli.Command{
+		Name:  "bundle",
+		Usage: "Inspect bundles written by -bundle",
+		Subcommands: []cli.Command{
+			{
+				Name:      "show",
+				Usage:     "Verify the checksums of a bundle and print its manifest, or print one of its entries",
+				ArgsUsage: "bundle.tar.gz [entry]",
+				Action:    showBundle,
+			},
+		},
+	}
+)
+
+// bundleEntry is a file of a bundle as listed by its manifest.
+type bundleEntry struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// bundleManifest describes a bundle: the run it was written by and its
+// entries.
+type bundleManifest struct {
+	BundleVersion       int            `json:"bundleVersion"`
+	FormatVersion       int            `json:"formatVersion"`
+	ReportSchemaVersion string         `json:"reportSchemaVersion"`
+	GeneratedAt         time.Time      `json:"generatedAt"`
+	Database            string         `json:"database"`
+	SampleStrategy      string         `json:"sampleStrategy"`
+	Collections         int            `json:"collections"`
+	Fields              int            `json:"fields"`
+	HealthScore         float64        `json:"healthScore"`
+	Findings            int            `json:"findings"`
+	Baseline            string         `json:"baseline,omitempty"`
+	Resources           *resourceUsage `json:"resources"`
+	Args                []string       `json:"args"`
+	Entries             []bundleEntry  `json:"entries"`
+}
+
+// bundleArgs returns the command line of the run with the passwords of
+// connection strings masked.
+func bundleArgs() []string {
+	args := make([]string, 0, len(os.Args)-1)
+	for _, arg := range os.Args[1:] {
+		args = append(args, maskPassword(arg))
+	}
+	return args
+}
+
+// bundleFiles returns the entries of the bundle of a run by name.
+func bundleFiles(cmdInfo *commandInfo, report *runReport) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	var err error
+	if files["schema.json"], err = json.Marshal(schemaFile{
+		FormatVersion: mgoschema.FormatVersion,
+		Database:      report.Database,
+		Collections:   report.Schema,
+	}); err != nil {
+		return nil, err
+	}
+	if files["report.json"], err = json.Marshal(report); err != nil {
+		return nil, err
+	}
+	if files["findings.json"], err = json.Marshal(report.Findings); err != nil {
+		return nil, err
+	}
+	if report.Diff != nil {
+		if files["diff.json"], err = json.Marshal(report.Diff); err != nil {
+			return nil, err
+		}
+	}
+	m := newSchemaModel(report.Database, report.Schema, report.Stats)
+	if files["dictionary.html"], err = htmlDictionary(m, cmdInfo.translator, cmdInfo.namespaces); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// exportBundle writes the bundle of the run to the -bundle path. The file
+// is created read-only and must not exist, so that a bundle once written
+// stays the record of its run.
+func exportBundle(cmdInfo *commandInfo, schema map[string]docSchema, stats map[string]*collectionStats, federationDiff *schemaDiff) error {
+	path, err := cmdInfo.bundle.expand(cmdInfo.dbName, "", "tar.gz")
+	if err != nil {
+		return err
+	}
+	report, err := newRunReport(cmdInfo, schema, stats, federationDiff)
+	if err != nil {
+		return err
+	}
+	files, err := bundleFiles(cmdInfo, report)
+	if err != nil {
+		return err
+	}
+	manifest := bundleManifest{
+		BundleVersion:       BundleVersion,
+		FormatVersion:       mgoschema.FormatVersion,
+		ReportSchemaVersion: ReportSchemaVersion,
+		GeneratedAt:         report.GeneratedAt,
+		Database:            report.Database,
+		SampleStrategy:      report.SampleStrategy,
+		Collections:         len(report.Schema),
+		HealthScore:         report.HealthScore,
+		Findings:            len(report.Findings),
+		Baseline:            cmdInfo.baseline,
+		Resources:           report.Resources,
+		Args:                bundleArgs(),
+	}
+	for _, fields := range report.Schema {
+		manifest.Fields += len(fields)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		manifest.Entries = append(manifest.Entries, bundleEntry{Name: name, Size: len(files[name]), SHA256: hex.EncodeToString(sum[:])})
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0444)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	write := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0444, Size: int64(len(data)), ModTime: report.GeneratedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := write(BundleManifest, manifestJSON); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := write(name, files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readBundle returns the manifest and entries of a bundle.
+func readBundle(path string) (*bundleManifest, map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	tr := tar.NewReader(zr)
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if files[header.Name], err = ioutil.ReadAll(tr); err != nil {
+			return nil, nil, err
+		}
+	}
+	data, ok := files[BundleManifest]
+	if !ok {
+		return nil, nil, fmt.Errorf("%v has no %v", path, BundleManifest)
+	}
+	manifest := new(bundleManifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, nil, fmt.Errorf("%v: %v", BundleManifest, err)
+	}
+	if manifest.BundleVersion > BundleVersion {
+		return nil, nil, fmt.Errorf("bundle version %v is newer than %v, the latest this build reads", manifest.BundleVersion, BundleVersion)
+	}
+	delete(files, BundleManifest)
+	return manifest, files, nil
+}
+
+// verify returns the problems of the entries of a bundle: missing, altered
+// or not in the manifest.
+func (manifest *bundleManifest) verify(files map[string][]byte) []string {
+	var problems []string
+	listed := make(map[string]bool)
+	for _, e := range manifest.Entries {
+		listed[e.Name] = true
+		data, ok := files[e.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%v is missing", e.Name))
+			continue
+		}
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != e.SHA256 {
+			problems = append(problems, fmt.Sprintf("%v does not match its checksum", e.Name))
+		}
+	}
+	for name := range files {
+		if !listed[name] {
+			problems = append(problems, fmt.Sprintf("%v is not in the manifest", name))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func showBundle(ctx *cli.Context) error {
+	path := ctx.Args().First()
+	if path == "" {
+		return cli.NewExitError("bundle show requires the path of a bundle", 1)
+	}
+	manifest, files, err := readBundle(path)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	problems := manifest.verify(files)
+	if name := ctx.Args().Get(1); name != "" {
+		data, ok := files[name]
+		if !ok {
+			return cli.NewExitError(fmt.Sprintf("%v has no entry %q", path, name), 1)
+		}
+		if len(problems) > 0 {
+			return cli.NewExitError(fmt.Sprintf("%v failed verification: %v", path, problems[0]), 1)
+		}
+		_, err := io.Copy(os.Stdout, bytes.NewReader(data))
+		return err
+	}
+	fmt.Printf("Database:       %v\n", manifest.Database)
+	fmt.Printf("Generated at:   %v\n", manifest.GeneratedAt.Format(time.RFC3339))
+	fmt.Printf("Strategy:       %v\n", manifest.SampleStrategy)
+	fmt.Printf("Collections:    %v\n", manifest.Collections)
+	fmt.Printf("Fields:         %v\n", manifest.Fields)
+	fmt.Printf("Health score:   %.1f\n", manifest.HealthScore)
+	fmt.Printf("Findings:       %v\n", manifest.Findings)
+	if manifest.Baseline != "" {
+		fmt.Printf("Baseline:       %v\n", manifest.Baseline)
+	}
+	fmt.Printf("Arguments:      %v\n", manifest.Args)
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTRY\tSIZE\tSHA256")
+	for _, e := range manifest.Entries {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", e.Name, e.Size, e.SHA256)
+	}
+	w.Flush()
+	fmt.Println()
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Printf("FAILED: %v\n", p)
+		}
+		return cli.NewExitError(fmt.Sprintf("%v failed verification", path), 1)
+	}
+	fmt.Println("All checksums verified.")
+	return nil
+}
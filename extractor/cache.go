@@ -0,0 +1,196 @@
+package extractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/emmansun/extract-mgo-schema/mgoschema"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	cacheTTLFlag = cli.DurationFlag{
+		Name: "cache-ttl",
+		Usage: "Reuse the schema extracted by a previous run with the same connection string, database and sampling " +
+			"flags for this long, e.g. \"30m\", unless the server has been written to since. Off by default",
+	}
+	cacheDirFlag = cli.StringFlag{
+		Name:  "cache-dir",
+		Usage: "Directory of the -cache-ttl cache. Default is extract_mgo in the user cache directory",
+	}
+	noCacheFlag = cli.BoolFlag{
+		Name:  "no-cache",
+		Usage: "Extract the schema again even when -cache-ttl holds a fresh one, and cache it",
+	}
+)
+
+// cacheKeyFlags are the flags changing what is sampled and how, which key
+// the cache together with the config.
+var cacheKeyFlags = []cli.Flag{
+	collectionsFlag, excludeCollectionsFlag, sampleStrategyFlag, timeFieldFlag, timeWindowFlag, scanPartitionsFlag,
+	excludeIDsFlag, maxFieldsFlag, fieldOverflowFlag, checkIndexesFlag, indexStatsFlag, deepFlag, memoryLimitFlag,
+	dynamicFlag, dynamicKeyLimitFlag, dependenciesFlag, rawTypesFlag, provenanceFlag, perCollectionBudgetFlag,
+	readConcernFlag, presetFlag, onlyTagFlag, ownerFlag, anonymizeFlag, tenantFieldFlag,
+}
+
+// schemaCache keeps the schemas extracted from servers on disk, keyed by
+// connection string, database, sampling flags and the last write of the
+// server.
+type schemaCache struct {
+	dir     string
+	ttl     time.Duration
+	refresh bool // set by -no-cache
+	// sampling describes the sampling flags and config of the run.
+	sampling string
+	// opTime is the last write of the server before sampling, and file the
+	// entry of the run; both are set by load.
+	opTime string
+	file   string
+}
+
+// cacheEntry is a cached extraction: the schema and stats with the warnings
+// and findings met while sampling.
+type cacheEntry struct {
+	FormatVersion int                         `json:"formatVersion"`
+	ExtractedAt   time.Time                   `json:"extractedAt"`
+	Database      string                      `json:"database"`
+	OpTime        string                      `json:"opTime,omitempty"`
+	Schema        map[string]docSchema        `json:"schema"`
+	Stats         map[string]*collectionStats `json:"stats"`
+	Warnings      []warning                   `json:"warnings"`
+	Findings      []finding                   `json:"findings"`
+}
+
+// newSchemaCache returns the cache of the run, nil without -cache-ttl.
+func newSchemaCache(ctx *cli.Context) (*schemaCache, error) {
+	ttl := ctx.GlobalDuration(cacheTTLFlag.Name)
+	if ttl <= 0 {
+		return nil, nil
+	}
+	dir := ctx.GlobalString(cacheDirFlag.Name)
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(userDir, "extract_mgo")
+	}
+	hash := sha256.New()
+	for _, flag := range cacheKeyFlags {
+		name := flag.GetName()
+		fmt.Fprintf(hash, "%v=%v\n", name, ctx.GlobalGeneric(name))
+	}
+	if path := ctx.GlobalString(configFlag.Name); path != "" {
+		// The config tags and anonymizes fields.
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		hash.Write(data)
+	}
+	return &schemaCache{
+		dir:      dir,
+		ttl:      ttl,
+		refresh:  ctx.GlobalBool(noCacheFlag.Name),
+		sampling: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// lastWrite returns the optime of the last write of a replica set member,
+// "" when the server does not tell, as standalone servers and mongos.
+func lastWrite(session *mgo.Session) string {
+	var result struct {
+		LastWrite struct {
+			OpTime struct {
+				TS bson.MongoTimestamp `bson:"ts"`
+				T  int64               `bson:"t"`
+			} `bson:"opTime"`
+		} `bson:"lastWrite"`
+	}
+	if err := session.Run("isMaster", &result); err != nil || result.LastWrite.OpTime.TS == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%v/%v", result.LastWrite.OpTime.T, int64(result.LastWrite.OpTime.TS))
+}
+
+// path returns the file of the entry of the run. Connection strings are
+// hashed so that their passwords are not written.
+func (c *schemaCache) path(cmdInfo *commandInfo) string {
+	key := sha256.Sum256([]byte(fmt.Sprintf("%v\n%v\n%v\n%v\n%v",
+		mgoschema.FormatVersion, cmdInfo.url, cmdInfo.dbName, c.sampling, c.opTime)))
+	return filepath.Join(c.dir, hex.EncodeToString(key[:])+".json")
+}
+
+// load returns the cached extraction of the run, nil when there is none
+// younger than the TTL or with -no-cache. The warnings and findings of the
+// cached run are added to those of this one.
+func (c *schemaCache) load(session *mgo.Session, cmdInfo *commandInfo) *cacheEntry {
+	if c == nil {
+		return nil
+	}
+	c.opTime = lastWrite(session)
+	c.file = c.path(cmdInfo)
+	if c.refresh {
+		return nil
+	}
+	data, err := ioutil.ReadFile(c.file)
+	if err != nil {
+		return nil
+	}
+	entry := new(cacheEntry)
+	if err := json.Unmarshal(data, entry); err != nil || entry.FormatVersion != mgoschema.FormatVersion {
+		return nil
+	}
+	if time.Since(entry.ExtractedAt) > c.ttl {
+		return nil
+	}
+	log.Printf("Reusing the schema extracted at %v from the cache\n", entry.ExtractedAt.Format(time.RFC3339))
+	findingsLock.Lock()
+	warnings = append(warnings, entry.Warnings...)
+	findings = append(findings, entry.Findings...)
+	findingsLock.Unlock()
+	return entry
+}
+
+// store caches the extraction of the run, keyed by the last write before
+// it. A run must not fail for its cache, so errors are only logged. Entries
+// may hold sampled values, so only their owner may read them.
+func (c *schemaCache) store(cmdInfo *commandInfo, schema map[string]docSchema, stats map[string]*collectionStats) {
+	if c == nil {
+		return
+	}
+	entry := cacheEntry{
+		FormatVersion: mgoschema.FormatVersion,
+		ExtractedAt:   time.Now().UTC(),
+		Database:      cmdInfo.dbName,
+		OpTime:        c.opTime,
+		Schema:        schema,
+		Stats:         stats,
+	}
+	findingsLock.Lock()
+	entry.Warnings = append([]warning{}, warnings...)
+	entry.Findings = append([]finding{}, findings...)
+	findingsLock.Unlock()
+	data, err := json.Marshal(&entry)
+	if err == nil {
+		err = os.MkdirAll(c.dir, 0700)
+	}
+	if err == nil {
+		tmp := c.file + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, c.file)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to cache the schema: %v\n", err)
+	}
+}
@@ -0,0 +1,413 @@
+package extractor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Catalog kinds of the -catalog targets.
+const (
+	OpenLineageCatalog = "openlineage"
+	DataHubCatalog     = "datahub"
+	AmundsenCatalog    = "amundsen"
+)
+
+const (
+	// CatalogTimeout bounds each request to a catalog.
+	CatalogTimeout = 30 * time.Second
+	// DataHubEnv is the fabric of the DataHub dataset URNs.
+	DataHubEnv = "PROD"
+	// Producer identifies the tool in OpenLineage events.
+	Producer = "https://github.com/emmansun/extract-mgo-schema"
+)
+
+var (
+	catalogFlag = cli.StringSliceFlag{
+		Name: "catalog",
+		Usage: "Publish the schema to a metadata catalog: \"openlineage=<lineage endpoint URL>\", " +
+			"\"datahub=<GMS URL>\" or \"amundsen=<directory>\" for databuilder CSV files. Repeatable",
+	}
+	catalogTokenFlag = cli.StringFlag{
+		Name:   "catalog-token",
+		Usage:  "Bearer token sent to -catalog endpoints",
+		EnvVar: "CATALOG_TOKEN",
+	}
+)
+
+// catalogTarget is a parsed -catalog value.
+type catalogTarget struct {
+	kind     string
+	location string
+}
+
+func parseCatalogTargets(values []string) ([]catalogTarget, error) {
+	var targets []catalogTarget
+	for _, v := range values {
+		i := strings.Index(v, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("%q is not kind=location", v)
+		}
+		t := catalogTarget{kind: v[:i], location: v[i+1:]}
+		switch t.kind {
+		case OpenLineageCatalog, DataHubCatalog, AmundsenCatalog:
+		default:
+			return nil, fmt.Errorf("unknown catalog %q", t.kind)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// catalogDataset is a collection as described to catalogs.
+type catalogDataset struct {
+	Collection  string
+	Description string
+	Owner       string
+	Domain      string
+	Fields      []catalogField
+	// TTL lists the TTL indexes expiring the documents.
+	TTL []ttlIndex
+}
+
+type catalogField struct {
+	Name        string
+	Types       []string
+	Description string
+	Nullable    bool
+	// Tags are the anonymization tags of the config, e.g. "pii".
+	Tags []string
+}
+
+// catalogDatasets describes the collections of the schema, with texts in the
+// -lang language.
+func catalogDatasets(cmdInfo *commandInfo, schema map[string]docSchema, stats map[string]*collectionStats) []catalogDataset {
+	t := cmdInfo.translator
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	datasets := make([]catalogDataset, 0, len(names))
+	for _, name := range names {
+		s := stats[name]
+		if s == nil {
+			s = &collectionStats{}
+		}
+		d := catalogDataset{
+			Collection:  name,
+			Description: t.text("datasetSummary", len(schema[name]), s.Sampled, s.Documents),
+			Owner:       s.Owner,
+			Domain:      s.Domain,
+			TTL:         s.TTL,
+		}
+		for _, ttl := range s.TTL {
+			d.Description += "; " + ttl.expiry(t)
+		}
+		for _, f := range schema[name] {
+			var descriptions []string
+			for _, typeName := range f.fieldTypes() {
+				descriptions = append(descriptions, t.typeDescription(typeName))
+			}
+			description := strings.Join(descriptions, " / ")
+			if s.Sampled > 0 {
+				description += ", " + t.text("presentIn", f.Count*100/s.Sampled)
+			}
+			field := catalogField{
+				Name:        f.Name,
+				Types:       f.fieldTypes(),
+				Description: description,
+				Nullable:    f.Count < s.Sampled,
+			}
+			if tag := valueAnonymizer.tag(name, f.Name); tag != "" {
+				field.Tags = []string{tag}
+			}
+			if ttl := ttlOf(s, f.Name); ttl != nil {
+				field.Description += ", " + ttl.expiry(t)
+				field.Tags = append(field.Tags, "ttl")
+			}
+			d.Fields = append(d.Fields, field)
+		}
+		datasets = append(datasets, d)
+	}
+	return datasets
+}
+
+// publishCatalogs sends the schema to every -catalog target.
+func publishCatalogs(cmdInfo *commandInfo, schema map[string]docSchema, stats map[string]*collectionStats) error {
+	dialInfo, err := mgo.ParseURL(cmdInfo.url)
+	if err != nil {
+		return err
+	}
+	host := dialInfo.Addrs[0]
+	if !strings.Contains(host, ":") {
+		host += ":27017"
+	}
+	datasets := catalogDatasets(cmdInfo, schema, stats)
+	client := &catalogClient{http: &http.Client{Timeout: CatalogTimeout}, token: cmdInfo.catalogToken}
+	for _, target := range cmdInfo.catalogs {
+		switch target.kind {
+		case OpenLineageCatalog:
+			err = client.post(target.location, openLineageEvent(host, cmdInfo.dbName, datasets))
+		case DataHubCatalog:
+			err = client.publishDataHub(target.location, cmdInfo.dbName, datasets)
+		case AmundsenCatalog:
+			err = writeAmundsenCSV(target.location, host, cmdInfo.dbName, datasets)
+		}
+		if err != nil {
+			return fmt.Errorf("%v catalog: %v", target.kind, err)
+		}
+	}
+	return nil
+}
+
+type catalogClient struct {
+	http  *http.Client
+	token string
+}
+
+// post sends body as JSON and fails on any status but 2xx.
+func (c *catalogClient) post(url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%v: %v %s", url, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func newRunID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// openLineageEvent returns a COMPLETE run event of the extraction job with
+// the collections as input datasets carrying schema, documentation,
+// ownership and tags facets.
+func openLineageEvent(host, database string, datasets []catalogDataset) map[string]interface{} {
+	facet := func(name string, fields map[string]interface{}) map[string]interface{} {
+		fields["_producer"] = Producer
+		fields["_schemaURL"] = "https://openlineage.io/spec/facets/1-0-0/" + name + ".json"
+		return fields
+	}
+	inputs := make([]map[string]interface{}, 0, len(datasets))
+	for _, d := range datasets {
+		fields := make([]map[string]interface{}, 0, len(d.Fields))
+		var tags []map[string]interface{}
+		for _, f := range d.Fields {
+			fields = append(fields, map[string]interface{}{
+				"name":        f.Name,
+				"type":        strings.Join(f.Types, "|"),
+				"description": f.Description,
+			})
+			for _, tag := range f.Tags {
+				tags = append(tags, map[string]interface{}{"key": tag, "value": "true", "source": "extract_mgo", "field": f.Name})
+			}
+		}
+		facets := map[string]interface{}{
+			"schema":        facet("SchemaDatasetFacet", map[string]interface{}{"fields": fields}),
+			"documentation": facet("DocumentationDatasetFacet", map[string]interface{}{"description": d.Description}),
+		}
+		if d.Owner != "" {
+			facets["ownership"] = facet("OwnershipDatasetFacet", map[string]interface{}{
+				"owners": []map[string]interface{}{{"name": "team:" + d.Owner, "type": "TECHNICAL_OWNER"}},
+			})
+		}
+		if d.Domain != "" {
+			tags = append(tags, map[string]interface{}{"key": "domain", "value": d.Domain, "source": "extract_mgo"})
+		}
+		if len(tags) > 0 {
+			facets["tags"] = facet("TagsDatasetFacet", map[string]interface{}{"tags": tags})
+		}
+		inputs = append(inputs, map[string]interface{}{
+			"namespace": "mongodb://" + host,
+			"name":      database + "." + d.Collection,
+			"facets":    facets,
+		})
+	}
+	return map[string]interface{}{
+		"eventType": "COMPLETE",
+		"eventTime": time.Now().UTC().Format(time.RFC3339Nano),
+		"run":       map[string]interface{}{"runId": newRunID()},
+		"job":       map[string]interface{}{"namespace": "extract_mgo", "name": "extract-schema." + database},
+		"inputs":    inputs,
+		"outputs":   []interface{}{},
+		"producer":  Producer,
+		"schemaURL": "https://openlineage.io/spec/2-0-2/OpenLineage.json#/$defs/RunEvent",
+	}
+}
+
+// dataHubTypes are the DataHub schema field types of the base types.
+var dataHubTypes = map[string]string{
+	"OBJECTID": "StringType",
+	"STRING":   "StringType",
+	"INTEGER":  "NumberType",
+	"DECIMAL":  "NumberType",
+	"BOOL":     "BooleanType",
+	"TIME":     "DateType",
+	"BINARY":   "BytesType",
+	"ARRAY":    "ArrayType",
+	"DOCUMENT": "RecordType",
+}
+
+func dataHubType(types []string) string {
+	if len(types) == 1 {
+		if t, ok := dataHubTypes[baseType(types[0])]; ok {
+			return t
+		}
+	}
+	return "UnionType"
+}
+
+type dataHubAspect struct {
+	name  string
+	value interface{}
+}
+
+// publishDataHub upserts the schemaMetadata, datasetProperties, ownership
+// and domain aspects of every collection through the GMS REST API.
+func (c *catalogClient) publishDataHub(gms, database string, datasets []catalogDataset) error {
+	url := strings.TrimSuffix(gms, "/") + "/aspects?action=ingestProposal"
+	for _, d := range datasets {
+		urn := fmt.Sprintf("urn:li:dataset:(urn:li:dataPlatform:mongodb,%v.%v,%v)", database, d.Collection, DataHubEnv)
+		fields := make([]map[string]interface{}, 0, len(d.Fields))
+		for _, f := range d.Fields {
+			field := map[string]interface{}{
+				"fieldPath":      f.Name,
+				"nativeDataType": strings.Join(f.Types, "|"),
+				"type":           map[string]interface{}{"type": map[string]interface{}{"com.linkedin.schema." + dataHubType(f.Types): map[string]interface{}{}}},
+				"description":    f.Description,
+				"nullable":       f.Nullable,
+			}
+			if len(f.Tags) > 0 {
+				var tags []map[string]string
+				for _, tag := range f.Tags {
+					tags = append(tags, map[string]string{"tag": "urn:li:tag:" + tag})
+				}
+				field["globalTags"] = map[string]interface{}{"tags": tags}
+			}
+			fields = append(fields, field)
+		}
+		properties := map[string]string{"database": database}
+		for _, ttl := range d.TTL {
+			properties["ttl."+ttl.Field] = fmt.Sprint(ttl.ExpireAfterSeconds)
+		}
+		aspects := []dataHubAspect{
+			{"schemaMetadata", map[string]interface{}{
+				"schemaName":     d.Collection,
+				"platform":       "urn:li:dataPlatform:mongodb",
+				"version":        0,
+				"hash":           "",
+				"platformSchema": map[string]interface{}{"com.linkedin.schema.Schemaless": map[string]interface{}{}},
+				"fields":         fields,
+			}},
+			{"datasetProperties", map[string]interface{}{
+				"name":             d.Collection,
+				"description":      d.Description,
+				"customProperties": properties,
+			}},
+		}
+		if d.Owner != "" {
+			aspects = append(aspects, dataHubAspect{"ownership", map[string]interface{}{
+				"owners": []map[string]string{{"owner": "urn:li:corpGroup:" + d.Owner, "type": "TECHNICAL_OWNER"}},
+			}})
+		}
+		if d.Domain != "" {
+			aspects = append(aspects, dataHubAspect{"domains", map[string]interface{}{"domains": []string{"urn:li:domain:" + d.Domain}}})
+		}
+		for _, aspect := range aspects {
+			value, err := json.Marshal(aspect.value)
+			if err != nil {
+				return err
+			}
+			err = c.post(url, map[string]interface{}{
+				"proposal": map[string]interface{}{
+					"entityType": "dataset",
+					"entityUrn":  urn,
+					"changeType": "UPSERT",
+					"aspectName": aspect.name,
+					"aspect":     map[string]string{"value": string(value), "contentType": "application/json"},
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeAmundsenCSV writes <database>.tables.csv and <database>.columns.csv
+// in dir, the input of the Amundsen databuilder CSV table column extractor.
+func writeAmundsenCSV(dir, host, database string, datasets []catalogDataset) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	cluster := strings.Split(host, ":")[0]
+	tables := [][]string{{"database", "cluster", "schema", "name", "description", "tags", "is_view", "description_source"}}
+	columns := [][]string{{"name", "description", "col_type", "sort_order", "database", "cluster", "schema", "table_name"}}
+	for _, d := range datasets {
+		var tags []string
+		if d.Domain != "" {
+			tags = append(tags, d.Domain)
+		}
+		if d.Owner != "" {
+			tags = append(tags, d.Owner)
+		}
+		if len(d.TTL) > 0 {
+			tags = append(tags, "ttl")
+		}
+		tables = append(tables, []string{"mongodb", cluster, database, d.Collection, d.Description, strings.Join(tags, ","), "false", ""})
+		for i, f := range d.Fields {
+			columns = append(columns, []string{f.Name, f.Description, strings.Join(f.Types, "|"), fmt.Sprint(i), "mongodb", cluster, database, d.Collection})
+		}
+	}
+	for name, rows := range map[string][][]string{"tables": tables, "columns": columns} {
+		f, err := os.Create(filepath.Join(dir, database+"."+name+".csv"))
+		if err != nil {
+			return err
+		}
+		w := csv.NewWriter(f)
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package extractor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// ChangeStreamWait is how long a getMore waits for more changes before the
+// collection counts as caught up.
+const ChangeStreamWait = 1000 // milliseconds
+
+var sinceTokenFlag = cli.StringFlag{
+	Name: "since-token",
+	Usage: "Infer the schema of the documents inserted, updated or replaced since the change stream positions saved " +
+		"in this file, instead of sampling, and save the new positions after a successful run so the next one continues " +
+		"from there. Collections without a saved position are sampled as usual and tracked from then on",
+}
+
+// changePositions are the change stream positions of the collections, kept
+// as the $changeStream options starting a stream there: resumeAfter a
+// resume token, or startAtOperationTime for collections first sampled.
+type changePositions struct {
+	path      string
+	mu        sync.Mutex
+	positions map[string]bson.M
+}
+
+func loadChangePositions(path string) (*changePositions, error) {
+	p := &changePositions{path: path, positions: make(map[string]bson.M)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := bson.UnmarshalJSON(data, &p.positions); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return p, nil
+}
+
+func (p *changePositions) get(collection string) bson.M {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.positions[collection]
+}
+
+func (p *changePositions) set(collection string, position bson.M) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.positions[collection] = position
+}
+
+// save writes the positions as extended JSON.
+func (p *changePositions) save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, err := bson.MarshalJSON(p.positions)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.path, data, 0644)
+}
+
+// operationTime returns the cluster time of the latest operation on the
+// deployment, which only replica sets and sharded clusters report.
+func operationTime(db *mgo.Database) (bson.MongoTimestamp, error) {
+	var result struct {
+		OperationTime bson.MongoTimestamp `bson:"operationTime"`
+	}
+	if err := db.Run(bson.D{{Name: "ping", Value: 1}}, &result); err != nil {
+		return 0, err
+	}
+	if result.OperationTime == 0 {
+		return 0, fmt.Errorf("change streams need a replica set or sharded cluster")
+	}
+	return result.OperationTime, nil
+}
+
+type changeBatch struct {
+	Cursor struct {
+		ID                   int64      `bson:"id"`
+		FirstBatch           []bson.Raw `bson:"firstBatch"`
+		NextBatch            []bson.Raw `bson:"nextBatch"`
+		PostBatchResumeToken bson.M     `bson:"postBatchResumeToken"`
+	} `bson:"cursor"`
+}
+
+type changeEvent struct {
+	ID           bson.M `bson:"_id"`
+	FullDocument bson.D `bson:"fullDocument"`
+}
+
+// changeQuery returns the aggregation reading the inserted, updated and
+// replaced documents since position.
+func changeQuery(position bson.M) sampleQuery {
+	stage := bson.M{"fullDocument": "updateLookup"}
+	for k, v := range position {
+		stage[k] = v
+	}
+	return sampleQuery{Pipeline: []bson.M{
+		{"$changeStream": stage},
+		{"$match": bson.M{"operationType": bson.M{"$in": []string{"insert", "update", "replace"}}}},
+	}}
+}
+
+// readChanges passes the current version of every document changed since
+// position to handle and returns the position after the last change, or
+// position itself when nothing changed.
+func readChanges(c *mgo.Collection, position bson.M, handle func(doc bson.D)) (bson.M, error) {
+	var batch changeBatch
+	err := c.Database.Run(changeQuery(position).command(c.Name), &batch)
+	if err != nil {
+		return nil, err
+	}
+	id := batch.Cursor.ID
+	defer c.Database.Run(bson.D{{Name: "killCursors", Value: c.Name}, {Name: "cursors", Value: []int64{id}}}, nil)
+	events := batch.Cursor.FirstBatch
+	// The first batch returns right away, the getMore batches once changes
+	// come in or after waiting; an empty one means caught up.
+	for first := true; ; first = false {
+		for _, raw := range events {
+			var e changeEvent
+			if err := raw.Unmarshal(&e); err != nil {
+				return nil, err
+			}
+			position = bson.M{"resumeAfter": e.ID}
+			// Updated documents deleted since have no current version.
+			if e.FullDocument != nil {
+				handle(e.FullDocument)
+			}
+		}
+		if batch.Cursor.PostBatchResumeToken != nil {
+			position = bson.M{"resumeAfter": batch.Cursor.PostBatchResumeToken}
+		}
+		if id == 0 || (!first && len(events) == 0) {
+			return position, nil
+		}
+		batch = changeBatch{}
+		err := c.Database.Run(bson.D{
+			{Name: "getMore", Value: id},
+			{Name: "collection", Value: c.Name},
+			{Name: "maxTimeMS", Value: ChangeStreamWait},
+		}, &batch)
+		if err != nil {
+			return nil, err
+		}
+		events = batch.Cursor.NextBatch
+	}
+}
+
+// startTracking saves the current time as the position of a collection
+// about to be sampled.
+func startTracking(c *mgo.Collection, positions *changePositions) error {
+	now, err := operationTime(c.Database)
+	if err != nil {
+		return err
+	}
+	positions.set(c.Name, bson.M{"startAtOperationTime": now})
+	return nil
+}
+
+// scanChanges returns the schema of the documents changed since the saved
+// position of c, with their number, and moves the position past them.
+func scanChanges(c *mgo.Collection, positions *changePositions) (docSchema, int, error) {
+	fieldSet := newFieldSet(c.Name)
+	colSchema := docSchema{}
+	sampled := 0
+	position, err := readChanges(c, positions.get(c.Name), func(doc bson.D) {
+		sampled++
+		fieldSet.nextDocument(doc)
+		getStructureSchema("", doc, &colSchema, fieldSet)
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("change stream of %v: %v", c.Name, err)
+	}
+	positions.set(c.Name, position)
+	log.Printf("Read %d changed documents of %v\n", sampled, c.Name)
+	return colSchema, sampled, nil
+}
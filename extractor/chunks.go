@@ -0,0 +1,222 @@
+package extractor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	FieldOverflowChunk = "chunk"
+	FieldOverflowTail  = "tail"
+)
+
+var (
+	maxFieldsFlag = cli.IntFlag{
+		Name:  "max-fields",
+		Usage: "Limit the fields written per collection and output file, e.g. for spreadsheet tools with row limits. 0 for no limit",
+	}
+	fieldOverflowFlag = cli.StringFlag{
+		Name: "field-overflow",
+		Usage: "What to do with collections over -max-fields: \"chunk\" them into files suffixed .part2, .part3 and " +
+			"so on, or keep the fields found in most documents and summarize the rest in a .long-tail file (\"tail\")",
+		Value: FieldOverflowChunk,
+	}
+)
+
+// longTailGroup summarizes the fields left out of the output under one top
+// level field.
+type longTailGroup struct {
+	Prefix   string   `json:"prefix"`
+	Fields   int      `json:"fields"`
+	MaxCount int      `json:"maxCount"`
+	Types    []string `json:"types"`
+}
+
+// withSuffix inserts suffix before the extension of path.
+func withSuffix(path, suffix string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + suffix + ext
+}
+
+// chunkFiles moves the fields of oversized collections past the first max
+// into files of their own: the second chunk of every collection goes to
+// the .part2 file, and so on.
+func chunkFiles(files map[string]map[string]docSchema, max int) map[string]map[string]docSchema {
+	chunked := make(map[string]map[string]docSchema)
+	add := func(path, name string, colSchema docSchema) {
+		if chunked[path] == nil {
+			chunked[path] = make(map[string]docSchema)
+		}
+		chunked[path][name] = colSchema
+	}
+	for path, fileSchema := range files {
+		for name, colSchema := range fileSchema {
+			if len(colSchema) <= max {
+				add(path, name, colSchema)
+				continue
+			}
+			log.Printf("Split the %d fields of %v into chunks of %d\n", len(colSchema), name, max)
+			for part := 0; part*max < len(colSchema); part++ {
+				end := (part + 1) * max
+				if end > len(colSchema) {
+					end = len(colSchema)
+				}
+				partPath := path
+				if part > 0 {
+					partPath = withSuffix(path, "part"+strconv.Itoa(part+1))
+				}
+				add(partPath, name, colSchema[part*max:end])
+			}
+		}
+	}
+	return chunked
+}
+
+// topFields keeps the max fields of colSchema found in most documents, _id
+// first, in schema order, and returns the others apart.
+func topFields(colSchema docSchema, max int) (docSchema, docSchema) {
+	order := make([]int, len(colSchema))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := colSchema[order[i]], colSchema[order[j]]
+		if isIDField(a.Name) != isIDField(b.Name) {
+			return isIDField(a.Name)
+		}
+		return a.Count > b.Count
+	})
+	keep := make(map[int]bool, max)
+	for _, i := range order[:max] {
+		keep[i] = true
+	}
+	var kept, tail docSchema
+	for i, f := range colSchema {
+		if keep[i] {
+			kept = append(kept, f)
+		} else {
+			tail = append(tail, f)
+		}
+	}
+	return kept, tail
+}
+
+// summarizeTail groups the fields by their top level field.
+func summarizeTail(tail docSchema) []longTailGroup {
+	var groups []longTailGroup
+	index := make(map[string]int)
+	for _, f := range tail {
+		prefix := f.Name
+		if i := strings.IndexAny(prefix, ".["); i > 0 {
+			prefix = prefix[:i]
+		}
+		i, ok := index[prefix]
+		if !ok {
+			i = len(groups)
+			index[prefix] = i
+			groups = append(groups, longTailGroup{Prefix: prefix})
+		}
+		g := &groups[i]
+		g.Fields++
+		if f.Count > g.MaxCount {
+			g.MaxCount = f.Count
+		}
+		for _, t := range f.fieldTypes() {
+			if !containsString(g.Types, t) {
+				g.Types = append(g.Types, t)
+			}
+		}
+	}
+	return groups
+}
+
+// tailFiles keeps the top max fields of oversized collections and returns
+// the summaries of the others by .long-tail file.
+func tailFiles(files map[string]map[string]docSchema, max int) (map[string]map[string]docSchema, map[string]map[string][]longTailGroup) {
+	limited := make(map[string]map[string]docSchema)
+	tails := make(map[string]map[string][]longTailGroup)
+	for path, fileSchema := range files {
+		limited[path] = make(map[string]docSchema)
+		for name, colSchema := range fileSchema {
+			if len(colSchema) <= max {
+				limited[path][name] = colSchema
+				continue
+			}
+			log.Printf("Keep %d of the %d fields of %v, summarizing the others\n", max, len(colSchema), name)
+			kept, tail := topFields(colSchema, max)
+			limited[path][name] = kept
+			tailPath := withSuffix(path, "long-tail")
+			if tails[tailPath] == nil {
+				tails[tailPath] = make(map[string][]longTailGroup)
+			}
+			tails[tailPath][name] = summarizeTail(tail)
+		}
+	}
+	return limited, tails
+}
+
+// exportLongTail writes the summaries of left out fields as CSV for the csv
+// format and as JSON otherwise.
+func exportLongTail(path, format string, tails map[string][]longTailGroup) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if format != CSVFormat {
+		data, err := json.MarshalIndent(tails, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	names := make([]string, 0, len(tails))
+	for name := range tails {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writer := csv.NewWriter(f)
+	for _, name := range names {
+		for _, g := range tails[name] {
+			err := writer.Write([]string{name, g.Prefix, strconv.Itoa(g.Fields), strconv.Itoa(g.MaxCount), strings.Join(g.Types, "|")})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// limitFields applies -max-fields to the output files, writing the long
+// tail summaries right away.
+func limitFields(cmdInfo *commandInfo, files map[string]map[string]docSchema) (map[string]map[string]docSchema, error) {
+	if cmdInfo.maxFields <= 0 {
+		return files, nil
+	}
+	if cmdInfo.fieldOverflow == FieldOverflowChunk {
+		return chunkFiles(files, cmdInfo.maxFields), nil
+	}
+	limited, tails := tailFiles(files, cmdInfo.maxFields)
+	for path, summaries := range tails {
+		if err := exportLongTail(path, cmdInfo.format, summaries); err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	return limited, nil
+}
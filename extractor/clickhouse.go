@@ -0,0 +1,177 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// ClickHouseDDLFormat writes a ClickHouse CREATE TABLE statement per
+// collection.
+const ClickHouseDDLFormat = "clickhouse-ddl"
+
+var (
+	clickHouseEngineFlag = cli.StringFlag{
+		Name:  "clickhouse-engine",
+		Usage: "Table engine of -format clickhouse-ddl, e.g. \"ReplacingMergeTree(updatedAt)\"",
+		Value: "MergeTree",
+	}
+	clickHouseOrderByFlag = cli.StringFlag{
+		Name: "clickhouse-order-by",
+		Usage: "Comma-separated columns of the ORDER BY clause of -format clickhouse-ddl. Tables lacking one of " +
+			"them, or holding it nullable, are ordered by _id",
+		Value: "_id",
+	}
+)
+
+// clickHouseTypes are the column types of the base types. ObjectIds are
+// kept as their hex strings.
+var clickHouseTypes = map[string]string{
+	"INTEGER":  "Int64",
+	"DECIMAL":  "Float64",
+	"STRING":   "String",
+	"BOOL":     "Bool",
+	"TIME":     "DateTime64(3, 'UTC')",
+	"OBJECTID": "FixedString(24)",
+	"BINARY":   "String",
+}
+
+var clickHouseIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// chIdent quotes an identifier unless ClickHouse takes it as is.
+func chIdent(name string) string {
+	if clickHouseIdentifier.MatchString(name) {
+		return name
+	}
+	return "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(name) + "`"
+}
+
+// clickHouseType returns the type of a node. Documents in arrays become
+// named tuples, -dynamic documents maps, and mixed types strings holding
+// their JSON; integers mixed with decimals are floats.
+func clickHouseType(n *modelNode) string {
+	types := n.Types
+	switch {
+	case n.Numeric:
+		return "Float64"
+	case len(types) != 1:
+		return "String"
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		switch {
+		case len(n.Properties) > 0:
+			elements := make([]string, 0, len(n.Properties))
+			for _, child := range n.Properties {
+				elements = append(elements, chIdent(child.Name)+" "+clickHouseType(child))
+			}
+			return "Tuple(" + strings.Join(elements, ", ") + ")"
+		case n.Rest != nil:
+			return "Map(String, " + clickHouseType(n.Rest) + ")"
+		}
+		return "Map(String, String)"
+	case "ARRAY":
+		if n.Items != nil {
+			return "Array(" + clickHouseType(n.Items) + ")"
+		}
+		return "Array(String)"
+	}
+	if t, ok := clickHouseTypes[types[0]]; ok {
+		return t
+	}
+	return "String"
+}
+
+// chColumns returns the columns of a node, named after name. Embedded
+// documents with known fields are flattened into a column per field, named
+// like "address_city". Optional scalars are Nullable; arrays, tuples and
+// maps cannot be, and are empty instead.
+func chColumns(name string, n *modelNode, notNull bool) []pgColumn {
+	if len(n.Types) == 1 && n.Types[0] == "DOCUMENT" && n.Properties != nil && n.Rest == nil && n.Path != "_id" {
+		var columns []pgColumn
+		for _, child := range n.Properties {
+			columns = append(columns, chColumns(name+"_"+child.Name, child, notNull && child.Required)...)
+		}
+		return columns
+	}
+	typ := clickHouseType(n)
+	if !notNull && !strings.HasPrefix(typ, "Array(") && !strings.HasPrefix(typ, "Tuple(") && !strings.HasPrefix(typ, "Map(") {
+		typ = "Nullable(" + typ + ")"
+	}
+	return []pgColumn{{name: name, field: n.Path, typ: typ, notNull: notNull}}
+}
+
+// createClickHouseTable returns the CREATE TABLE statement of a collection
+// with the engine and ORDER BY columns given, or ordered by _id when it
+// lacks one of them or has it nullable.
+func createClickHouseTable(database string, c *collectionModel, engine string, orderBy []string) string {
+	var columns []pgColumn
+	for _, child := range c.Document.Properties {
+		columns = append(columns, chColumns(child.Name, child, child.Required)...)
+	}
+	if c.Document.Rest != nil {
+		columns = append(columns, pgColumn{name: "extra", field: "*", typ: "Map(String, String)"})
+	}
+	taken := make(map[string]bool)
+	sortable := make(map[string]bool)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %v.%v\n(\n", chIdent(database), chIdent(c.Name))
+	for i, col := range columns {
+		name := uniqueName(taken, col.name)
+		if !strings.HasPrefix(col.typ, "Nullable(") {
+			sortable[name] = true
+		}
+		fmt.Fprintf(&b, "    %v %v", chIdent(name), col.typ)
+		if col.field != name {
+			fmt.Fprintf(&b, " COMMENT '%v'", strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(col.field))
+		}
+		if i < len(columns)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(")\n")
+	keys := make([]string, 0, len(orderBy))
+	for _, column := range orderBy {
+		if !sortable[column] {
+			if column != "_id" {
+				log.Printf("Ordering %v by _id, as it has no column %v that is never null\n", c.Name, column)
+			}
+			keys = nil
+			if sortable["_id"] {
+				keys = []string{"_id"}
+			}
+			break
+		}
+		keys = append(keys, chIdent(column))
+	}
+	fmt.Fprintf(&b, "ENGINE = %v\n", engine)
+	switch len(keys) {
+	case 0:
+		b.WriteString("ORDER BY tuple()")
+	case 1:
+		fmt.Fprintf(&b, "ORDER BY %v", keys[0])
+	default:
+		fmt.Fprintf(&b, "ORDER BY (%v)", strings.Join(keys, ", "))
+	}
+	b.WriteString(";\n")
+	return b.String()
+}
+
+// exportClickHouseDDL writes the database and the tables of the
+// collections.
+func exportClickHouseDDL(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	var b bytes.Buffer
+	b.WriteString("-- Generated by extract_mgo from sampled documents.\n")
+	fmt.Fprintf(&b, "CREATE DATABASE IF NOT EXISTS %v;\n", chIdent(m.Database))
+	for _, c := range m.Collections {
+		b.WriteString("\n")
+		b.WriteString(createClickHouseTable(m.Database, c, cmdInfo.clickHouseEngine, cmdInfo.clickHouseOrderBy))
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
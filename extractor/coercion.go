@@ -0,0 +1,236 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var coercionPlanFlag = cli.StringFlag{
+	Name: "coercion-plan",
+	Usage: "Write the suggested coercions of mixed-type fields as a mongosh script, or as JSON when the path ends " +
+		"with .json",
+}
+
+// bsonTypeAliases are the $type aliases of the base types.
+var bsonTypeAliases = map[string][]string{
+	"OBJECTID": {"objectId"},
+	"STRING":   {"string"},
+	"INTEGER":  {"int", "long"},
+	"DECIMAL":  {"double", "decimal"},
+	"BOOL":     {"bool"},
+	"TIME":     {"date"},
+	"BINARY":   {"binData"},
+	"ARRAY":    {"array"},
+	"DOCUMENT": {"object"},
+}
+
+// coercion is the suggested cleanup of a mixed-type field: the safest type
+// to keep and the updates converting the other types to it.
+type coercion struct {
+	Target  string           `json:"target"`
+	Updates []coercionUpdate `json:"updates"`
+}
+
+// coercionUpdate converts the values of one type with an update pipeline.
+// Values that fail to convert are left as they are.
+type coercionUpdate struct {
+	From string `json:"from"`
+	// Affected estimates the documents of the collection holding the field
+	// with this type, extrapolated from the sample.
+	Affected int                      `json:"affected"`
+	Filter   map[string]interface{}   `json:"filter"`
+	Pipeline []map[string]interface{} `json:"pipeline"`
+}
+
+// recordTypeDocument counts the current document as holding the field with
+// the given type, once per document.
+func (field *docField) recordTypeDocument(typeName string, fieldSet *fieldSet) {
+	key := field.Name + "\x00" + typeName
+	if _, ok := fieldSet.doc[key]; ok {
+		return
+	}
+	fieldSet.doc[key] = struct{}{}
+	if field.typeDocs == nil {
+		field.typeDocs = make(map[string]int)
+	}
+	field.typeDocs[typeName]++
+}
+
+func (field *docField) mergeTypeDocs(other *docField) {
+	for t, n := range other.typeDocs {
+		if field.typeDocs == nil {
+			field.typeDocs = make(map[string]int)
+		}
+		field.typeDocs[t] += n
+	}
+}
+
+func convertTo(field, to string) map[string]interface{} {
+	return convertInput("$"+field, field, to)
+}
+
+func convertInput(input interface{}, field, to string) map[string]interface{} {
+	return map[string]interface{}{"$convert": map[string]interface{}{
+		"input": input, "to": to, "onError": "$" + field, "onNull": "$" + field,
+	}}
+}
+
+// coercionTarget picks the type a mixed field converts to without losing
+// information, or "" when the values need a manual decision, with the
+// function giving the expression that converts a value of a type to it.
+// Numbers become doubles unless some integer is beyond what a double holds
+// exactly, in which case they become decimals. Numeric strings only become
+// numbers when none has leading zeros or more significant digits than a
+// double holds, and otherwise fall back to strings.
+func coercionTarget(f *docField) (string, func(from string) interface{}) {
+	p := f.profile
+	if p == nil {
+		p = new(fieldProfile)
+	}
+	types := make(map[string]bool)
+	for _, t := range f.fieldTypes() {
+		types[baseType(t)] = true
+	}
+	only := func(allowed ...string) bool {
+		n := 0
+		for _, t := range allowed {
+			if types[t] {
+				n++
+			}
+		}
+		return n == len(types)
+	}
+	numericStrings := p.strings > 0 && p.numericStrings == p.strings && p.inexactStrings == 0
+	number := "double"
+	if p.largeIntegers > 0 {
+		number = "decimal"
+	}
+	booleanStrings := p.strings > 0 && p.booleanStrings == p.strings
+	epochIntegers := p.integers > 0 && (p.epochSeconds == p.integers || p.epochMillis == p.integers)
+	switch {
+	case only("INTEGER", "DECIMAL"), only("INTEGER", "DECIMAL", "STRING") && numericStrings:
+		return "DECIMAL", func(string) interface{} { return convertTo(f.Name, number) }
+	case only("BOOL", "STRING") && booleanStrings:
+		return "BOOL", func(string) interface{} {
+			return map[string]interface{}{"$in": []interface{}{
+				map[string]interface{}{"$toLower": map[string]interface{}{"$trim": map[string]interface{}{"input": "$" + f.Name}}},
+				[]string{"true", "1"},
+			}}
+		}
+	case types["TIME"] && only("TIME", "STRING", "INTEGER") && (!types["INTEGER"] || epochIntegers):
+		return "TIME", func(from string) interface{} {
+			if from == "INTEGER" && p.epochSeconds == p.integers {
+				return convertInput(map[string]interface{}{"$multiply": []interface{}{"$" + f.Name, 1000}}, f.Name, "date")
+			}
+			return convertTo(f.Name, "date")
+		}
+	case only("OBJECTID", "STRING") && f.typeDocs["OBJECTID"] >= f.typeDocs["STRING"]:
+		return "OBJECTID", func(string) interface{} { return convertTo(f.Name, "objectId") }
+	case !types["ARRAY"] && !types["DOCUMENT"] && !types["BINARY"] && !types["UNKNOWN"]:
+		return "STRING", func(string) interface{} { return convertTo(f.Name, "string") }
+	}
+	return "", nil
+}
+
+// suggestCoercions attaches a coercion to every mixed-type field outside
+// arrays, estimating affected documents from the sample.
+func suggestCoercions(collection string, colSchema docSchema, documents, sampled int) {
+	for i := range colSchema {
+		f := &colSchema[i]
+		if len(f.Types) < 2 || strings.Contains(f.Name, "[]") || f.summarizesKeys() || sampled == 0 {
+			continue
+		}
+		target, conversion := coercionTarget(f)
+		if target == "" {
+			continue
+		}
+		c := &coercion{Target: target}
+		from := make([]string, 0, len(f.typeDocs))
+		for t := range f.typeDocs {
+			if baseType(t) != target {
+				from = append(from, t)
+			}
+		}
+		sort.Strings(from)
+		total := 0
+		for _, t := range from {
+			affected := int(math.Round(float64(f.typeDocs[t]) / float64(sampled) * float64(documents)))
+			total += affected
+			c.Updates = append(c.Updates, coercionUpdate{
+				From:     t,
+				Affected: affected,
+				Filter:   map[string]interface{}{f.Name: map[string]interface{}{"$type": bsonTypeAliases[baseType(t)]}},
+				Pipeline: []map[string]interface{}{{"$set": map[string]interface{}{f.Name: conversion(t)}}},
+			})
+		}
+		if len(c.Updates) == 0 {
+			continue
+		}
+		f.Coercion = c
+		addFinding(finding{
+			Collection: collection,
+			Field:      f.Name,
+			Kind:       "type-coercion",
+			Message: fmt.Sprintf("%v.%v (%v): coerce to %v, about %v documents to update",
+				collection, f.Name, strings.Join(f.fieldTypes(), "|"), target, publishedCount(total)),
+		})
+	}
+}
+
+// exportCoercionPlan writes the coercions of the schema as a mongosh script,
+// or as JSON, ordered by collection and field.
+func exportCoercionPlan(path string, schema map[string]docSchema) error {
+	type plannedField struct {
+		Collection string    `json:"collection"`
+		Field      string    `json:"field"`
+		Types      []string  `json:"types"`
+		Coercion   *coercion `json:"coercion"`
+	}
+	plan := []plannedField{}
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, f := range schema[name] {
+			if f.Coercion != nil {
+				plan = append(plan, plannedField{Collection: name, Field: f.Name, Types: f.fieldTypes(), Coercion: f.Coercion})
+			}
+		}
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	var script strings.Builder
+	script.WriteString("// Coercions of mixed-type fields suggested by extract_mgo. Review before running:\n")
+	script.WriteString("// values that fail to convert are left unchanged.\n")
+	for _, p := range plan {
+		fmt.Fprintf(&script, "\n// %v.%v: %v -> %v\n", p.Collection, p.Field, strings.Join(p.Types, "|"), p.Coercion.Target)
+		for _, u := range p.Coercion.Updates {
+			filter, err := json.Marshal(u.Filter)
+			if err != nil {
+				return err
+			}
+			pipeline, err := json.Marshal(u.Pipeline)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&script, "// about %v documents hold %v\n", u.Affected, u.From)
+			fmt.Fprintf(&script, "db.getCollection(%v).updateMany(%s, %s);\n", strconv.Quote(p.Collection), filter, pipeline)
+		}
+	}
+	return ioutil.WriteFile(path, []byte(script.String()), 0644)
+}
@@ -0,0 +1,95 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxFoldedValues bounds the distinct strings per field kept to detect
+// values differing only by case or diacritics.
+const MaxFoldedValues = 1000
+
+// foldString removes case and diacritics, approximating a strength 1
+// collation.
+func foldString(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
+
+// observeFolded remembers the first pair of distinct values that collide
+// once folded.
+func (p *fieldProfile) observeFolded(s string) {
+	if p.foldVariant[0] != "" {
+		return
+	}
+	key := foldString(s)
+	if prev, ok := p.folded[key]; ok {
+		if prev != s {
+			p.foldVariant = [2]string{prev, s}
+		}
+		return
+	}
+	if p.folded == nil {
+		p.folded = make(map[string]string)
+	}
+	if len(p.folded) < MaxFoldedValues {
+		p.folded[key] = s
+	}
+}
+
+// reportFoldVariants flags string fields that would break unique
+// constraints under case- or accent-insensitive collations downstream.
+func reportFoldVariants(collection string, colSchema docSchema) {
+	for _, f := range colSchema {
+		if f.profile == nil || f.profile.foldVariant[0] == "" {
+			continue
+		}
+		examples := ""
+		first, ok := anonymize(collection, f.Name, f.profile.foldVariant[0])
+		if ok {
+			second, _ := anonymize(collection, f.Name, f.profile.foldVariant[1])
+			examples = fmt.Sprintf(" (%q, %q)", first, second)
+		}
+		addFinding(finding{
+			Collection: collection,
+			Field:      f.Name,
+			Kind:       "case-variants",
+			Message: fmt.Sprintf("%v.%v has values differing only by case or diacritics%v; unique constraints under an insensitive collation would reject them",
+				collection, f.Name, examples),
+		})
+	}
+}
+
+// collectionCollation returns the default collation of the collection, or
+// nil for simple binary comparison.
+func collectionCollation(c *mgo.Collection) bson.M {
+	var result struct {
+		Cursor struct {
+			FirstBatch []struct {
+				Options struct {
+					Collation bson.M `bson:"collation"`
+				} `bson:"options"`
+			} `bson:"firstBatch"`
+		} `bson:"cursor"`
+	}
+	cmd := bson.D{{Name: "listCollections", Value: 1}, {Name: "filter", Value: bson.M{"name": c.Name}}}
+	if err := c.Database.Run(cmd, &result); err != nil {
+		addWarning(c.Name, "", "failed to read collection options: %v", err)
+		return nil
+	}
+	if len(result.Cursor.FirstBatch) == 0 {
+		return nil
+	}
+	return result.Cursor.FirstBatch[0].Options.Collation
+}
@@ -0,0 +1,43 @@
+package extractor
+
+import (
+	"io/ioutil"
+
+	cli "gopkg.in/urfave/cli.v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var configFlag = cli.StringFlag{
+	Name:  "config",
+	Usage: "YAML configuration file",
+}
+
+// config is the content of the -config file.
+type config struct {
+	// Presets adds presets or extends the built-in ones of the same name.
+	Presets map[string]preset `yaml:"presets"`
+	// Anonymize is the policy for example values written to the output.
+	Anonymize anonymizeConfig `yaml:"anonymize"`
+	// Owners maps collections and fields to owning teams and domains.
+	Owners ownerRules `yaml:"owners"`
+	// Profiles adds output profiles or overrides settings of the built-in
+	// ones of the same name.
+	Profiles map[string]outputProfile `yaml:"profiles"`
+	// Lint adds -lint rules or overrides built-in ones with the same id.
+	Lint lintPack `yaml:"lint"`
+}
+
+func loadConfig(path string) (*config, error) {
+	cfg := new(config)
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
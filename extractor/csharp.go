@@ -0,0 +1,192 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// CSharpFormat writes C# classes of the collections, annotated for the
+// MongoDB C# driver.
+const CSharpFormat = "csharp"
+
+var csharpNamespaceFlag = cli.StringFlag{
+	Name:  "csharp-namespace",
+	Usage: "Namespace of the C# classes written by -format csharp",
+	Value: "Models",
+}
+
+// csharpTypes are the C# types of the base types and whether they are value
+// types, made nullable when the field is optional.
+var csharpTypes = map[string]struct {
+	name  string
+	value bool
+}{
+	"INTEGER":  {"long", true},
+	"DECIMAL":  {"double", true},
+	"STRING":   {"string", false},
+	"BOOL":     {"bool", true},
+	"TIME":     {"DateTime", true},
+	"OBJECTID": {"ObjectId", true},
+	"BINARY":   {"byte[]", false},
+}
+
+// csharpUsings are the namespaces of the simple names the classes may use.
+var csharpUsings = map[string]string{
+	"DateTime":     "System",
+	"List":         "System.Collections.Generic",
+	"Dictionary":   "System.Collections.Generic",
+	"ObjectId":     "MongoDB.Bson",
+	"BsonValue":    "MongoDB.Bson",
+	"BsonArray":    "MongoDB.Bson",
+	"BsonDocument": "MongoDB.Bson",
+}
+
+// csharpWriter writes the classes of the collections, each followed by the
+// classes of its nested documents.
+type csharpWriter struct {
+	source  bytes.Buffer
+	usings  map[string]bool
+	classes map[string]bool
+	pending []pendingStruct
+}
+
+// use returns a simple name, adding the using directive it needs.
+func (w *csharpWriter) use(name string) string {
+	if ns := csharpUsings[name]; ns != "" {
+		w.usings[ns] = true
+	}
+	return name
+}
+
+// csharpType returns the C# type of the node, queuing the classes it needs
+// under names derived from name. Optional value types are nullable. Mixed
+// types are BsonValues, except for integers mixed with decimals.
+func (w *csharpWriter) csharpType(name string, n *modelNode, optional bool) string {
+	types := n.Types
+	if n.Numeric {
+		types = []string{"DECIMAL"}
+	}
+	if len(types) != 1 {
+		return w.use("BsonValue")
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		if n.Properties == nil {
+			if n.Rest == nil {
+				return w.use("BsonDocument")
+			}
+			return w.use("Dictionary") + "<string, " + w.csharpType(name+"Value", n.Rest, false) + ">"
+		}
+		className := uniqueName(w.classes, name)
+		w.pending = append(w.pending, pendingStruct{name: className, node: n})
+		return className
+	case "ARRAY":
+		if n.Items == nil {
+			return w.use("BsonArray")
+		}
+		return w.use("List") + "<" + w.csharpType(name+"Item", n.Items, false) + ">"
+	}
+	t, ok := csharpTypes[types[0]]
+	if !ok {
+		return w.use("BsonValue")
+	}
+	w.use(t.name)
+	if t.value && optional {
+		return t.name + "?"
+	}
+	return t.name
+}
+
+// writeClass writes the class of a document with a property per field,
+// mapped with [BsonElement]; the _id of a collection is the [BsonId].
+// Optional fields are not written when null, and summarized -dynamic keys
+// are kept as extra elements.
+func (w *csharpWriter) writeClass(s pendingStruct, collection bool) {
+	// A member cannot be named after its class, and the driver maps a
+	// property named Id to _id.
+	properties := map[string]bool{s.name: true, "Id": true}
+	w.usings["MongoDB.Bson.Serialization.Attributes"] = true
+	fmt.Fprintf(&w.source, "    public class %v\n    {\n", s.name)
+	for i, child := range s.node.Properties {
+		name := "Id"
+		if child.Name != "_id" {
+			name = uniqueName(properties, goName(child.Name))
+		}
+		typ := w.csharpType(s.name+goName(child.Name), child, !child.Required)
+		var attributes []string
+		if child.Name == "_id" && collection {
+			attributes = append(attributes, "BsonId")
+		} else {
+			attributes = append(attributes, fmt.Sprintf("BsonElement(%v)", strconv.Quote(child.Name)))
+		}
+		if !child.Required {
+			attributes = append(attributes, "BsonIgnoreIfNull")
+		}
+		if i > 0 {
+			w.source.WriteString("\n")
+		}
+		fmt.Fprintf(&w.source, "        [%v]\n        public %v %v { get; set; }\n", strings.Join(attributes, ", "), typ, name)
+	}
+	if s.node.Rest != nil {
+		if len(s.node.Properties) > 0 {
+			w.source.WriteString("\n")
+		}
+		fmt.Fprintf(&w.source, "        [BsonExtraElements]\n        public %v %v { get; set; }\n", w.use("BsonDocument"),
+			uniqueName(properties, "ExtraElements"))
+	}
+	w.source.WriteString("    }\n")
+}
+
+// csharpClasses returns a C# source declaring a class per collection, named
+// after the collection, and the classes of their nested documents.
+func csharpClasses(namespace string, m *schemaModel) []byte {
+	w := &csharpWriter{usings: make(map[string]bool), classes: make(map[string]bool)}
+	for _, c := range m.Collections {
+		name := uniqueName(w.classes, goName(c.Name))
+		if w.source.Len() > 0 {
+			w.source.WriteString("\n")
+		}
+		fmt.Fprintf(&w.source, "    /// <summary>A document of the %v collection.</summary>\n", c.Name)
+		w.writeClass(pendingStruct{name: name, node: c.Document}, true)
+		for len(w.pending) > 0 {
+			s := w.pending[0]
+			w.pending = w.pending[1:]
+			w.source.WriteString("\n")
+			w.writeClass(s, false)
+		}
+	}
+	var source bytes.Buffer
+	source.WriteString("// Generated by extract_mgo from sampled documents.\n\n")
+	usings := make([]string, 0, len(w.usings))
+	for ns := range w.usings {
+		usings = append(usings, ns)
+	}
+	// System namespaces come first, as by dotnet format.
+	system := func(ns string) bool { return ns == "System" || strings.HasPrefix(ns, "System.") }
+	sort.Slice(usings, func(i, j int) bool {
+		if system(usings[i]) != system(usings[j]) {
+			return system(usings[i])
+		}
+		return usings[i] < usings[j]
+	})
+	for _, ns := range usings {
+		fmt.Fprintf(&source, "using %v;\n", ns)
+	}
+	if len(usings) > 0 {
+		source.WriteString("\n")
+	}
+	fmt.Fprintf(&source, "namespace %v\n{\n", namespace)
+	source.Write(w.source.Bytes())
+	source.WriteString("}\n")
+	return source.Bytes()
+}
+
+func exportCSharp(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, csharpClasses(cmdInfo.csharpNamespace, m), 0644)
+}
@@ -0,0 +1,90 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// DBMLFormat writes DBML, the language of dbdiagram.io and dbdocs, with a
+// table per collection and the references between them.
+const DBMLFormat = "dbml"
+
+// dbmlName quotes names DBML does not take bare, e.g. those with dots.
+func dbmlName(name string) string {
+	if name != "" && plainName(name) == name {
+		return name
+	}
+	return `"` + strings.Replace(name, `"`, `\"`, -1) + `"`
+}
+
+// dbmlString quotes a note.
+func dbmlString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", `\n`).Replace(s) + "'"
+}
+
+// dbmlColumnType is the column type of a field: its lowercased base type,
+// "mixed" for mixed types, which are listed in the note of the column.
+func dbmlColumnType(f *docField) string {
+	types := f.fieldTypes()
+	if len(types) != 1 {
+		return "mixed"
+	}
+	return strings.ToLower(baseType(types[0]))
+}
+
+// dbmlSchema returns the DBML of the model: a table per collection whose
+// columns are its fields, _id as primary key and the fields in every
+// sampled document not null, and a Ref per reference to a collection of the
+// model, many-to-many for references in arrays. Elements of arrays are left
+// out, the arrays standing for them.
+func dbmlSchema(m *schemaModel) []byte {
+	collections := modelCollections(m)
+	var b, refs bytes.Buffer
+	b.WriteString("// Generated by extract_mgo from sampled documents.\n\n")
+	fmt.Fprintf(&b, "Project %v {\n  database_type: 'MongoDB'\n}\n\n", dbmlName(m.Database))
+	for _, c := range m.Collections {
+		table := dbmlName(c.Name)
+		fmt.Fprintf(&b, "Table %v", table)
+		if c.Stats != nil {
+			fmt.Fprintf(&b, " [note: %v]", dbmlString(fmt.Sprintf("%v documents, %v sampled", c.Stats.Documents, c.Stats.Sampled)))
+		}
+		b.WriteString(" {\n")
+		for i := range c.Fields {
+			f := &c.Fields[i]
+			if strings.HasSuffix(f.Name, "[]") {
+				continue
+			}
+			var settings []string
+			switch {
+			case f.Name == "_id":
+				settings = append(settings, "pk")
+			case !strings.Contains(f.Name, "[]") && f.Count >= c.Document.Count:
+				settings = append(settings, "not null")
+			}
+			if types := f.fieldTypes(); len(types) > 1 {
+				settings = append(settings, "note: "+dbmlString(strings.Join(types, ", ")))
+			}
+			fmt.Fprintf(&b, "  %v %v", dbmlName(f.Name), dbmlColumnType(f))
+			if len(settings) > 0 {
+				fmt.Fprintf(&b, " [%v]", strings.Join(settings, ", "))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n\n")
+		for _, r := range referencesOf(c, collections) {
+			relation := ">"
+			if r.Many {
+				relation = "<>"
+			}
+			fmt.Fprintf(&refs, "Ref: %v.%v %v %v._id\n", table, dbmlName(r.Field), relation, dbmlName(r.Target))
+		}
+	}
+	b.Write(refs.Bytes())
+	return b.Bytes()
+}
+
+func exportDBML(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, dbmlSchema(m), 0644)
+}
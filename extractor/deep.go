@@ -0,0 +1,504 @@
+package extractor
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// TopValues is the number of most frequent values reported per field.
+	TopValues = 10
+	// HistogramBins is the number of bins of numeric histograms.
+	HistogramBins = 20
+	// ValueEntryOverhead approximates the memory of an exact count entry
+	// beyond the value itself.
+	ValueEntryOverhead = 64
+	// DefaultMemoryLimit bounds exact value counts when -memory-limit is not
+	// given.
+	DefaultMemoryLimit = "256MB"
+)
+
+var (
+	deepFlag = cli.BoolFlag{
+		Name:  "deep",
+		Usage: "Profile field values: distinct count, top values and numeric histograms",
+	}
+	memoryLimitFlag = cli.StringFlag{
+		Name: "memory-limit",
+		Usage: "Memory for exact value counts of -deep, e.g. \"512MB\" or \"2GB\". Beyond it fields switch to approximate " +
+			"distinct counts and top values, or spill to -spill-dir",
+		Value: DefaultMemoryLimit,
+	}
+	spillDirFlag = cli.StringFlag{
+		Name:  "spill-dir",
+		Usage: "Directory for temporary files of exact value counts that exceed -memory-limit",
+	}
+)
+
+// valueProfiling is the memory budget of -deep, nil when values are not
+// profiled.
+var valueProfiling *memoryBudget
+
+// memoryBudget is shared by the value counts of all collections sampled
+// concurrently.
+type memoryBudget struct {
+	limit    int64
+	used     int64
+	spillDir string
+}
+
+// parseByteSize parses sizes such as "1048576", "512KB", "512MB" or "2GB".
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// charge reserves n bytes, failing when the budget is exhausted.
+func (b *memoryBudget) charge(n int64) bool {
+	if atomic.AddInt64(&b.used, n) > b.limit {
+		atomic.AddInt64(&b.used, -n)
+		return false
+	}
+	return true
+}
+
+func (b *memoryBudget) release(n int64) {
+	atomic.AddInt64(&b.used, -n)
+}
+
+// valueCount is a value with its number of occurrences.
+type valueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// valueSummary is the -deep profile of a field.
+type valueSummary struct {
+	Distinct int `json:"distinct"`
+	// Approximate is set when Distinct and Top were estimated because the
+	// memory limit was reached.
+	Approximate bool           `json:"approximate,omitempty"`
+	Top         []valueCount   `json:"top,omitempty"`
+	Min         *float64       `json:"min,omitempty"`
+	Max         *float64       `json:"max,omitempty"`
+	Histogram   []histogramBin `json:"histogram,omitempty"`
+}
+
+// valueStats counts the values of a field exactly while the memory budget
+// allows, then either spills the counts to sorted run files or switches to
+// sketches.
+type valueStats struct {
+	budget  *memoryBudget
+	counts  map[string]int
+	charged int64
+	runs    []string
+
+	distinct *hyperLogLog
+	top      *spaceSaving
+
+	numbers  int
+	min, max float64
+	hist     *streamingHistogram
+}
+
+func newValueStats(budget *memoryBudget) *valueStats {
+	return &valueStats{
+		budget: budget,
+		counts: make(map[string]int),
+		hist:   &streamingHistogram{maxBins: HistogramBins},
+	}
+}
+
+// valueKey renders a scalar value for counting and reporting.
+func valueKey(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bson.ObjectId:
+		return v.Hex()
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func (s *valueStats) observe(value interface{}) {
+	if x, ok := numericValue(value); ok {
+		s.addNumber(x, 1)
+	}
+	s.add(valueKey(value), 1)
+}
+
+func (s *valueStats) addNumber(x float64, count int) {
+	if s.numbers == 0 || x < s.min {
+		s.min = x
+	}
+	if s.numbers == 0 || x > s.max {
+		s.max = x
+	}
+	s.numbers += count
+	s.hist.add(x, count)
+}
+
+func (s *valueStats) add(key string, count int) {
+	if s.counts == nil {
+		s.distinct.add(key)
+		s.top.add(key, count)
+		return
+	}
+	if _, ok := s.counts[key]; !ok {
+		cost := int64(len(key) + ValueEntryOverhead)
+		if !s.budget.charge(cost) {
+			s.degrade()
+			s.add(key, count)
+			return
+		}
+		s.charged += cost
+	}
+	s.counts[key] += count
+}
+
+// degrade frees the exact counts when the budget is exhausted, spilling them
+// when a spill directory is configured, otherwise switching to sketches.
+func (s *valueStats) degrade() {
+	// Spilling frees nothing when other fields hold the whole budget.
+	if s.budget.spillDir != "" && s.charged > 0 {
+		err := s.spill()
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to spill value counts, switching to approximate counts: %v\n", err)
+	}
+	s.approximate()
+}
+
+// approximate feeds the exact counts, in memory and spilled, to sketches and
+// keeps counting with them.
+func (s *valueStats) approximate() {
+	counts, runs := s.counts, s.runs
+	s.distinct = new(hyperLogLog)
+	s.top = newSpaceSaving(TopValues * 10)
+	s.counts, s.runs = nil, nil
+	s.budget.release(s.charged)
+	s.charged = 0
+	for key, count := range counts {
+		s.add(key, count)
+	}
+	for _, run := range runs {
+		if err := readRun(run, s.add); err != nil {
+			log.Printf("Failed to read spilled value counts: %v\n", err)
+		}
+		os.Remove(run)
+	}
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// spill writes the exact counts as a sorted run of "count<TAB>quoted value"
+// lines and empties them.
+func (s *valueStats) spill() error {
+	f, err := ioutil.TempFile(s.budget.spillDir, "extract_mgo-values-")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, key := range sortedKeys(s.counts) {
+		fmt.Fprintf(w, "%d\t%s\n", s.counts[key], strconv.Quote(key))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+	s.counts = make(map[string]int)
+	s.budget.release(s.charged)
+	s.charged = 0
+	return nil
+}
+
+// runReader reads a spilled run line by line.
+type runReader struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	key     string
+	count   int
+	err     error
+}
+
+func openRun(path string) (*runReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &runReader{file: f, scanner: scanner}, nil
+}
+
+// next advances to the next entry, returning false at the end of the run or
+// on an error, which is kept in r.err.
+func (r *runReader) next() bool {
+	if !r.scanner.Scan() {
+		r.err = r.scanner.Err()
+		return false
+	}
+	parts := strings.SplitN(r.scanner.Text(), "\t", 2)
+	if len(parts) != 2 {
+		r.err = fmt.Errorf("malformed spill line %q", r.scanner.Text())
+		return false
+	}
+	if r.count, r.err = strconv.Atoi(parts[0]); r.err != nil {
+		return false
+	}
+	if r.key, r.err = strconv.Unquote(parts[1]); r.err != nil {
+		return false
+	}
+	return true
+}
+
+func readRun(path string, add func(key string, count int)) error {
+	r, err := openRun(path)
+	if err != nil {
+		return err
+	}
+	defer r.file.Close()
+	for r.next() {
+		add(r.key, r.count)
+	}
+	return r.err
+}
+
+// runHeap orders run readers by their current key for a k-way merge.
+type runHeap []*runReader
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].key < h[j].key }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// topValues keeps the n most frequent values, most frequent first.
+type topValues struct {
+	n      int
+	values []valueCount
+}
+
+func (t *topValues) add(key string, count int) {
+	if len(t.values) == t.n && count <= t.values[t.n-1].Count {
+		return
+	}
+	t.values = append(t.values, valueCount{Value: key, Count: count})
+	sort.SliceStable(t.values, func(i, j int) bool { return t.values[i].Count > t.values[j].Count })
+	if len(t.values) > t.n {
+		t.values = t.values[:t.n]
+	}
+}
+
+// mergeRuns merges the sorted runs into the distinct count and top values,
+// removing the run files.
+func (s *valueStats) mergeRuns(summary *valueSummary) error {
+	defer func() {
+		for _, run := range s.runs {
+			os.Remove(run)
+		}
+		s.runs = nil
+	}()
+	h := &runHeap{}
+	for _, run := range s.runs {
+		r, err := openRun(run)
+		if err != nil {
+			return err
+		}
+		defer r.file.Close()
+		if r.next() {
+			heap.Push(h, r)
+		} else if r.err != nil {
+			return r.err
+		}
+	}
+	top := &topValues{n: TopValues}
+	for h.Len() > 0 {
+		key, count := (*h)[0].key, 0
+		for h.Len() > 0 && (*h)[0].key == key {
+			r := (*h)[0]
+			count += r.count
+			if r.next() {
+				heap.Fix(h, 0)
+			} else {
+				if r.err != nil {
+					return r.err
+				}
+				heap.Pop(h)
+			}
+		}
+		summary.Distinct++
+		top.add(key, count)
+	}
+	summary.Top = top.values
+	return nil
+}
+
+// summary computes the reported profile and frees the counts.
+func (s *valueStats) summary() *valueSummary {
+	summary := new(valueSummary)
+	if s.numbers > 0 {
+		min, max := s.min, s.max
+		summary.Min, summary.Max = &min, &max
+		summary.Histogram = s.hist.bins
+	}
+	if len(s.runs) > 0 && len(s.counts) > 0 {
+		if err := s.spill(); err != nil {
+			log.Printf("Failed to spill value counts, switching to approximate counts: %v\n", err)
+			s.approximate()
+		}
+	}
+	if len(s.runs) > 0 {
+		err := s.mergeRuns(summary)
+		if err != nil {
+			log.Printf("Failed to merge spilled value counts: %v\n", err)
+			summary.Distinct, summary.Top = 0, nil
+			summary.Approximate = true
+		}
+		return summary
+	}
+	top := &topValues{n: TopValues}
+	if s.counts == nil {
+		summary.Distinct = s.distinct.estimate()
+		summary.Approximate = true
+		for _, key := range sortedKeys(s.top.counts) {
+			top.add(key, s.top.counts[key])
+		}
+	} else {
+		summary.Distinct = len(s.counts)
+		for _, key := range sortedKeys(s.counts) {
+			top.add(key, s.counts[key])
+		}
+		s.counts = nil
+		s.budget.release(s.charged)
+		s.charged = 0
+	}
+	summary.Top = top.values
+	return summary
+}
+
+// merge adds the values of other, counted on another part of the collection.
+func (s *valueStats) merge(other *valueStats) {
+	if other.numbers > 0 {
+		if s.numbers == 0 || other.min < s.min {
+			s.min = other.min
+		}
+		if s.numbers == 0 || other.max > s.max {
+			s.max = other.max
+		}
+		s.numbers += other.numbers
+		s.hist.merge(other.hist)
+	}
+	if other.counts == nil {
+		if s.counts != nil {
+			s.approximate()
+		}
+		s.distinct.merge(other.distinct)
+		s.top.merge(other.top)
+		return
+	}
+	if s.counts == nil {
+		for _, run := range other.runs {
+			if err := readRun(run, s.add); err != nil {
+				log.Printf("Failed to read spilled value counts: %v\n", err)
+			}
+			os.Remove(run)
+		}
+	} else {
+		s.runs = append(s.runs, other.runs...)
+	}
+	other.runs = nil
+	counts := other.counts
+	other.counts = nil
+	other.budget.release(other.charged)
+	other.charged = 0
+	for key, count := range counts {
+		s.add(key, count)
+	}
+}
+
+// summarizeValues replaces the value counts of the sampled fields with their
+// reported profile, with the values anonymized.
+func summarizeValues(collection string, colSchema docSchema) {
+	for i := range colSchema {
+		if p := colSchema[i].profile; p != nil && p.values != nil {
+			summary := p.values.summary()
+			p.values = nil
+			top := summary.Top[:0]
+			for _, v := range summary.Top {
+				value, ok := anonymize(collection, colSchema[i].Name, v.Value)
+				if !ok {
+					// Dropped values leave out the numeric summary too.
+					top, summary.Min, summary.Max, summary.Histogram = nil, nil, nil, nil
+					break
+				}
+				top = append(top, valueCount{Value: value, Count: v.Count})
+			}
+			summary.Top = top
+			colSchema[i].Values = summary
+		}
+	}
+}
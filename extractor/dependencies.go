@@ -0,0 +1,180 @@
+package extractor
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// MaxConditionValues is the number of distinct values above which a
+	// field is no longer considered as a condition of other fields.
+	MaxConditionValues = 20
+	// MinDependencySupport is the number of documents a dependency must hold
+	// in before it is reported.
+	MinDependencySupport = 10
+)
+
+var dependenciesFlag = cli.BoolFlag{
+	Name: "dependencies",
+	Usage: "Report conditions under which optional fields appear, e.g. refundedAt only when status is \"refunded\", " +
+		"from the first sampled documents of each collection",
+}
+
+// dependencyAnalysis is set by -dependencies.
+var dependencyAnalysis bool
+
+// overflowed marks the value presence of a field with too many values to be
+// a condition.
+var overflowed = map[string]presence{}
+
+func (p presence) count() int {
+	n := 0
+	for _, word := range p {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+// recordValuePresence remembers the document as holding value in the field,
+// for strings and booleans outside arrays.
+func (field *docField) recordValuePresence(value interface{}, doc int) {
+	if !dependencyAnalysis || doc >= MaxPresenceDocuments || strings.Contains(field.Name, "[]") {
+		return
+	}
+	var key string
+	switch v := value.(type) {
+	case string:
+		key = strconv.Quote(v)
+	case bool:
+		key = strconv.FormatBool(v)
+	default:
+		return
+	}
+	field.addValuePresence(key, func(p *presence) { p.set(doc) })
+}
+
+func (field *docField) addValuePresence(key string, add func(p *presence)) {
+	if len(field.valuePresence) == 0 && field.valuePresence != nil {
+		return
+	}
+	if field.valuePresence == nil {
+		field.valuePresence = make(map[string]presence)
+	}
+	p, ok := field.valuePresence[key]
+	if !ok && len(field.valuePresence) >= MaxConditionValues {
+		field.valuePresence = overflowed
+		return
+	}
+	add(&p)
+	field.valuePresence[key] = p
+}
+
+// mergeValuePresence adds the value presence of other, whose documents are
+// numbered from offset on.
+func (field *docField) mergeValuePresence(other *docField, offset int) {
+	if other.valuePresence == nil {
+		return
+	}
+	if len(other.valuePresence) == 0 {
+		field.valuePresence = overflowed
+		return
+	}
+	for key, p := range other.valuePresence {
+		field.addValuePresence(key, func(merged *presence) { merged.merge(p, offset) })
+	}
+}
+
+// conditionText renders "field == value", anonymizing string values.
+func conditionText(collection, field, key string) (string, bool) {
+	if value, err := strconv.Unquote(key); err == nil {
+		anonymized, ok := anonymize(collection, field, value)
+		if !ok {
+			return "", false
+		}
+		key = strconv.Quote(anonymized)
+	}
+	return field + " == " + key, true
+}
+
+// reportDependencies reports, for each optional field, the value of another
+// field it appears only with, and whether it is then required; failing that,
+// the least common optional field it always appears with.
+func reportDependencies(collection string, colSchema docSchema) {
+	window := 0
+	for _, f := range colSchema {
+		if n := f.presence.count(); n > window {
+			window = n
+		}
+	}
+	for i := range colSchema {
+		b := &colSchema[i]
+		support := b.presence.count()
+		if isIDField(b.Name) || strings.Contains(b.Name, "[]") || support < MinDependencySupport || support == window {
+			continue
+		}
+		var conditions []string
+		for _, c := range colSchema {
+			if c.Name == b.Name || len(c.valuePresence) == 0 {
+				continue
+			}
+			keys := make([]string, 0, len(c.valuePresence))
+			for key := range c.valuePresence {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				values := c.valuePresence[key]
+				both, _ := b.presence.overlap(values)
+				matching := values.count()
+				// A value every document has is no condition.
+				if both != support || matching == window {
+					continue
+				}
+				condition, ok := conditionText(collection, c.Name, key)
+				if !ok {
+					continue
+				}
+				if matching == support {
+					conditions = append(conditions, "required when "+condition)
+				} else {
+					conditions = append(conditions, fmt.Sprintf("present only when %v (in %v of %v such documents)", condition, support, matching))
+				}
+			}
+		}
+		if len(conditions) == 0 {
+			var companion *docField
+			for j := range colSchema {
+				a := &colSchema[j]
+				n := a.presence.count()
+				if a.Name == b.Name || isIDField(a.Name) || n == window || n <= support ||
+					strings.HasPrefix(b.Name, a.Name+".") || strings.HasPrefix(a.Name, b.Name+".") {
+					continue
+				}
+				if both, _ := b.presence.overlap(a.presence); both == support && (companion == nil || n < companion.presence.count()) {
+					companion = a
+				}
+			}
+			if companion != nil {
+				conditions = append(conditions, fmt.Sprintf("present only when %v is present (in %v of %v such documents)",
+					companion.Name, support, companion.presence.count()))
+			}
+		}
+		b.Conditions = conditions
+		for _, condition := range conditions {
+			addFinding(finding{
+				Collection: collection,
+				Field:      b.Name,
+				Kind:       "field-dependency",
+				Message:    fmt.Sprintf("%v.%v is %v", collection, b.Name, condition),
+			})
+		}
+	}
+	for i := range colSchema {
+		colSchema[i].valuePresence = nil
+	}
+}
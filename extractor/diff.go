@@ -0,0 +1,128 @@
+package extractor
+
+import (
+	"os"
+	"sort"
+)
+
+// fieldChange is a field whose types differ between baseline and current.
+type fieldChange struct {
+	Name   string   `json:"name"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+type collectionDiff struct {
+	Collection    string        `json:"collection"`
+	AddedFields   []docField    `json:"addedFields,omitempty"`
+	RemovedFields []docField    `json:"removedFields,omitempty"`
+	ChangedFields []fieldChange `json:"changedFields,omitempty"`
+}
+
+// schemaDiff is the structural difference between a baseline schema and the
+// current one.
+type schemaDiff struct {
+	Baseline           string           `json:"baseline"`
+	AddedCollections   []string         `json:"addedCollections,omitempty"`
+	RemovedCollections []string         `json:"removedCollections,omitempty"`
+	Collections        []collectionDiff `json:"collections,omitempty"`
+}
+
+// readBaseline loads a schema file that must exist.
+func readBaseline(path string) (map[string]docSchema, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return readSchemaFile(path)
+}
+
+func sameTypes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func diffCollection(name string, before, after docSchema) *collectionDiff {
+	diff := &collectionDiff{Collection: name}
+	beforeFields := make(map[string]*docField, len(before))
+	for i := range before {
+		beforeFields[before[i].Name] = &before[i]
+	}
+	afterFields := make(map[string]struct{}, len(after))
+	for _, f := range after {
+		afterFields[f.Name] = struct{}{}
+		old, ok := beforeFields[f.Name]
+		if !ok {
+			diff.AddedFields = append(diff.AddedFields, f)
+			continue
+		}
+		if !sameTypes(old.fieldTypes(), f.fieldTypes()) {
+			diff.ChangedFields = append(diff.ChangedFields, fieldChange{Name: f.Name, Before: old.fieldTypes(), After: f.fieldTypes()})
+		}
+	}
+	for _, f := range before {
+		if _, ok := afterFields[f.Name]; !ok {
+			diff.RemovedFields = append(diff.RemovedFields, f)
+		}
+	}
+	if diff.AddedFields == nil && diff.RemovedFields == nil && diff.ChangedFields == nil {
+		return nil
+	}
+	return diff
+}
+
+// diffSchema compares the current schema against baseline.
+func diffSchema(baselineName string, baseline, current map[string]docSchema) *schemaDiff {
+	diff := &schemaDiff{Baseline: baselineName}
+	for name, fields := range current {
+		before, ok := baseline[name]
+		if !ok {
+			diff.AddedCollections = append(diff.AddedCollections, name)
+			continue
+		}
+		if c := diffCollection(name, before, fields); c != nil {
+			diff.Collections = append(diff.Collections, *c)
+		}
+	}
+	for name := range baseline {
+		if _, ok := current[name]; !ok {
+			diff.RemovedCollections = append(diff.RemovedCollections, name)
+		}
+	}
+	sort.Strings(diff.AddedCollections)
+	sort.Strings(diff.RemovedCollections)
+	sort.Slice(diff.Collections, func(i, j int) bool {
+		return diff.Collections[i].Collection < diff.Collections[j].Collection
+	})
+	return diff
+}
+
+// forGroup keeps the parts of the diff owned by an owner group.
+func (diff *schemaDiff) forGroup(g *ownerGroup) *schemaDiff {
+	if diff == nil {
+		return nil
+	}
+	result := &schemaDiff{Baseline: diff.Baseline}
+	for _, c := range diff.AddedCollections {
+		if g.owns(c, "") {
+			result.AddedCollections = append(result.AddedCollections, c)
+		}
+	}
+	for _, c := range diff.RemovedCollections {
+		if g.owns(c, "") {
+			result.RemovedCollections = append(result.RemovedCollections, c)
+		}
+	}
+	for _, c := range diff.Collections {
+		if g.owns(c.Collection, "") {
+			result.Collections = append(result.Collections, c)
+		}
+	}
+	return result
+}
@@ -0,0 +1,138 @@
+package extractor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// MaxPresenceShift is the change of the share of documents holding a
+	// field, e.g. from 95% to 70%, past which it drifted.
+	MaxPresenceShift = 0.2
+	// MaxDistributionShift is the total variation distance between the
+	// value distributions of a field past which it drifted: the share of
+	// values that would have to change to turn one into the other.
+	MaxDistributionShift = 0.25
+	// MaxRangeShift is how far the values of a numeric field may fall
+	// outside the baseline range, relative to its width, before it drifted.
+	MaxRangeShift = 0.5
+)
+
+var valueDriftFlag = cli.BoolFlag{
+	Name: "value-drift",
+	Usage: "Compare the value statistics of the fields with those of the -baseline, reporting significant " +
+		"shifts of how often fields are present and, with -deep on both runs, of their value distributions and " +
+		"numeric ranges as value-drift findings",
+}
+
+// presenceRate returns the share of the sampled documents of a collection
+// holding each field, counting the documents by their _id.
+func presenceRate(colSchema docSchema) map[string]float64 {
+	documents := 0
+	for _, f := range colSchema {
+		if f.Name == "_id" {
+			documents = f.Count
+		}
+	}
+	rates := make(map[string]float64, len(colSchema))
+	if documents == 0 {
+		return rates
+	}
+	for _, f := range colSchema {
+		rates[f.Name] = math.Min(float64(f.Count)/float64(documents), 1)
+	}
+	return rates
+}
+
+// distributionShift returns the total variation distance between the
+// distributions of the most common values of two profiles, the values
+// besides them counting as one. It is unknown, -1, when either profile has
+// no values.
+func distributionShift(before, after *valueSummary, beforeCount, afterCount int) float64 {
+	if len(before.Top) == 0 || len(after.Top) == 0 || beforeCount == 0 || afterCount == 0 {
+		return -1
+	}
+	shares := func(top []valueCount, count int) (map[string]float64, float64) {
+		result := make(map[string]float64, len(top))
+		rest := 1.0
+		for _, v := range top {
+			share := float64(v.Count) / float64(count)
+			result[v.Value] = share
+			rest -= share
+		}
+		return result, math.Max(rest, 0)
+	}
+	a, restA := shares(before.Top, beforeCount)
+	b, restB := shares(after.Top, afterCount)
+	distance := math.Abs(restA - restB)
+	for value, share := range a {
+		distance += math.Abs(share - b[value])
+	}
+	for value, share := range b {
+		if _, ok := a[value]; !ok {
+			distance += share
+		}
+	}
+	return distance / 2
+}
+
+// rangeShift returns how far the range of after reaches outside the one of
+// before, relative to its width, or -1 when either has no numbers.
+func rangeShift(before, after *valueSummary) float64 {
+	if before.Min == nil || before.Max == nil || after.Min == nil || after.Max == nil {
+		return -1
+	}
+	width := *before.Max - *before.Min
+	if width == 0 {
+		width = math.Max(math.Abs(*before.Max), 1)
+	}
+	outside := math.Max(*before.Min-*after.Min, 0) + math.Max(*after.Max-*before.Max, 0)
+	return outside / width
+}
+
+// reportValueDrift reports the fields of the collections both in the
+// baseline and current schemas whose values shifted significantly.
+func reportValueDrift(baseline, schema map[string]docSchema) {
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		if _, ok := baseline[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		before := make(map[string]*docField)
+		for i, f := range baseline[name] {
+			before[f.Name] = &baseline[name][i]
+		}
+		beforeRates, afterRates := presenceRate(baseline[name]), presenceRate(schema[name])
+		for _, f := range schema[name] {
+			old := before[f.Name]
+			if old == nil {
+				continue
+			}
+			drift := func(format string, args ...interface{}) {
+				addFinding(finding{Collection: name, Field: f.Name, Kind: "value-drift",
+					Message: fmt.Sprintf("%v.%v ", name, f.Name) + fmt.Sprintf(format, args...)})
+			}
+			was, is := beforeRates[f.Name], afterRates[f.Name]
+			if math.Abs(is-was) >= MaxPresenceShift {
+				drift("is present in %.0f%% of documents, %.0f%% in the baseline", 100*is, 100*was)
+			}
+			if old.Values == nil || f.Values == nil {
+				continue
+			}
+			if shift := distributionShift(old.Values, f.Values, old.Count, f.Count); shift >= MaxDistributionShift {
+				drift("changed value distribution: %.0f%% of values shifted (most common now %q, %q in the baseline)",
+					100*shift, f.Values.Top[0].Value, old.Values.Top[0].Value)
+			}
+			if shift := rangeShift(old.Values, f.Values); shift >= MaxRangeShift {
+				drift("ranges from %v to %v, from %v to %v in the baseline",
+					*f.Values.Min, *f.Values.Max, *old.Values.Min, *old.Values.Max)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package extractor
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+const (
+	// MaxPresenceDocuments is the number of sampled documents whose field
+	// presence is remembered to correlate fields.
+	MaxPresenceDocuments = 1024
+	// MinCoPresence is the share of documents with either field that must
+	// hold both for two fields to count as copies of each other.
+	MinCoPresence = 0.9
+)
+
+// duplicateSuffixes turn a name into another representation of the same
+// value, e.g. price and priceCents.
+var duplicateSuffixes = []string{
+	"cents", "ms", "millis", "sec", "secs", "seconds", "ts", "timestamp", "at", "date", "utc", "iso",
+	"str", "string", "text", "num", "number", "value", "raw", "formatted", "old", "new", "v2",
+}
+
+// presence is a bitset of the sampled documents containing a field.
+type presence []uint64
+
+func (p *presence) set(doc int) {
+	if doc < 0 || doc >= MaxPresenceDocuments {
+		return
+	}
+	for len(*p) <= doc/64 {
+		*p = append(*p, 0)
+	}
+	(*p)[doc/64] |= 1 << uint(doc%64)
+}
+
+// merge adds the documents of other, numbered from offset on.
+func (p *presence) merge(other presence, offset int) {
+	for i, word := range other {
+		for word != 0 {
+			b := bits.TrailingZeros64(word)
+			p.set(offset + i*64 + b)
+			word &= word - 1
+		}
+	}
+}
+
+// overlap returns the number of documents with both fields and with either.
+func (p presence) overlap(other presence) (both, either int) {
+	for i := 0; i < len(p) || i < len(other); i++ {
+		var a, b uint64
+		if i < len(p) {
+			a = p[i]
+		}
+		if i < len(other) {
+			b = other[i]
+		}
+		both += bits.OnesCount64(a & b)
+		either += bits.OnesCount64(a | b)
+	}
+	return both, either
+}
+
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(name))
+}
+
+// similarNames reports whether two sibling names look like representations
+// of the same value: equal up to case and separators, or one being the other
+// with a unit or format suffix.
+func similarNames(a, b string) bool {
+	na, nb := normalizeFieldName(a), normalizeFieldName(b)
+	if na == nb {
+		return true
+	}
+	if len(na) > len(nb) {
+		na, nb = nb, na
+	}
+	if len(na) < 3 || !strings.HasPrefix(nb, na) {
+		return false
+	}
+	suffix := nb[len(na):]
+	for _, s := range duplicateSuffixes {
+		if suffix == s {
+			return true
+		}
+	}
+	return false
+}
+
+// splitFieldName splits a field name into its parent path and last segment.
+func splitFieldName(name string) (string, string) {
+	if i := strings.LastIndex(name, "."); i != -1 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// reportDuplicateFields reports sibling fields whose names and presence
+// suggest they hold the same value, either copied in every document or
+// replaced by one another over time.
+func reportDuplicateFields(collection string, colSchema docSchema) {
+	siblings := make(map[string][]*docField)
+	var parents []string
+	for i := range colSchema {
+		f := &colSchema[i]
+		if isIDField(f.Name) || strings.HasSuffix(f.Name, "[]") {
+			continue
+		}
+		parent, _ := splitFieldName(f.Name)
+		if _, ok := siblings[parent]; !ok {
+			parents = append(parents, parent)
+		}
+		siblings[parent] = append(siblings[parent], f)
+	}
+	for _, parent := range parents {
+		fields := siblings[parent]
+		for i, a := range fields {
+			for _, b := range fields[i+1:] {
+				_, nameA := splitFieldName(a.Name)
+				_, nameB := splitFieldName(b.Name)
+				if !similarNames(nameA, nameB) || a.presence == nil || b.presence == nil {
+					continue
+				}
+				both, either := a.presence.overlap(b.presence)
+				var relation string
+				switch {
+				case either == 0:
+					continue
+				case float64(both)/float64(either) >= MinCoPresence:
+					if both, either = publishedCount(both), publishedCount(either); both > either {
+						both = either
+					}
+					relation = fmt.Sprintf("present together in %v of %v documents", both, either)
+				case both == 0:
+					relation = "never present together, as after a migration"
+				default:
+					continue
+				}
+				addFinding(finding{
+					Collection: collection,
+					Field:      b.Name,
+					Kind:       "duplicate-field",
+					Message: fmt.Sprintf("%v.%v (%v) and %v (%v) look like the same value, %v; consider keeping one",
+						collection, a.Name, strings.Join(a.fieldTypes(), "|"), b.Name, strings.Join(b.fieldTypes(), "|"), relation),
+				})
+			}
+		}
+	}
+}
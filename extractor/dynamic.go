@@ -0,0 +1,118 @@
+package extractor
+
+import (
+	"fmt"
+	"path"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// DefaultDynamicKeyLimit is the number of keys of a dynamic document
+// enumerated as fields before the others are summarized.
+const DefaultDynamicKeyLimit = 50
+
+var (
+	dynamicFlag = cli.StringSliceFlag{
+		Name: "dynamic",
+		Usage: "Collection, or \"collection.field\" subdocument, whose keys are data rather than schema, e.g. a settings blob. " +
+			"Keys beyond -dynamic-key-limit are summarized in one \"*\" field with their value-type distribution. " +
+			"Glob patterns, repeatable",
+	}
+	dynamicKeyLimitFlag = cli.IntFlag{
+		Name:  "dynamic-key-limit",
+		Usage: "Number of keys of a -dynamic document enumerated as fields before the others are summarized",
+		Value: DefaultDynamicKeyLimit,
+	}
+)
+
+// dynamicPolicy selects the documents whose keys are summarized past a limit.
+type dynamicPolicy struct {
+	patterns []string
+	limit    int
+}
+
+// dynamicSchemas is the policy of the run; nil enumerates every key.
+var dynamicSchemas *dynamicPolicy
+
+func newDynamicPolicy(patterns []string, limit int) (*dynamicPolicy, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("negative key limit %d", limit)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %v", pattern, err)
+		}
+	}
+	return &dynamicPolicy{patterns: patterns, limit: limit}, nil
+}
+
+// dynamic reports whether the keys of the document at prefix, "" for the
+// top level, are dynamic.
+func (p *dynamicPolicy) dynamic(collection, prefix string) bool {
+	if p == nil {
+		return false
+	}
+	return matchAny(p.patterns, joinPath(collection, prefix))
+}
+
+// enumerate reports whether the key of the dynamic document at prefix is
+// reported as a field of its own, which holds for the first keys seen up to
+// the limit.
+func (fieldSet *fieldSet) enumerate(prefix, key string) bool {
+	keys, ok := fieldSet.keys[prefix]
+	if !ok {
+		keys = make(map[string]struct{})
+		fieldSet.keys[prefix] = keys
+	}
+	if _, ok := keys[key]; ok {
+		return true
+	}
+	if len(keys) >= dynamicSchemas.limit {
+		return false
+	}
+	keys[key] = struct{}{}
+	return true
+}
+
+// summarizeKey records a key past the limit on the "*" field of its dynamic
+// document, without descending into its value.
+func summarizeKey(prefix, key string, value interface{}, schema *docSchema, fieldSet *fieldSet) {
+	field := &docField{Name: joinPath(prefix, "*"), Type: valueType(joinPath(prefix, key), value)}
+	entry := addIfNotExists(schema, field, fieldSet)
+	if entry.keys == nil {
+		entry.keys = new(hyperLogLog)
+		entry.KeyTypes = make(map[string]int)
+	}
+	entry.keys.add(key)
+	entry.KeyTypes[field.Type]++
+}
+
+// mergeKeys adds the summarized keys of other to the field.
+func (field *docField) mergeKeys(other *docField) {
+	if other.keys == nil {
+		return
+	}
+	if field.keys == nil {
+		field.keys = new(hyperLogLog)
+		field.KeyTypes = make(map[string]int)
+	}
+	field.keys.merge(other.keys)
+	for t, n := range other.KeyTypes {
+		field.KeyTypes[t] += n
+	}
+}
+
+// summarizesKeys reports whether the field stands for the keys of a dynamic
+// document rather than for a field of its own.
+func (field docField) summarizesKeys() bool {
+	return field.KeyTypes != nil
+}
+
+// countKeys sets the estimated number of distinct keys on the "*" fields.
+func countKeys(colSchema docSchema) {
+	for i := range colSchema {
+		if f := &colSchema[i]; f.keys != nil {
+			f.Keys = f.keys.estimate()
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package extractor
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	EmptyInclude = "include"
+	EmptyOmit    = "omit"
+	EmptyError   = "error"
+)
+
+var emptyCollectionsFlag = cli.StringFlag{
+	Name:  "empty-collections",
+	Usage: "What to do with collections holding no documents: \"include\" them with no fields, \"omit\" them, or fail with \"error\"",
+	Value: EmptyInclude,
+}
+
+// applyEmptyCollectionPolicy handles collections without documents.
+// Collections that have documents but yielded no sample are always kept and
+// only warned about.
+func applyEmptyCollectionPolicy(policy string, schema map[string]docSchema, stats map[string]*collectionStats) error {
+	var empty []string
+	for name, s := range stats {
+		if s.Documents == 0 {
+			empty = append(empty, name)
+		} else if s.Sampled == 0 {
+			addWarning(name, "", "collection has %v documents but none were sampled", publishedCount(s.Documents))
+		}
+	}
+	sort.Strings(empty)
+	switch policy {
+	case EmptyOmit:
+		for _, name := range empty {
+			log.Printf("Omit empty collection %v\n", name)
+			delete(schema, name)
+			delete(stats, name)
+		}
+	case EmptyError:
+		if len(empty) > 0 {
+			return fmt.Errorf("empty collections: %v", strings.Join(empty, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Event types of the -events stream.
+const (
+	EventRunStarted         = "run-started"
+	EventCollectionStarted  = "collection-started"
+	EventFieldDiscovered    = "field-discovered"
+	EventCollectionFinished = "collection-finished"
+	EventWarning            = "warning"
+	EventFinding            = "finding"
+	EventRunFinished        = "run-finished"
+)
+
+var eventsFlag = cli.StringFlag{
+	Name: "events",
+	Usage: "Stream progress events as NDJSON while the run proceeds: \"-\" for stdout, \"fd:3\" for an open file " +
+		"descriptor, or a file path. Events are run-started, collection-started, field-discovered, " +
+		"collection-finished, warning, finding and run-finished",
+}
+
+// event is one line of the -events stream. Fields not relevant to the event
+// type are left out.
+type event struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Database   string    `json:"database,omitempty"`
+	Collection string    `json:"collection,omitempty"`
+	Field      string    `json:"field,omitempty"`
+	FieldType  string    `json:"fieldType,omitempty"`
+	Kind       string    `json:"kind,omitempty"`
+	Documents  int       `json:"documents,omitempty"`
+	Sampled    int       `json:"sampled,omitempty"`
+	Fields     int       `json:"fields,omitempty"`
+	Seconds    float64   `json:"seconds,omitempty"`
+	Message    string    `json:"message,omitempty"`
+}
+
+// eventWriter writes events as they happen; it is safe for concurrent use.
+type eventWriter struct {
+	lock     sync.Mutex
+	out      io.WriteCloser
+	encoder  *json.Encoder
+	database string
+}
+
+// eventStream is the -events destination, nil when events are not streamed.
+var eventStream *eventWriter
+
+func openEventStream(target string) (*eventWriter, error) {
+	var out io.WriteCloser
+	switch {
+	case target == "-":
+		out = os.Stdout
+	case strings.HasPrefix(target, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(target, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid file descriptor %q", target)
+		}
+		out = os.NewFile(uintptr(fd), target)
+	default:
+		f, err := os.Create(target)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	return &eventWriter{out: out, encoder: json.NewEncoder(out)}, nil
+}
+
+// emitEvent writes e to the event stream, if any, stamping time and
+// database, and records it in the -summary-file.
+func emitEvent(e event) {
+	runSummary.record(e)
+	w := eventStream
+	if w == nil {
+		return
+	}
+	e.Time = time.Now()
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if e.Database == "" {
+		e.Database = w.database
+	}
+	// A consumer going away must not fail the extraction.
+	w.encoder.Encode(e)
+}
+
+func (w *eventWriter) close() error {
+	if w.out == os.Stdout {
+		return nil
+	}
+	return w.out.Close()
+}
@@ -0,0 +1,131 @@
+package extractor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var excludeIDsFlag = cli.StringFlag{
+	Name: "exclude-ids",
+	Usage: "File of _id values never to sample, e.g. known corrupted documents, one per line: an extended JSON value " +
+		"such as {\"$oid\": \"...\"} or 42, a bare ObjectId hex or string, optionally after \"collection<TAB>\". " +
+		"Lines starting with # are comments",
+}
+
+// excludedIDs are the _id values kept out of sampling, for every collection
+// and per collection.
+type excludedIDs struct {
+	all          []interface{}
+	byCollection map[string][]interface{}
+}
+
+// parseID reads an _id as an ObjectId for 24 hex digits, as extended JSON
+// when valid JSON and as a string otherwise.
+func parseID(text string) interface{} {
+	if bson.IsObjectIdHex(text) {
+		return bson.ObjectIdHex(text)
+	}
+	var value interface{}
+	if json.Valid([]byte(text)) && bson.UnmarshalJSON([]byte(text), &value) == nil {
+		return value
+	}
+	return text
+}
+
+func loadExcludedIDs(path string) (*excludedIDs, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ids := &excludedIDs{byCollection: make(map[string][]interface{})}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, "\t"); i != -1 {
+			collection := strings.TrimSpace(line[:i])
+			ids.byCollection[collection] = append(ids.byCollection[collection], parseID(strings.TrimSpace(line[i+1:])))
+		} else {
+			ids.all = append(ids.all, parseID(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return ids, nil
+}
+
+func (ids *excludedIDs) forCollection(collection string) []interface{} {
+	if ids == nil {
+		return nil
+	}
+	return append(append([]interface{}{}, ids.all...), ids.byCollection[collection]...)
+}
+
+// excluding returns the query with the documents of ids left out by the
+// server, and by the reader for queries the server cannot filter by _id.
+func (q sampleQuery) excluding(ids []interface{}) sampleQuery {
+	if len(ids) == 0 {
+		return q
+	}
+	q.skip = make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		q.skip[valueKey(id)] = struct{}{}
+	}
+	if q.Database != "" {
+		// Redirected reads, such as of the oplog, have other _ids.
+		return q
+	}
+	nin := bson.M{"_id": bson.M{"$nin": ids}}
+	switch {
+	case q.Pipeline != nil:
+		// After $sample, so that it still picks documents at random.
+		q.Pipeline = append(append([]bson.M{}, q.Pipeline...), bson.M{"$match": nin})
+	case len(q.Filter) == 0:
+		q.Filter = nin
+	default:
+		q.Filter = bson.M{"$and": []bson.M{q.Filter, nin}}
+	}
+	return q
+}
+
+// skips reports whether the reader must drop the document.
+func (q sampleQuery) skips(doc bson.D) bool {
+	if len(q.skip) == 0 {
+		return false
+	}
+	id := documentID(doc)
+	if id == nil {
+		return false
+	}
+	_, ok := q.skip[valueKey(id)]
+	return ok
+}
+
+// countExcluded returns how many of the excluded documents the collection
+// holds, all of which sampling skipped.
+func countExcluded(c *mgo.Collection, ids []interface{}) int {
+	if len(ids) == 0 {
+		return 0
+	}
+	n, err := c.Find(bson.M{"_id": bson.M{"$in": ids}}).Count()
+	if err != nil {
+		log.Printf("Failed to count excluded documents of %v: %v\n", c.Name, err)
+		return 0
+	}
+	if n > 0 {
+		log.Printf("Skipped %d excluded documents of %v\n", n, c.Name)
+	}
+	return n
+}
@@ -0,0 +1,165 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Statuses of the -summary-file and of its collections.
+const (
+	SummaryOK      = "ok"
+	SummaryFailed  = "failed"
+	SummaryRunning = "running"
+	// SummaryIncomplete is the status of a run that ended without
+	// finishing, as on fatal errors; its exit reason is the last message it
+	// logged.
+	SummaryIncomplete = "incomplete"
+)
+
+var summaryFileFlag = cli.StringFlag{
+	Name: "summary-file",
+	Usage: "Write a JSON summary of the run to this file: its status and exit reason, the status and counts of " +
+		"each collection, and the warnings. It is kept up to date while the run proceeds, so it also describes " +
+		"runs that fail",
+}
+
+// exitSummary is the content of the -summary-file.
+type exitSummary struct {
+	Database    string                        `json:"database,omitempty"`
+	Status      string                        `json:"status"`
+	ExitReason  string                        `json:"exitReason,omitempty"`
+	StartedAt   time.Time                     `json:"startedAt"`
+	Seconds     float64                       `json:"seconds"`
+	Collections map[string]*collectionSummary `json:"collections"`
+	Fields      int                           `json:"fields"`
+	Findings    int                           `json:"findings"`
+	Warnings    []warning                     `json:"warnings"`
+	Resources   *resourceUsage                `json:"resources,omitempty"`
+}
+
+type collectionSummary struct {
+	Status    string  `json:"status"`
+	Documents int     `json:"documents"`
+	Sampled   int     `json:"sampled"`
+	Fields    int     `json:"fields"`
+	Seconds   float64 `json:"seconds"`
+}
+
+// summaryWriter keeps the -summary-file up to date from the events of the
+// run and the messages it logs; it is safe for concurrent use.
+type summaryWriter struct {
+	lock    sync.Mutex
+	path    string
+	summary exitSummary
+}
+
+// runSummary is the -summary-file writer, nil without one.
+var runSummary *summaryWriter
+
+// logPrefix is the date and time the standard logger starts messages with.
+var logPrefix = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `)
+
+func newSummaryWriter(path string) *summaryWriter {
+	return &summaryWriter{path: path, summary: exitSummary{
+		Status:      SummaryIncomplete,
+		StartedAt:   time.Now().UTC(),
+		Collections: make(map[string]*collectionSummary),
+		Warnings:    []warning{},
+	}}
+}
+
+// save writes the summary; the lock must be held. A run must not fail for
+// its summary, so errors are dropped.
+func (w *summaryWriter) save() {
+	w.summary.Seconds = time.Since(w.summary.StartedAt).Seconds()
+	data, err := json.MarshalIndent(&w.summary, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp := w.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err == nil {
+		os.Rename(tmp, w.path)
+	}
+}
+
+// record updates the summary with an event of the run.
+func (w *summaryWriter) record(e event) {
+	if w == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	s := &w.summary
+	switch e.Type {
+	case EventCollectionStarted:
+		s.Collections[e.Collection] = &collectionSummary{Status: SummaryRunning}
+	case EventCollectionFinished:
+		s.Collections[e.Collection] = &collectionSummary{
+			Status:    SummaryOK,
+			Documents: e.Documents,
+			Sampled:   e.Sampled,
+			Fields:    e.Fields,
+			Seconds:   e.Seconds,
+		}
+		s.Fields += e.Fields
+	case EventWarning:
+		s.Warnings = append(s.Warnings, warning{Collection: e.Collection, Field: e.Field, Message: e.Message})
+	case EventFinding:
+		s.Findings++
+		return
+	case EventFieldDiscovered:
+		return
+	}
+	w.save()
+}
+
+// Write takes the log output, keeping the last message as the exit reason
+// of a run ending without finishing.
+func (w *summaryWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.summary.Status == SummaryIncomplete {
+		w.summary.ExitReason = strings.TrimSpace(logPrefix.ReplaceAllString(string(p), ""))
+		w.save()
+	}
+	return len(p), nil
+}
+
+func (w *summaryWriter) setDatabase(database string) {
+	if w == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.summary.Database = database
+	w.save()
+}
+
+// finish records how the run ended. Collections still running failed with
+// it.
+func (w *summaryWriter) finish(err error) {
+	if w == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	s := &w.summary
+	s.Status, s.ExitReason = SummaryOK, ""
+	if err != nil {
+		s.Status, s.ExitReason = SummaryFailed, err.Error()
+	}
+	for _, c := range s.Collections {
+		if c.Status == SummaryRunning {
+			c.Status = SummaryFailed
+		}
+	}
+	s.Resources = currentResourceUsage()
+	w.save()
+}
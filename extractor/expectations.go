@@ -0,0 +1,269 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Formats of the -expectations output.
+const (
+	GreatExpectationsFormat = "great-expectations"
+	SodaFormat              = "soda"
+)
+
+const (
+	// GreatExpectationsVersion is the Great Expectations release whose suite
+	// format is written.
+	GreatExpectationsVersion = "0.18.8"
+	// MinEnumOccurrences is the average number of times each value of a
+	// string field must have been sampled for its values to be expected as a
+	// closed set, so that unique values do not make an enum.
+	MinEnumOccurrences = 3
+)
+
+var (
+	expectationsFlag = cli.StringFlag{
+		Name: "expectations",
+		Usage: "Write data-quality expectations inferred from the schema and -deep profile: types, required fields, " +
+			"ranges and enums. The path may use the -output template variables; Great Expectations suites need {{.Collection}}",
+	}
+	expectationsFormatFlag = cli.StringFlag{
+		Name:  "expectations-format",
+		Usage: "Format of the -expectations output: \"great-expectations\" suite JSON or \"soda\" checks YAML",
+		Value: GreatExpectationsFormat,
+	}
+)
+
+// pythonTypes are the types the values of a field are read as in Python,
+// which Great Expectations checks against.
+var pythonTypes = map[string]string{
+	"OBJECTID": "ObjectId",
+	"STRING":   "str",
+	"INTEGER":  "int",
+	"DECIMAL":  "float",
+	"BOOL":     "bool",
+	"TIME":     "datetime",
+	"BINARY":   "bytes",
+	"ARRAY":    "list",
+	"DOCUMENT": "dict",
+}
+
+// expectation is a data-quality rule inferred for a field. Only the members
+// of its kind are set.
+type expectation struct {
+	Kind   string // "type", "not-null", "between" or "in-set"
+	Field  string
+	Types  []string
+	Min    *float64
+	Max    *float64
+	Values []string
+}
+
+// inferExpectations derives the rules the sampled documents of a collection
+// satisfy. stats may be nil for collections kept from a merged schema, which
+// leaves out required fields.
+func inferExpectations(collection string, colSchema docSchema, stats *collectionStats) []expectation {
+	var result []expectation
+	for _, f := range colSchema {
+		// Array elements and summarized keys are not columns.
+		if strings.Contains(f.Name, "[]") || f.summarizesKeys() {
+			continue
+		}
+		var types []string
+		nullable := false
+		for _, t := range f.fieldTypes() {
+			if pt, ok := pythonTypes[baseType(t)]; ok {
+				types = appendIfMissing(types, pt)
+			}
+			// Nulls are typed UNKNOWN, and count as present.
+			nullable = nullable || baseType(t) == "UNKNOWN"
+		}
+		if len(types) > 0 {
+			result = append(result, expectation{Kind: "type", Field: f.Name, Types: types})
+		}
+		if stats != nil && stats.Sampled > 0 && f.Count == stats.Sampled && !nullable {
+			result = append(result, expectation{Kind: "not-null", Field: f.Name})
+		}
+		if f.Values == nil {
+			continue
+		}
+		if f.Values.Min != nil && f.Values.Max != nil {
+			result = append(result, expectation{Kind: "between", Field: f.Name, Min: f.Values.Min, Max: f.Values.Max})
+		}
+		if values := enumValues(collection, f); values != nil {
+			result = append(result, expectation{Kind: "in-set", Field: f.Name, Values: values})
+		}
+	}
+	return result
+}
+
+// enumValues returns the closed set of values of a string field, or nil when
+// the profile does not hold all of them, they are not repeated enough, or
+// they were anonymized.
+func enumValues(collection string, f docField) []string {
+	v := f.Values
+	if f.Type != "STRING" || v.Approximate || v.Distinct == 0 || len(v.Top) != v.Distinct {
+		return nil
+	}
+	if valueAnonymizer != nil && valueAnonymizer.profile(collection, f.Name).Method != AnonymizeKeep {
+		return nil
+	}
+	total := 0
+	values := make([]string, 0, len(v.Top))
+	for _, top := range v.Top {
+		total += top.Count
+		values = append(values, top.Value)
+	}
+	if total < MinEnumOccurrences*v.Distinct {
+		return nil
+	}
+	sort.Strings(values)
+	return values
+}
+
+func appendIfMissing(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// geExpectation is an expectation of a Great Expectations suite.
+type geExpectation struct {
+	Type   string                 `json:"expectation_type"`
+	Kwargs map[string]interface{} `json:"kwargs"`
+	Meta   map[string]interface{} `json:"meta"`
+}
+
+type geSuite struct {
+	Name         string                 `json:"expectation_suite_name"`
+	Expectations []geExpectation        `json:"expectations"`
+	Meta         map[string]interface{} `json:"meta"`
+}
+
+func greatExpectationsSuite(database, collection string, expectations []expectation) geSuite {
+	suite := geSuite{
+		Name:         database + "." + collection,
+		Expectations: []geExpectation{},
+		Meta: map[string]interface{}{
+			"great_expectations_version": GreatExpectationsVersion,
+			"generated_by":               "extract_mgo",
+		},
+	}
+	for _, e := range expectations {
+		kwargs := map[string]interface{}{"column": e.Field}
+		var kind string
+		switch e.Kind {
+		case "type":
+			if len(e.Types) == 1 {
+				kind = "expect_column_values_to_be_of_type"
+				kwargs["type_"] = e.Types[0]
+			} else {
+				kind = "expect_column_values_to_be_in_type_list"
+				kwargs["type_list"] = e.Types
+			}
+		case "not-null":
+			kind = "expect_column_values_to_not_be_null"
+		case "between":
+			kind = "expect_column_values_to_be_between"
+			kwargs["min_value"], kwargs["max_value"] = *e.Min, *e.Max
+		case "in-set":
+			kind = "expect_column_values_to_be_in_set"
+			kwargs["value_set"] = e.Values
+		}
+		suite.Expectations = append(suite.Expectations, geExpectation{Type: kind, Kwargs: kwargs, Meta: map[string]interface{}{}})
+	}
+	return suite
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// sodaChecks returns the SodaCL checks of a collection. Soda checks column
+// types against warehouse types, so types are left out.
+func sodaChecks(collection string, expectations []expectation) yaml.MapItem {
+	checks := []interface{}{}
+	for _, e := range expectations {
+		switch e.Kind {
+		case "not-null":
+			checks = append(checks, "missing_count("+e.Field+") = 0")
+		case "between":
+			checks = append(checks, "min("+e.Field+") >= "+formatNumber(*e.Min), "max("+e.Field+") <= "+formatNumber(*e.Max))
+		case "in-set":
+			checks = append(checks, yaml.MapSlice{{
+				Key:   "invalid_count(" + e.Field + ") = 0",
+				Value: yaml.MapSlice{{Key: "valid values", Value: e.Values}},
+			}})
+		}
+	}
+	return yaml.MapItem{Key: "checks for " + collection, Value: checks}
+}
+
+// exportExpectations writes the expectations of every collection to the
+// -expectations path, one file per collection when it names the collection.
+func exportExpectations(cmdInfo *commandInfo, schema map[string]docSchema, stats map[string]*collectionStats) error {
+	expectationsPath, err := parseOutputPath(cmdInfo.expectations)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make(map[string][]string)
+	var paths []string
+	for _, name := range names {
+		collection := ""
+		if expectationsPath.perCollection {
+			collection = name
+		}
+		path, err := expectationsPath.expand(cmdInfo.dbName, collection, cmdInfo.expectationsFormat)
+		if err != nil {
+			return err
+		}
+		if _, ok := files[path]; !ok {
+			paths = append(paths, path)
+		}
+		files[path] = append(files[path], name)
+	}
+	for _, path := range paths {
+		var data []byte
+		if cmdInfo.expectationsFormat == SodaFormat {
+			var checks yaml.MapSlice
+			for _, name := range files[path] {
+				checks = append(checks, sodaChecks(name, inferExpectations(name, schema[name], stats[name])))
+			}
+			data, err = yaml.Marshal(checks)
+		} else {
+			// Great Expectations suites hold one data asset each, which the
+			// path template guarantees.
+			name := files[path][0]
+			suite := greatExpectationsSuite(cmdInfo.dbName, name, inferExpectations(name, schema[name], stats[name]))
+			data, err = json.MarshalIndent(suite, "", "  ")
+		}
+		if err != nil {
+			return err
+		}
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
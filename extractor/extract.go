@@ -0,0 +1,61 @@
+// Package extractor is extract_mgo as a library. Programs embedding it
+// register their own types with mgoschema.RegisterTypeHook and then extract
+// schemas with Extract, or run the whole command line with Run.
+package extractor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/emmansun/extract-mgo-schema/mgoschema"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// extractLock serializes Extract calls, whose runs keep their state in
+// package variables.
+var extractLock sync.Mutex
+
+// Extract samples the database of url as "extract_mgo -format json" does and
+// returns its schema. flags are further command line flags other than
+// -database, -format and -output, e.g. "-collections", "orders",
+// "-sample-strategy", "random". Calls run one at a time.
+func Extract(url string, flags ...string) (*mgoschema.Schema, error) {
+	extractLock.Lock()
+	defer extractLock.Unlock()
+	resetRun()
+	dir, err := ioutil.TempDir("", "extract_mgo")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "schema.json")
+	args := append([]string{"extract_mgo", "-database", url, "-format", JSONFormat, "-output", output}, flags...)
+	app := newApp()
+	app.Action = func(ctx *cli.Context) error {
+		err := extractSchema(ctx)
+		if exitErr, ok := err.(cli.ExitCoder); ok {
+			// app.Run would exit the embedding program.
+			return errors.New(exitErr.Error())
+		}
+		return err
+	}
+	if err := app.Run(args); err != nil {
+		return nil, err
+	}
+	return mgoschema.ReadFile(output)
+}
+
+// resetRun forgets what an earlier run of the process left behind.
+func resetRun() {
+	findingsLock.Lock()
+	findings, warnings = nil, nil
+	findingsLock.Unlock()
+	valueAnonymizer, valueProfiling, dynamicSchemas = nil, nil, nil
+	eventStream, runSummary, liveTail = nil, nil, nil
+	atomic.StoreInt64(&serverBytesRead, 0)
+	atomic.StoreUint64(&peakMemoryBytes, 0)
+}
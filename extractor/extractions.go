@@ -0,0 +1,332 @@
+package extractor
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// ExtractionHistory is the number of finished extractions serve keeps
+	// the status of.
+	ExtractionHistory = 100
+	// ExtractionRetryAfter is the number of seconds clients are told to wait
+	// when the queue is full.
+	ExtractionRetryAfter = 30
+)
+
+var queueSizeFlag = cli.IntFlag{
+	Name:  "queue-size",
+	Usage: "Number of on-demand extractions serve -jobs queues before refusing more with 429 Too Many Requests",
+	Value: 100,
+}
+
+// extraction is an on-demand extraction of a database of a job, or of one
+// of its collections.
+type extraction struct {
+	ID         string `json:"id"`
+	Job        string `json:"job"`
+	Database   string `json:"database"`
+	Collection string `json:"collection,omitempty"`
+	// RequestedBy is the approver whose token queued the extraction.
+	RequestedBy string `json:"requestedBy"`
+	// Status is "queued", "running", "ok" or "failed".
+	Status string `json:"status"`
+	// Position is the place of a queued extraction in the queue, from 1.
+	Position   int        `json:"position,omitempty"`
+	QueuedAt   time.Time  `json:"queuedAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Seconds    float64    `json:"seconds,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	seq int
+	run *jobRun
+}
+
+// key identifies the extractions doing the same work.
+func (e *extraction) key() string {
+	return e.database() + "\x00" + e.Collection
+}
+
+// database identifies the extractions writing the outputs of a database of
+// a job.
+func (e *extraction) database() string {
+	return e.Job + "\x00" + e.Database
+}
+
+// extractionQueue runs the extractions requested from serve, parallel at a
+// time, each in its own process as the run command does. A request for an
+// extraction already queued or running gets that one, and requests beyond
+// the size of the queue are refused. Extractions of the same database of a
+// job run one after the other, as they may write the same files: a worker
+// takes the oldest queued extraction whose database is not being extracted,
+// so that a burst of requests for one database leaves the others running.
+type extractionQueue struct {
+	jobs       map[string]*job
+	executable string
+	size       int
+	outputLock sync.Mutex
+	// requesterOf returns the approver whose token a request bears, or "".
+	requesterOf func(r *http.Request) string
+
+	lock sync.Mutex
+	// ready is signalled when an extraction is queued or a database freed.
+	ready *sync.Cond
+	// queued are the extractions waiting for a worker, oldest first, and
+	// running the databases being extracted.
+	queued  []*extraction
+	running map[string]bool
+	nextID  int
+	// active are the queued and running extractions by key, all every known
+	// extraction by id, and finished the ids of the finished ones, oldest
+	// first.
+	active   map[string]*extraction
+	all      map[string]*extraction
+	finished []string
+}
+
+func newExtractionQueue(jobs *jobsFile, parallel, size int) (*extractionQueue, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	if size < 1 {
+		size = 1
+	}
+	q := &extractionQueue{
+		jobs:       make(map[string]*job),
+		executable: executable,
+		size:       size,
+		running:    make(map[string]bool),
+		active:     make(map[string]*extraction),
+		all:        make(map[string]*extraction),
+	}
+	q.ready = sync.NewCond(&q.lock)
+	for i := range jobs.Jobs {
+		j := &jobs.Jobs[i]
+		if j.Name == "" {
+			j.Name = fmt.Sprintf("job%d", i+1)
+		}
+		if _, err := j.runs(); err != nil {
+			return nil, fmt.Errorf("job %v: %v", j.Name, err)
+		}
+		q.jobs[j.Name] = j
+	}
+	for i := 0; i < parallel; i++ {
+		go q.work()
+	}
+	return q, nil
+}
+
+// globEscape escapes the glob metacharacters of a collection name, so that
+// -collections matches that collection only.
+var globEscape = strings.NewReplacer("*", `\*`, "?", `\?`, "[", `\[`)
+
+// collectionOutput returns the output of a job limited to a collection: the
+// output of the job when it names {{.Collection}}, and otherwise the output
+// with the collection before its extension, e.g. "out/{{.Database}}.orders.json"
+// for "out/{{.Database}}.json".
+func collectionOutput(output, collection string) string {
+	if strings.Contains(output, ".Collection") {
+		return output
+	}
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + ".{{" + strconv.Quote(collection) + "}}" + ext
+}
+
+// newRun returns the run extracting a database of a job, or nil when the
+// job has no such database. Limited to a collection, the run only writes
+// its schema, to its own file, so that neither the schema of the database
+// nor its newest report are replaced by those of one collection.
+func (q *extractionQueue) newRun(jobName, database, collection string) (*jobRun, error) {
+	j, ok := q.jobs[jobName]
+	if !ok {
+		return nil, nil
+	}
+	if collection != "" {
+		limited := *j
+		limited.Collections = []string{globEscape.Replace(collection)}
+		limited.ExcludeCollections = nil
+		limited.Output = collectionOutput(j.Output, collection)
+		limited.Report, limited.Findings = "", ""
+		j = &limited
+	}
+	runs, err := j.runs()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range runs {
+		if r.Database == database {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// enqueue queues an extraction, returning the one already queued or running
+// for the same work instead, if any, and nil when the queue is full.
+func (q *extractionQueue) enqueue(run *jobRun, collection, requester string) (e *extraction, queued bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	e = &extraction{Job: run.Job, Database: run.Database, Collection: collection, RequestedBy: requester,
+		Status: "queued", QueuedAt: time.Now(), run: run}
+	if existing, ok := q.active[e.key()]; ok {
+		return existing, false
+	}
+	if len(q.queued) >= q.size {
+		return nil, false
+	}
+	q.nextID++
+	e.seq, e.ID = q.nextID, strconv.Itoa(q.nextID)
+	q.queued = append(q.queued, e)
+	q.active[e.key()] = e
+	q.all[e.ID] = e
+	q.ready.Broadcast()
+	return e, true
+}
+
+// next waits for the oldest queued extraction whose database is free and
+// marks it running. The lock must be held.
+func (q *extractionQueue) next() *extraction {
+	for {
+		for i, e := range q.queued {
+			if !q.running[e.database()] {
+				q.queued = append(q.queued[:i], q.queued[i+1:]...)
+				q.running[e.database()] = true
+				started := time.Now()
+				e.Status, e.StartedAt = "running", &started
+				return e
+			}
+		}
+		q.ready.Wait()
+	}
+}
+
+func (q *extractionQueue) work() {
+	for {
+		q.lock.Lock()
+		e := q.next()
+		q.lock.Unlock()
+
+		e.run.execute(q.executable, &q.outputLock)
+
+		q.lock.Lock()
+		finished := time.Now()
+		e.Status, e.FinishedAt = e.run.Status, &finished
+		e.Seconds, e.Error = e.run.Seconds, e.run.Error
+		delete(q.running, e.database())
+		delete(q.active, e.key())
+		q.finished = append(q.finished, e.ID)
+		if len(q.finished) > ExtractionHistory {
+			delete(q.all, q.finished[0])
+			q.finished = q.finished[1:]
+		}
+		q.ready.Broadcast()
+		q.lock.Unlock()
+	}
+}
+
+// snapshot copies an extraction for serving, with its place in the queue.
+// The lock must be held.
+func (q *extractionQueue) snapshot(e *extraction) *extraction {
+	copied := *e
+	if e.Status == "queued" {
+		for _, other := range q.active {
+			if other.Status == "queued" && other.seq < e.seq {
+				copied.Position++
+			}
+		}
+		copied.Position++
+	}
+	return &copied
+}
+
+// handleExtract queues the extraction of POST
+// /api/extract/<job>/<database>[/<collection>] by an approver of -approvers.
+func (q *extractionQueue) handleExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "extractions must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	requester := q.requesterOf(r)
+	if requester == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="extractions"`)
+		http.Error(w, "the token of an approver is mandatory", http.StatusUnauthorized)
+		return
+	}
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/extract"), "/"), "/", 3)
+	if len(parts) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+	collection := ""
+	if len(parts) == 3 {
+		collection = parts[2]
+		if collection == "" || strings.ContainsAny(collection, "/\\") {
+			http.Error(w, "invalid collection name", http.StatusBadRequest)
+			return
+		}
+	}
+	run, err := q.newRun(parts[0], parts[1], collection)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if run == nil {
+		http.NotFound(w, r)
+		return
+	}
+	e, queued := q.enqueue(run, collection, requester)
+	if e == nil {
+		w.Header().Set("Retry-After", strconv.Itoa(ExtractionRetryAfter))
+		http.Error(w, "the extraction queue is full", http.StatusTooManyRequests)
+		return
+	}
+	q.lock.Lock()
+	e = q.snapshot(e)
+	q.lock.Unlock()
+	w.Header().Set("Location", "/api/extractions/"+e.ID)
+	if queued {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusAccepted)
+	}
+	writeJSON(w, e)
+}
+
+// handleExtractions serves the status of an extraction at
+// /api/extractions/<id>, or lists the queued, running and finished ones at
+// /api/extractions, newest first.
+func (q *extractionQueue) handleExtractions(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/extractions"), "/")
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if id != "" {
+		e, ok := q.all[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, q.snapshot(e))
+		return
+	}
+	list := make([]*extraction, 0, len(q.all))
+	for _, e := range q.all {
+		list = append(list, q.snapshot(e))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].seq > list[j].seq })
+	writeJSON(w, list)
+}
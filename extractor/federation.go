@@ -0,0 +1,171 @@
+package extractor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var federationFlag = cli.StringFlag{
+	Name:  "federation",
+	Usage: "Atlas Data Federation / Online Archive connection string. The schemas stored there (sqlGetSchema) are diffed against the extraction",
+}
+
+// jsonSchemaTypes maps the bsonType names of a $jsonSchema to our types.
+var jsonSchemaTypes = map[string]string{
+	"string":     "STRING",
+	"int":        "INTEGER",
+	"long":       "INTEGER",
+	"double":     "DECIMAL",
+	"decimal":    "DECIMAL",
+	"bool":       "BOOL",
+	"date":       "TIME",
+	"timestamp":  "TIME",
+	"objectId":   "OBJECTID",
+	"binData":    "BINARY",
+	"array":      "ARRAY",
+	"javascript": "UNKNOWN",
+	"regex":      "UNKNOWN",
+}
+
+// bsonTypesOf lists the bsonType names allowed by a $jsonSchema node,
+// including those of anyOf alternatives.
+func bsonTypesOf(node bson.M) []string {
+	var types []string
+	switch t := node["bsonType"].(type) {
+	case string:
+		types = append(types, t)
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	if anyOf, ok := node["anyOf"].([]interface{}); ok {
+		for _, alt := range anyOf {
+			if m, ok := alt.(bson.M); ok {
+				types = append(types, bsonTypesOf(m)...)
+			}
+		}
+	}
+	return types
+}
+
+// jsonSchemaFields flattens a $jsonSchema node into schema fields named the
+// same way getSchema names them.
+func jsonSchemaFields(name string, node bson.M, colSchema *docSchema) {
+	var types []string
+	for _, bsonType := range bsonTypesOf(node) {
+		switch bsonType {
+		case "object":
+			if name == "_id" {
+				types = append(types, "DOCUMENT")
+			}
+			if properties, ok := node["properties"].(bson.M); ok {
+				keys := make([]string, 0, len(properties))
+				for key := range properties {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					child, ok := properties[key].(bson.M)
+					if !ok {
+						continue
+					}
+					childName := key
+					if name != "" {
+						childName = name + "." + key
+					}
+					jsonSchemaFields(childName, child, colSchema)
+				}
+			}
+		case "array":
+			types = append(types, "ARRAY")
+			if items, ok := node["items"].(bson.M); ok {
+				jsonSchemaFields(name+"[]", items, colSchema)
+			}
+		case "null":
+		default:
+			if t, ok := jsonSchemaTypes[bsonType]; ok {
+				types = append(types, t)
+			} else {
+				types = append(types, "UNKNOWN")
+			}
+		}
+	}
+	if name == "" || len(types) == 0 {
+		return
+	}
+	field := docField{Name: name, Type: types[0]}
+	for _, t := range types[1:] {
+		field.addType(t)
+	}
+	*colSchema = append(*colSchema, field)
+}
+
+// baseTypeSchema drops subtypes, which a federated schema cannot express.
+func baseTypeSchema(colSchema docSchema) docSchema {
+	result := make(docSchema, 0, len(colSchema))
+	for _, f := range colSchema {
+		field := docField{Name: f.Name, Type: baseType(f.Type)}
+		for _, t := range f.fieldTypes() {
+			field.addType(baseType(t))
+		}
+		result = append(result, field)
+	}
+	return result
+}
+
+// diffFederation fetches the stored schema of every extracted collection
+// from Data Federation and diffs it against the live schema.
+func diffFederation(cmdInfo *commandInfo, schema map[string]docSchema) (*schemaDiff, error) {
+	fedInfo := &commandInfo{urls: []string{cmdInfo.federation}, readOnly: cmdInfo.readOnly}
+	session, err := connect(fedInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	db := session.DB(fedInfo.dbName)
+
+	federated := make(map[string]docSchema)
+	live := make(map[string]docSchema)
+	for name, colSchema := range schema {
+		var result struct {
+			Schema struct {
+				JSONSchema bson.M `bson:"jsonSchema"`
+			} `bson:"schema"`
+		}
+		if err := db.Run(bson.D{{Name: "sqlGetSchema", Value: name}}, &result); err != nil {
+			addWarning(name, "", "sqlGetSchema failed on %v: %v", maskPassword(cmdInfo.federation), err)
+			continue
+		}
+		if result.Schema.JSONSchema == nil {
+			addWarning(name, "", "no federated schema stored")
+			continue
+		}
+		fedSchema := docSchema{}
+		jsonSchemaFields("", result.Schema.JSONSchema, &fedSchema)
+		federated[name] = fedSchema
+		live[name] = baseTypeSchema(colSchema)
+	}
+
+	diff := diffSchema(maskPassword(cmdInfo.federation), federated, live)
+	for _, c := range diff.Collections {
+		for _, f := range c.AddedFields {
+			addFinding(finding{Collection: c.Collection, Field: f.Name, Kind: "federation-drift",
+				Message: fmt.Sprintf("%v.%v is live but missing from the federated schema", c.Collection, f.Name)})
+		}
+		for _, f := range c.RemovedFields {
+			addFinding(finding{Collection: c.Collection, Field: f.Name, Kind: "federation-drift",
+				Message: fmt.Sprintf("%v.%v is federated but not observed live", c.Collection, f.Name)})
+		}
+		for _, f := range c.ChangedFields {
+			addFinding(finding{Collection: c.Collection, Field: f.Name, Kind: "federation-drift",
+				Message: fmt.Sprintf("%v.%v is %v federated but %v live", c.Collection, f.Name, f.Before, f.After)})
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,76 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var findingsFlag = cli.StringFlag{
+	Name:  "findings",
+	Usage: "Write review findings (index checks etc.) to this JSON file",
+}
+
+// finding is an observation worth a reviewer's attention, reported next to
+// the schema itself.
+type finding struct {
+	Collection string `json:"collection"`
+	Field      string `json:"field,omitempty"`
+	Kind       string `json:"kind"`
+	// Severity is set on -lint findings.
+	Severity string `json:"severity,omitempty"`
+	Message  string `json:"message"`
+}
+
+// warning is a problem met during the run that may make the schema
+// incomplete.
+type warning struct {
+	Collection string `json:"collection,omitempty"`
+	Field      string `json:"field,omitempty"`
+	Message    string `json:"message"`
+}
+
+var (
+	findingsLock sync.Mutex
+	findings     []finding
+	warnings     []warning
+)
+
+// addWarning logs the warning and keeps it for the run report. It is safe
+// for concurrent use.
+func addWarning(collection, field, format string, args ...interface{}) {
+	w := warning{Collection: collection, Field: field, Message: fmt.Sprintf(format, args...)}
+	log.Printf("Warning: %v.%v: %v\n", w.Collection, w.Field, w.Message)
+	emitEvent(event{Type: EventWarning, Collection: w.Collection, Field: w.Field, Message: w.Message})
+	findingsLock.Lock()
+	warnings = append(warnings, w)
+	findingsLock.Unlock()
+}
+
+// addFinding logs the finding and keeps it for exportFindings. It is safe
+// for concurrent use.
+func addFinding(f finding) {
+	log.Printf("%v: %v\n", f.Kind, f.Message)
+	emitEvent(event{Type: EventFinding, Collection: f.Collection, Field: f.Field, Kind: f.Kind, Message: f.Message})
+	findingsLock.Lock()
+	findings = append(findings, f)
+	findingsLock.Unlock()
+}
+
+func exportFindings(path string) error {
+	findingsLock.Lock()
+	defer findingsLock.Unlock()
+	list := findings
+	if list == nil {
+		list = []finding{}
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,294 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	inventoryFlag = cli.StringFlag{
+		Name:  "inventory",
+		Usage: "YAML file listing the clusters of the fleet and their databases",
+	}
+	fleetOutputFlag = cli.StringFlag{
+		Name:  "output",
+		Usage: "JSON file the federated catalog is written to",
+	}
+	noExtractFlag = cli.BoolFlag{
+		Name:  "no-extract",
+		Usage: "Read the schema files of the inventory as they are instead of extracting the clusters with a uri",
+	}
+
+	fleetCommand = cli.Command{
+		Name: "fleet",
+		Usage: "Extract the clusters of a fleet inventory and write a single catalog of their schemas by cluster, " +
+			"database and collection, diffing each database against the first cluster of the inventory holding it",
+		Flags:  []cli.Flag{inventoryFlag, fleetOutputFlag, parallelFlag, noExtractFlag},
+		Action: fleetCatalogAction,
+	}
+)
+
+// fleetCluster is a cluster of the inventory. Its databases are extracted
+// to the JSON schema files named by Schemas, which may use the -output
+// template variables and must name {{.Database}} when it lists several
+// databases. Clusters without a uri are only read from those files, e.g.
+// when written by a run elsewhere.
+type fleetCluster struct {
+	Name               string   `yaml:"name"`
+	URI                string   `yaml:"uri"`
+	Databases          []string `yaml:"databases"`
+	Collections        []string `yaml:"collections"`
+	ExcludeCollections []string `yaml:"excludeCollections"`
+	SampleStrategy     string   `yaml:"sampleStrategy"`
+	Schemas            string   `yaml:"schemas"`
+	// Args are further command line flags of the extractions.
+	Args []string `yaml:"args"`
+}
+
+// fleetInventory is the content of the -inventory file.
+type fleetInventory struct {
+	// Parallel is the number of extractions run at the same time, 1 by
+	// default.
+	Parallel int            `yaml:"parallel"`
+	Clusters []fleetCluster `yaml:"clusters"`
+}
+
+func loadInventory(path string) (*fleetInventory, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	inventory := new(fleetInventory)
+	if err := yaml.UnmarshalStrict(data, inventory); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, c := range inventory.Clusters {
+		switch {
+		case c.Name == "":
+			return nil, fmt.Errorf("clusters must have a name")
+		case names[c.Name]:
+			return nil, fmt.Errorf("cluster %v is listed twice", c.Name)
+		case c.Schemas == "":
+			return nil, fmt.Errorf("cluster %v: schemas is mandatory", c.Name)
+		case c.URI == "" && len(c.Databases) == 0:
+			return nil, fmt.Errorf("cluster %v: databases is mandatory without a uri", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return inventory, nil
+}
+
+// job returns the extraction of the cluster as a job of the run command.
+func (c *fleetCluster) job() *job {
+	return &job{
+		Name:               c.Name,
+		URI:                c.URI,
+		Databases:          c.Databases,
+		Collections:        c.Collections,
+		ExcludeCollections: c.ExcludeCollections,
+		SampleStrategy:     c.SampleStrategy,
+		Format:             JSONFormat,
+		Output:             c.Schemas,
+		Args:               c.Args,
+	}
+}
+
+// fleetDatabase is a database of a cluster in the catalog, or the error that
+// kept it out.
+type fleetDatabase struct {
+	Collections map[string]docSchema `json:"collections,omitempty"`
+	Error       string               `json:"error,omitempty"`
+
+	schemas string
+}
+
+// fleetVariation is how a database differs on a cluster from the same
+// database on the first cluster of the inventory holding it.
+type fleetVariation struct {
+	Database string      `json:"database"`
+	Cluster  string      `json:"cluster"`
+	Diff     *schemaDiff `json:"diff"`
+}
+
+// fleetCatalog is the federated catalog of the fleet, keyed by cluster,
+// database and collection.
+type fleetCatalog struct {
+	GeneratedAt time.Time                            `json:"generatedAt"`
+	Clusters    map[string]map[string]*fleetDatabase `json:"clusters"`
+	Variations  []fleetVariation                     `json:"variations"`
+}
+
+// differences counts the collections the diff reports.
+func (diff *schemaDiff) differences() int {
+	return len(diff.AddedCollections) + len(diff.RemovedCollections) + len(diff.Collections)
+}
+
+// sortedDatabases returns the names of the databases of a cluster in order.
+func sortedDatabases(databases map[string]*fleetDatabase) []string {
+	names := make([]string, 0, len(databases))
+	for name := range databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fleetDatabases returns the databases of each cluster with the schema file
+// they are read from. Two databases cannot share a file.
+func fleetDatabases(inventory *fleetInventory) (map[string]map[string]*fleetDatabase, error) {
+	clusters := make(map[string]map[string]*fleetDatabase)
+	owners := make(map[string]string)
+	for i := range inventory.Clusters {
+		c := &inventory.Clusters[i]
+		databases := c.Databases
+		if len(databases) == 0 {
+			runs, err := c.job().runs()
+			if err != nil {
+				return nil, fmt.Errorf("cluster %v: %v", c.Name, err)
+			}
+			databases = []string{runs[0].Database}
+		}
+		if len(databases) > 1 && !strings.Contains(c.Schemas, ".Database") {
+			return nil, fmt.Errorf("cluster %v: %v must contain {{.Database}} to hold several databases", c.Name, c.Schemas)
+		}
+		clusters[c.Name] = make(map[string]*fleetDatabase)
+		for _, database := range databases {
+			path, err := expandPath(c.Schemas, database, JSONFormat)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %v: %v", c.Name, err)
+			}
+			name := c.Name + "/" + database
+			if owner, ok := owners[path]; ok {
+				return nil, fmt.Errorf("%v is the schema file of both %v and %v", path, owner, name)
+			}
+			owners[path] = name
+			clusters[c.Name][database] = &fleetDatabase{schemas: path}
+		}
+	}
+	return clusters, nil
+}
+
+// newFleetCatalog reads the schema files of the fleet and diffs each
+// database against its first cluster in inventory order.
+func newFleetCatalog(inventory *fleetInventory, clusters map[string]map[string]*fleetDatabase) *fleetCatalog {
+	catalog := &fleetCatalog{GeneratedAt: time.Now(), Clusters: clusters, Variations: []fleetVariation{}}
+	baselines := make(map[string]string)
+	for _, c := range inventory.Clusters {
+		for _, database := range sortedDatabases(clusters[c.Name]) {
+			db := clusters[c.Name][database]
+			if db.Error != "" {
+				continue
+			}
+			schema, err := readBaseline(db.schemas)
+			if err != nil {
+				db.Error = err.Error()
+				continue
+			}
+			db.Collections = schema
+			baseline, ok := baselines[database]
+			if !ok {
+				baselines[database] = c.Name
+				continue
+			}
+			diff := diffSchema(baseline, clusters[baseline][database].Collections, schema)
+			if diff.differences() > 0 {
+				catalog.Variations = append(catalog.Variations, fleetVariation{Database: database, Cluster: c.Name, Diff: diff})
+			}
+		}
+	}
+	return catalog
+}
+
+func printFleet(out io.Writer, inventory *fleetInventory, catalog *fleetCatalog) {
+	variations := make(map[string]*schemaDiff)
+	for _, v := range catalog.Variations {
+		variations[v.Cluster+"/"+v.Database] = v.Diff
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tDATABASE\tCOLLECTIONS\tVARIATION\tERROR")
+	for _, c := range inventory.Clusters {
+		for _, database := range sortedDatabases(catalog.Clusters[c.Name]) {
+			db := catalog.Clusters[c.Name][database]
+			variation := ""
+			if diff := variations[c.Name+"/"+database]; diff != nil {
+				variation = fmt.Sprintf("%d collections differ from %v", diff.differences(), diff.Baseline)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", c.Name, database, len(db.Collections), variation, db.Error)
+		}
+	}
+	w.Flush()
+}
+
+func fleetCatalogAction(ctx *cli.Context) error {
+	for _, flag := range []string{inventoryFlag.Name, fleetOutputFlag.Name} {
+		if ctx.String(flag) == "" {
+			return cli.NewExitError(fmt.Sprintf("%s is mandatory!", flag), 1)
+		}
+	}
+	inventory, err := loadInventory(ctx.String(inventoryFlag.Name))
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Failed to load inventory: %v", err), 1)
+	}
+	clusters, err := fleetDatabases(inventory)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if !ctx.Bool(noExtractFlag.Name) {
+		var runs []*jobRun
+		for _, c := range inventory.Clusters {
+			if c.URI == "" {
+				continue
+			}
+			clusterRuns, err := c.job().runs()
+			if err != nil {
+				return cli.NewExitError(fmt.Sprintf("Cluster %v: %v", c.Name, err), 1)
+			}
+			runs = append(runs, clusterRuns...)
+		}
+		parallel := inventory.Parallel
+		if ctx.IsSet(parallelFlag.Name) {
+			parallel = ctx.Int(parallelFlag.Name)
+		}
+		if err := executeRuns(runs, parallel); err != nil {
+			return err
+		}
+		for _, r := range runs {
+			if r.Status != "ok" {
+				clusters[r.Job][r.Database].Error = r.Error
+			}
+		}
+	}
+
+	catalog := newFleetCatalog(inventory, clusters)
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(ctx.String(fleetOutputFlag.Name), data, 0644); err != nil {
+		return err
+	}
+	printFleet(os.Stdout, inventory, catalog)
+	failed := 0
+	for _, databases := range clusters {
+		for _, db := range databases {
+			if db.Error != "" {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("%v databases of the fleet are missing from the catalog", failed), 1)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// GoStructFormat writes Go struct definitions of the collections.
+const GoStructFormat = "gostruct"
+
+var goPackageFlag = cli.StringFlag{
+	Name:  "go-package",
+	Usage: "Package of the Go source written by -format gostruct",
+	Value: "models",
+}
+
+// goScalarTypes are the Go types of the base types, as decoded by mgo.
+var goScalarTypes = map[string]string{
+	"INTEGER":  "int64",
+	"DECIMAL":  "float64",
+	"STRING":   "string",
+	"BOOL":     "bool",
+	"TIME":     "time.Time",
+	"OBJECTID": "bson.ObjectId",
+	"BINARY":   "[]byte",
+}
+
+// goName turns a field or collection name into an exported Go identifier,
+// e.g. "order_lines" into "OrderLines" and "_id" into "ID".
+func goName(name string) string {
+	if name == "_id" {
+		return "ID"
+	}
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	ident := b.String()
+	if ident == "" || unicode.IsDigit([]rune(ident)[0]) {
+		ident = "F" + ident
+	}
+	return ident
+}
+
+// uniqueName returns name, or name suffixed with a number when taken, and
+// marks it taken.
+func uniqueName(taken map[string]bool, name string) string {
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%v%d", name, i)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// goStructWriter writes the structs of nested documents after the struct
+// using them.
+type goStructWriter struct {
+	source  bytes.Buffer
+	imports map[string]bool
+	types   map[string]bool
+	pending []pendingStruct
+}
+
+type pendingStruct struct {
+	name string
+	node *modelNode
+}
+
+// goType returns the Go type of the node, queuing the structs it needs
+// under names derived from name. Mixed types decode into interface{},
+// except for integers mixed with decimals.
+func (w *goStructWriter) goType(name string, n *modelNode) string {
+	if n.Numeric {
+		return "float64"
+	}
+	types := n.Types
+	if len(types) != 1 {
+		return "interface{}"
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		if n.Properties == nil {
+			if n.Rest == nil {
+				w.imports["github.com/globalsign/mgo/bson"] = true
+				return "bson.M"
+			}
+			return "map[string]" + w.goType(name+"Value", n.Rest)
+		}
+		structName := uniqueName(w.types, name)
+		w.pending = append(w.pending, pendingStruct{name: structName, node: n})
+		return structName
+	case "ARRAY":
+		if n.Items == nil {
+			return "[]interface{}"
+		}
+		return "[]" + w.goType(name+"Item", n.Items)
+	}
+	goType, ok := goScalarTypes[types[0]]
+	if !ok {
+		return "interface{}"
+	}
+	switch {
+	case strings.HasPrefix(goType, "time."):
+		w.imports["time"] = true
+	case strings.HasPrefix(goType, "bson."):
+		w.imports["github.com/globalsign/mgo/bson"] = true
+	}
+	return goType
+}
+
+// writeStruct writes the struct of a document, _id first, with optional
+// fields omitted when empty. Summarized -dynamic keys are inlined as a map.
+func (w *goStructWriter) writeStruct(s pendingStruct) {
+	fields := make(map[string]bool)
+	fmt.Fprintf(&w.source, "type %v struct {\n", s.name)
+	for _, child := range s.node.Properties {
+		fieldName := uniqueName(fields, goName(child.Name))
+		goType := w.goType(s.name+fieldName, child)
+		options := ""
+		if !child.Required {
+			options = ",omitempty"
+		}
+		fmt.Fprintf(&w.source, "\t%v %v `bson:\"%v%v\" json:\"%v%v\"`\n", fieldName, goType, child.Name, options, child.Name, options)
+	}
+	if s.node.Rest != nil {
+		fieldName := uniqueName(fields, "Extra")
+		fmt.Fprintf(&w.source, "\t%v map[string]%v `bson:\",inline\" json:\"-\"`\n", fieldName,
+			w.goType(s.name+fieldName, s.node.Rest))
+	}
+	w.source.WriteString("}\n\n")
+}
+
+// goStructs returns formatted Go source declaring a struct per collection,
+// named after the collection, and the structs of their nested documents.
+func goStructs(pkg string, m *schemaModel) ([]byte, error) {
+	w := &goStructWriter{imports: make(map[string]bool), types: make(map[string]bool)}
+	for _, c := range m.Collections {
+		name := uniqueName(w.types, goName(c.Name))
+		fmt.Fprintf(&w.source, "// %v is a document of the %v collection.\n", name, c.Name)
+		w.pending = append(w.pending, pendingStruct{name: name, node: c.Document})
+		for len(w.pending) > 0 {
+			s := w.pending[0]
+			w.pending = w.pending[1:]
+			w.writeStruct(s)
+		}
+	}
+	var source bytes.Buffer
+	source.WriteString("// Generated by extract_mgo from sampled documents.\n\n")
+	fmt.Fprintf(&source, "package %v\n\n", pkg)
+	if len(w.imports) > 0 {
+		imports := make([]string, 0, len(w.imports))
+		for path := range w.imports {
+			imports = append(imports, path)
+		}
+		// The standard library, with no dot in its paths, comes first.
+		standard := func(path string) bool { return !strings.Contains(path, ".") }
+		sort.Slice(imports, func(i, j int) bool {
+			if standard(imports[i]) != standard(imports[j]) {
+				return standard(imports[i])
+			}
+			return imports[i] < imports[j]
+		})
+		source.WriteString("import (\n")
+		for i, path := range imports {
+			if i > 0 && standard(imports[i-1]) && !standard(path) {
+				source.WriteString("\n")
+			}
+			fmt.Fprintf(&source, "\t%q\n", path)
+		}
+		source.WriteString(")\n\n")
+	}
+	source.Write(w.source.Bytes())
+	return format.Source(source.Bytes())
+}
+
+func exportGoStructs(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	source, err := goStructs(cmdInfo.goPackage, m)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, source, 0644)
+}
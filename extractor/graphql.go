@@ -0,0 +1,136 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// GraphQLFormat writes GraphQL SDL object types of the collections.
+const GraphQLFormat = "graphql"
+
+// graphQLScalarTypes are the GraphQL types of the base types. TIME is the
+// custom DateTime scalar and BINARY a base64 string, as in Extended JSON.
+var graphQLScalarTypes = map[string]string{
+	"INTEGER":  "Int",
+	"DECIMAL":  "Float",
+	"STRING":   "String",
+	"BOOL":     "Boolean",
+	"TIME":     "DateTime",
+	"OBJECTID": "ID",
+	"BINARY":   "String",
+}
+
+// graphQLCustomScalars are the scalars the types may use that GraphQL does
+// not define.
+var graphQLCustomScalars = map[string]bool{"DateTime": true, "JSON": true}
+
+// graphQLWriter writes the types of nested documents after the type using
+// them, like goStructWriter.
+type graphQLWriter struct {
+	source  bytes.Buffer
+	scalars map[string]bool
+	types   map[string]bool
+	pending []pendingStruct
+}
+
+// graphQLType returns the nullable GraphQL type of the node, queuing the
+// object types it needs under names derived from name. Mixed types,
+// -dynamic documents and documents without known fields are the custom
+// JSON scalar, except for integers mixed with decimals.
+func (w *graphQLWriter) graphQLType(name string, n *modelNode) string {
+	if n.Numeric {
+		return "Float"
+	}
+	types := n.Types
+	graphQLType := "JSON"
+	if len(types) == 1 {
+		switch types[0] {
+		case "DOCUMENT":
+			if n.Properties != nil {
+				typeName := uniqueName(w.types, name)
+				w.pending = append(w.pending, pendingStruct{name: typeName, node: n})
+				return typeName
+			}
+		case "ARRAY":
+			if n.Items == nil {
+				return "[JSON]"
+			}
+			item := w.graphQLType(name+"Item", n.Items)
+			if !containsString(n.Items.Types, "UNKNOWN") {
+				item += "!"
+			}
+			return "[" + item + "]"
+		default:
+			if t, ok := graphQLScalarTypes[types[0]]; ok {
+				graphQLType = t
+			}
+		}
+	}
+	if graphQLCustomScalars[graphQLType] {
+		w.scalars[graphQLType] = true
+	}
+	return graphQLType
+}
+
+// writeType writes the object type of a document, _id first, with the
+// fields every document holds non-null. Fields renamed to GraphQL names
+// are described by their document name.
+func (w *graphQLWriter) writeType(s pendingStruct, description string) {
+	fields := make(map[string]bool)
+	fmt.Fprintf(&w.source, "%q\ntype %v {\n", description, s.name)
+	for _, child := range s.node.Properties {
+		// Names starting with "__", such as Mongoose's __v, are reserved.
+		fieldName := plainName(child.Name)
+		if strings.HasPrefix(fieldName, "__") {
+			fieldName = "_" + strings.TrimLeft(fieldName, "_")
+		}
+		fieldName = uniqueName(fields, fieldName)
+		graphQLType := w.graphQLType(s.name+goName(child.Name), child)
+		if child.Required {
+			graphQLType += "!"
+		}
+		if fieldName != child.Name {
+			fmt.Fprintf(&w.source, "  %q\n", "Document field "+child.Name)
+		}
+		fmt.Fprintf(&w.source, "  %v: %v\n", fieldName, graphQLType)
+	}
+	w.source.WriteString("}\n\n")
+}
+
+// graphQLTypes returns GraphQL SDL declaring an object type per
+// collection, named after the collection, and the types of their nested
+// documents.
+func graphQLTypes(m *schemaModel) []byte {
+	w := &graphQLWriter{scalars: make(map[string]bool), types: make(map[string]bool)}
+	for _, c := range m.Collections {
+		name := uniqueName(w.types, goName(c.Name))
+		w.writeType(pendingStruct{name: name, node: c.Document}, "A document of the "+c.Name+" collection.")
+		for len(w.pending) > 0 {
+			s := w.pending[0]
+			w.pending = w.pending[1:]
+			w.writeType(s, "An embedded document of "+c.Name+".")
+		}
+	}
+	var source bytes.Buffer
+	source.WriteString("# Generated by extract_mgo from sampled documents.\n\n")
+	scalars := make([]string, 0, len(w.scalars))
+	for scalar := range w.scalars {
+		scalars = append(scalars, scalar)
+	}
+	sort.Strings(scalars)
+	for _, scalar := range scalars {
+		fmt.Fprintf(&source, "scalar %v\n", scalar)
+	}
+	if len(scalars) > 0 {
+		source.WriteString("\n")
+	}
+	source.Write(w.source.Bytes())
+	return source.Bytes()
+}
+
+func exportGraphQL(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, graphQLTypes(m), 0644)
+}
@@ -0,0 +1,137 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// HiveDDLFormat writes a Hive CREATE EXTERNAL TABLE statement per
+// collection, which Athena also runs, over exports landed in a data lake as
+// JSON lines.
+const HiveDDLFormat = "hive-ddl"
+
+// HiveSerDe reads the JSON lines of the exports, matching keys to columns
+// regardless of case.
+const HiveSerDe = "org.openx.data.jsonserde.JsonSerDe"
+
+var hiveLocationFlag = cli.StringFlag{
+	Name: "hive-location",
+	Usage: "Location of the exports read by the tables of -format hive-ddl, e.g. \"s3://lake/shop\". The table " +
+		"of a collection reads the directory named after it, e.g. s3://lake/shop/orders/. Athena requires it",
+}
+
+// hiveTypes are the Hive types of the base types. ObjectIds are their hex
+// strings.
+var hiveTypes = map[string]string{
+	"INTEGER":  "BIGINT",
+	"DECIMAL":  "DOUBLE",
+	"STRING":   "STRING",
+	"BOOL":     "BOOLEAN",
+	"TIME":     "TIMESTAMP",
+	"OBJECTID": "STRING",
+	"BINARY":   "BINARY",
+}
+
+// hiveIdent quotes an identifier, so that reserved words and names starting
+// with an underscore may be used.
+func hiveIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// hiveString quotes a string literal.
+func hiveString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// hiveName returns the column or struct field name of a field. Hive names
+// are lowercase and may hold neither dots nor colons.
+func hiveName(taken map[string]bool, name string) string {
+	return uniqueName(taken, strings.ToLower(plainName(name)))
+}
+
+// hiveType returns the Hive type of a node. Embedded documents with known
+// fields become structs, -dynamic documents maps, and mixed types strings;
+// integers mixed with decimals are doubles.
+func hiveType(n *modelNode) string {
+	types := n.Types
+	switch {
+	case n.Numeric:
+		return "DOUBLE"
+	case len(types) != 1:
+		return "STRING"
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		switch {
+		case len(n.Properties) > 0:
+			taken := make(map[string]bool)
+			fields := make([]string, 0, len(n.Properties))
+			for _, child := range n.Properties {
+				fields = append(fields, hiveIdent(hiveName(taken, child.Name))+":"+hiveType(child))
+			}
+			return "STRUCT<" + strings.Join(fields, ",") + ">"
+		case n.Rest != nil:
+			return "MAP<STRING," + hiveType(n.Rest) + ">"
+		}
+		return "MAP<STRING,STRING>"
+	case "ARRAY":
+		if n.Items != nil {
+			return "ARRAY<" + hiveType(n.Items) + ">"
+		}
+		return "ARRAY<STRING>"
+	}
+	if t, ok := hiveTypes[types[0]]; ok {
+		return t
+	}
+	return "STRING"
+}
+
+// createExternalTable returns the CREATE EXTERNAL TABLE statement of a
+// collection. Top-level fields renamed to be valid columns are mapped back
+// to their keys; nested ones cannot be, and read as null.
+func createExternalTable(database string, c *collectionModel, location string) string {
+	var b bytes.Buffer
+	taken := make(map[string]bool)
+	var mappings []string
+	fmt.Fprintf(&b, "CREATE EXTERNAL TABLE IF NOT EXISTS %v.%v (\n", hiveIdent(database), hiveIdent(c.Name))
+	for i, child := range c.Document.Properties {
+		column := hiveName(taken, child.Name)
+		if column != strings.ToLower(child.Name) {
+			mappings = append(mappings, fmt.Sprintf("%v = %v", hiveString("mapping."+column), hiveString(child.Name)))
+		}
+		fmt.Fprintf(&b, "  %v %v", hiveIdent(column), hiveType(child))
+		if i < len(c.Document.Properties)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(")\n")
+	if c.Stats != nil {
+		fmt.Fprintf(&b, "COMMENT %v\n", hiveString(fmt.Sprintf("%v documents, %v sampled", c.Stats.Documents, c.Stats.Sampled)))
+	}
+	fmt.Fprintf(&b, "ROW FORMAT SERDE %v\n", hiveString(HiveSerDe))
+	if len(mappings) > 0 {
+		fmt.Fprintf(&b, "WITH SERDEPROPERTIES (\n  %v\n)\n", strings.Join(mappings, ",\n  "))
+	}
+	if location != "" {
+		fmt.Fprintf(&b, "LOCATION %v\n", hiveString(strings.TrimSuffix(location, "/")+"/"+c.Name+"/"))
+	}
+	return strings.TrimSuffix(b.String(), "\n") + ";\n"
+}
+
+// exportHiveDDL writes the database and the external tables of the
+// collections.
+func exportHiveDDL(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	var b bytes.Buffer
+	b.WriteString("-- Generated by extract_mgo from sampled documents.\n")
+	fmt.Fprintf(&b, "CREATE DATABASE IF NOT EXISTS %v;\n", hiveIdent(m.Database))
+	for _, c := range m.Collections {
+		b.WriteString("\n")
+		b.WriteString(createExternalTable(m.Database, c, cmdInfo.hiveLocation))
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
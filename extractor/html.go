@@ -0,0 +1,200 @@
+package extractor
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"strings"
+)
+
+// HTMLFormat writes the data dictionary as a single HTML page, with no
+// external resources, to email or host as static documentation.
+const HTMLFormat = "html"
+
+// htmlRow is a node of the document tree of a collection, as a row of its
+// field table.
+type htmlRow struct {
+	// Label is the property name, "[]" for the elements of an array and "*"
+	// for the summarized keys of a -dynamic document.
+	Label    string
+	Path     string
+	Depth    int
+	Parent   bool
+	Type     string
+	Nullable bool
+	Example  string
+}
+
+type htmlCollection struct {
+	dictionaryCollection
+	Rows []htmlRow
+}
+
+// htmlRows flattens the tree below n, parents before their children.
+func htmlRows(n *modelNode, depth int, t *translator, rows []htmlRow) []htmlRow {
+	add := func(label string, child *modelNode) {
+		types := child.Types
+		if child.field != nil {
+			types = child.field.fieldTypes()
+		}
+		descriptions := make([]string, 0, len(types))
+		for _, typeName := range types {
+			descriptions = append(descriptions, t.typeDescription(typeName))
+		}
+		row := htmlRow{
+			Label:    label,
+			Path:     child.Path,
+			Depth:    depth,
+			Parent:   child.Properties != nil || child.Items != nil || child.Rest != nil,
+			Type:     strings.Join(descriptions, " / "),
+			Nullable: label != "[]" && label != "*" && !child.Required,
+		}
+		if f := child.field; f != nil && f.Values != nil && len(f.Values.Top) > 0 {
+			row.Example = f.Values.Top[0].Value
+		}
+		rows = htmlRows(child, depth+1, t, append(rows, row))
+	}
+	for _, child := range n.Properties {
+		add(child.Name, child)
+	}
+	if n.Items != nil {
+		add("[]", n.Items)
+	}
+	if n.Rest != nil {
+		add("*", n.Rest)
+	}
+	return rows
+}
+
+const htmlTemplate = `<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+<meta charset="utf-8">
+<title>{{t "title"}}: {{.Database}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 0; color: #222; }
+header { background: #2d3e50; color: #fff; padding: 8px 16px; display: flex; gap: 16px; align-items: center; }
+header h1 { font-size: 18px; margin: 0; flex: 1; }
+main { display: flex; }
+nav { width: 260px; border-right: 1px solid #ddd; padding: 8px; height: calc(100vh - 52px); overflow: auto; box-sizing: border-box; }
+section { flex: 1; padding: 8px 16px; height: calc(100vh - 52px); overflow: auto; box-sizing: border-box; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 16px; }
+th, td { text-align: left; padding: 3px 8px; border-bottom: 1px solid #eee; font-size: 13px; }
+ul { list-style: none; padding: 0; margin: 0; }
+li { padding: 4px; font-size: 13px; }
+li:hover { background: #f0f4f8; }
+a { color: #2d5f8f; text-decoration: none; }
+button.toggle { border: 0; background: none; cursor: pointer; width: 16px; padding: 0; }
+code { font-size: 13px; }
+h2 { font-size: 16px; } small { color: #777; }
+</style>
+</head>
+<body>
+<header><h1>{{t "title"}}: {{.Database}}</h1><input id="search" type="search" placeholder="{{t "search"}}"><small>{{t "generatedAt"}} {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}</small></header>
+<main>
+<nav><h2>{{t "collections"}}</h2><ul>
+{{if .Namespaces}}{{range .Namespaces}}<li><details open><summary>{{or .Name (t "otherCollections")}} <small>{{len .Collections}}</small></summary><ul>
+{{range $i := .Collections}}{{with index $.Collections $i}}<li id="nav-{{$i}}"><a href="#collection-{{$i}}">{{.Name}}</a> <small>{{len .Fields}}</small></li>
+{{end}}{{end}}</ul></details></li>
+{{end}}{{else}}{{range $i, $c := .Collections}}<li id="nav-{{$i}}"><a href="#collection-{{$i}}">{{$c.Name}}</a> <small>{{len $c.Fields}}</small></li>
+{{end}}{{end}}</ul></nav>
+<section>
+{{if not .Collections}}<p>{{t "noCollection"}}</p>{{end}}
+{{range $i, $c := .Collections}}<article id="collection-{{$i}}" data-nav="nav-{{$i}}">
+<h2>{{if $c.Namespace}}<small>{{$c.Namespace}} /</small> {{end}}{{$c.Name}}</h2>
+<p><small>{{t "documents"}}: {{$c.Documents}} · {{t "sampled"}}: {{$c.Sampled}} · {{t "fields"}}: {{len $c.Fields}}</small></p>
+{{range $c.Expiry}}<p><small>{{t "expiry"}}: {{.}}</small></p>
+{{end}}<table>
+<thead><tr><th>{{t "field"}}</th><th>{{t "type"}}</th><th>{{t "nullable"}}</th><th>{{t "example"}}</th></tr></thead>
+<tbody>
+{{range $c.Rows}}<tr data-path="{{.Path}}"><td style="padding-left: {{indent .Depth}}px">{{if .Parent}}<button class="toggle">▾</button>{{else}}<button class="toggle" disabled></button>{{end}}<code>{{.Label}}</code></td><td>{{.Type}}</td><td>{{if .Nullable}}{{t "yes"}}{{else}}{{t "no"}}{{end}}</td><td>{{.Example}}</td></tr>
+{{end}}</tbody>
+</table>
+{{if $c.Findings}}<h3>{{t "findings"}}</h3>
+<ul>{{range $c.Findings}}<li>{{.}}</li>{{end}}</ul>
+{{end}}</article>
+{{end}}</section>
+</main>
+<script>
+"use strict";
+var search = document.getElementById("search");
+var articles = [].slice.call(document.querySelectorAll("article"));
+
+// isBelow tells whether path is nested in the one of parent.
+function isBelow(parent, path) {
+  return path.length > parent.length && path.lastIndexOf(parent, 0) === 0 &&
+    (path.charAt(parent.length) === "." || path.charAt(parent.length) === "[");
+}
+
+// refresh shows the rows matching the search with their parents, or else
+// the rows not in collapsed parents.
+function refresh() {
+  var q = search.value.trim().toLowerCase();
+  articles.forEach(function (article) {
+    var rows = [].slice.call(article.querySelectorAll("tr[data-path]"));
+    var matched = rows.filter(function (r) { return r.dataset.path.toLowerCase().indexOf(q) >= 0; });
+    var collapsed = rows.filter(function (r) { return r.classList.contains("collapsed"); });
+    rows.forEach(function (r) {
+      var path = r.dataset.path;
+      r.hidden = q ?
+        !matched.some(function (m) { return m === r || isBelow(path, m.dataset.path); }) :
+        collapsed.some(function (c) { return isBelow(c.dataset.path, path); });
+    });
+    var hidden = q !== "" && matched.length === 0;
+    article.hidden = hidden;
+    document.getElementById(article.dataset.nav).hidden = hidden;
+  });
+  document.querySelectorAll("nav details").forEach(function (details) {
+    details.parentNode.hidden = [].every.call(details.querySelectorAll("li"), function (li) { return li.hidden; });
+  });
+}
+
+document.querySelectorAll("button.toggle").forEach(function (button) {
+  button.onclick = function () {
+    var row = button.parentNode.parentNode;
+    button.textContent = row.classList.toggle("collapsed") ? "▸" : "▾";
+    refresh();
+  };
+});
+search.oninput = refresh;
+</script>
+</body>
+</html>
+`
+
+// htmlDictionary renders the data dictionary of the model as a page.
+func htmlDictionary(m *schemaModel, t *translator, namespaces *namespaceRule) ([]byte, error) {
+	tmpl, err := template.New(HTMLFormat).Funcs(template.FuncMap(t.templateFuncs())).
+		Funcs(template.FuncMap{"indent": func(depth int) int { return 8 + 16*depth }}).Parse(htmlTemplate)
+	if err != nil {
+		return nil, err
+	}
+	d := newDictionary(m, t, namespaces)
+	data := struct {
+		*dictionary
+		Collections []htmlCollection
+	}{dictionary: d}
+	documents := make(map[string]*modelNode, len(m.Collections))
+	for _, c := range m.Collections {
+		documents[c.Name] = c.Document
+	}
+	for _, c := range d.Collections {
+		data.Collections = append(data.Collections, htmlCollection{
+			dictionaryCollection: c,
+			Rows:                 htmlRows(documents[c.Name], 0, t, nil),
+		})
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func exportHTML(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	data, err := htmlDictionary(m, cmdInfo.translator, cmdInfo.namespaces)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
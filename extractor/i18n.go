@@ -0,0 +1,258 @@
+package extractor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"text/template"
+
+	cli "gopkg.in/urfave/cli.v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultLang is the language of the human-readable reports, and the
+// fallback for keys a bundle does not translate.
+const DefaultLang = "en"
+
+var (
+	langFlag = cli.StringFlag{
+		Name:  "lang",
+		Usage: "Language of the human-readable reports: \"en\", \"zh\", \"de\" or one added with -lang-bundle",
+		Value: DefaultLang,
+	}
+	langBundleFlag = cli.StringSliceFlag{
+		Name: "lang-bundle",
+		Usage: "YAML translation bundle with \"lang\", \"messages\" and \"types\" maps. It adds a language or " +
+			"overrides keys of a built-in one. Repeatable",
+	}
+)
+
+// translationBundle holds the texts of the report templates in one language.
+type translationBundle struct {
+	Lang string `yaml:"lang"`
+	// Messages are the headers and labels, by key.
+	Messages map[string]string `yaml:"messages"`
+	// Types describe field types, by type name such as "STRING(NUMERIC)".
+	Types map[string]string `yaml:"types"`
+}
+
+var builtinBundles = map[string]translationBundle{
+	"en": {
+		Lang: "en",
+		Messages: map[string]string{
+			"title":            "Data dictionary",
+			"database":         "Database",
+			"generatedAt":      "Generated at",
+			"collections":      "Collections",
+			"collection":       "Collection",
+			"documents":        "Documents",
+			"sampled":          "Sampled",
+			"fields":           "Fields",
+			"field":            "Field",
+			"type":             "Type",
+			"description":      "Description",
+			"nullable":         "Nullable",
+			"example":          "Example",
+			"findings":         "Findings",
+			"search":           "Search fields",
+			"otherCollections": "Other collections",
+			"yes":              "yes",
+			"no":               "no",
+			"noCollection":     "The database has no collections.",
+			"presentIn":        "present in %v%% of sampled documents",
+			"datasetSummary":   "MongoDB collection with %v fields, found by sampling %v of %v documents",
+			"expiry":           "Expiry",
+			"expiresAfter":     "documents expire %v after the date in %v",
+			"expiresAt":        "documents expire at the date in %v",
+		},
+		Types: map[string]string{
+			"OBJECTID":               "ObjectId",
+			"STRING":                 "Text",
+			"STRING(NUMERIC)":        "Number stored as text",
+			"STRING(BOOLEAN)":        "Yes/no stored as text",
+			"INTEGER":                "Whole number",
+			"INTEGER(EPOCH_SECONDS)": "Date as seconds since 1970",
+			"INTEGER(EPOCH_MILLIS)":  "Date as milliseconds since 1970",
+			"DECIMAL":                "Decimal number",
+			"BOOL":                   "Yes/no",
+			"TIME":                   "Date and time",
+			"BINARY":                 "Binary data",
+			"ARRAY":                  "List",
+			"DOCUMENT":               "Embedded document",
+			"UNKNOWN":                "Unknown type",
+		},
+	},
+	"zh": {
+		Lang: "zh",
+		Messages: map[string]string{
+			"title":            "数据字典",
+			"database":         "数据库",
+			"generatedAt":      "生成时间",
+			"collections":      "集合",
+			"collection":       "集合",
+			"documents":        "文档数",
+			"sampled":          "采样数",
+			"fields":           "字段",
+			"field":            "字段",
+			"type":             "类型",
+			"description":      "说明",
+			"nullable":         "可为空",
+			"example":          "示例",
+			"findings":         "发现的问题",
+			"search":           "搜索字段",
+			"otherCollections": "其他集合",
+			"yes":              "是",
+			"no":               "否",
+			"noCollection":     "该数据库没有集合。",
+			"presentIn":        "出现在 %v%% 的采样文档中",
+			"datasetSummary":   "MongoDB 集合，共 %[3]v 个文档，采样 %[2]v 个，发现 %[1]v 个字段",
+			"expiry":           "过期",
+			"expiresAfter":     "文档在 %[2]v 的时间 %[1]v 之后过期",
+			"expiresAt":        "文档在 %v 的时间过期",
+		},
+		Types: map[string]string{
+			"OBJECTID":               "ObjectId",
+			"STRING":                 "文本",
+			"STRING(NUMERIC)":        "以文本存储的数字",
+			"STRING(BOOLEAN)":        "以文本存储的布尔值",
+			"INTEGER":                "整数",
+			"INTEGER(EPOCH_SECONDS)": "日期（1970年以来的秒数）",
+			"INTEGER(EPOCH_MILLIS)":  "日期（1970年以来的毫秒数）",
+			"DECIMAL":                "小数",
+			"BOOL":                   "布尔值",
+			"TIME":                   "日期时间",
+			"BINARY":                 "二进制数据",
+			"ARRAY":                  "数组",
+			"DOCUMENT":               "嵌入文档",
+			"UNKNOWN":                "未知类型",
+		},
+	},
+	"de": {
+		Lang: "de",
+		Messages: map[string]string{
+			"title":            "Datenkatalog",
+			"database":         "Datenbank",
+			"generatedAt":      "Erstellt am",
+			"collections":      "Collections",
+			"collection":       "Collection",
+			"documents":        "Dokumente",
+			"sampled":          "Stichprobe",
+			"fields":           "Felder",
+			"field":            "Feld",
+			"type":             "Typ",
+			"description":      "Beschreibung",
+			"nullable":         "Optional",
+			"example":          "Beispiel",
+			"findings":         "Befunde",
+			"search":           "Felder suchen",
+			"otherCollections": "Weitere Collections",
+			"yes":              "ja",
+			"no":               "nein",
+			"noCollection":     "Die Datenbank enthält keine Collections.",
+			"presentIn":        "vorhanden in %v%% der Stichprobendokumente",
+			"datasetSummary":   "MongoDB-Collection, %v Felder, gefunden durch Stichprobe von %v der %v Dokumente",
+			"expiry":           "Ablauf",
+			"expiresAfter":     "Dokumente laufen %v nach dem Datum in %v ab",
+			"expiresAt":        "Dokumente laufen zum Datum in %v ab",
+		},
+		Types: map[string]string{
+			"OBJECTID":               "ObjectId",
+			"STRING":                 "Text",
+			"STRING(NUMERIC)":        "Zahl als Text",
+			"STRING(BOOLEAN)":        "Ja/Nein als Text",
+			"INTEGER":                "Ganzzahl",
+			"INTEGER(EPOCH_SECONDS)": "Datum in Sekunden seit 1970",
+			"INTEGER(EPOCH_MILLIS)":  "Datum in Millisekunden seit 1970",
+			"DECIMAL":                "Dezimalzahl",
+			"BOOL":                   "Ja/Nein",
+			"TIME":                   "Datum und Uhrzeit",
+			"BINARY":                 "Binärdaten",
+			"ARRAY":                  "Liste",
+			"DOCUMENT":               "Eingebettetes Dokument",
+			"UNKNOWN":                "Unbekannter Typ",
+		},
+	},
+}
+
+// translator looks up report texts in the selected language, falling back
+// to English and then to the key itself.
+type translator struct {
+	bundle   translationBundle
+	fallback translationBundle
+}
+
+// mergeBundle returns base with the texts of overlay added or replaced.
+func mergeBundle(base, overlay translationBundle) translationBundle {
+	merged := translationBundle{Lang: overlay.Lang, Messages: make(map[string]string), Types: make(map[string]string)}
+	for _, b := range []translationBundle{base, overlay} {
+		for k, v := range b.Messages {
+			merged.Messages[k] = v
+		}
+		for k, v := range b.Types {
+			merged.Types[k] = v
+		}
+	}
+	return merged
+}
+
+func newTranslator(lang string, bundleFiles []string) (*translator, error) {
+	bundles := make(map[string]translationBundle, len(builtinBundles))
+	for name, b := range builtinBundles {
+		bundles[name] = b
+	}
+	for _, path := range bundleFiles {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var b translationBundle
+		if err := yaml.UnmarshalStrict(data, &b); err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+		if b.Lang == "" {
+			return nil, fmt.Errorf("%v: missing lang", path)
+		}
+		bundles[b.Lang] = mergeBundle(bundles[b.Lang], b)
+	}
+	bundle, ok := bundles[lang]
+	if !ok {
+		return nil, fmt.Errorf("no translation bundle for language %q", lang)
+	}
+	return &translator{bundle: bundle, fallback: bundles[DefaultLang]}, nil
+}
+
+// text returns the text of a message key, formatted with args when given.
+func (t *translator) text(key string, args ...interface{}) string {
+	msg, ok := t.bundle.Messages[key]
+	if !ok {
+		if msg, ok = t.fallback.Messages[key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// typeDescription describes a field type, trying the full type name before
+// its base type.
+func (t *translator) typeDescription(typeName string) string {
+	for _, name := range []string{typeName, baseType(typeName)} {
+		for _, b := range []translationBundle{t.bundle, t.fallback} {
+			if desc, ok := b.Types[name]; ok {
+				return desc
+			}
+		}
+	}
+	return typeName
+}
+
+// templateFuncs exposes the translator to report templates as
+// {{t "field"}} and {{typeDesc .Type}}.
+func (t *translator) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"t":        t.text,
+		"typeDesc": t.typeDescription,
+		"lang":     func() string { return t.bundle.Lang },
+	}
+}
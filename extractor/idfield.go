@@ -0,0 +1,78 @@
+package extractor
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// MonotonicityProbe is how many _id values are read in natural order to
+// judge whether new documents get increasing ids.
+const MonotonicityProbe = 50
+
+// compareIDs orders two _id values of the same scalar type, returning false
+// when they are not comparable.
+func compareIDs(a, b interface{}) (less bool, ok bool) {
+	switch x := a.(type) {
+	case int:
+		y, ok := b.(int)
+		return x < y, ok
+	case int64:
+		y, ok := b.(int64)
+		return x < y, ok
+	case float64:
+		y, ok := b.(float64)
+		return x < y, ok
+	case string:
+		y, ok := b.(string)
+		return x < y, ok
+	case time.Time:
+		y, ok := b.(time.Time)
+		return x.Before(y), ok
+	}
+	return false, false
+}
+
+// probeMonotonicity reads _id values in natural (roughly insertion) order
+// and reports whether they keep increasing.
+func probeMonotonicity(c *mgo.Collection) string {
+	var docs []struct {
+		ID interface{} `bson:"_id"`
+	}
+	err := c.Find(nil).Select(bson.M{"_id": 1}).Sort("$natural").Limit(MonotonicityProbe).All(&docs)
+	if err != nil || len(docs) < 2 {
+		return "unknown"
+	}
+	for i := 1; i < len(docs); i++ {
+		less, ok := compareIDs(docs[i-1].ID, docs[i].ID)
+		if !ok || !less {
+			return "non-monotonic"
+		}
+	}
+	return "increasing"
+}
+
+// describeID completes the _id entry with uniqueness, guaranteed by the _id
+// index, and a note on whether ids grow with insertion order, which matters
+// for sharding and range-partitioned reads.
+func describeID(c *mgo.Collection, colSchema docSchema) {
+	for i := range colSchema {
+		f := &colSchema[i]
+		if f.Name != "_id" {
+			continue
+		}
+		f.Unique = true
+		switch {
+		case len(f.Types) > 0:
+			f.Monotonicity = "non-monotonic"
+		case f.Type == "OBJECTID":
+			f.Monotonicity = "increasing"
+		case f.Type == "DOCUMENT" || f.Type == "BINARY":
+			f.Monotonicity = "non-monotonic"
+		default:
+			f.Monotonicity = probeMonotonicity(c)
+		}
+		return
+	}
+}
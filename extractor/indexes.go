@@ -0,0 +1,168 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// MinReferenceCoverage is the share of sampled documents a reference field
+// must appear in before a missing index on it is reported.
+const MinReferenceCoverage = 0.9
+
+var (
+	checkIndexesFlag = cli.BoolFlag{
+		Name:  "check-indexes",
+		Usage: "Cross-check index keys against sampled fields, reporting dead indexes and unindexed reference fields as findings",
+	}
+	indexStatsFlag = cli.BoolFlag{
+		Name:  "index-stats",
+		Usage: "Annotate fields with the indexes they participate in and their usage from $indexStats (MongoDB 3.2+)",
+	}
+)
+
+// indexUsage tells how often an index containing the field was used since
+// the server started tracking it.
+type indexUsage struct {
+	Index string    `json:"index"`
+	Ops   int64     `json:"ops"`
+	Since time.Time `json:"since"`
+}
+
+// indexKeyField returns the field path of an mgo index key such as "-age",
+// "$text:title" or "$2dsphere:location", or "" for wildcard keys.
+func indexKeyField(key string) string {
+	if strings.Contains(key, "$**") {
+		return ""
+	}
+	if strings.HasPrefix(key, "$") {
+		if i := strings.Index(key, ":"); i != -1 {
+			return key[i+1:]
+		}
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(key, "-"), "+")
+}
+
+// fieldPath converts a schema field name to the dotted path used by
+// queries and indexes, e.g. "items[].sku" to "items.sku".
+func fieldPath(name string) string {
+	return strings.Replace(name, "[]", "", -1)
+}
+
+// isReferenceField guesses whether the field points at another document.
+func isReferenceField(field *docField) bool {
+	if field.Name == "_id" {
+		return false
+	}
+	if objectIDReference(field) != "" {
+		return true
+	}
+	for _, t := range field.fieldTypes() {
+		if t == "OBJECTID" {
+			return true
+		}
+	}
+	name := field.Name
+	if i := strings.LastIndex(name, "."); i != -1 {
+		name = name[i+1:]
+	}
+	return strings.HasSuffix(name, "Id") || strings.HasSuffix(name, "_id")
+}
+
+func checkIndexes(c *mgo.Collection, colSchema docSchema, sampled int) {
+	if sampled == 0 {
+		return
+	}
+	indexes, err := c.Indexes()
+	if err != nil {
+		addWarning(c.Name, "", "failed to list indexes: %v", err)
+		return
+	}
+	observed := make(map[string]struct{})
+	for _, f := range colSchema {
+		// An index on an embedded document covers its sub-fields too.
+		for path := fieldPath(f.Name); path != ""; {
+			observed[path] = struct{}{}
+			i := strings.LastIndex(path, ".")
+			if i == -1 {
+				break
+			}
+			path = path[:i]
+		}
+	}
+	leading := make(map[string]struct{})
+	for _, index := range indexes {
+		if index.Name == "_id_" {
+			continue
+		}
+		for i, key := range index.Key {
+			path := indexKeyField(key)
+			if path == "" {
+				continue
+			}
+			if i == 0 {
+				leading[path] = struct{}{}
+			}
+			if _, ok := observed[path]; !ok {
+				addFinding(finding{
+					Collection: c.Name,
+					Field:      path,
+					Kind:       "dead-index",
+					Message:    fmt.Sprintf("index %v on %v: field %v never appears in %v sampled documents", index.Name, c.Name, path, publishedCount(sampled)),
+				})
+			}
+		}
+	}
+	for i := range colSchema {
+		f := &colSchema[i]
+		coverage := float64(f.Count) / float64(sampled)
+		if !isReferenceField(f) || coverage < MinReferenceCoverage {
+			continue
+		}
+		path := fieldPath(f.Name)
+		if _, ok := leading[path]; ok {
+			continue
+		}
+		addFinding(finding{
+			Collection: c.Name,
+			Field:      path,
+			Kind:       "unindexed-reference",
+			Message:    fmt.Sprintf("reference field %v.%v appears in %.0f%% of sampled documents but leads no index", c.Name, path, coverage*100),
+		})
+	}
+}
+
+// annotateIndexUsage records $indexStats usage on the fields of the
+// collection's index keys.
+func annotateIndexUsage(c *mgo.Collection, colSchema docSchema) {
+	var stats []struct {
+		Name     string `bson:"name"`
+		Key      bson.D `bson:"key"`
+		Accesses struct {
+			Ops   int64     `bson:"ops"`
+			Since time.Time `bson:"since"`
+		} `bson:"accesses"`
+	}
+	if err := c.Pipe([]bson.M{{"$indexStats": bson.M{}}}).All(&stats); err != nil {
+		addWarning(c.Name, "", "failed to read $indexStats: %v", err)
+		return
+	}
+	byPath := make(map[string][]int)
+	for i := range colSchema {
+		path := fieldPath(colSchema[i].Name)
+		byPath[path] = append(byPath[path], i)
+	}
+	for _, stat := range stats {
+		usage := indexUsage{Index: stat.Name, Ops: stat.Accesses.Ops, Since: stat.Accesses.Since}
+		for _, key := range stat.Key {
+			for _, i := range byPath[key.Name] {
+				colSchema[i].IndexUsage = append(colSchema[i].IndexUsage, usage)
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// JavaFormat writes a Java class per collection, annotated for Spring Data
+// MongoDB, into the -output directory.
+const JavaFormat = "java"
+
+var javaPackageFlag = cli.StringFlag{
+	Name:  "java-package",
+	Usage: "Package of the Java classes written by -format java",
+	Value: "model",
+}
+
+// javaTypes are the Java types of the base types, boxed so that missing
+// fields are null.
+var javaTypes = map[string]string{
+	"INTEGER":  "Long",
+	"DECIMAL":  "Double",
+	"STRING":   "String",
+	"BOOL":     "Boolean",
+	"TIME":     "Instant",
+	"OBJECTID": "ObjectId",
+	"BINARY":   "byte[]",
+}
+
+// javaImports are the imports of the simple names the classes may use.
+var javaImports = map[string]string{
+	"Document": "org.springframework.data.mongodb.core.mapping.Document",
+	"Field":    "org.springframework.data.mongodb.core.mapping.Field",
+	"Id":       "org.springframework.data.annotation.Id",
+	"Instant":  "java.time.Instant",
+	"List":     "java.util.List",
+	"Map":      "java.util.Map",
+	"ObjectId": "org.bson.types.ObjectId",
+}
+
+// javaReserved are the keywords and literals of Java, which cannot name a
+// field.
+var javaReserved = map[string]bool{
+	"abstract": true, "assert": true, "boolean": true, "break": true, "byte": true, "case": true, "catch": true,
+	"char": true, "class": true, "const": true, "continue": true, "default": true, "do": true, "double": true,
+	"else": true, "enum": true, "extends": true, "false": true, "final": true, "finally": true, "float": true,
+	"for": true, "goto": true, "if": true, "implements": true, "import": true, "instanceof": true, "int": true,
+	"interface": true, "long": true, "native": true, "new": true, "null": true, "package": true, "private": true,
+	"protected": true, "public": true, "return": true, "short": true, "static": true, "strictfp": true,
+	"super": true, "switch": true, "synchronized": true, "this": true, "throw": true, "throws": true,
+	"transient": true, "true": true, "try": true, "void": true, "volatile": true, "while": true, "var": true,
+}
+
+// camelName turns a field name into a field or property name of a JVM
+// language, e.g. "first name" into "firstName", "_id" into "id" and, when
+// reserved by the language, "class" into "class_".
+func camelName(name string, reserved map[string]bool) string {
+	if name == "_id" {
+		return "id"
+	}
+	ident := []rune(goName(name))
+	ident[0] = unicode.ToLower(ident[0])
+	if reserved[string(ident)] {
+		return string(ident) + "_"
+	}
+	return string(ident)
+}
+
+// javaClassWriter writes the class of a collection with the classes of its
+// nested documents as static nested classes.
+type javaClassWriter struct {
+	source  bytes.Buffer
+	imports map[string]bool
+	// classes are the names taken in the file, including those imported.
+	classes map[string]bool
+	pending []pendingStruct
+}
+
+// use returns a simple name, importing it.
+func (w *javaClassWriter) use(name string) string {
+	if javaImports[name] != "" {
+		w.imports[javaImports[name]] = true
+	}
+	return name
+}
+
+// javaType returns the Java type of the node, queuing the classes it needs
+// under names derived from name. Mixed types are Objects, except for
+// integers mixed with decimals.
+func (w *javaClassWriter) javaType(name string, n *modelNode) string {
+	if n.Numeric {
+		return "Double"
+	}
+	types := n.Types
+	if len(types) != 1 {
+		return "Object"
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		if n.Properties == nil {
+			value := "Object"
+			if n.Rest != nil {
+				value = w.javaType(name+"Value", n.Rest)
+			}
+			return w.use("Map") + "<String, " + value + ">"
+		}
+		className := uniqueName(w.classes, name)
+		w.pending = append(w.pending, pendingStruct{name: className, node: n})
+		return className
+	case "ARRAY":
+		item := "Object"
+		if n.Items != nil {
+			item = w.javaType(name+"Item", n.Items)
+		}
+		return w.use("List") + "<" + item + ">"
+	}
+	if t, ok := javaTypes[types[0]]; ok {
+		return w.use(t)
+	}
+	return "Object"
+}
+
+// writeClass writes a class with a field per property of the node, and its
+// getters and setters, unclosed. Nested classes are static, indented and
+// named after the path to them within the collection class. Fields not
+// named after their property are mapped with @Field; the _id of the
+// collection is the @Id. Summarized -dynamic keys are left out, as Spring
+// Data cannot map them next to the known fields.
+func (w *javaClassWriter) writeClass(s pendingStruct, nested bool) {
+	type javaField struct{ name, typ string }
+	var fields []javaField
+	taken := make(map[string]bool)
+	indent, modifiers, prefix := "", "public", ""
+	if nested {
+		indent, modifiers, prefix = "    ", "public static", s.name
+	}
+	fmt.Fprintf(&w.source, "%v%v class %v {\n", indent, modifiers, s.name)
+	for _, child := range s.node.Properties {
+		name := uniqueName(taken, camelName(child.Name, javaReserved))
+		typ := w.javaType(prefix+goName(child.Name), child)
+		w.source.WriteString("\n")
+		switch {
+		case child.Name == "_id" && !nested:
+			fmt.Fprintf(&w.source, "%v    @%v\n", indent, w.use("Id"))
+		case name != child.Name:
+			fmt.Fprintf(&w.source, "%v    @%v(%v)\n", indent, w.use("Field"), strconv.Quote(child.Name))
+		}
+		fmt.Fprintf(&w.source, "%v    private %v %v;\n", indent, typ, name)
+		fields = append(fields, javaField{name: name, typ: typ})
+	}
+	for _, f := range fields {
+		accessor := strings.ToUpper(f.name[:1]) + f.name[1:]
+		fmt.Fprintf(&w.source, "\n%v    public %v get%v() {\n%v        return %v;\n%v    }\n", indent, f.typ, accessor, indent, f.name, indent)
+		fmt.Fprintf(&w.source, "\n%v    public void set%v(%v %v) {\n%v        this.%v = %v;\n%v    }\n", indent, accessor,
+			f.typ, f.name, indent, f.name, f.name, indent)
+	}
+}
+
+// javaClass returns the source of the class of a collection.
+func javaClass(pkg string, c *collectionModel, name string) []byte {
+	w := &javaClassWriter{imports: make(map[string]bool), classes: map[string]bool{name: true}}
+	for simple := range javaImports {
+		w.classes[simple] = true
+	}
+	fmt.Fprintf(&w.source, "/**\n * A document of the %v collection.\n */\n@%v(collection = %v)\n", c.Name,
+		w.use("Document"), strconv.Quote(c.Name))
+	w.writeClass(pendingStruct{name: name, node: c.Document}, false)
+	for len(w.pending) > 0 {
+		s := w.pending[0]
+		w.pending = w.pending[1:]
+		w.source.WriteString("\n")
+		w.writeClass(s, true)
+		w.source.WriteString("    }\n")
+	}
+	w.source.WriteString("}\n")
+
+	var source bytes.Buffer
+	source.WriteString("// Generated by extract_mgo from sampled documents.\n\n")
+	fmt.Fprintf(&source, "package %v;\n\n", pkg)
+	imports := make([]string, 0, len(w.imports))
+	for path := range w.imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&source, "import %v;\n", path)
+	}
+	source.WriteString("\n")
+	source.Write(w.source.Bytes())
+	return source.Bytes()
+}
+
+// exportJava writes the class of each collection into the directory path,
+// in a file named after the class as Java requires.
+func exportJava(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	taken := make(map[string]bool)
+	for simple := range javaImports {
+		taken[simple] = true
+	}
+	for _, c := range m.Collections {
+		name := uniqueName(taken, goName(c.Name))
+		source := javaClass(cmdInfo.javaPackage, c, name)
+		if err := ioutil.WriteFile(filepath.Join(path, name+".java"), source, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
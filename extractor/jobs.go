@@ -0,0 +1,334 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/globalsign/mgo"
+	cli "gopkg.in/urfave/cli.v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	jobsFlag = cli.StringFlag{
+		Name:  "jobs",
+		Usage: "YAML file listing the extraction jobs",
+	}
+	parallelFlag = cli.IntFlag{
+		Name:  "parallel",
+		Usage: "Number of jobs run at the same time, overriding \"parallel\" of the jobs file",
+	}
+	summaryFlag = cli.StringFlag{
+		Name:  "summary",
+		Usage: "Also write the run summary to this JSON file",
+	}
+
+	runCommand = cli.Command{
+		Name:   "run",
+		Usage:  "Run the extraction jobs of a jobs file, each in its own process, and summarize the results",
+		Flags:  []cli.Flag{jobsFlag, parallelFlag, summaryFlag},
+		Action: runJobs,
+	}
+)
+
+// job is an extraction described in the jobs file. Each database of a job is
+// extracted by a separate run of the tool; output, report and findings may
+// use the -output template variables, and must name {{.Database}} when the
+// job lists several databases.
+type job struct {
+	Name               string   `yaml:"name"`
+	URI                string   `yaml:"uri"`
+	Databases          []string `yaml:"databases"`
+	Collections        []string `yaml:"collections"`
+	ExcludeCollections []string `yaml:"excludeCollections"`
+	SampleStrategy     string   `yaml:"sampleStrategy"`
+	Format             string   `yaml:"format"`
+	Output             string   `yaml:"output"`
+	Report             string   `yaml:"report"`
+	Findings           string   `yaml:"findings"`
+	// Args are further command line flags, e.g. ["-deep"].
+	Args []string `yaml:"args"`
+}
+
+// jobsFile is the content of the -jobs file.
+type jobsFile struct {
+	// Parallel is the number of jobs run at the same time, 1 by default.
+	Parallel int   `yaml:"parallel"`
+	Jobs     []job `yaml:"jobs"`
+}
+
+// jobRun is the extraction of one database of a job.
+type jobRun struct {
+	Job      string        `json:"job"`
+	Database string        `json:"database"`
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"-"`
+	Seconds  float64       `json:"seconds"`
+	Error    string        `json:"error,omitempty"`
+
+	args []string
+}
+
+func loadJobs(path string) (*jobsFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jobs := new(jobsFile)
+	if err := yaml.UnmarshalStrict(data, jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// withDatabase replaces the database of a connection string.
+func withDatabase(uri, database string) string {
+	start := strings.Index(uri, "://") + len("://")
+	end := len(uri)
+	if q := strings.Index(uri[start:], "?"); q != -1 {
+		end = start + q
+	}
+	if at := strings.LastIndex(uri[start:end], "@"); at != -1 {
+		start += at + 1
+	}
+	hosts := uri[start:end]
+	if slash := strings.Index(hosts, "/"); slash != -1 {
+		hosts = hosts[:slash]
+	}
+	return uri[:start] + hosts + "/" + database + uri[end:]
+}
+
+// expandPath fills the template variables of a report or findings path.
+func expandPath(pattern, database, format string) (string, error) {
+	path, err := parseOutputPath(pattern)
+	if err != nil {
+		return "", err
+	}
+	return path.expand(database, "", format)
+}
+
+// runs turns the job into the command lines of its runs.
+func (j *job) runs() ([]*jobRun, error) {
+	if j.URI == "" || j.Output == "" {
+		return nil, fmt.Errorf("uri and output are mandatory")
+	}
+	databases := j.Databases
+	if len(databases) == 0 {
+		dialInfo, err := mgo.ParseURL(j.URI)
+		if err != nil {
+			return nil, err
+		}
+		databases = []string{dialInfo.Database}
+	}
+	if len(databases) > 1 {
+		for _, path := range []string{j.Output, j.Report, j.Findings} {
+			if path != "" && !strings.Contains(path, ".Database") {
+				return nil, fmt.Errorf("%v must contain {{.Database}} to extract several databases", path)
+			}
+		}
+	}
+	format := j.Format
+	if format == "" {
+		format = JSONFormat
+	}
+	var runs []*jobRun
+	for _, database := range databases {
+		uri := j.URI
+		if len(j.Databases) > 0 {
+			uri = withDatabase(uri, database)
+		}
+		args := []string{"-" + datatabseFlag.Name, uri, "-" + outputFlag.Name, j.Output, "-" + formatFlag.Name, format}
+		for _, pattern := range j.Collections {
+			args = append(args, "-"+collectionsFlag.Name, pattern)
+		}
+		for _, pattern := range j.ExcludeCollections {
+			args = append(args, "-"+excludeCollectionsFlag.Name, pattern)
+		}
+		if j.SampleStrategy != "" {
+			args = append(args, "-"+sampleStrategyFlag.Name, j.SampleStrategy)
+		}
+		for _, option := range []struct{ flag, pattern string }{{reportFlag.Name, j.Report}, {findingsFlag.Name, j.Findings}} {
+			if option.pattern == "" {
+				continue
+			}
+			path, err := expandPath(option.pattern, database, format)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, "-"+option.flag, path)
+		}
+		runs = append(runs, &jobRun{Job: j.Name, Database: database, args: append(args, j.Args...)})
+	}
+	return runs, nil
+}
+
+// prefixWriter writes the output of a run line by line with the run name in
+// front, so that the logs of parallel runs stay readable. It remembers the
+// last line, which holds the error of a failed run, or the message of a
+// panic rather than the stack trace following it.
+type prefixWriter struct {
+	prefix   string
+	out      io.Writer
+	lock     *sync.Mutex
+	buf      []byte
+	last     string
+	panicked bool
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			return len(p), nil
+		}
+		w.writeLine(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+}
+
+func (w *prefixWriter) writeLine(line string) {
+	w.lock.Lock()
+	fmt.Fprintf(w.out, "%s %s\n", w.prefix, line)
+	w.lock.Unlock()
+	switch {
+	case w.panicked || strings.TrimSpace(line) == "":
+	case strings.HasPrefix(line, "panic: "):
+		w.last, w.panicked = strings.TrimPrefix(line, "panic: "), true
+	default:
+		w.last = line
+	}
+}
+
+func (w *prefixWriter) flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// execute runs the tool with the arguments of the run.
+func (r *jobRun) execute(executable string, outputLock *sync.Mutex) {
+	start := time.Now()
+	logs := &prefixWriter{prefix: fmt.Sprintf("[%v/%v]", r.Job, r.Database), out: os.Stderr, lock: outputLock}
+	cmd := exec.Command(executable, r.args...)
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+	err := cmd.Run()
+	logs.flush()
+	r.Duration = time.Since(start).Round(time.Millisecond)
+	r.Seconds = r.Duration.Seconds()
+	r.Status = "ok"
+	if err != nil {
+		r.Status = "failed"
+		r.Error = stripLogTime(logs.last)
+		if r.Error == "" {
+			r.Error = err.Error()
+		}
+	}
+}
+
+// stripLogTime removes the timestamp the log package puts in front of lines.
+func stripLogTime(line string) string {
+	const layout = "2006/01/02 15:04:05 "
+	if len(line) >= len(layout) {
+		if _, err := time.Parse(layout, line[:len(layout)]); err == nil {
+			return line[len(layout):]
+		}
+	}
+	return line
+}
+
+func printSummary(out io.Writer, runs []*jobRun) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tDATABASE\tSTATUS\tDURATION\tERROR")
+	for _, r := range runs {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", r.Job, r.Database, r.Status, r.Duration, r.Error)
+	}
+	w.Flush()
+}
+
+// executeRuns runs the tool for each run, parallel at a time.
+func executeRuns(runs []*jobRun, parallel int) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	var done sync.WaitGroup
+	var outputLock sync.Mutex
+	slots := make(chan struct{}, parallel)
+	for _, r := range runs {
+		done.Add(1)
+		slots <- struct{}{}
+		go func(r *jobRun) {
+			defer done.Done()
+			r.execute(executable, &outputLock)
+			<-slots
+		}(r)
+	}
+	done.Wait()
+	return nil
+}
+
+func runJobs(ctx *cli.Context) error {
+	path := ctx.String(jobsFlag.Name)
+	if path == "" {
+		return cli.NewExitError(fmt.Sprintf("%s is mandatory!", jobsFlag.Name), 1)
+	}
+	jobs, err := loadJobs(path)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Failed to load jobs: %v", err), 1)
+	}
+	var runs []*jobRun
+	for i := range jobs.Jobs {
+		j := &jobs.Jobs[i]
+		if j.Name == "" {
+			j.Name = fmt.Sprintf("job%d", i+1)
+		}
+		jobRuns, err := j.runs()
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Job %v: %v", j.Name, err), 1)
+		}
+		runs = append(runs, jobRuns...)
+	}
+	parallel := jobs.Parallel
+	if ctx.IsSet(parallelFlag.Name) {
+		parallel = ctx.Int(parallelFlag.Name)
+	}
+	if err := executeRuns(runs, parallel); err != nil {
+		return err
+	}
+
+	printSummary(os.Stdout, runs)
+	if summary := ctx.String(summaryFlag.Name); summary != "" {
+		data, err := json.MarshalIndent(runs, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(summary, data, 0644); err != nil {
+			return err
+		}
+	}
+	failed := 0
+	for _, r := range runs {
+		if r.Status != "ok" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("%v of %v runs failed", failed, len(runs)), 1)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+)
+
+const (
+	// JSONSchemaFormat writes one JSON Schema document per collection.
+	JSONSchemaFormat = "jsonschema"
+	// JSONSchema2020 is the dialect of the -format jsonschema documents.
+	JSONSchema2020 = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// jsonSchemaTypeSchemas give the JSON Schema of each base type, for values
+// encoded as relaxed JSON: dates as date-time strings, ObjectIds as hex
+// strings and binary data as base64.
+var jsonSchemaTypeSchemas = map[string]map[string]interface{}{
+	"INTEGER":  {"type": "integer"},
+	"DECIMAL":  {"type": "number"},
+	"STRING":   {"type": "string"},
+	"BOOL":     {"type": "boolean"},
+	"TIME":     {"type": "string", "format": "date-time"},
+	"OBJECTID": {"type": "string", "pattern": "^[0-9a-fA-F]{24}$"},
+	"BINARY":   {"type": "string", "contentEncoding": "base64"},
+}
+
+// jsonSchema renders the node.
+func (n *modelNode) jsonSchema() map[string]interface{} {
+	var alternatives []map[string]interface{}
+	simple := true
+	for _, t := range n.Types {
+		var schema map[string]interface{}
+		switch t {
+		case "DOCUMENT":
+			schema = n.objectSchema()
+		case "ARRAY":
+			schema = map[string]interface{}{"type": "array"}
+			if n.Items != nil {
+				schema["items"] = n.Items.jsonSchema()
+			}
+		default:
+			typeSchema, ok := jsonSchemaTypeSchemas[t]
+			if !ok {
+				// Unknown types may hold anything.
+				return map[string]interface{}{}
+			}
+			schema = make(map[string]interface{}, len(typeSchema))
+			for k, v := range typeSchema {
+				schema[k] = v
+			}
+		}
+		simple = simple && len(schema) == 1
+		alternatives = append(alternatives, schema)
+	}
+	switch {
+	case len(alternatives) == 0:
+		return map[string]interface{}{}
+	case len(alternatives) == 1:
+		return alternatives[0]
+	case simple:
+		names := make([]interface{}, len(alternatives))
+		for i, schema := range alternatives {
+			names[i] = schema["type"]
+		}
+		return map[string]interface{}{"type": names}
+	}
+	anyOf := make([]interface{}, len(alternatives))
+	for i, schema := range alternatives {
+		anyOf[i] = schema
+	}
+	return map[string]interface{}{"anyOf": anyOf}
+}
+
+func (n *modelNode) objectSchema() map[string]interface{} {
+	schema := map[string]interface{}{"type": "object"}
+	if n.Properties != nil {
+		properties := make(map[string]interface{}, len(n.Properties))
+		required := []string{}
+		for _, child := range n.Properties {
+			properties[child.Name] = child.jsonSchema()
+			if child.Required {
+				required = append(required, child.Name)
+			}
+		}
+		schema["properties"] = properties
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+	}
+	if n.Rest != nil {
+		schema["additionalProperties"] = n.Rest.jsonSchema()
+	}
+	return schema
+}
+
+// collectionJSONSchema renders the nested JSON Schema of the documents of a
+// collection.
+func collectionJSONSchema(c *collectionModel) map[string]interface{} {
+	schema := c.Document.objectSchema()
+	schema["$schema"] = JSONSchema2020
+	schema["title"] = c.Name
+	return schema
+}
+
+// exportJSONSchema writes the JSON Schema of the only collection of m.
+func exportJSONSchema(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	for _, c := range m.Collections {
+		data, err := json.MarshalIndent(collectionJSONSchema(c), "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// MaxModelDepth stops the expansion of recursive model types.
+const MaxModelDepth = 10
+
+var knownSchemaFlag = cli.StringSliceFlag{
+	Name: "known-schema",
+	Usage: "Application model file: Go source with bson-tagged structs, a JSON Schema, or a JSON schema written by this tool. " +
+		"Fields observed in the database but unknown to the models are reported as shadow-field findings. " +
+		"Prefix a JSON Schema with \"collection=\" to name its collection. Repeatable",
+}
+
+// knownFields is the set of field paths an application model declares, named
+// the way getSchema names fields.
+type knownFields struct {
+	paths map[string]struct{}
+	// opaque holds paths whose content is free-form, e.g. a bson.M; "" makes
+	// every field known.
+	opaque map[string]struct{}
+}
+
+func newKnownFields() *knownFields {
+	return &knownFields{paths: make(map[string]struct{}), opaque: make(map[string]struct{})}
+}
+
+// knows reports whether the model declares the field or a free-form parent.
+func (k *knownFields) knows(name string) bool {
+	if _, ok := k.paths[name]; ok {
+		return true
+	}
+	if _, ok := k.opaque[""]; ok {
+		return true
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] == '.' || strings.HasPrefix(name[i:], "[]") {
+			if _, ok := k.opaque[name[:i]]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// knownSchema holds models by collection name, and Go models by struct name,
+// which are matched to collections loosely.
+type knownSchema struct {
+	collections map[string]*knownFields
+	models      map[string]*knownFields
+}
+
+// normalizeModelName lowercases and drops underscores, so that "OrderItem"
+// matches "order_items".
+func normalizeModelName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+// lookup finds the model of a collection, trying plural forms of Go struct
+// names. A struct named after the collection wins over one whose plural is,
+// e.g. Statuses over Status for "statuses", and ties go to the first name
+// in order, so that the same model is found on every run.
+func (known *knownSchema) lookup(collection string) *knownFields {
+	if k, ok := known.collections[collection]; ok {
+		return k
+	}
+	target := normalizeModelName(collection)
+	names := make([]string, 0, len(known.models))
+	for name := range known.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if normalizeModelName(name) == target {
+			return known.models[name]
+		}
+	}
+	for _, name := range names {
+		n := normalizeModelName(name)
+		candidates := []string{n + "s", n + "es"}
+		if strings.HasSuffix(n, "y") {
+			candidates = append(candidates, n[:len(n)-1]+"ies")
+		}
+		for _, candidate := range candidates {
+			if candidate == target {
+				return known.models[name]
+			}
+		}
+	}
+	return nil
+}
+
+func loadKnownSchemas(specs []string) (*knownSchema, error) {
+	known := &knownSchema{collections: make(map[string]*knownFields), models: make(map[string]*knownFields)}
+	for _, spec := range specs {
+		collection, path := "", spec
+		if i := strings.Index(spec, "="); i != -1 {
+			collection, path = spec[:i], spec[i+1:]
+		}
+		var err error
+		if strings.HasSuffix(path, ".go") {
+			err = loadGoModels(path, known)
+		} else {
+			err = loadJSONModels(path, collection, known)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	return known, nil
+}
+
+// goModelParser collects the field paths of bson-tagged Go structs.
+type goModelParser struct {
+	structs map[string]*ast.StructType
+}
+
+func loadGoModels(path string, known *knownSchema) error {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return err
+	}
+	p := &goModelParser{structs: make(map[string]*ast.StructType)}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok {
+			if st, ok := spec.Type.(*ast.StructType); ok {
+				p.structs[spec.Name.Name] = st
+			}
+		}
+		return true
+	})
+	for name, st := range p.structs {
+		k := newKnownFields()
+		p.addStruct(k, "", st, 0)
+		known.models[name] = k
+	}
+	return nil
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func (p *goModelParser) addStruct(k *knownFields, prefix string, st *ast.StructType, depth int) {
+	if depth > MaxModelDepth {
+		k.opaque[prefix] = struct{}{}
+		return
+	}
+	for _, field := range st.Fields.List {
+		var tag []string
+		if field.Tag != nil {
+			tag = strings.Split(reflect.StructTag(strings.Trim(field.Tag.Value, "`")).Get("bson"), ",")
+		}
+		key, inline := "", false
+		if len(tag) > 0 {
+			key = tag[0]
+			for _, opt := range tag[1:] {
+				inline = inline || opt == "inline"
+			}
+		}
+		if key == "-" {
+			continue
+		}
+		if inline {
+			p.addType(k, prefix, field.Type, depth, true)
+			continue
+		}
+		names := field.Names
+		if len(names) == 0 {
+			// Embedded fields are stored under the lowercased type name.
+			typeExpr := field.Type
+			if star, ok := typeExpr.(*ast.StarExpr); ok {
+				typeExpr = star.X
+			}
+			if ident, ok := typeExpr.(*ast.Ident); ok {
+				names = []*ast.Ident{ident}
+			}
+		}
+		for _, ident := range names {
+			if !ast.IsExported(ident.Name) {
+				continue
+			}
+			name := key
+			if name == "" {
+				name = strings.ToLower(ident.Name)
+			}
+			p.addType(k, joinPath(prefix, name), field.Type, depth, false)
+		}
+	}
+}
+
+// addType declares path with the given Go type. Inlined types contribute
+// their fields at path itself.
+func (p *goModelParser) addType(k *knownFields, path string, expr ast.Expr, depth int, inline bool) {
+	if !inline {
+		k.paths[path] = struct{}{}
+	}
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		p.addType(k, path, t.X, depth, inline)
+	case *ast.ArrayType:
+		if ident, ok := t.Elt.(*ast.Ident); ok && ident.Name == "byte" {
+			return
+		}
+		p.addType(k, path+"[]", t.Elt, depth+1, false)
+	case *ast.MapType, *ast.InterfaceType:
+		k.opaque[path] = struct{}{}
+	case *ast.StructType:
+		p.addStruct(k, path, t, depth+1)
+	case *ast.Ident:
+		if st, ok := p.structs[t.Name]; ok {
+			p.addStruct(k, path, st, depth+1)
+		}
+	case *ast.SelectorExpr:
+		switch t.Sel.Name {
+		case "M", "D", "Raw", "RawD", "A":
+			k.opaque[path] = struct{}{}
+		}
+	}
+}
+
+// loadJSONModels reads a JSON Schema, a map of collection names to JSON
+// Schemas, or a schema file written by this tool.
+func loadJSONModels(path, collection string, known *knownSchema) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if isJSONSchema(doc) {
+		if collection == "" {
+			collection, _ = doc["title"].(string)
+		}
+		if collection == "" {
+			collection = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".json"), ".schema")
+		}
+		k := newKnownFields()
+		jsonSchemaPaths(k, "", doc, doc, 0)
+		known.collections[collection] = k
+		return nil
+	}
+	if _, ok := doc["formatVersion"]; ok {
+		schema, err := parseSchemaFile(data)
+		if err != nil {
+			return err
+		}
+		for name, fields := range schema {
+			k := newKnownFields()
+			for _, f := range fields {
+				k.paths[f.Name] = struct{}{}
+			}
+			known.collections[name] = k
+		}
+		return nil
+	}
+	for name, value := range doc {
+		k := newKnownFields()
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				if field, ok := item.(map[string]interface{}); ok {
+					if fieldName, ok := field["name"].(string); ok {
+						k.paths[fieldName] = struct{}{}
+					}
+				}
+			}
+		case map[string]interface{}:
+			if inner, ok := v["$jsonSchema"].(map[string]interface{}); ok {
+				v = inner
+			}
+			jsonSchemaPaths(k, "", v, v, 0)
+		}
+		known.collections[name] = k
+	}
+	return nil
+}
+
+func isJSONSchema(doc map[string]interface{}) bool {
+	for _, key := range []string{"$schema", "properties", "type", "bsonType"} {
+		if _, ok := doc[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRef follows a local "#/$defs/Name" or "#/definitions/Name" reference.
+func resolveRef(root map[string]interface{}, ref string) map[string]interface{} {
+	parts := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+	var node interface{} = root
+	for _, part := range parts {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+	m, _ := node.(map[string]interface{})
+	return m
+}
+
+func jsonSchemaPaths(k *knownFields, path string, node, root map[string]interface{}, depth int) {
+	if depth > MaxModelDepth {
+		k.opaque[path] = struct{}{}
+		return
+	}
+	if ref, ok := node["$ref"].(string); ok {
+		if target := resolveRef(root, ref); target != nil {
+			node = target
+		}
+	}
+	if path != "" {
+		k.paths[path] = struct{}{}
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		if alternatives, ok := node[key].([]interface{}); ok {
+			for _, alt := range alternatives {
+				if m, ok := alt.(map[string]interface{}); ok {
+					jsonSchemaPaths(k, path, m, root, depth+1)
+				}
+			}
+		}
+	}
+	if items, ok := node["items"].(map[string]interface{}); ok {
+		jsonSchemaPaths(k, path+"[]", items, root, depth+1)
+	}
+	properties, hasProperties := node["properties"].(map[string]interface{})
+	for name, child := range properties {
+		if m, ok := child.(map[string]interface{}); ok {
+			jsonSchemaPaths(k, joinPath(path, name), m, root, depth+1)
+		}
+	}
+	isObject := node["type"] == "object" || node["bsonType"] == "object"
+	if additional, ok := node["additionalProperties"]; ok && additional != false {
+		k.opaque[path] = struct{}{}
+	} else if isObject && !hasProperties {
+		k.opaque[path] = struct{}{}
+	}
+}
+
+// reportShadowFields reports fields observed in the database that the
+// application models do not know about.
+func reportShadowFields(known *knownSchema, schema map[string]docSchema) {
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, collection := range names {
+		k := known.lookup(collection)
+		if k == nil {
+			addFinding(finding{
+				Collection: collection,
+				Kind:       "unmodeled-collection",
+				Message:    fmt.Sprintf("no application model matches collection %v", collection),
+			})
+			continue
+		}
+		shadow := 0
+		for _, f := range schema[collection] {
+			if isIDField(f.Name) || f.summarizesKeys() || k.knows(f.Name) {
+				continue
+			}
+			shadow++
+			addFinding(finding{
+				Collection: collection,
+				Field:      f.Name,
+				Kind:       "shadow-field",
+				Message:    fmt.Sprintf("%v.%v (%v) is unknown to the application models", collection, f.Name, strings.Join(f.fieldTypes(), "|")),
+			})
+		}
+		if shadow > 0 {
+			log.Printf("Collection %v has %v shadow fields\n", collection, shadow)
+		}
+	}
+}
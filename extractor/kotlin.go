@@ -0,0 +1,175 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// KotlinFormat writes Kotlin data classes of the collections for the data
+// class codec of the official Kotlin driver, which KMongo reads too.
+const KotlinFormat = "kotlin"
+
+var kotlinPackageFlag = cli.StringFlag{
+	Name:  "kotlin-package",
+	Usage: "Package of the Kotlin source written by -format kotlin",
+	Value: "model",
+}
+
+// kotlinTypes are the Kotlin types of the base types.
+var kotlinTypes = map[string]string{
+	"INTEGER":  "Long",
+	"DECIMAL":  "Double",
+	"STRING":   "String",
+	"BOOL":     "Boolean",
+	"TIME":     "Instant",
+	"OBJECTID": "ObjectId",
+	"BINARY":   "ByteArray",
+}
+
+// kotlinImports are the imports of the simple names the classes may use.
+var kotlinImports = map[string]string{
+	"BsonId":       "org.bson.codecs.pojo.annotations.BsonId",
+	"BsonProperty": "org.bson.codecs.pojo.annotations.BsonProperty",
+	"BsonValue":    "org.bson.BsonValue",
+	"Document":     "org.bson.Document",
+	"Instant":      "java.time.Instant",
+	"ObjectId":     "org.bson.types.ObjectId",
+}
+
+// kotlinReserved are the hard keywords of Kotlin, which cannot name a
+// property.
+var kotlinReserved = map[string]bool{
+	"as": true, "break": true, "class": true, "continue": true, "do": true, "else": true, "false": true,
+	"for": true, "fun": true, "if": true, "in": true, "interface": true, "is": true, "null": true,
+	"object": true, "package": true, "return": true, "super": true, "this": true, "throw": true, "true": true,
+	"try": true, "typealias": true, "typeof": true, "val": true, "var": true, "when": true, "while": true,
+}
+
+// kotlinWriter writes the data class of a collection followed by the data
+// classes of its nested documents.
+type kotlinWriter struct {
+	source  bytes.Buffer
+	imports map[string]bool
+	classes map[string]bool
+	pending []pendingStruct
+}
+
+// use returns a simple name, importing it.
+func (w *kotlinWriter) use(name string) string {
+	if kotlinImports[name] != "" {
+		w.imports[kotlinImports[name]] = true
+	}
+	return name
+}
+
+// kotlinType returns the Kotlin type of the node, queuing the classes it
+// needs under names derived from name. Mixed types are BsonValues, except
+// for integers mixed with decimals.
+func (w *kotlinWriter) kotlinType(name string, n *modelNode) string {
+	if n.Numeric {
+		return "Double"
+	}
+	types := n.Types
+	if len(types) != 1 {
+		return w.use("BsonValue")
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		if n.Properties == nil {
+			if n.Rest == nil {
+				return w.use("Document")
+			}
+			return "Map<String, " + w.kotlinType(name+"Value", n.Rest) + ">"
+		}
+		className := uniqueName(w.classes, name)
+		w.pending = append(w.pending, pendingStruct{name: className, node: n})
+		return className
+	case "ARRAY":
+		if n.Items == nil {
+			return "List<" + w.use("BsonValue") + ">"
+		}
+		return "List<" + w.kotlinType(name+"Item", n.Items) + ">"
+	}
+	if t, ok := kotlinTypes[types[0]]; ok {
+		return w.use(t)
+	}
+	return w.use("BsonValue")
+}
+
+// writeClass writes the data class of a document with a property per
+// field. Properties not named after their field are mapped with
+// @BsonProperty; the _id of a collection is the @BsonId. Fields missing from
+// some documents holding them are nullable and default to null. Summarized
+// -dynamic keys are left out, as the data class codec cannot map them next
+// to the known fields.
+func (w *kotlinWriter) writeClass(s pendingStruct, collection bool) {
+	if len(s.node.Properties) == 0 {
+		fmt.Fprintf(&w.source, "class %v\n", s.name)
+		return
+	}
+	fmt.Fprintf(&w.source, "data class %v(\n", s.name)
+	properties := make(map[string]bool)
+	for _, child := range s.node.Properties {
+		name := uniqueName(properties, camelName(child.Name, kotlinReserved))
+		typ := w.kotlinType(s.name+goName(child.Name), child)
+		w.source.WriteString("    ")
+		switch {
+		case child.Name == "_id" && collection:
+			fmt.Fprintf(&w.source, "@%v ", w.use("BsonId"))
+		case name != child.Name:
+			fmt.Fprintf(&w.source, "@%v(%v) ", w.use("BsonProperty"), strconv.Quote(child.Name))
+		}
+		if child.Required {
+			fmt.Fprintf(&w.source, "val %v: %v,\n", name, typ)
+		} else {
+			fmt.Fprintf(&w.source, "val %v: %v? = null,\n", name, typ)
+		}
+	}
+	w.source.WriteString(")\n")
+}
+
+// kotlinClasses returns a Kotlin file declaring a data class per
+// collection, named after the collection, and the classes of their nested
+// documents.
+func kotlinClasses(pkg string, m *schemaModel) []byte {
+	w := &kotlinWriter{imports: make(map[string]bool), classes: make(map[string]bool)}
+	for simple := range kotlinImports {
+		w.classes[simple] = true
+	}
+	for _, c := range m.Collections {
+		name := uniqueName(w.classes, goName(c.Name))
+		fmt.Fprintf(&w.source, "\n/** A document of the %v collection. */\n", c.Name)
+		w.writeClass(pendingStruct{name: name, node: c.Document}, true)
+		for len(w.pending) > 0 {
+			s := w.pending[0]
+			w.pending = w.pending[1:]
+			w.source.WriteString("\n")
+			w.writeClass(s, false)
+		}
+	}
+	var source bytes.Buffer
+	source.WriteString("// Generated by extract_mgo from sampled documents.\n\n")
+	fmt.Fprintf(&source, "package %v\n", pkg)
+	if len(w.imports) > 0 {
+		source.WriteString("\n")
+		imports := make([]string, 0, len(w.imports))
+		for path := range w.imports {
+			imports = append(imports, path)
+		}
+		sort.Strings(imports)
+		for _, path := range imports {
+			fmt.Fprintf(&source, "import %v\n", path)
+		}
+	}
+	source.Write(w.source.Bytes())
+	return source.Bytes()
+}
+
+func exportKotlin(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, kotlinClasses(cmdInfo.kotlinPackage, m), 0644)
+}
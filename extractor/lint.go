@@ -0,0 +1,247 @@
+package extractor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Severities of lint rules, from the least severe. SeverityOff turns a rule
+// off.
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+	SeverityOff     = "off"
+)
+
+var severityLevels = map[string]int{SeverityInfo: 1, SeverityWarning: 2, SeverityError: 3}
+
+var (
+	lintFlag = cli.BoolFlag{
+		Name: "lint",
+		Usage: "Check the fields of the schema against the built-in lint rules, those of the config and of " +
+			"-lint-rules, and report the violations as findings",
+	}
+	lintRulesFlag = cli.StringSliceFlag{
+		Name: "lint-rules",
+		Usage: "YAML rule pack of -lint with a \"rules\" list. A rule with the id of an earlier one, built-in or " +
+			"from the config, replaces it, or turns it off with severity \"off\". Repeatable",
+	}
+	failOnFlag = cli.StringFlag{
+		Name: "fail-on",
+		Usage: "Fail the run, after writing its outputs, when -lint reports a violation of this severity or a " +
+			"higher one: \"error\", \"warning\" or \"info\"",
+	}
+)
+
+// lintRule flags the fields matching all its conditions; conditions left
+// empty match any field. Globs are path.Match patterns.
+type lintRule struct {
+	ID       string `yaml:"id"`
+	Severity string `yaml:"severity"`
+	Message  string `yaml:"message"`
+	// Collections and Fields are globs on the names of collections and the
+	// paths of fields, e.g. "address.*"; Names are globs on the last part of
+	// the path, e.g. "*At".
+	Collections []string `yaml:"collections"`
+	Fields      []string `yaml:"fields"`
+	Names       []string `yaml:"names"`
+	// Types match fields with one of these types, either exactly or by base
+	// type, e.g. "STRING" also matches "STRING(NUMERIC)".
+	Types []string `yaml:"types"`
+	// Mixed matches fields with several types, or with one type only when
+	// false. Integers mixed with decimals count as one type.
+	Mixed *bool `yaml:"mixed"`
+	// Required matches fields in every sampled document, or missing from
+	// some when false.
+	Required *bool `yaml:"required"`
+}
+
+// lintPack is a list of rules, from the config or a -lint-rules file.
+type lintPack struct {
+	Rules []lintRule `yaml:"rules"`
+}
+
+var lintTrue = true
+
+var builtinLintRules = []lintRule{
+	{ID: "mixed-types", Severity: SeverityWarning, Mixed: &lintTrue,
+		Message: "values have several types"},
+	{ID: "numbers-as-strings", Severity: SeverityWarning, Types: []string{"STRING(NUMERIC)"},
+		Message: "numbers should be stored as numbers"},
+	{ID: "booleans-as-strings", Severity: SeverityWarning, Types: []string{"STRING(BOOLEAN)"},
+		Message: "booleans should be stored as booleans"},
+	{ID: "dates-as-numbers", Severity: SeverityInfo, Types: []string{"INTEGER(EPOCH_SECONDS)", "INTEGER(EPOCH_MILLIS)"},
+		Message: "dates should be stored as dates"},
+	{ID: "vague-names", Severity: SeverityInfo, Names: []string{"data", "info", "misc", "tmp", "temp", "obj", "stuff"},
+		Message: "the name says nothing of what the field holds"},
+	{ID: "names-with-spaces", Severity: SeverityWarning, Names: []string{"* *"},
+		Message: "field names with spaces must be quoted in most query languages"},
+}
+
+// lintRules is the rule set of the run: the built-in rules overridden by
+// those of the packs, in order.
+type lintRules []lintRule
+
+// validate checks a rule, naming it by where it comes from.
+func (r *lintRule) validate(source string) error {
+	if r.ID == "" {
+		return fmt.Errorf("%v: rule without id", source)
+	}
+	if _, ok := severityLevels[r.Severity]; !ok && r.Severity != SeverityOff {
+		return fmt.Errorf("%v: rule %v: unknown severity %q", source, r.ID, r.Severity)
+	}
+	if r.Message == "" && r.Severity != SeverityOff {
+		return fmt.Errorf("%v: rule %v: missing message", source, r.ID)
+	}
+	for _, globs := range [][]string{r.Collections, r.Fields, r.Names} {
+		for _, glob := range globs {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("%v: rule %v: %v: %v", source, r.ID, glob, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadLintRules returns the built-in rules with those of the config and of
+// the rule pack files applied.
+func loadLintRules(cfg lintPack, files []string) (lintRules, error) {
+	rules := append(lintRules{}, builtinLintRules...)
+	add := func(source string, pack lintPack) error {
+		for _, rule := range pack.Rules {
+			if err := rule.validate(source); err != nil {
+				return err
+			}
+			replaced := false
+			for i := range rules {
+				if rules[i].ID == rule.ID {
+					rules[i], replaced = rule, true
+				}
+			}
+			if !replaced {
+				rules = append(rules, rule)
+			}
+		}
+		return nil
+	}
+	if err := add("config", cfg); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var pack lintPack
+		if err := yaml.UnmarshalStrict(data, &pack); err != nil {
+			return nil, fmt.Errorf("%v: %v", file, err)
+		}
+		if err := add(file, pack); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func matchesAny(globs []string, name string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matches tells whether a field of a collection with sampled documents
+// breaks the rule.
+func (r *lintRule) matches(collection string, f *docField, sampled int) bool {
+	name := f.Name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	if r.Severity == SeverityOff || !matchesAny(r.Collections, collection) || !matchesAny(r.Fields, f.Name) ||
+		!matchesAny(r.Names, name) {
+		return false
+	}
+	types := f.fieldTypes()
+	if len(r.Types) > 0 {
+		found := false
+		for _, t := range types {
+			found = found || containsString(r.Types, t) || containsString(r.Types, baseType(t))
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Mixed != nil {
+		numbers := numericTypes(types)
+		if *r.Mixed != (len(types) > 1 && !numbers) {
+			return false
+		}
+	}
+	if r.Required != nil && *r.Required != (f.Count >= sampled) {
+		return false
+	}
+	return true
+}
+
+// lint reports the fields breaking the rules as findings of kind
+// "lint:<id>", and returns the number of violations by severity.
+func (rules lintRules) lint(schema map[string]docSchema, stats map[string]*collectionStats) map[string]int {
+	violations := make(map[string]int)
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, collection := range names {
+		sampled := 0
+		if s := stats[collection]; s != nil {
+			sampled = s.Sampled
+		}
+		for i := range schema[collection] {
+			f := &schema[collection][i]
+			for j := range rules {
+				rule := &rules[j]
+				if !rule.matches(collection, f, sampled) {
+					continue
+				}
+				violations[rule.Severity]++
+				addFinding(finding{
+					Collection: collection,
+					Field:      f.Name,
+					Kind:       "lint:" + rule.ID,
+					Severity:   rule.Severity,
+					Message: fmt.Sprintf("%v.%v (%v): %v", collection, f.Name,
+						strings.Join(f.fieldTypes(), "|"), rule.Message),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// lintFailure fails the run when there are violations of the -fail-on
+// severity or a higher one.
+func lintFailure(violations map[string]int, failOn string) error {
+	n := 0
+	for severity, count := range violations {
+		if severityLevels[severity] >= severityLevels[failOn] {
+			n += count
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	return cli.NewExitError(fmt.Sprintf("%v lint violations of severity %v or higher", n, failOn), 1)
+}
@@ -0,0 +1,1173 @@
+package extractor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/emmansun/extract-mgo-schema/mgoschema"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	CSVFormat  = "csv"
+	JSONFormat = "json"
+
+	MaxTryRecords = 100
+	MaxGoRoutines = 4
+)
+
+type commandInfo struct {
+	urls       []string
+	url        string
+	output     string
+	outputPath *outputPath
+	goPackage  string
+	// avroDecimal is set by -avro-decimal.
+	avroDecimal *avroDecimal
+	columns     []string
+	translator  *translator
+	namespaces  *namespaceRule // set by -namespaces
+	format      string
+	dbName      string
+	mergeInto   string
+	findings    string
+	report      string
+	bundle      *outputPath // set by -bundle
+	baseline    string
+	valueDrift  bool
+	federation  string
+	known       *knownSchema
+
+	expectations       string
+	coercionPlan       string
+	tenantMatrix       string
+	expectationsFormat string
+	catalogs           []catalogTarget
+	catalogToken       string
+	privacy            *privacyPolicy
+	hiveLocation       string
+	clickHouseEngine   string
+	clickHouseOrderBy  []string
+	mysqlVarchar       int
+	mysqlDecimal       *avroDecimal
+	javaPackage        string
+	csharpNamespace    string
+	kotlinPackage      string
+	mappingTable       *template.Template
+	mappingColumn      *template.Template
+	lintRules          lintRules // set by -lint
+	failOn             string
+	cache              *schemaCache // set by -cache-ttl
+
+	emptyCollections   string
+	maxFields          int
+	sharedModels       bool
+	fieldOverflow      string
+	owners             ownerRules
+	groupBy            string
+	collections        []string
+	excludeCollections []string
+	presets            *preset
+	readOnly           bool
+	// applyValidators is set by apply-validators without -dry-run.
+	applyValidators bool
+	prune           int
+	pruneLog        string
+
+	checkIndexes bool
+	indexStats   bool
+
+	strategyName   string
+	strategy       SamplingStrategy
+	scanPartitions int
+	reader         *sampleReader
+	excludedIDs    *excludedIDs
+	timeField      string
+	timeWindow     time.Duration
+
+	changePositions *changePositions // set by -since-token
+	archives        []archiveSource
+	subset          *schemaSubset // set by -only-tag and -owner
+
+	// snapshotURL is the private mongod of -snapshot-dbpath, dialed instead
+	// of urls, which still identify the deployment.
+	snapshotURL string
+}
+
+type docField struct {
+	Name  string   `json:"name"`
+	Type  string   `json:"type"`
+	Types []string `json:"types,omitempty"`
+	// Count is the number of sampled documents containing the field.
+	Count int `json:"count,omitempty"`
+	// Missed counts consecutive merge runs in which the field was not observed.
+	Missed int `json:"missed,omitempty"`
+	// IndexUsage lists the indexes on the field with their $indexStats usage.
+	IndexUsage []indexUsage `json:"indexUsage,omitempty"`
+	// Unique and Monotonicity describe _id: uniqueness and whether ids grow
+	// with insertion order ("increasing", "non-monotonic" or "unknown").
+	Unique       bool   `json:"unique,omitempty"`
+	Monotonicity string `json:"monotonicity,omitempty"`
+	// Owner and Domain are set on fields owned apart from their collection.
+	Owner  string `json:"owner,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	// Values is the -deep profile of the sampled values.
+	Values *valueSummary `json:"values,omitempty"`
+	// Provenance lists, per type, _id values of sampled documents where the
+	// field has that type.
+	Provenance map[string][]interface{} `json:"provenance,omitempty"`
+	// KeyTypes and Keys describe the "*" field summarizing the keys of a
+	// -dynamic document past the limit: the number of values of each type,
+	// and the estimated number of distinct keys.
+	KeyTypes map[string]int `json:"keyTypes,omitempty"`
+	Keys     int            `json:"keys,omitempty"`
+	// Conditions describe when an optional field appears, found by
+	// -dependencies, e.g. "required when status == \"refunded\"".
+	Conditions []string `json:"conditions,omitempty"`
+	// Coercion suggests how to clean up a mixed-type field.
+	Coercion *coercion `json:"coercion,omitempty"`
+	// ElementTypes counts the sampled elements of an array by type, and
+	// Homogeneous tells whether they all have the same type.
+	ElementTypes map[string]int `json:"elementTypes,omitempty"`
+	Homogeneous  *bool          `json:"homogeneous,omitempty"`
+	// Sources are the databases the field was seen in with -archive: "live"
+	// and the names of archives.
+	Sources []string `json:"sources,omitempty"`
+	// Tenants counts the sampled documents of each -tenant-field tenant
+	// holding the field; those of _id are all the documents of the tenant.
+	Tenants map[string]int `json:"tenants,omitempty"`
+
+	profile  *fieldProfile
+	presence presence
+	keys     *hyperLogLog
+	// valuePresence holds the documents with each value of a categorical
+	// field for -dependencies.
+	valuePresence map[string]presence
+	typeDocs      map[string]int // sampled documents holding each type
+	tenantDocs    map[string]int // sampled documents of each tenant holding the field
+}
+
+type docSchema []docField
+
+// Len is the number of elements in the collection.
+func (schema docSchema) Len() int {
+	return len(schema)
+}
+
+// Less reports whether the element with
+// index i should sort before the element with index j.
+// _id and its parts always come first.
+func (schema docSchema) Less(i, j int) bool {
+	iID, jID := isIDField(schema[i].Name), isIDField(schema[j].Name)
+	if iID != jID {
+		return iID
+	}
+	return strings.Compare(schema[i].Name, schema[j].Name) < 0
+}
+
+func isIDField(name string) bool {
+	return name == "_id" || strings.HasPrefix(name, "_id.")
+}
+
+// Swap swaps the elements with indexes i and j.
+func (schema docSchema) Swap(i, j int) {
+	temp := schema[i]
+	schema[i] = schema[j]
+	schema[j] = temp
+}
+
+var (
+	datatabseFlag = cli.StringSliceFlag{
+		Name:  "database",
+		Usage: "Database connection string. Example: \"mongodb://localhost:3001/meteor\". Repeat it to list failover candidates, tried in order until one has a reachable primary",
+	}
+	outputFlag = cli.StringFlag{
+		Name: "output",
+		Usage: "Output file. May be a template with {{.Database}}, {{.Collection}}, {{.Format}}, {{.Timestamp}}, {{.Date}} " +
+			"and {{.Time}}, e.g. \"schemas/{{.Database}}/{{.Collection}}.{{.Format}}\"; naming the collection writes one file per collection",
+	}
+	formatFlag = cli.StringFlag{
+		Name: "format",
+		Usage: "Output file format. Can be \"json\", \"csv\", \"jsonschema\" (one JSON Schema draft 2020-12 document " +
+			"per collection), \"gostruct\" (Go structs with bson and json tags), \"postgres-ddl\" (PostgreSQL " +
+			"CREATE TABLE statements), \"bigquery\" (one BigQuery table schema per collection), \"avro\" (one Avro " +
+			"schema per collection), \"proto\" (proto3 messages), \"graphql\" (GraphQL object types), \"spark\" " +
+			"(one Spark StructType per collection), \"markdown\" (a data dictionary in the -lang language), \"html\" " +
+			"(the data dictionary as a single page), \"pii-report\" (a CSV inventory of the fields tagged by the " +
+			"config), \"mermaid\" (an ER diagram with the references between collections), \"plantuml\" (a class " +
+			"diagram of the collections and embedded documents), \"dbml\" (for dbdiagram.io and dbdocs), " +
+			"\"mongo-validator\" (a collMod command setting a $jsonSchema validator per collection), \"openapi\" " +
+			"(OpenAPI 3.1 components/schemas), \"hive-ddl\" (Hive/Athena CREATE EXTERNAL TABLE statements), " +
+			"\"snowflake-ddl\" (Snowflake CREATE TABLE statements), \"clickhouse-ddl\" (ClickHouse CREATE TABLE " +
+			"statements), \"mysql-ddl\" (MySQL CREATE TABLE statements with JSON columns for embedded documents), " +
+			"\"pydantic\" (Python Pydantic v2 models), \"java\" (a Spring Data MongoDB class per collection, written " +
+			"into the -output directory), \"csharp\" (C# classes with MongoDB.Bson attributes), \"mapping\" " +
+			"(a source-to-target mapping stub pairing each field with its postgres-ddl column), \"rust\" (Rust " +
+			"structs with serde attributes for the bson crate), \"kotlin\" (Kotlin data classes for the official " +
+			"Kotlin driver and KMongo), \"zod\" (TypeScript Zod schemas to validate documents at runtime) or " +
+			"\"model\" (the nested model the other formats are generated from). Default is \"json\"",
+		Value: JSONFormat,
+	}
+	collectionsFlag = cli.StringSliceFlag{
+		Name:  "collections",
+		Usage: "Only extract collections matching this glob pattern, e.g. \"orders*\". Repeatable",
+	}
+	excludeCollectionsFlag = cli.StringSliceFlag{
+		Name:  "exclude-collections",
+		Usage: "Skip collections matching this glob pattern. Repeatable",
+	}
+)
+
+var tasks chan string
+
+// fieldSet indexes the fields of a schema under construction.
+type fieldSet struct {
+	collection string
+	index      map[string]int                 // field name to position in the schema
+	doc        map[string]struct{}            // fields already counted for the current document
+	docID      interface{}                    // _id of the current document
+	docIndex   int                            // number of the current document
+	keys       map[string]map[string]struct{} // keys enumerated per -dynamic document
+	budget     *profilingBudget
+	profiling  bool            // whether the values of the current document are profiled
+	tenant     string          // -tenant-field of the current document
+	tenants    map[string]bool // tenants told apart, up to MaxTenants
+}
+
+func newFieldSet(collection string) *fieldSet {
+	return &fieldSet{
+		collection: collection,
+		index:      make(map[string]int),
+		docIndex:   -1,
+		keys:       make(map[string]map[string]struct{}),
+		budget:     profilingBudgetOf(collection),
+	}
+}
+
+// nextDocument starts counting field presence for a new sampled document.
+func (fieldSet *fieldSet) nextDocument(doc bson.D) {
+	fieldSet.doc = make(map[string]struct{})
+	fieldSet.docID = documentID(doc)
+	if id, ok := fieldSet.docID.(string); ok {
+		fieldSet.docID = stringValue(fieldSet.collection, "_id", id)
+	}
+	fieldSet.docIndex++
+	fieldSet.profiling = fieldSet.budget.allows()
+	fieldSet.tenant = fieldSet.tenantOf(doc)
+}
+
+// addIfNotExists adds the field to the schema unless it is known already, in
+// which case a new type is recorded on it, and returns the schema entry.
+func addIfNotExists(schema *docSchema, field *docField, fieldSet *fieldSet) *docField {
+	i, ok := fieldSet.index[field.Name]
+	if !ok {
+		i = len(*schema)
+		fieldSet.index[field.Name] = i
+		*schema = append(*schema, *field)
+		emitEvent(event{Type: EventFieldDiscovered, Collection: fieldSet.collection, Field: field.Name, FieldType: field.Type})
+	} else {
+		(*schema)[i].addType(field.Type)
+	}
+	if _, ok := fieldSet.doc[field.Name]; !ok {
+		fieldSet.doc[field.Name] = struct{}{}
+		(*schema)[i].Count++
+		(*schema)[i].presence.set(fieldSet.docIndex)
+		(*schema)[i].recordTenant(fieldSet.tenant)
+	}
+	liveTail.observe(fieldSet.collection, field.Name, field.Type)
+	(*schema)[i].recordProvenance(field.Type, fieldSet.docID)
+	(*schema)[i].recordTypeDocument(field.Type, fieldSet)
+	return &(*schema)[i]
+}
+
+// typeOf returns the schema type name of a BSON value. Documents may be
+// ordered (bson.D) or unordered (bson.M, other maps with string keys) and
+// arrays any slice, as when decoded into Go values rather than bson.D.
+func typeOf(object interface{}) string {
+	switch object.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "INTEGER"
+	case float32, float64:
+		return "DECIMAL"
+	case string:
+		return "STRING"
+	case bool:
+		return "BOOL"
+	case time.Time:
+		return "TIME"
+	case bson.ObjectId:
+		return "OBJECTID"
+	case bson.Binary, []uint8:
+		return "BINARY"
+	case bson.D, bson.M, map[string]interface{}:
+		return "DOCUMENT"
+	case []interface{}:
+		return "ARRAY"
+	}
+	switch v := reflect.ValueOf(object); v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			return "DOCUMENT"
+		}
+	case reflect.Slice, reflect.Array:
+		return "ARRAY"
+	}
+	return unknownType(object)
+}
+
+// valueType returns the type of the value at path, as given by the
+// registered type hooks or else inferred by typeOf.
+func valueType(path string, object interface{}) string {
+	if t, ok := mgoschema.TypeOverride(path, object); ok {
+		return t
+	}
+	return typeOf(object)
+}
+
+// asDocument returns the elements of a document, those of unordered
+// documents sorted by name.
+func asDocument(object interface{}) bson.D {
+	if doc, ok := object.(bson.D); ok {
+		return doc
+	}
+	v := reflect.ValueOf(object)
+	doc := make(bson.D, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		doc = append(doc, bson.DocElem{Name: key.String(), Value: v.MapIndex(key).Interface()})
+	}
+	sort.Slice(doc, func(i, j int) bool { return doc[i].Name < doc[j].Name })
+	return doc
+}
+
+// asArray returns the elements of an array.
+func asArray(object interface{}) []interface{} {
+	if array, ok := object.([]interface{}); ok {
+		return array
+	}
+	v := reflect.ValueOf(object)
+	array := make([]interface{}, v.Len())
+	for i := range array {
+		array[i] = v.Index(i).Interface()
+	}
+	return array
+}
+
+func getSchema(prefix string, object interface{}, schema *docSchema, fieldSet *fieldSet) {
+	if object == nil {
+		return
+	}
+	field := new(docField)
+	if prefix != "" {
+		field.Name = prefix
+	}
+	if t, ok := mgoschema.TypeOverride(field.Name, object); ok {
+		field.Type = t
+		addIfNotExists(schema, field, fieldSet)
+		return
+	}
+	field.Type = typeOf(object)
+	switch baseType(field.Type) {
+	case "BINARY":
+		addIfNotExists(schema, field, fieldSet)
+	case "DOCUMENT":
+		if field.Name == "_id" {
+			// A compound _id is reported itself, not only through its parts.
+			addIfNotExists(schema, field, fieldSet)
+		}
+		getStructureSchema(field.Name, asDocument(object), schema, fieldSet)
+	case "ARRAY":
+		elements := asArray(object)
+		addIfNotExists(schema, field, fieldSet).recordElementTypes(field.Name+"[]", elements)
+		for i, v := range elements {
+			if i < MaxTryRecords {
+				getSchema(field.Name+"[]", v, schema, fieldSet)
+			} else {
+				break
+			}
+		}
+	case "UNKNOWN":
+		addIfNotExists(schema, field, fieldSet)
+		addWarning(fieldSet.collection, field.Name, "unknown type %v", reflect.TypeOf(object))
+	default:
+		if s, ok := object.(string); ok {
+			object = stringValue(fieldSet.collection, field.Name, s)
+		}
+		entry := addIfNotExists(schema, field, fieldSet)
+		entry.observe(object, fieldSet.profiling)
+		if fieldSet.profiling {
+			entry.recordValuePresence(object, fieldSet.docIndex)
+		}
+	}
+}
+
+func getStructureSchema(prefix string, object bson.D, schema *docSchema, fieldSet *fieldSet) {
+	dynamic := dynamicSchemas.dynamic(fieldSet.collection, prefix)
+	for _, v := range object {
+		if v.Value == nil {
+			continue
+		}
+		key := fieldKey(fieldSet.collection, prefix, v.Name)
+		name := prefix
+		if prefix == "" {
+			name = key
+		} else {
+			name = prefix + "." + key
+		}
+		if dynamic && name != "_id" && !fieldSet.enumerate(prefix, key) {
+			summarizeKey(prefix, key, v.Value, schema, fieldSet)
+			continue
+		}
+		getSchema(name, v.Value, schema, fieldSet)
+	}
+}
+
+// scanCollection runs the sample query against c and returns the schema of
+// the documents read together with their number.
+func scanCollection(c *mgo.Collection, q sampleQuery, reader *sampleReader) (docSchema, int, error) {
+	fieldSet := newFieldSet(c.Name)
+	var colSchema = docSchema{}
+	sampled := 0
+	err := reader.run(c, q, func(doc bson.D) {
+		sampled++
+		fieldSet.nextDocument(doc)
+		getStructureSchema("", doc, &colSchema, fieldSet)
+	})
+	return colSchema, sampled, err
+}
+
+// genCollectionSchema samples the collection and returns its schema together
+// with the number of sampled documents and the query read. Full scans of large collections are
+// split into parallel _id ranges with -scan-partitions. With -since-token,
+// collections with a saved position read their changes instead.
+func genCollectionSchema(c *mgo.Collection, cmdInfo *commandInfo, documents int) (docSchema, int, *sampledQuery, error) {
+	q := cmdInfo.strategy.Query(c, MaxTryRecords).excluding(cmdInfo.excludedIDs.forCollection(c.Name))
+	var colSchema docSchema
+	var sampled int
+	var query *sampledQuery
+	var err error
+	budget := startProfilingBudget(c.Name)
+	switch {
+	case cmdInfo.changePositions != nil && cmdInfo.changePositions.get(c.Name) != nil:
+		// Change streams are read without the read concern.
+		query = (&sampleReader{}).describe(c, changeQuery(cmdInfo.changePositions.get(c.Name)), nil)
+		colSchema, sampled, err = scanChanges(c, cmdInfo.changePositions)
+	case cmdInfo.changePositions != nil:
+		if err := startTracking(c, cmdInfo.changePositions); err != nil {
+			return nil, 0, nil, err
+		}
+		fallthrough
+	default:
+		var partitions []bson.M
+		if cmdInfo.scanPartitions > 1 && documents >= MinPartitionDocuments && partitionable(q) {
+			colSchema, sampled, partitions, err = scanPartitioned(c, q, cmdInfo.reader, cmdInfo.scanPartitions)
+		} else {
+			colSchema, sampled, err = scanCollection(c, q, cmdInfo.reader)
+		}
+		query = cmdInfo.reader.describe(c, q, partitions)
+	}
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, 0, nil, err
+	}
+	// Dependencies cannot be told from the values of part of the sample.
+	exceeded := budget.end(c.Name, sampled)
+	classifyFields(c.Name, colSchema)
+	suggestCoercions(c.Name, colSchema, documents, sampled)
+	reportArrayHomogeneity(c.Name, colSchema)
+	reportFoldVariants(c.Name, colSchema)
+	reportDuplicateFields(c.Name, colSchema)
+	if tenantField != "" {
+		reportTenantFields(c.Name, colSchema)
+	}
+	if dependencyAnalysis && !exceeded {
+		reportDependencies(c.Name, colSchema)
+	}
+	countKeys(colSchema)
+	summarizeValues(c.Name, colSchema)
+	describeID(c, colSchema)
+	sort.Sort(colSchema)
+	return colSchema, sampled, query, nil
+}
+
+// collectionStats describes how a collection was sampled.
+type collectionStats struct {
+	Documents int `json:"documents"`
+	Sampled   int `json:"sampled"`
+	// Excluded counts the documents left out by -exclude-ids.
+	Excluded int `json:"excluded,omitempty"`
+	Fields   int `json:"fields"`
+	// Collation is the default collation, absent for binary comparison.
+	Collation bson.M        `json:"collation,omitempty"`
+	Quality   *qualityScore `json:"quality,omitempty"`
+	Owner     string        `json:"owner,omitempty"`
+	Domain    string        `json:"domain,omitempty"`
+	// Query is the read the sample was taken with.
+	Query *sampledQuery `json:"query,omitempty"`
+	// TTL lists the TTL indexes expiring the documents.
+	TTL []ttlIndex `json:"ttl,omitempty"`
+}
+
+// extractCollection infers the schema of one collection and gathers its
+// statistics and annotations.
+func extractCollection(c *mgo.Collection, cmdInfo *commandInfo) (docSchema, *collectionStats, error) {
+	documents, err := c.Count()
+	if err != nil {
+		return nil, nil, err
+	}
+	colSchema, sampled, query, err := genCollectionSchema(c, cmdInfo, documents)
+	if err != nil {
+		return nil, nil, err
+	}
+	colSchema = cmdInfo.presets.apply(colSchema)
+	if cmdInfo.checkIndexes {
+		checkIndexes(c, colSchema, sampled)
+	}
+	if cmdInfo.indexStats {
+		annotateIndexUsage(c, colSchema)
+	}
+	stats := &collectionStats{
+		Documents: documents,
+		Sampled:   sampled,
+		Excluded:  countExcluded(c, cmdInfo.excludedIDs.forCollection(c.Name)),
+		Fields:    len(colSchema),
+		Collation: collectionCollation(c),
+		Quality:   scoreCollection(c.Name, colSchema, sampled),
+		Query:     query,
+		TTL:       collectionTTL(c),
+	}
+	cmdInfo.owners.stamp(c.Name, colSchema, stats)
+	return colSchema, stats, nil
+}
+
+// getDbSchema extracts the collections of the database. The first collection
+// failing fails the extraction; the collections not started yet are skipped.
+func getDbSchema(db *mgo.Database, cmdInfo *commandInfo) (map[string]docSchema, map[string]*collectionStats, error) {
+	log.Printf("Extract schema for database %v\n", db.Name)
+	defer func(start time.Time) {
+		log.Printf("Extract schema for database %v done, used time %v\n", db.Name, time.Now().Sub(start))
+	}(time.Now())
+	dbSchemas := make(map[string]docSchema)
+	dbStats := make(map[string]*collectionStats)
+	collectionNames, err := db.CollectionNames()
+	if err != nil {
+		return nil, nil, err
+	}
+	var failure error
+	if len(collectionNames) > 0 {
+		var done sync.WaitGroup
+		var lock sync.Mutex
+		tasks = make(chan string, len(collectionNames))
+		for _, collectionName := range collectionNames {
+			tasks <- collectionName
+		}
+		close(tasks)
+		routines := MaxGoRoutines
+		if routines > len(collectionNames) {
+			routines = len(collectionNames)
+		}
+		for i := 1; i <= MaxGoRoutines; i++ {
+			done.Add(1)
+			go func(i int) {
+				for {
+					collectionName, ok := <-tasks
+					if !ok {
+						done.Done()
+						return
+					}
+					lock.Lock()
+					failed := failure != nil
+					lock.Unlock()
+					if failed {
+						continue
+					}
+					if cmdInfo.presets.skipsCollection(collectionName) {
+						log.Printf("Skip collection %v excluded by preset\n", collectionName)
+						continue
+					}
+					if (len(cmdInfo.collections) > 0 && !matchAny(cmdInfo.collections, collectionName)) ||
+						matchAny(cmdInfo.excludeCollections, collectionName) {
+						log.Printf("Skip collection %v excluded by collection filter\n", collectionName)
+						continue
+					}
+					startTime := time.Now()
+					emitEvent(event{Type: EventCollectionStarted, Collection: collectionName})
+					c := db.C(collectionName)
+					colSchema, colStats, err := extractCollection(c, cmdInfo)
+					if err != nil {
+						lock.Lock()
+						if failure == nil {
+							failure = fmt.Errorf("collection %v: %v", collectionName, err)
+						}
+						lock.Unlock()
+						continue
+					}
+					lock.Lock()
+					dbSchemas[collectionName] = colSchema
+					dbStats[collectionName] = colStats
+					lock.Unlock()
+					emitEvent(event{
+						Type:       EventCollectionFinished,
+						Collection: collectionName,
+						Documents:  colStats.Documents,
+						Sampled:    colStats.Sampled,
+						Fields:     colStats.Fields,
+						Seconds:    time.Since(startTime).Seconds(),
+					})
+					log.Printf("Go Routine %v, Extract schema for collection %v, used time %v.\n", i, collectionName, time.Now().Sub(startTime))
+				}
+			}(i)
+		}
+		done.Wait()
+	}
+	if failure != nil {
+		return nil, nil, failure
+	}
+	return dbSchemas, dbStats, nil
+}
+
+func exportJSON(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	schemaJSON, err := json.Marshal(schemaFile{
+		FormatVersion: mgoschema.FormatVersion,
+		Database:      m.Database,
+		Collections:   m.flat(),
+	})
+	if err == nil {
+		return ioutil.WriteFile(path, schemaJSON, 0644)
+	}
+	return err
+}
+
+func exportCSV(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	for _, c := range m.Collections {
+		for _, f := range c.Fields {
+			record := make([]string, len(cmdInfo.columns))
+			for i, column := range cmdInfo.columns {
+				record[i] = csvColumns[column](c.Name, f)
+			}
+			err := writer.Write(record)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return nil
+}
+
+func extractSchema(ctx *cli.Context) (err error) {
+	if ctx.NumFlags() == 0 {
+		cli.ShowAppHelpAndExit(ctx, -1)
+		return nil
+	}
+	if path := ctx.GlobalString(summaryFileFlag.Name); path != "" {
+		runSummary = newSummaryWriter(path)
+		log.SetOutput(io.MultiWriter(os.Stderr, runSummary))
+		defer func() { runSummary.finish(err) }()
+	}
+	defer monitorResources()()
+	cfg, err := loadConfig(ctx.GlobalString(configFlag.Name))
+	if err != nil {
+		return fmt.Errorf("Failed to load config: %v", err)
+	}
+	if err := applyProfile(ctx, cfg); err != nil {
+		return fmt.Errorf("Invalid %s: %v", profileFlag.Name, err)
+	}
+	cmdInfo := new(commandInfo)
+	cmdInfo.urls = databaseURLs(ctx)
+	cmdInfo.readOnly = ctx.GlobalBool(assertReadOnlyFlag.Name)
+	cmdInfo.format = formatFlag.Value
+	if ctx.GlobalIsSet(formatFlag.Name) {
+		cmdInfo.format = ctx.GlobalString(formatFlag.Name)
+	}
+	if _, ok := exporters[cmdInfo.format]; !ok {
+		cmdInfo.format = JSONFormat
+	}
+	cmdInfo.goPackage = ctx.GlobalString(goPackageFlag.Name)
+	cmdInfo.javaPackage = ctx.GlobalString(javaPackageFlag.Name)
+	cmdInfo.csharpNamespace = ctx.GlobalString(csharpNamespaceFlag.Name)
+	cmdInfo.kotlinPackage = ctx.GlobalString(kotlinPackageFlag.Name)
+	cmdInfo.hiveLocation = ctx.GlobalString(hiveLocationFlag.Name)
+	if cmdInfo.mappingTable, err = parseMappingTemplate("table", ctx.GlobalString(mappingTableFlag.Name)); err != nil {
+		return fmt.Errorf("Invalid %s: %v", mappingTableFlag.Name, err)
+	}
+	if cmdInfo.mappingColumn, err = parseMappingTemplate("column", ctx.GlobalString(mappingColumnFlag.Name)); err != nil {
+		return fmt.Errorf("Invalid %s: %v", mappingColumnFlag.Name, err)
+	}
+	if cmdInfo.clickHouseEngine = strings.TrimSpace(ctx.GlobalString(clickHouseEngineFlag.Name)); cmdInfo.clickHouseEngine == "" {
+		return fmt.Errorf("Invalid %s: empty", clickHouseEngineFlag.Name)
+	}
+	for _, column := range strings.Split(ctx.GlobalString(clickHouseOrderByFlag.Name), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			cmdInfo.clickHouseOrderBy = append(cmdInfo.clickHouseOrderBy, column)
+		}
+	}
+	if cmdInfo.mysqlVarchar = ctx.GlobalInt(mysqlVarcharFlag.Name); cmdInfo.mysqlVarchar < 0 || cmdInfo.mysqlVarchar > 16383 {
+		return fmt.Errorf("Invalid %s: want a length between 0 and 16383", mysqlVarcharFlag.Name)
+	}
+	if cmdInfo.mysqlDecimal, err = parseAvroDecimal(ctx.GlobalString(mysqlDecimalFlag.Name)); err != nil {
+		return fmt.Errorf("Invalid %s: %v", mysqlDecimalFlag.Name, err)
+	}
+	if value := ctx.GlobalString(avroDecimalFlag.Name); value != "" {
+		if cmdInfo.avroDecimal, err = parseAvroDecimal(value); err != nil {
+			return fmt.Errorf("Invalid %s: %v", avroDecimalFlag.Name, err)
+		}
+	}
+	if cmdInfo.columns, err = parseColumns(ctx.GlobalString(columnsFlag.Name)); err != nil {
+		return fmt.Errorf("Invalid %s: %v", columnsFlag.Name, err)
+	}
+	cmdInfo.mergeInto = ctx.GlobalString(mergeIntoFlag.Name)
+	cmdInfo.findings = ctx.GlobalString(findingsFlag.Name)
+	cmdInfo.report = ctx.GlobalString(reportFlag.Name)
+	if pattern := ctx.GlobalString(bundleFlag.Name); pattern != "" {
+		if cmdInfo.bundle, err = parseOutputPath(pattern); err != nil {
+			return fmt.Errorf("Invalid %s: %v", bundleFlag.Name, err)
+		}
+	}
+	cmdInfo.expectations = ctx.GlobalString(expectationsFlag.Name)
+	cmdInfo.coercionPlan = ctx.GlobalString(coercionPlanFlag.Name)
+	cmdInfo.expectationsFormat = ctx.GlobalString(expectationsFormatFlag.Name)
+	switch cmdInfo.expectationsFormat {
+	case GreatExpectationsFormat:
+		if cmdInfo.expectations != "" && !strings.Contains(cmdInfo.expectations, ".Collection") {
+			return fmt.Errorf("%s suites hold one collection each, %s must contain {{.Collection}}", GreatExpectationsFormat, expectationsFlag.Name)
+		}
+	case SodaFormat:
+	default:
+		return fmt.Errorf("Unknown %s value %q", expectationsFormatFlag.Name, cmdInfo.expectationsFormat)
+	}
+	catalogs, err := parseCatalogTargets(ctx.GlobalStringSlice(catalogFlag.Name))
+	if err != nil {
+		return fmt.Errorf("Invalid %s: %v", catalogFlag.Name, err)
+	}
+	cmdInfo.catalogs = catalogs
+	cmdInfo.catalogToken = ctx.GlobalString(catalogTokenFlag.Name)
+	cmdInfo.privacy, err = newPrivacyPolicy(ctx.GlobalFloat64(noiseEpsilonFlag.Name),
+		ctx.GlobalInt(roundCountsFlag.Name), ctx.GlobalInt(minCategoryFlag.Name))
+	if err != nil {
+		return err
+	}
+	findingPrivacy = cmdInfo.privacy
+	cmdInfo.baseline = ctx.GlobalString(baselineFlag.Name)
+	cmdInfo.valueDrift = ctx.GlobalBool(valueDriftFlag.Name)
+	if cmdInfo.valueDrift && cmdInfo.baseline == "" {
+		return fmt.Errorf("%s requires %s!", valueDriftFlag.Name, baselineFlag.Name)
+	}
+	cmdInfo.federation = ctx.GlobalString(federationFlag.Name)
+	if specs := ctx.GlobalStringSlice(knownSchemaFlag.Name); len(specs) > 0 {
+		known, err := loadKnownSchemas(specs)
+		if err != nil {
+			return fmt.Errorf("Failed to load known schema: %v", err)
+		}
+		cmdInfo.known = known
+	}
+	if cfg.Anonymize.Fields != nil || cfg.Anonymize.Default != "" || ctx.GlobalIsSet(anonymizeFlag.Name) {
+		if valueAnonymizer, err = newAnonymizer(cfg.Anonymize, ctx.GlobalString(anonymizeFlag.Name)); err != nil {
+			return err
+		}
+	}
+	if cmdInfo.format == PIIReportFormat && valueAnonymizer == nil {
+		return fmt.Errorf("%s lists the fields tagged by anonymize.fields in the config, which has none", PIIReportFormat)
+	}
+	if err := cfg.Owners.validate(); err != nil {
+		return fmt.Errorf("Invalid config: %v", err)
+	}
+	cmdInfo.owners = cfg.Owners
+	if ctx.GlobalBool(lintFlag.Name) {
+		if cmdInfo.lintRules, err = loadLintRules(cfg.Lint, ctx.GlobalStringSlice(lintRulesFlag.Name)); err != nil {
+			return fmt.Errorf("Invalid %s: %v", lintRulesFlag.Name, err)
+		}
+	}
+	if cmdInfo.failOn = ctx.GlobalString(failOnFlag.Name); cmdInfo.failOn != "" {
+		if _, ok := severityLevels[cmdInfo.failOn]; !ok {
+			return fmt.Errorf("Unknown %s value %q", failOnFlag.Name, cmdInfo.failOn)
+		}
+		if cmdInfo.lintRules == nil {
+			return fmt.Errorf("%s requires %s!", failOnFlag.Name, lintFlag.Name)
+		}
+	}
+	cmdInfo.subset = newSchemaSubset(ctx.GlobalStringSlice(onlyTagFlag.Name), ctx.GlobalStringSlice(ownerFlag.Name))
+	if cmdInfo.subset != nil && len(cmdInfo.subset.tags) > 0 && valueAnonymizer == nil {
+		return fmt.Errorf("%s requires anonymize.fields in the config!", onlyTagFlag.Name)
+	}
+	if cmdInfo.subset != nil && len(cmdInfo.subset.owners) > 0 && len(cmdInfo.owners) == 0 {
+		return fmt.Errorf("%s requires owners in the config!", ownerFlag.Name)
+	}
+	cmdInfo.groupBy = ctx.GlobalString(groupByFlag.Name)
+	switch cmdInfo.groupBy {
+	case "", "owner", "domain":
+	default:
+		return fmt.Errorf("Unknown %s value %q", groupByFlag.Name, cmdInfo.groupBy)
+	}
+	if presets := ctx.GlobalStringSlice(presetFlag.Name); len(presets) > 0 {
+		if cmdInfo.presets, err = resolvePresets(presets, cfg); err != nil {
+			return err
+		}
+	}
+	cmdInfo.collections = ctx.GlobalStringSlice(collectionsFlag.Name)
+	cmdInfo.excludeCollections = ctx.GlobalStringSlice(excludeCollectionsFlag.Name)
+	cmdInfo.maxFields = ctx.GlobalInt(maxFieldsFlag.Name)
+	cmdInfo.fieldOverflow = ctx.GlobalString(fieldOverflowFlag.Name)
+	switch cmdInfo.fieldOverflow {
+	case FieldOverflowChunk, FieldOverflowTail:
+	default:
+		return fmt.Errorf("Unknown %s value %q", fieldOverflowFlag.Name, cmdInfo.fieldOverflow)
+	}
+	cmdInfo.emptyCollections = ctx.GlobalString(emptyCollectionsFlag.Name)
+	switch cmdInfo.emptyCollections {
+	case EmptyInclude, EmptyOmit, EmptyError:
+	default:
+		return fmt.Errorf("Unknown %s value %q", emptyCollectionsFlag.Name, cmdInfo.emptyCollections)
+	}
+	cmdInfo.checkIndexes = ctx.GlobalBool(checkIndexesFlag.Name)
+	cmdInfo.indexStats = ctx.GlobalBool(indexStatsFlag.Name)
+	cmdInfo.timeField = ctx.GlobalString(timeFieldFlag.Name)
+	cmdInfo.timeWindow = ctx.GlobalDuration(timeWindowFlag.Name)
+	cmdInfo.strategyName = ctx.GlobalString(sampleStrategyFlag.Name)
+	strategy, err := newSamplingStrategy(cmdInfo.strategyName, cmdInfo)
+	if err != nil {
+		return err
+	}
+	cmdInfo.strategy = strategy
+	cmdInfo.scanPartitions = ctx.GlobalInt(scanPartitionsFlag.Name)
+	if path := ctx.GlobalString(sinceTokenFlag.Name); path != "" {
+		if cmdInfo.changePositions, err = loadChangePositions(path); err != nil {
+			return fmt.Errorf("Invalid %s: %v", sinceTokenFlag.Name, err)
+		}
+	}
+	if cmdInfo.cache, err = newSchemaCache(ctx); err != nil {
+		return fmt.Errorf("Invalid %s: %v", cacheTTLFlag.Name, err)
+	}
+	if cmdInfo.cache != nil && cmdInfo.changePositions != nil {
+		// The cache holds what was sampled, not the changes since the positions.
+		return fmt.Errorf("%s cannot be combined with %s", cacheTTLFlag.Name, sinceTokenFlag.Name)
+	}
+	if path := ctx.GlobalString(excludeIDsFlag.Name); path != "" {
+		if cmdInfo.excludedIDs, err = loadExcludedIDs(path); err != nil {
+			return fmt.Errorf("Invalid %s: %v", excludeIDsFlag.Name, err)
+		}
+	}
+	provenanceLimit = ctx.GlobalInt(provenanceFlag.Name)
+	dependencyAnalysis = ctx.GlobalBool(dependenciesFlag.Name)
+	tenantField = ctx.GlobalString(tenantFieldFlag.Name)
+	cmdInfo.tenantMatrix = ctx.GlobalString(tenantMatrixFlag.Name)
+	if cmdInfo.tenantMatrix != "" && tenantField == "" {
+		return fmt.Errorf("%s requires %s!", tenantMatrixFlag.Name, tenantFieldFlag.Name)
+	}
+	perCollectionBudget = ctx.GlobalDuration(perCollectionBudgetFlag.Name)
+	rawTypes = ctx.GlobalBool(rawTypesFlag.Name)
+	if ctx.GlobalBool(tailFlag.Name) {
+		if ctx.GlobalString(eventsFlag.Name) == "-" {
+			// Both would write to stdout.
+			return fmt.Errorf("%s cannot be combined with %s -", tailFlag.Name, eventsFlag.Name)
+		}
+		liveTail = newFieldTail(os.Stdout)
+	}
+	if patterns := ctx.GlobalStringSlice(dynamicFlag.Name); len(patterns) > 0 {
+		if dynamicSchemas, err = newDynamicPolicy(patterns, ctx.GlobalInt(dynamicKeyLimitFlag.Name)); err != nil {
+			return fmt.Errorf("Invalid %s: %v", dynamicFlag.Name, err)
+		}
+	}
+	if ctx.GlobalBool(deepFlag.Name) {
+		limit, err := parseByteSize(ctx.GlobalString(memoryLimitFlag.Name))
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %v", memoryLimitFlag.Name, err)
+		}
+		valueProfiling = &memoryBudget{limit: limit, spillDir: ctx.GlobalString(spillDirFlag.Name)}
+	}
+	readConcern := ctx.GlobalString(readConcernFlag.Name)
+	if readConcern == "" && cmdInfo.readOnly {
+		readConcern = "majority"
+	}
+	if cmdInfo.reader, err = newSampleReader(readConcern); err != nil {
+		return err
+	}
+	if readConcern == "snapshot" && cmdInfo.strategyName == "oplogtail" {
+		return fmt.Errorf("The oplog cannot be read with snapshot read concern")
+	}
+	cmdInfo.prune = ctx.GlobalInt(pruneFlag.Name)
+	cmdInfo.pruneLog = ctx.GlobalString(pruneLogFlag.Name)
+	if cmdInfo.prune > 0 && cmdInfo.mergeInto == "" {
+		return fmt.Errorf("%s requires %s!", pruneFlag.Name, mergeIntoFlag.Name)
+	}
+	if cmdInfo.maxFields > 0 && cmdInfo.mergeInto != "" {
+		// The next merge would read a partial schema.
+		return fmt.Errorf("%s cannot be combined with %s", maxFieldsFlag.Name, mergeIntoFlag.Name)
+	}
+	for _, value := range ctx.GlobalStringSlice(archiveFlag.Name) {
+		cmdInfo.archives = append(cmdInfo.archives, parseArchive(value))
+	}
+	if cmdInfo.archives != nil && cmdInfo.changePositions != nil {
+		// Change stream positions are those of the live database.
+		return fmt.Errorf("%s cannot be combined with %s", archiveFlag.Name, sinceTokenFlag.Name)
+	}
+	if cmdInfo.subset != nil && cmdInfo.mergeInto != "" {
+		// The next merge would count the fields left out as missed.
+		return fmt.Errorf("%s and %s cannot be combined with %s", onlyTagFlag.Name, ownerFlag.Name, mergeIntoFlag.Name)
+	}
+	cmdInfo.sharedModels = ctx.GlobalBool(sharedModelsFlag.Name)
+	if cmdInfo.sharedModels && cmdInfo.mergeInto != "" {
+		// The next merge would not find the collections it merges into.
+		return fmt.Errorf("%s cannot be combined with %s", sharedModelsFlag.Name, mergeIntoFlag.Name)
+	}
+	if err := checkReadOnly(cmdInfo); err != nil {
+		return err
+	}
+	if ctx.GlobalIsSet(outputFlag.Name) {
+		cmdInfo.output = ctx.GlobalString(outputFlag.Name)
+	} else if cmdInfo.mergeInto != "" {
+		cmdInfo.output = cmdInfo.mergeInto
+		cmdInfo.format = JSONFormat
+	} else {
+		return fmt.Errorf("%s is mandatory!", outputFlag.Name)
+	}
+	if cmdInfo.outputPath, err = parseOutputPath(cmdInfo.output); err != nil {
+		return fmt.Errorf("Invalid %s: %v", outputFlag.Name, err)
+	}
+	if exporters[cmdInfo.format].perCollection && !cmdInfo.outputPath.perCollection {
+		return fmt.Errorf("%s schemas hold one collection each, %s must contain {{.Collection}}", cmdInfo.format, outputFlag.Name)
+	}
+	if cmdInfo.namespaces, err = parseNamespaceRule(ctx.GlobalString(namespacesFlag.Name)); err != nil {
+		return fmt.Errorf("Invalid %s: %v", namespacesFlag.Name, err)
+	}
+	if cmdInfo.translator, err = newTranslator(ctx.GlobalString(langFlag.Name), ctx.GlobalStringSlice(langBundleFlag.Name)); err != nil {
+		return err
+	}
+	var existing map[string]docSchema
+	if cmdInfo.mergeInto != "" {
+		existing, err = readSchemaFile(cmdInfo.mergeInto)
+		if err != nil {
+			return fmt.Errorf("Failed to read %v: %v", cmdInfo.mergeInto, err)
+		}
+	}
+	if target := ctx.GlobalString(eventsFlag.Name); target != "" {
+		if eventStream, err = openEventStream(target); err != nil {
+			return fmt.Errorf("Failed to open %s: %v", eventsFlag.Name, err)
+		}
+		defer eventStream.close()
+	}
+	runStart := time.Now()
+	if ctx.GlobalString(snapshotDBPathFlag.Name) != "" {
+		server, err := prepareSnapshot(ctx, cmdInfo)
+		if err != nil {
+			return fmt.Errorf("Failed to serve the snapshot: %v", err)
+		}
+		defer server.stop()
+	} else if ctx.GlobalBool(backupCursorFlag.Name) {
+		return fmt.Errorf("%s requires %s!", backupCursorFlag.Name, snapshotDBPathFlag.Name)
+	}
+	session, err := connect(cmdInfo)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	db := session.DB(cmdInfo.dbName)
+	if eventStream != nil {
+		eventStream.database = cmdInfo.dbName
+	}
+	runSummary.setDatabase(cmdInfo.dbName)
+	emitEvent(event{Type: EventRunStarted})
+	if err := cmdInfo.reader.start(session, db); err != nil {
+		return err
+	}
+	var schema map[string]docSchema
+	var stats map[string]*collectionStats
+	if entry := cmdInfo.cache.load(session, cmdInfo); entry != nil {
+		schema, stats = entry.Schema, entry.Stats
+	} else {
+		if schema, stats, err = getDbSchema(db, cmdInfo); err != nil {
+			return err
+		}
+		probeStringReferences(db, schema)
+		cmdInfo.cache.store(cmdInfo, schema, stats)
+	}
+	if err := sampleArchives(cmdInfo, schema, stats); err != nil {
+		return err
+	}
+	if err := applyEmptyCollectionPolicy(cmdInfo.emptyCollections, schema, stats); err != nil {
+		return err
+	}
+	if cmdInfo.known != nil {
+		reportShadowFields(cmdInfo.known, schema)
+	}
+	if cmdInfo.privacy != nil {
+		cmdInfo.privacy.apply(schema, stats)
+	}
+	reportSimilarCollections(schema)
+	if cmdInfo.valueDrift {
+		baseline, err := readBaseline(cmdInfo.baseline)
+		if err != nil {
+			return fmt.Errorf("Failed to read %v: %v", cmdInfo.baseline, err)
+		}
+		reportValueDrift(baseline, schema)
+	}
+	if existing != nil {
+		var events []pruneEvent
+		schema, events = mergeSchema(existing, schema, cmdInfo.prune)
+		if err := recordPruneEvents(cmdInfo.pruneLog, events); err != nil {
+			return err
+		}
+	}
+	var federationDiff *schemaDiff
+	if cmdInfo.federation != "" {
+		if federationDiff, err = diffFederation(cmdInfo, schema); err != nil {
+			return err
+		}
+	}
+	var violations map[string]int
+	if cmdInfo.lintRules != nil {
+		violations = cmdInfo.lintRules.lint(schema, stats)
+	}
+	if cmdInfo.findings != "" {
+		if err := exportFindings(cmdInfo.findings); err != nil {
+			return err
+		}
+	}
+	if cmdInfo.report != "" {
+		if err := exportReport(cmdInfo, schema, stats, federationDiff); err != nil {
+			return err
+		}
+	}
+	if cmdInfo.expectations != "" {
+		if err := exportExpectations(cmdInfo, schema, stats); err != nil {
+			return err
+		}
+	}
+	if cmdInfo.coercionPlan != "" {
+		if err := exportCoercionPlan(cmdInfo.coercionPlan, schema); err != nil {
+			return err
+		}
+	}
+	if cmdInfo.tenantMatrix != "" {
+		if err := exportTenantMatrix(cmdInfo.tenantMatrix, schema); err != nil {
+			return err
+		}
+	}
+	err = exportSchema(cmdInfo, schema, stats)
+	if err == nil && cmdInfo.changePositions != nil {
+		// Only a run whose schema was written may move the positions on.
+		err = cmdInfo.changePositions.save()
+	}
+	if err == nil && len(cmdInfo.catalogs) > 0 {
+		err = publishCatalogs(cmdInfo, schema, stats)
+	}
+	if err == nil && cmdInfo.bundle != nil {
+		err = exportBundle(cmdInfo, schema, stats, federationDiff)
+	}
+	if err == nil && cmdInfo.failOn != "" {
+		err = lintFailure(violations, cmdInfo.failOn)
+	}
+	finished := event{Type: EventRunFinished, Seconds: time.Since(runStart).Seconds()}
+	for _, fields := range schema {
+		finished.Fields += len(fields)
+	}
+	if err != nil {
+		finished.Message = err.Error()
+	}
+	emitEvent(finished)
+	usage := currentResourceUsage()
+	log.Printf("Peak memory %v MB, %v MB read from the server, %.1fs of CPU time\n",
+		usage.PeakMemoryBytes>>20, usage.ServerBytesRead>>20, usage.CPUSeconds)
+	return err
+}
+
+// DialTimeout bounds each connection attempt, as mgo.Dial does.
+const DialTimeout = 10 * time.Second
+
+// connect dials the first reachable of cmdInfo.urls, or the snapshot server,
+// and fills cmdInfo.url and cmdInfo.dbName from it. With a snapshot,
+// cmdInfo.url is the deployment the snapshot was taken of.
+func connect(cmdInfo *commandInfo) (*mgo.Session, error) {
+	urls := cmdInfo.urls
+	if cmdInfo.snapshotURL != "" {
+		urls = []string{cmdInfo.snapshotURL}
+	}
+	var lastErr error
+	for _, url := range urls {
+		dialInfo, err := mgo.ParseURL(url)
+		if err != nil {
+			return nil, err
+		}
+		if dialInfo.Database == "" {
+			return nil, fmt.Errorf("Please specify database name.")
+		}
+		if dialInfo.Timeout == 0 {
+			dialInfo.Timeout = DialTimeout
+		}
+		if cmdInfo.readOnly && dialInfo.AppName == "" {
+			dialInfo.AppName = ReadOnlyAppName
+		}
+		dialInfo.DialServer = countingDialer(dialInfo.DialServer, dialInfo.Timeout)
+		session, err := mgo.DialWithInfo(dialInfo)
+		if err != nil {
+			if len(cmdInfo.urls) > 1 {
+				log.Printf("Failed to connect to %v: %v\n", maskPassword(url), err)
+			}
+			lastErr = err
+			continue
+		}
+		if len(cmdInfo.urls) > 1 {
+			log.Printf("Connected to %v\n", maskPassword(url))
+		}
+		cmdInfo.url = url
+		if cmdInfo.snapshotURL != "" {
+			cmdInfo.url = cmdInfo.urls[0]
+		}
+		cmdInfo.dbName = dialInfo.Database
+		ensureCredentials(session, dialInfo)
+		return session, nil
+	}
+	return nil, lastErr
+}
+
+// Run runs the extract_mgo command line, args[0] being the program name. The
+// run and serve commands start extractions as processes of the executable,
+// so a program embedding the extractor behaves as extract_mgo when its main
+// only calls Run.
+func Run(args []string) error {
+	return newApp().Run(args)
+}
+
+func newApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "extract mongodb schema"
+	app.Description = "extract mongodb schema"
+	app.Flags = []cli.Flag{
+		datatabseFlag, interactiveFlag, outputFlag, formatFlag, profileFlag, columnsFlag, goPackageFlag, javaPackageFlag, csharpNamespaceFlag,
+		kotlinPackageFlag, mappingTableFlag, mappingColumnFlag, avroDecimalFlag, hiveLocationFlag, clickHouseEngineFlag, clickHouseOrderByFlag, mysqlVarcharFlag, mysqlDecimalFlag, maxFieldsFlag, fieldOverflowFlag, sharedModelsFlag, archiveFlag, onlyTagFlag, ownerFlag,
+		collectionsFlag, excludeCollectionsFlag,
+		mergeIntoFlag, pruneFlag, pruneLogFlag,
+		findingsFlag, checkIndexesFlag, indexStatsFlag, reportFlag, bundleFlag, baselineFlag, valueDriftFlag,
+		expectationsFlag, expectationsFormatFlag, coercionPlanFlag, catalogFlag, catalogTokenFlag,
+		noiseEpsilonFlag, roundCountsFlag, minCategoryFlag,
+		snapshotDBPathFlag, backupCursorFlag, mongodFlag,
+		federationFlag, knownSchemaFlag, emptyCollectionsFlag, configFlag, presetFlag,
+		assertReadOnlyFlag, readConcernFlag,
+		sampleStrategyFlag, timeFieldFlag, timeWindowFlag, scanPartitionsFlag, excludeIDsFlag, sinceTokenFlag,
+		deepFlag, memoryLimitFlag, spillDirFlag, provenanceFlag, anonymizeFlag,
+		dynamicFlag, dynamicKeyLimitFlag, dependenciesFlag, rawTypesFlag, perCollectionBudgetFlag,
+		langFlag, langBundleFlag, namespacesFlag, groupByFlag, eventsFlag, tailFlag, summaryFileFlag,
+		cacheTTLFlag, cacheDirFlag, noCacheFlag, tenantFieldFlag, tenantMatrixFlag, lintFlag, lintRulesFlag, failOnFlag,
+	}
+	app.Action = extractSchema
+	app.Commands = []cli.Command{preflightCommand, runCommand, fleetCommand, serveCommand, metaSchemaCommand, bundleCommand,
+		applyValidatorsCommand, snippetsCommand, approveCommand}
+	return app
+}
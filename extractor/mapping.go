@@ -0,0 +1,133 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"strings"
+	"text/template"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// MappingFormat writes a source-to-target mapping stub: a CSV row per
+// field pairing it with the warehouse column -format postgres-ddl puts it
+// in, for analysts to complete.
+const MappingFormat = "mapping"
+
+var (
+	mappingTableFlag = cli.StringFlag{
+		Name:  "mapping-table",
+		Usage: "Target table of the collections in -format mapping, a template with {{.Database}} and {{.Collection}}",
+		Value: "{{.Collection}}",
+	}
+	mappingColumnFlag = cli.StringFlag{
+		Name: "mapping-column",
+		Usage: "Target column of the fields in -format mapping, a template with {{.Database}}, {{.Collection}}, " +
+			"{{.Field}} and {{.Column}}, the column named by the postgres-ddl rules",
+		Value: "{{.Column}}",
+	}
+)
+
+// mappingHeader names the columns of the mapping. The transformation is
+// pre-filled where the DDL implies one; the notes are left to the analysts.
+var mappingHeader = []string{"source_collection", "source_field", "source_types", "required",
+	"target_table", "target_column", "target_type", "transformation", "notes"}
+
+// mappingVars are the variables of the -mapping-table and -mapping-column
+// templates.
+type mappingVars struct {
+	Database   string
+	Collection string
+	Field      string
+	Column     string
+}
+
+func parseMappingTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+func expandMapping(t *template.Template, vars mappingVars) (string, error) {
+	var b bytes.Buffer
+	err := t.Execute(&b, vars)
+	return b.String(), err
+}
+
+// columnOf returns the column holding a field: the column of the field
+// itself, or the jsonb column of the array or document it is within. The
+// parents of flattened documents have none.
+func columnOf(columns []pgColumn, field string) (column *pgColumn, within string) {
+	for i := range columns {
+		col := &columns[i]
+		switch {
+		case col.field == field:
+			return col, ""
+		case col.typ == "jsonb" && strings.HasPrefix(field, col.field) &&
+			(field[len(col.field)] == '.' || field[len(col.field)] == '['):
+			return col, strings.TrimPrefix(field[len(col.field):], ".")
+		}
+	}
+	return nil, ""
+}
+
+// mappingRows returns the rows of the fields of a collection.
+func mappingRows(database string, c *collectionModel, cmdInfo *commandInfo) ([][]string, error) {
+	table, err := expandMapping(cmdInfo.mappingTable, mappingVars{Database: database, Collection: c.Name})
+	if err != nil {
+		return nil, err
+	}
+	columns := tableColumns(c)
+	sampled := 0
+	if c.Stats != nil {
+		sampled = c.Stats.Sampled
+	}
+	var rows [][]string
+	for _, f := range c.Fields {
+		required := "no"
+		if sampled > 0 && f.Count >= sampled && !strings.Contains(f.Name, "[]") {
+			required = "yes"
+		}
+		row := []string{c.Name, f.Name, strings.Join(f.fieldTypes(), "|"), required, table, "", "", "", ""}
+		col, within := columnOf(columns, f.Name)
+		switch {
+		case col == nil:
+			row[7] = "flattened into the columns of its fields"
+		default:
+			if row[5], err = expandMapping(cmdInfo.mappingColumn, mappingVars{
+				Database: database, Collection: c.Name, Field: f.Name, Column: col.name,
+			}); err != nil {
+				return nil, err
+			}
+			row[6] = col.typ
+			switch {
+			case within != "":
+				row[7] = "within the JSON of " + col.field + " at " + within
+			case col.typ == "jsonb":
+				row[7] = "as JSON"
+			case containsString(f.fieldTypes(), "OBJECTID"):
+				row[7] = "ObjectId as hex string"
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func exportMapping(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	writer.Write(mappingHeader)
+	for _, c := range m.Collections {
+		rows, err := mappingRows(m.Database, c, cmdInfo)
+		if err != nil {
+			return err
+		}
+		writer.WriteAll(rows)
+	}
+	writer.Flush()
+	return writer.Error()
+}
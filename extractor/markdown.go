@@ -0,0 +1,170 @@
+package extractor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// MarkdownFormat writes a data dictionary in Markdown, for sharing the
+// schema with readers who do not read JSON.
+const MarkdownFormat = "markdown"
+
+// dictionary is what the human-readable formats render: per collection, a
+// table of its fields with texts in the -lang language.
+type dictionary struct {
+	Database    string
+	GeneratedAt time.Time
+	Collections []dictionaryCollection
+	// Namespaces group the collections with -namespaces.
+	Namespaces []dictionaryNamespace
+}
+
+type dictionaryCollection struct {
+	Name      string
+	Documents int
+	Sampled   int
+	Fields    []dictionaryField
+	Findings  []string
+	// Expiry describes the TTL indexes expiring the documents.
+	Expiry []string
+	// Namespace is set with -namespaces, FirstInNamespace on the first
+	// collection of each.
+	Namespace        string
+	FirstInNamespace bool
+}
+
+type dictionaryField struct {
+	Name string
+	// Type describes the types of the field, e.g. "Text / Whole number".
+	Type     string
+	Types    []string
+	Nullable bool
+	// Example is the most common value, known with -deep only.
+	Example string
+}
+
+// newDictionary builds the dictionary of the model and the findings of the
+// run, grouped into the namespaces of the rule, if any.
+func newDictionary(m *schemaModel, t *translator, namespaces *namespaceRule) *dictionary {
+	d := &dictionary{Database: m.Database, GeneratedAt: time.Now().UTC()}
+	byCollection := make(map[string][]string)
+	findingsLock.Lock()
+	for _, f := range findings {
+		byCollection[f.Collection] = append(byCollection[f.Collection], f.Message)
+	}
+	findingsLock.Unlock()
+	for _, c := range m.Collections {
+		s := c.Stats
+		if s == nil {
+			s = &collectionStats{}
+		}
+		dc := dictionaryCollection{
+			Name:      c.Name,
+			Documents: s.Documents,
+			Sampled:   s.Sampled,
+			Fields:    make([]dictionaryField, 0, len(c.Fields)),
+			Findings:  byCollection[c.Name],
+		}
+		for _, ttl := range s.TTL {
+			dc.Expiry = append(dc.Expiry, ttl.expiry(t))
+		}
+		for _, f := range c.Fields {
+			var descriptions []string
+			for _, typeName := range f.fieldTypes() {
+				descriptions = append(descriptions, t.typeDescription(typeName))
+			}
+			field := dictionaryField{
+				Name:     f.Name,
+				Type:     strings.Join(descriptions, " / "),
+				Types:    f.fieldTypes(),
+				Nullable: f.Count < s.Sampled,
+			}
+			if f.Values != nil && len(f.Values.Top) > 0 {
+				field.Example = f.Values.Top[0].Value
+			}
+			dc.Fields = append(dc.Fields, field)
+		}
+		d.Collections = append(d.Collections, dc)
+	}
+	namespaces.group(d)
+	return d
+}
+
+// markdownCell escapes text for a table cell.
+func markdownCell(text string) string {
+	text = strings.NewReplacer("\\", "\\\\", "|", "\\|", "\r", " ", "\n", " ").Replace(text)
+	return strings.TrimSpace(text)
+}
+
+// markdownAnchor returns the anchor GitHub gives a heading.
+func markdownAnchor(heading string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ':
+			return '-'
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, heading)
+}
+
+// markdownCode writes text as code in a table cell, so that names such as
+// _id stay as they are.
+func markdownCode(text string) string {
+	if strings.Contains(text, "`") {
+		return "`` " + markdownCell(text) + " ``"
+	}
+	return "`" + markdownCell(text) + "`"
+}
+
+const markdownTemplate = `# {{t "title"}}: {{.Database}}
+
+{{t "generatedAt"}}: {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}
+{{if not .Collections}}
+{{t "noCollection"}}
+{{end}}{{if .Namespaces}}
+{{range .Namespaces}}- **{{or .Name (t "otherCollections")}}**: {{range $j, $i := .Collections}}{{if $j}}, {{end}}{{with index $.Collections $i}}[{{.Name}}](#{{anchor .Name}}){{end}}{{end}}
+{{end}}{{end}}{{range .Collections}}{{if .FirstInNamespace}}
+## {{or .Namespace (t "otherCollections")}}
+{{end}}
+{{if $.Namespaces}}###{{else}}##{{end}} {{.Name}}
+
+{{t "documents"}}: {{.Documents}} · {{t "sampled"}}: {{.Sampled}} · {{t "fields"}}: {{len .Fields}}
+{{range .Expiry}}
+{{t "expiry"}}: {{.}}
+{{end}}
+| {{t "field"}} | {{t "type"}} | {{t "nullable"}} | {{t "example"}} |
+| --- | --- | --- | --- |
+{{range .Fields}}| {{code .Name}} | {{cell .Type}} | {{if .Nullable}}{{t "yes"}}{{else}}{{t "no"}}{{end}} | {{cell .Example}} |
+{{end}}{{if .Findings}}
+{{if $.Namespaces}}####{{else}}###{{end}} {{t "findings"}}
+
+{{range .Findings}}- {{.}}
+{{end}}{{end}}{{end}}`
+
+// markdownDictionary renders the data dictionary of the model.
+func markdownDictionary(m *schemaModel, t *translator, namespaces *namespaceRule) ([]byte, error) {
+	tmpl, err := template.New(MarkdownFormat).Funcs(t.templateFuncs()).
+		Funcs(template.FuncMap{"cell": markdownCell, "code": markdownCode, "anchor": markdownAnchor}).Parse(markdownTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, newDictionary(m, t, namespaces)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func exportMarkdown(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	data, err := markdownDictionary(m, cmdInfo.translator, cmdInfo.namespaces)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,203 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emmansun/extract-mgo-schema/mgoschema"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	mergeIntoFlag = cli.StringFlag{
+		Name:  "merge-into",
+		Usage: "Merge the extracted schema into an existing JSON schema file, keeping fields not observed this time. The file is rewritten unless -output is given",
+	}
+	pruneFlag = cli.IntFlag{
+		Name:  "prune",
+		Usage: "With -merge-into, remove fields absent from this many consecutive runs. 0 never removes fields",
+	}
+	pruneLogFlag = cli.StringFlag{
+		Name:  "prune-log",
+		Usage: "File to append pruned field events to, one JSON object per line",
+	}
+)
+
+// schemaFile is the JSON output format, read by the mgoschema package.
+type schemaFile struct {
+	FormatVersion int                  `json:"formatVersion"`
+	Database      string               `json:"database,omitempty"`
+	Collections   map[string]docSchema `json:"collections"`
+}
+
+// readSchemaFile loads a schema previously written by exportJSON. A missing
+// file yields an empty schema so the first merge run can create it.
+func readSchemaFile(path string) (map[string]docSchema, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return make(map[string]docSchema), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseSchemaFile(data)
+}
+
+// parseSchemaFile decodes a schema file of any format version.
+func parseSchemaFile(data []byte) (map[string]docSchema, error) {
+	data, err := mgoschema.Upgrade(data)
+	if err != nil {
+		return nil, err
+	}
+	var file schemaFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Collections == nil {
+		file.Collections = make(map[string]docSchema)
+	}
+	return file.Collections, nil
+}
+
+// fieldTypes returns every type recorded for the field.
+func (field *docField) fieldTypes() []string {
+	if len(field.Types) > 0 {
+		return field.Types
+	}
+	return []string{field.Type}
+}
+
+// addType records typeName on the field, switching it to a mixed field when
+// the type was not seen before. Differing subtypes of the same base type
+// collapse to the base type, since the subtype no longer holds.
+func (field *docField) addType(typeName string) {
+	if len(field.Types) == 0 && field.Type == typeName {
+		return
+	}
+	types := append([]string{}, field.fieldTypes()...)
+	collapsed := false
+	for i, t := range types {
+		if t == typeName {
+			return
+		}
+		if baseType(t) == baseType(typeName) {
+			types[i] = baseType(t)
+			collapsed = true
+		}
+	}
+	if baseType(field.Type) == baseType(typeName) {
+		field.Type = baseType(typeName)
+	}
+	if !collapsed {
+		types = append(types, typeName)
+	}
+	if len(types) == 1 {
+		field.Types = nil
+		return
+	}
+	sort.Strings(types)
+	field.Types = types
+}
+
+// pruneEvent records a field dropped from a merged schema.
+type pruneEvent struct {
+	Time       time.Time `json:"time"`
+	Collection string    `json:"collection"`
+	Field      string    `json:"field"`
+	Types      []string  `json:"types"`
+	MissedRuns int       `json:"missedRuns"`
+}
+
+// mergeSchema adds the fields and types of observed into existing. Fields
+// present only in existing are kept, but count as missed for the run; with
+// prune > 0 a field missed in prune consecutive runs is removed. Collections
+// not extracted in this run are left untouched.
+func mergeSchema(existing, observed map[string]docSchema, prune int) (map[string]docSchema, []pruneEvent) {
+	var events []pruneEvent
+	now := time.Now()
+	for name, fields := range observed {
+		colSchema, ok := existing[name]
+		if !ok {
+			existing[name] = fields
+			continue
+		}
+		index := make(map[string]int, len(colSchema))
+		for i := range colSchema {
+			index[colSchema[i].Name] = i
+			colSchema[i].Missed++
+		}
+		for _, f := range fields {
+			i, ok := index[f.Name]
+			if !ok {
+				index[f.Name] = len(colSchema)
+				colSchema = append(colSchema, f)
+				continue
+			}
+			colSchema[i].Missed = 0
+			colSchema[i].Count = f.Count
+			colSchema[i].IndexUsage = f.IndexUsage
+			colSchema[i].Unique = f.Unique
+			colSchema[i].Monotonicity = f.Monotonicity
+			colSchema[i].Values = f.Values
+			colSchema[i].Owner, colSchema[i].Domain = f.Owner, f.Domain
+			colSchema[i].Provenance = f.Provenance
+			colSchema[i].KeyTypes, colSchema[i].Keys = f.KeyTypes, f.Keys
+			colSchema[i].Conditions = f.Conditions
+			colSchema[i].Coercion = f.Coercion
+			colSchema[i].ElementTypes, colSchema[i].Homogeneous = f.ElementTypes, f.Homogeneous
+			colSchema[i].Tenants = f.Tenants
+			for _, source := range f.Sources {
+				colSchema[i].tagSource(source)
+			}
+			for _, t := range f.fieldTypes() {
+				colSchema[i].addType(t)
+			}
+		}
+		kept := colSchema[:0]
+		for _, f := range colSchema {
+			if prune > 0 && f.Missed >= prune {
+				events = append(events, pruneEvent{
+					Time:       now,
+					Collection: name,
+					Field:      f.Name,
+					Types:      f.fieldTypes(),
+					MissedRuns: f.Missed,
+				})
+				continue
+			}
+			kept = append(kept, f)
+		}
+		colSchema = kept
+		sort.Sort(colSchema)
+		existing[name] = colSchema
+	}
+	return existing, events
+}
+
+// recordPruneEvents logs the removals and appends them as JSON lines to path
+// when one is given.
+func recordPruneEvents(path string, events []pruneEvent) error {
+	for _, e := range events {
+		log.Printf("Pruned %v.%v (%v), missing in %v consecutive runs\n", e.Collection, e.Field, strings.Join(e.Types, "|"), e.MissedRuns)
+	}
+	if path == "" || len(events) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	for _, e := range events {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// MermaidFormat writes a Mermaid erDiagram of the collections and the
+// references between them.
+const MermaidFormat = "mermaid"
+
+// normalizedName lowercases a name and drops what is not a letter or digit,
+// so that user_profiles and userProfiles compare equal.
+func normalizedName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// referencedCollection guesses the collection a reference field points at
+// from its name, e.g. users for userId, author_id or authors[], trying the
+// singular and plural forms. It returns "" when no collection matches.
+func referencedCollection(field *docField, collections map[string]string) string {
+	name := strings.Replace(field.Name, "[]", "", -1)
+	if i := strings.LastIndex(name, "."); i != -1 {
+		name = name[i+1:]
+	}
+	for _, suffix := range []string{"_ids", "Ids", "_id", "Id", "ID"} {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			name = name[:len(name)-len(suffix)]
+			break
+		}
+	}
+	base := normalizedName(name)
+	if base == "" {
+		return ""
+	}
+	candidates := []string{base, base + "s", base + "es"}
+	if strings.HasSuffix(base, "y") {
+		candidates = append(candidates, base[:len(base)-1]+"ies")
+	}
+	if strings.HasSuffix(base, "s") {
+		candidates = append(candidates, base[:len(base)-1])
+	}
+	for _, candidate := range candidates {
+		if collection, ok := collections[candidate]; ok {
+			return collection
+		}
+	}
+	return ""
+}
+
+// reference is a field of a collection holding ids of another one.
+type reference struct {
+	// Field is the name of the field, that of the array for references in
+	// arrays.
+	Field    string
+	Target   string
+	Many     bool // in an array
+	Optional bool // not in every sampled document
+}
+
+// modelCollections indexes the collections of the model by normalized
+// name, for referencedCollection.
+func modelCollections(m *schemaModel) map[string]string {
+	collections := make(map[string]string, len(m.Collections))
+	for _, c := range m.Collections {
+		collections[normalizedName(c.Name)] = c.Name
+	}
+	return collections
+}
+
+// referencesOf returns the references of a collection to the collections of
+// the model, those probed by probeStringReferences or else guessed from the
+// names of the fields.
+func referencesOf(c *collectionModel, collections map[string]string) []reference {
+	var references []reference
+	for i := range c.Fields {
+		f := &c.Fields[i]
+		if !isReferenceField(f) {
+			continue
+		}
+		target := objectIDReference(f)
+		if collections[normalizedName(target)] != target {
+			target = referencedCollection(f, collections)
+		}
+		if target == "" {
+			continue
+		}
+		name := f.Name
+		for strings.HasSuffix(name, "[]") {
+			name = strings.TrimSuffix(name, "[]")
+		}
+		references = append(references, reference{
+			Field:    name,
+			Target:   target,
+			Many:     strings.Contains(f.Name, "[]"),
+			Optional: f.Count < c.Document.Count,
+		})
+	}
+	return references
+}
+
+// mermaidType is the attribute type of a field: its base type, "mixed" for
+// mixed types.
+func mermaidType(f *docField) string {
+	types := f.fieldTypes()
+	if len(types) != 1 {
+		return "mixed"
+	}
+	return strings.ToLower(baseType(types[0]))
+}
+
+// mermaidDiagram returns the erDiagram of the model: an entity per
+// collection with its fields, _id as primary key and references as foreign
+// keys, and a relationship per reference to a collection of the model.
+// Elements of arrays are left out, the arrays standing for them.
+func mermaidDiagram(m *schemaModel) []byte {
+	collections := modelCollections(m)
+	entities := make(map[string]string, len(m.Collections))
+	taken := make(map[string]bool)
+	for _, c := range m.Collections {
+		entities[c.Name] = uniqueName(taken, plainName(c.Name))
+	}
+	var b, relationships bytes.Buffer
+	b.WriteString("erDiagram\n")
+	for _, c := range m.Collections {
+		// References in arrays are keyed by the array standing for them.
+		references := make(map[string]bool)
+		for _, r := range referencesOf(c, collections) {
+			references[r.Field] = true
+			cardinality := "}o--||"
+			switch {
+			case r.Many:
+				cardinality = "}o--o{"
+			case r.Optional:
+				cardinality = "}o--o|"
+			}
+			fmt.Fprintf(&relationships, "    %v %v %v : %q\n", entities[c.Name], cardinality, entities[r.Target], r.Field)
+		}
+		fmt.Fprintf(&b, "    %v {\n", entities[c.Name])
+		attributes := make(map[string]bool)
+		for i := range c.Fields {
+			f := &c.Fields[i]
+			if strings.HasSuffix(f.Name, "[]") {
+				continue
+			}
+			attribute := uniqueName(attributes, plainName(f.Name))
+			key := ""
+			switch {
+			case f.Name == "_id":
+				key = " PK"
+			case references[f.Name]:
+				key = " FK"
+			}
+			comment := ""
+			if attribute != f.Name {
+				comment = fmt.Sprintf(" %q", f.Name)
+			}
+			fmt.Fprintf(&b, "        %v %v%v%v\n", mermaidType(f), attribute, key, comment)
+		}
+		b.WriteString("    }\n")
+	}
+	b.Write(relationships.Bytes())
+	return b.Bytes()
+}
+
+func exportMermaid(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, mermaidDiagram(m), 0644)
+}
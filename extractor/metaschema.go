@@ -0,0 +1,195 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/emmansun/extract-mgo-schema/mgoschema"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// JSONSchemaDraft is the JSON Schema dialect of the meta-schemas.
+const JSONSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+var metaSchemaCommand = cli.Command{
+	Name:      "meta-schema",
+	Usage:     "Print the JSON Schema of an output format of this version of the tool, or list the formats",
+	ArgsUsage: "[format]",
+	Action:    printMetaSchema,
+}
+
+// outputFormat is a JSON output of the tool, described by the Go type it is
+// encoded from so that its meta-schema cannot drift from the code.
+type outputFormat struct {
+	name  string
+	title string
+	value interface{}
+	// constants pin properties to the version written by this build.
+	constants map[string]interface{}
+}
+
+var outputFormats = []outputFormat{
+	{
+		name:      "schema",
+		title:     "Schema file written by -output with the json format",
+		value:     schemaFile{},
+		constants: map[string]interface{}{"formatVersion": mgoschema.FormatVersion},
+	},
+	{
+		name:      "report",
+		title:     "Run report written by -report",
+		value:     runReport{},
+		constants: map[string]interface{}{"schemaVersion": ReportSchemaVersion},
+	},
+	{name: "diff", title: "Schema diff of the run report", value: schemaDiff{}},
+	{name: "model", title: "Schema model written by -format model", value: schemaModel{}},
+	{name: "findings", title: "Findings file written by -findings", value: []finding{}},
+	{name: "events", title: "One line of the NDJSON -events stream", value: event{}},
+	{name: "prune-log", title: "One line of the NDJSON -prune-log", value: pruneEvent{}},
+	{name: "run-summary", title: "Summary written by run -summary", value: []jobRun{}},
+	{name: "exit-summary", title: "Summary written by -summary-file", value: exitSummary{}},
+	{name: "bundle-manifest", title: "Manifest of a bundle written by -bundle", value: bundleManifest{}},
+	{name: "server-summary", title: "Response of the serve /summary/<database> endpoint", value: schemaSummary{}},
+}
+
+func printMetaSchema(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if name == "" {
+		for _, f := range outputFormats {
+			fmt.Printf("%-15s %v\n", f.name, f.title)
+		}
+		return nil
+	}
+	for _, f := range outputFormats {
+		if f.name == name {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(f.metaSchema())
+		}
+	}
+	return cli.NewExitError(fmt.Sprintf("unknown output format %q", name), 1)
+}
+
+func (f outputFormat) metaSchema() map[string]interface{} {
+	g := &jsonSchemaGenerator{definitions: make(map[string]interface{})}
+	root := g.schemaOf(reflect.TypeOf(f.value))
+	if ref, ok := root["$ref"].(string); ok {
+		// Inline the root type so that constants can be pinned on it.
+		name := strings.TrimPrefix(ref, "#/definitions/")
+		root = g.definitions[name].(map[string]interface{})
+		delete(g.definitions, name)
+	}
+	if properties, ok := root["properties"].(map[string]interface{}); ok {
+		for property, value := range f.constants {
+			properties[property].(map[string]interface{})["const"] = value
+		}
+	}
+	root["$schema"] = JSONSchemaDraft
+	root["title"] = f.title
+	if len(g.definitions) > 0 {
+		root["definitions"] = g.definitions
+	}
+	return root
+}
+
+// jsonSchemaGenerator derives JSON Schemas from Go types the way
+// encoding/json encodes them. Named structs become definitions.
+type jsonSchemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *jsonSchemaGenerator) schemaOf(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaOf(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.definitions[t.Name()]; !ok {
+			// Reserve the name first for recursive types.
+			g.definitions[t.Name()] = nil
+			g.definitions[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	}
+	// Interfaces hold any value.
+	return map[string]interface{}{}
+}
+
+func (g *jsonSchemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	g.addFields(t, properties, &required)
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the encoded fields of t, including those of embedded
+// structs.
+func (g *jsonSchemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i != -1 {
+			name, options = tag[:i], tag[i+1:]
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.addFields(field.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := g.schemaOf(field.Type)
+		omitEmpty := strings.Contains(options, "omitempty")
+		switch field.Type.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			// Nil values are omitted with omitempty and encoded as null
+			// otherwise.
+			if !omitEmpty && len(schema) > 0 {
+				schema = map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+			}
+		}
+		properties[name] = schema
+		if !omitEmpty {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// ModelFormat writes the schema model itself, for tools of other languages
+// to generate their own formats from.
+const ModelFormat = "model"
+
+// schemaModel is what every -format exporter writes: the collections of a
+// database sorted by name, each with its flat fields as sampled, carrying
+// their statistics and annotations, and the same fields nested into a tree
+// of type unions. Exporters of nested formats walk the tree and look up
+// the annotations they need on the flat fields it points to.
+type schemaModel struct {
+	Database    string             `json:"database"`
+	Collections []*collectionModel `json:"collections"`
+}
+
+type collectionModel struct {
+	Name  string           `json:"name"`
+	Stats *collectionStats `json:"stats,omitempty"`
+	// Fields are named with dots and "[]" as in the json format.
+	Fields docSchema `json:"fields"`
+	// Document is the root of the tree, the documents of the collection.
+	Document *modelNode `json:"document"`
+}
+
+// modelNode is a value of the nested structure rebuilt from the flat field
+// names: a document property, the elements of an array (Items) or the
+// summarized values of the keys of a -dynamic document (Rest).
+type modelNode struct {
+	// Name is the property name, empty for the root, elements and keys.
+	Name string `json:"name,omitempty"`
+	// Path is the flat field name of the node, e.g. "lines[].sku".
+	Path string `json:"path,omitempty"`
+	// Types is the union of the base types of the node, including DOCUMENT
+	// and ARRAY when it has properties or elements.
+	Types []string `json:"types"`
+	// Count is the number of sampled documents holding the node. Embedded
+	// documents are not fields themselves and count as their most common
+	// field.
+	Count int `json:"count"`
+	// Numeric tells that the types are INTEGER and DECIMAL, which formats
+	// widen to their decimal type rather than treat as mixed.
+	Numeric bool `json:"numeric,omitempty"`
+	// Required tells whether the property is in every document holding its
+	// parent, which the counts of documents cannot tell within arrays.
+	Required bool `json:"required,omitempty"`
+	// Properties are sorted by name, _id first.
+	Properties []*modelNode `json:"properties,omitempty"`
+	Items      *modelNode   `json:"items,omitempty"`
+	Rest       *modelNode   `json:"rest,omitempty"`
+
+	// field is the flat field of the node, nil for embedded documents only
+	// known from their fields.
+	field  *docField
+	byName map[string]*modelNode
+}
+
+// pathSegments splits a field name such as "lines[].sku" into "lines", "[]"
+// and "sku".
+func pathSegments(name string) []string {
+	var segments []string
+	for _, part := range strings.Split(name, ".") {
+		arrays := 0
+		for strings.HasSuffix(part, "[]") {
+			part = part[:len(part)-2]
+			arrays++
+		}
+		if part != "" {
+			segments = append(segments, part)
+		}
+		for ; arrays > 0; arrays-- {
+			segments = append(segments, "[]")
+		}
+	}
+	return segments
+}
+
+func (n *modelNode) child(segment string) *modelNode {
+	switch segment {
+	case "[]":
+		if n.Items == nil {
+			n.Items = &modelNode{Path: n.Path + "[]"}
+		}
+		return n.Items
+	case "*":
+		if n.Rest == nil {
+			n.Rest = &modelNode{Path: joinPath(n.Path, "*")}
+		}
+		return n.Rest
+	}
+	if n.byName == nil {
+		n.byName = make(map[string]*modelNode)
+	}
+	child := n.byName[segment]
+	if child == nil {
+		child = &modelNode{Name: segment, Path: joinPath(n.Path, segment)}
+		n.byName[segment] = child
+		n.Properties = append(n.Properties, child)
+	}
+	return child
+}
+
+// finish fills in the types, counts and required properties of the tree
+// once all fields are in.
+func (n *modelNode) finish(inArray bool) {
+	if n.field != nil {
+		n.Count = n.field.Count
+		for _, t := range n.field.fieldTypes() {
+			if t := baseType(t); !containsString(n.Types, t) {
+				n.Types = append(n.Types, t)
+			}
+		}
+	}
+	for _, child := range n.Properties {
+		child.finish(inArray)
+		if n.field == nil && child.Count > n.Count {
+			n.Count = child.Count
+		}
+	}
+	for _, child := range n.Properties {
+		child.Required = !inArray && n.Count > 0 && child.Count == n.Count
+	}
+	sort.Slice(n.Properties, func(i, j int) bool {
+		a, b := n.Properties[i].Name, n.Properties[j].Name
+		if (a == "_id") != (b == "_id") {
+			return a == "_id"
+		}
+		return a < b
+	})
+	if n.Rest != nil {
+		n.Rest.finish(inArray)
+	}
+	if n.Items != nil {
+		n.Items.finish(true)
+	}
+	if (n.Properties != nil || n.Rest != nil) && !containsString(n.Types, "DOCUMENT") {
+		n.Types = append(n.Types, "DOCUMENT")
+	}
+	if n.Items != nil && !containsString(n.Types, "ARRAY") {
+		n.Types = append(n.Types, "ARRAY")
+	}
+	if n.Types == nil {
+		n.Types = []string{}
+	}
+	n.Numeric = numericTypes(n.Types)
+}
+
+// numericTypes tells whether types are integers mixed with decimals,
+// whatever their subtypes.
+func numericTypes(types []string) bool {
+	if len(types) != 2 {
+		return false
+	}
+	a, b := baseType(types[0]), baseType(types[1])
+	return a == "INTEGER" && b == "DECIMAL" || a == "DECIMAL" && b == "INTEGER"
+}
+
+// schemaTree nests the flat schema of a collection.
+func schemaTree(colSchema docSchema) *modelNode {
+	root := new(modelNode)
+	for i := range colSchema {
+		node := root
+		for _, segment := range pathSegments(colSchema[i].Name) {
+			node = node.child(segment)
+		}
+		node.field = &colSchema[i]
+	}
+	root.finish(false)
+	return root
+}
+
+// newSchemaModel builds the model of the collections of schema. stats may
+// miss collections, or be nil.
+func newSchemaModel(database string, schema map[string]docSchema, stats map[string]*collectionStats) *schemaModel {
+	m := &schemaModel{Database: database, Collections: make([]*collectionModel, 0, len(schema))}
+	for name, colSchema := range schema {
+		m.Collections = append(m.Collections, &collectionModel{
+			Name:     name,
+			Stats:    stats[name],
+			Fields:   colSchema,
+			Document: schemaTree(colSchema),
+		})
+	}
+	sort.Slice(m.Collections, func(i, j int) bool { return m.Collections[i].Name < m.Collections[j].Name })
+	return m
+}
+
+// flat returns the flat fields by collection.
+func (m *schemaModel) flat() map[string]docSchema {
+	schema := make(map[string]docSchema, len(m.Collections))
+	for _, c := range m.Collections {
+		schema[c.Name] = c.Fields
+	}
+	return schema
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func exportModel(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
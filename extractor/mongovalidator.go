@@ -0,0 +1,136 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+)
+
+// MongoValidatorFormat writes one collMod command per collection setting a
+// $jsonSchema validator, to enforce the inferred schema on the database.
+const MongoValidatorFormat = "mongo-validator"
+
+// bsonTypes are the $jsonSchema bsonType aliases of the base types.
+var bsonTypes = map[string][]string{
+	"INTEGER":  {"int", "long"},
+	"DECIMAL":  {"double"},
+	"STRING":   {"string"},
+	"BOOL":     {"bool"},
+	"TIME":     {"date"},
+	"OBJECTID": {"objectId"},
+	"BINARY":   {"binData"},
+	"DOCUMENT": {"object"},
+	"ARRAY":    {"array"},
+}
+
+// bsonSchema renders the node as a $jsonSchema, which takes no formats or
+// annotations. Properties missing from some documents may also be null,
+// since sampling does not record null values.
+func (n *modelNode) bsonSchema(nullable bool) map[string]interface{} {
+	var names []string
+	var alternatives []map[string]interface{}
+	for _, t := range n.Types {
+		aliases, ok := bsonTypes[t]
+		if !ok {
+			// Unknown types may hold anything.
+			return map[string]interface{}{}
+		}
+		names = append(names, aliases...)
+		switch t {
+		case "DOCUMENT":
+			schema := map[string]interface{}{"bsonType": "object"}
+			n.addBSONProperties(schema)
+			alternatives = append(alternatives, schema)
+		case "ARRAY":
+			schema := map[string]interface{}{"bsonType": "array"}
+			if n.Items != nil {
+				schema["items"] = n.Items.bsonSchema(false)
+			}
+			alternatives = append(alternatives, schema)
+		}
+	}
+	if nullable {
+		names = append(names, "null")
+	}
+	switch {
+	case len(names) == 0:
+		return map[string]interface{}{}
+	case len(alternatives) == 0:
+		if len(names) == 1 {
+			return map[string]interface{}{"bsonType": names[0]}
+		}
+		return map[string]interface{}{"bsonType": names}
+	case len(alternatives) == 1 && len(names) == 1:
+		return alternatives[0]
+	}
+	// The properties or items of documents and arrays only apply to them.
+	anyOf := make([]interface{}, 0, len(names))
+	for _, schema := range alternatives {
+		anyOf = append(anyOf, schema)
+	}
+	for _, name := range names {
+		if name != "object" && name != "array" {
+			anyOf = append(anyOf, map[string]interface{}{"bsonType": name})
+		}
+	}
+	return map[string]interface{}{"anyOf": anyOf}
+}
+
+// addBSONProperties adds the properties of a document to its $jsonSchema,
+// those in every document holding it required.
+func (n *modelNode) addBSONProperties(schema map[string]interface{}) {
+	if n.Properties != nil {
+		properties := make(map[string]interface{}, len(n.Properties))
+		required := []string{}
+		for _, child := range n.Properties {
+			properties[child.Name] = child.bsonSchema(!child.Required)
+			if child.Required {
+				required = append(required, child.Name)
+			}
+		}
+		schema["properties"] = properties
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+	}
+	if n.Rest != nil {
+		schema["additionalProperties"] = n.Rest.bsonSchema(false)
+	}
+}
+
+// collModCommand sets the validator of a collection. The command name
+// must come first.
+type collModCommand struct {
+	CollMod          string                 `json:"collMod"`
+	Validator        map[string]interface{} `json:"validator"`
+	ValidationLevel  string                 `json:"validationLevel"`
+	ValidationAction string                 `json:"validationAction"`
+}
+
+// collectionValidator returns the collMod command setting the validator of
+// a collection. Validation is moderate and only warns, so that applying it
+// rejects no write; tighten it once the warnings are understood.
+func collectionValidator(c *collectionModel) *collModCommand {
+	schema := map[string]interface{}{"bsonType": "object", "title": c.Name}
+	c.Document.addBSONProperties(schema)
+	return &collModCommand{
+		CollMod:          c.Name,
+		Validator:        map[string]interface{}{"$jsonSchema": schema},
+		ValidationLevel:  "moderate",
+		ValidationAction: "warn",
+	}
+}
+
+// exportMongoValidator writes the collMod command of the only collection of
+// m.
+func exportMongoValidator(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	for _, c := range m.Collections {
+		data, err := json.MarshalIndent(collectionValidator(c), "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// MySQLDDLFormat writes a MySQL CREATE TABLE statement per collection.
+const MySQLDDLFormat = "mysql-ddl"
+
+var (
+	mysqlVarcharFlag = cli.IntFlag{
+		Name:  "mysql-varchar",
+		Usage: "Length of the VARCHAR columns of string fields with -format mysql-ddl, or 0 for TEXT columns",
+		Value: 255,
+	}
+	mysqlDecimalFlag = cli.StringFlag{
+		Name:  "mysql-decimal",
+		Usage: "Precision and scale of the DECIMAL columns of decimal fields with -format mysql-ddl",
+		Value: "38,10",
+	}
+)
+
+// mysqlTypes are the column types of the base types but STRING and
+// DECIMAL, which are set by flags. ObjectIds are kept as their hex strings,
+// and dates as UTC DATETIMEs with milliseconds.
+var mysqlTypes = map[string]string{
+	"INTEGER":  "BIGINT",
+	"BOOL":     "BOOLEAN",
+	"TIME":     "DATETIME(3)",
+	"OBJECTID": "CHAR(24)",
+	"BINARY":   "LONGBLOB",
+}
+
+// mysqlIdent quotes an identifier. MySQL has too many reserved words for
+// telling which names need it.
+func mysqlIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// mysqlString quotes a string literal.
+func mysqlString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(s) + "'"
+}
+
+// mysqlColumnType returns the type of the column of a node: JSON for
+// embedded documents, arrays and mixed types.
+func mysqlColumnType(n *modelNode, cmdInfo *commandInfo) string {
+	decimal := fmt.Sprintf("DECIMAL(%v,%v)", cmdInfo.mysqlDecimal.precision, cmdInfo.mysqlDecimal.scale)
+	switch {
+	case n.Numeric:
+		return decimal
+	case len(n.Types) != 1:
+		return "JSON"
+	}
+	switch n.Types[0] {
+	case "DECIMAL":
+		return decimal
+	case "STRING":
+		if cmdInfo.mysqlVarchar > 0 {
+			return fmt.Sprintf("VARCHAR(%v)", cmdInfo.mysqlVarchar)
+		}
+		return "TEXT"
+	}
+	if t, ok := mysqlTypes[n.Types[0]]; ok {
+		return t
+	}
+	return "JSON"
+}
+
+// createMySQLTable returns the CREATE TABLE statement of a collection,
+// keyed by _id. Columns of fields missing from some sampled documents are
+// nullable. Keys cannot be TEXT or BLOB, so _id is VARCHAR or VARBINARY.
+func createMySQLTable(c *collectionModel, cmdInfo *commandInfo) string {
+	var columns []pgColumn
+	for _, child := range c.Document.Properties {
+		columns = append(columns, pgColumn{name: child.Name, field: child.Path, typ: mysqlColumnType(child, cmdInfo), notNull: child.Required})
+	}
+	if c.Document.Rest != nil {
+		columns = append(columns, pgColumn{name: "extra", field: "*", typ: "JSON"})
+	}
+	taken := make(map[string]bool)
+	var lines []string
+	key := ""
+	for _, col := range columns {
+		name := uniqueName(taken, col.name)
+		if col.field == "_id" {
+			switch col.typ {
+			case "TEXT":
+				col.typ = "VARCHAR(255)"
+			case "LONGBLOB":
+				col.typ = "VARBINARY(255)"
+			}
+			// JSON columns cannot be keys either.
+			if col.typ != "JSON" {
+				key = name
+			}
+		}
+		line := mysqlIdent(name) + " " + col.typ
+		if col.notNull {
+			line += " NOT NULL"
+		}
+		if col.field != name {
+			line += " COMMENT " + mysqlString(col.field)
+		}
+		lines = append(lines, line)
+	}
+	if key != "" {
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY (%v)", mysqlIdent(key)))
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %v (\n", mysqlIdent(c.Name))
+	for i, line := range lines {
+		b.WriteString("    " + line)
+		if i < len(lines)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	if c.Stats != nil {
+		fmt.Fprintf(&b, "\n  COMMENT=%v", mysqlString(fmt.Sprintf("%v documents, %v sampled", c.Stats.Documents, c.Stats.Sampled)))
+	}
+	b.WriteString(";\n")
+	return b.String()
+}
+
+// exportMySQLDDL writes the CREATE TABLE statements of the collections.
+func exportMySQLDDL(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	var b bytes.Buffer
+	b.WriteString("-- Generated by extract_mgo from sampled documents.\n")
+	for _, c := range m.Collections {
+		b.WriteString("\n")
+		b.WriteString(createMySQLTable(c, cmdInfo))
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
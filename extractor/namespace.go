@@ -0,0 +1,94 @@
+package extractor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var namespacesFlag = cli.StringFlag{
+	Name: "namespaces",
+	Usage: "Group the collections of the markdown and html data dictionaries into namespaces: \"prefix\" by the " +
+		"part of their name before the first underscore, \"separator:<s>\" before the first s, e.g. " +
+		"\"separator:.\", or \"regexp:<expression>\" by its first group. Collections that match no namespace come last",
+}
+
+// namespaceRule tells the namespace of a collection from its name.
+type namespaceRule struct {
+	pattern *regexp.Regexp
+}
+
+// parseNamespaceRule parses -namespaces, nil when empty.
+func parseNamespaceRule(value string) (*namespaceRule, error) {
+	var expression string
+	switch {
+	case value == "":
+		return nil, nil
+	case value == "prefix":
+		expression = "^([^_]+)_."
+	case strings.HasPrefix(value, "separator:"):
+		separator := strings.TrimPrefix(value, "separator:")
+		if separator == "" {
+			return nil, fmt.Errorf("empty separator")
+		}
+		expression = "^(.+?)" + regexp.QuoteMeta(separator) + "."
+	case strings.HasPrefix(value, "regexp:"):
+		expression = strings.TrimPrefix(value, "regexp:")
+	default:
+		return nil, fmt.Errorf("unknown rule %q", value)
+	}
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	if pattern.NumSubexp() == 0 {
+		return nil, fmt.Errorf("%v has no group naming the namespace", expression)
+	}
+	return &namespaceRule{pattern: pattern}, nil
+}
+
+// namespace returns the namespace of a collection, "" when it has none.
+func (r *namespaceRule) namespace(collection string) string {
+	if m := r.pattern.FindStringSubmatch(collection); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// dictionaryNamespace lists the collections of a namespace by their index
+// in the dictionary. The collections that match no namespace are listed
+// under "".
+type dictionaryNamespace struct {
+	Name        string
+	Collections []int
+}
+
+// group sorts the collections of the dictionary by namespace, those with
+// none last, and lists the namespaces.
+func (r *namespaceRule) group(d *dictionary) {
+	if r == nil {
+		return
+	}
+	for i := range d.Collections {
+		d.Collections[i].Namespace = r.namespace(d.Collections[i].Name)
+	}
+	sort.SliceStable(d.Collections, func(i, j int) bool {
+		a, b := d.Collections[i].Namespace, d.Collections[j].Namespace
+		if (a == "") != (b == "") {
+			return b == ""
+		}
+		return a < b
+	})
+	for i := range d.Collections {
+		c := &d.Collections[i]
+		if n := len(d.Namespaces); n == 0 || d.Namespaces[n-1].Name != c.Namespace {
+			c.FirstInNamespace = true
+			d.Namespaces = append(d.Namespaces, dictionaryNamespace{Name: c.Namespace})
+		}
+		last := &d.Namespaces[len(d.Namespaces)-1]
+		last.Collections = append(last.Collections, i)
+	}
+}
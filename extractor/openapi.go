@@ -0,0 +1,46 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+const (
+	// OpenAPIFormat writes an OpenAPI document holding the schemas of the
+	// collections as components, to reference from API specifications.
+	OpenAPIFormat = "openapi"
+	// OpenAPIVersion is the version of the -format openapi documents, whose
+	// schemas are JSON Schema draft 2020-12 like those of -format jsonschema.
+	OpenAPIVersion = "3.1.0"
+)
+
+// openAPIComponents returns an OpenAPI document with no paths and a schema
+// per collection under components/schemas, named like the gostruct structs
+// and titled with the collection name. Specifications reference them as
+// "#/components/schemas/<name>" of the file.
+func openAPIComponents(m *schemaModel) map[string]interface{} {
+	schemas := make(map[string]interface{}, len(m.Collections))
+	taken := make(map[string]bool)
+	for _, c := range m.Collections {
+		schema := c.Document.objectSchema()
+		schema["title"] = c.Name
+		schemas[uniqueName(taken, goName(c.Name))] = schema
+	}
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":       m.Database,
+			"version":     "1.0.0",
+			"description": "Schemas of the " + m.Database + " collections, generated by extract_mgo from sampled documents.",
+		},
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+func exportOpenAPI(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	data, err := json.MarshalIndent(openAPIComponents(m), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
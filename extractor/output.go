@@ -0,0 +1,154 @@
+package extractor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// outputVars are the variables of an -output path template.
+type outputVars struct {
+	Database   string
+	Collection string
+	Format     string
+	// Owner is the owner or domain of a review packet split with -group-by.
+	Owner string
+	// Time is the start of the run; Timestamp and Date are common renderings
+	// of it.
+	Time      time.Time
+	Timestamp string // 20060102T150405Z
+	Date      string // 2006-01-02
+}
+
+// outputPath expands the -output path template. Paths referring to
+// .Collection produce one file per collection.
+type outputPath struct {
+	template      *template.Template
+	perCollection bool
+	started       time.Time
+}
+
+func parseOutputPath(pattern string) (*outputPath, error) {
+	t, err := template.New("output").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &outputPath{
+		template:      t,
+		perCollection: strings.Contains(pattern, ".Collection"),
+		started:       time.Now().UTC(),
+	}, nil
+}
+
+func (o *outputPath) expand(database, collection, format string) (string, error) {
+	return o.expandVars(outputVars{Database: database, Collection: collection, Format: format})
+}
+
+// expandVars expands the template with vars, filling in the time variables.
+func (o *outputPath) expandVars(vars outputVars) (string, error) {
+	vars.Time = o.started
+	vars.Timestamp = o.started.Format("20060102T150405Z")
+	vars.Date = o.started.Format("2006-01-02")
+	var path bytes.Buffer
+	err := o.template.Execute(&path, vars)
+	return path.String(), err
+}
+
+// exporter writes a -format file from the schema model. A new format only
+// needs an exporter registered in exporters.
+type exporter struct {
+	// perCollection exporters write one collection per file, so that the
+	// -output path must contain {{.Collection}}.
+	perCollection bool
+	export        func(path string, m *schemaModel, cmdInfo *commandInfo) error
+}
+
+var exporters = map[string]exporter{
+	JSONFormat:           {export: exportJSON},
+	CSVFormat:            {export: exportCSV},
+	JSONSchemaFormat:     {perCollection: true, export: exportJSONSchema},
+	GoStructFormat:       {export: exportGoStructs},
+	PostgresDDLFormat:    {export: exportPostgresDDL},
+	BigQueryFormat:       {perCollection: true, export: exportBigQuery},
+	AvroFormat:           {perCollection: true, export: exportAvro},
+	ProtoFormat:          {export: exportProto},
+	GraphQLFormat:        {export: exportGraphQL},
+	SparkFormat:          {perCollection: true, export: exportSpark},
+	MarkdownFormat:       {export: exportMarkdown},
+	HTMLFormat:           {export: exportHTML},
+	PIIReportFormat:      {export: exportPIIReport},
+	MermaidFormat:        {export: exportMermaid},
+	PlantUMLFormat:       {export: exportPlantUML},
+	DBMLFormat:           {export: exportDBML},
+	MongoValidatorFormat: {perCollection: true, export: exportMongoValidator},
+	OpenAPIFormat:        {export: exportOpenAPI},
+	HiveDDLFormat:        {export: exportHiveDDL},
+	SnowflakeDDLFormat:   {export: exportSnowflakeDDL},
+	ClickHouseDDLFormat:  {export: exportClickHouseDDL},
+	MySQLDDLFormat:       {export: exportMySQLDDL},
+	PydanticFormat:       {export: exportPydantic},
+	JavaFormat:           {export: exportJava},
+	CSharpFormat:         {export: exportCSharp},
+	MappingFormat:        {export: exportMapping},
+	RustFormat:           {export: exportRust},
+	KotlinFormat:         {export: exportKotlin},
+	ZodFormat:            {export: exportZod},
+	ModelFormat:          {export: exportModel},
+}
+
+// exportSchema writes the schema to the -output path, creating missing
+// directories, split into one file per collection when the path template
+// names the collection. Only the subset of -only-tag and -owner is written,
+// and with -shared-models, similar collections are written as one.
+func exportSchema(cmdInfo *commandInfo, schema map[string]docSchema, stats map[string]*collectionStats) error {
+	if cmdInfo.subset != nil {
+		schema, stats = cmdInfo.subset.apply(schema, stats)
+	}
+	if cmdInfo.sharedModels {
+		schema, stats = shareModels(schema, stats)
+	}
+	files := make(map[string]map[string]docSchema)
+	if cmdInfo.outputPath.perCollection {
+		names := make([]string, 0, len(schema))
+		for name := range schema {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			path, err := cmdInfo.outputPath.expand(cmdInfo.dbName, name, cmdInfo.format)
+			if err != nil {
+				return err
+			}
+			if files[path] == nil {
+				files[path] = make(map[string]docSchema)
+			}
+			files[path][name] = schema[name]
+		}
+	} else {
+		path, err := cmdInfo.outputPath.expand(cmdInfo.dbName, "", cmdInfo.format)
+		if err != nil {
+			return err
+		}
+		files[path] = schema
+	}
+	files, err := limitFields(cmdInfo, files)
+	if err != nil {
+		return err
+	}
+	for path, fileSchema := range files {
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+		err := exporters[cmdInfo.format].export(path, newSchemaModel(cmdInfo.dbName, fileSchema, stats), cmdInfo)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package extractor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Stats depths of an output profile.
+const (
+	StatsBasic = "basic"
+	StatsDeep  = "deep"
+	StatsFull  = "full"
+)
+
+var (
+	profileFlag = cli.StringFlag{
+		Name: "profile",
+		Usage: "Output profile bundling format, CSV columns, statistics depth and anonymization for an audience: " +
+			"\"dba\", \"analyst\", \"developer\" or a profile of the config file. Flags given explicitly take precedence",
+	}
+	columnsFlag = cli.StringFlag{
+		Name:  "columns",
+		Usage: "Comma-separated columns of the csv format, among " + strings.Join(csvColumnNames(), ", "),
+		Value: "collection,field,types",
+	}
+)
+
+// outputProfile is a named set of defaults for the flags shaping the output.
+type outputProfile struct {
+	Format  string   `yaml:"format"`
+	Columns []string `yaml:"columns"`
+	// Stats is "basic" for types and counts, "deep" for -deep value
+	// profiles, or "full" adding -dependencies, -check-indexes and
+	// -index-stats.
+	Stats     string `yaml:"stats"`
+	Anonymize string `yaml:"anonymize"`
+}
+
+var builtinProfiles = map[string]outputProfile{
+	"dba": {
+		Format:    CSVFormat,
+		Columns:   []string{"collection", "field", "types", "count", "indexes"},
+		Stats:     StatsFull,
+		Anonymize: AnonymizeDrop,
+	},
+	"analyst": {
+		Format:    CSVFormat,
+		Columns:   []string{"collection", "field", "type", "count", "distinct", "min", "max", "top"},
+		Stats:     StatsDeep,
+		Anonymize: AnonymizeTruncate,
+	},
+	"developer": {
+		Format:    JSONFormat,
+		Stats:     StatsBasic,
+		Anonymize: AnonymizeFake,
+	},
+}
+
+// csvColumns render the columns of a field in the csv format.
+var csvColumns = map[string]func(collection string, f docField) string{
+	"collection": func(collection string, f docField) string { return collection },
+	"field":      func(collection string, f docField) string { return f.Name },
+	"type":       func(collection string, f docField) string { return f.Type },
+	"types":      func(collection string, f docField) string { return strings.Join(f.fieldTypes(), "|") },
+	"count":      func(collection string, f docField) string { return strconv.Itoa(f.Count) },
+	"owner":      func(collection string, f docField) string { return f.Owner },
+	"domain":     func(collection string, f docField) string { return f.Domain },
+	"conditions": func(collection string, f docField) string { return strings.Join(f.Conditions, "; ") },
+	"indexes": func(collection string, f docField) string {
+		names := make([]string, len(f.IndexUsage))
+		for i, u := range f.IndexUsage {
+			names[i] = u.Index
+		}
+		return strings.Join(names, "|")
+	},
+	"distinct": func(collection string, f docField) string {
+		if f.Values == nil {
+			return ""
+		}
+		return strconv.Itoa(f.Values.Distinct)
+	},
+	"min": func(collection string, f docField) string {
+		if f.Values == nil || f.Values.Min == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*f.Values.Min, 'g', -1, 64)
+	},
+	"max": func(collection string, f docField) string {
+		if f.Values == nil || f.Values.Max == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*f.Values.Max, 'g', -1, 64)
+	},
+	"top": func(collection string, f docField) string {
+		if f.Values == nil {
+			return ""
+		}
+		top := make([]string, len(f.Values.Top))
+		for i, v := range f.Values.Top {
+			top[i] = fmt.Sprintf("%v (%d)", v.Value, v.Count)
+		}
+		return strings.Join(top, "; ")
+	},
+}
+
+func csvColumnNames() []string {
+	names := make([]string, 0, len(csvColumns))
+	for name := range csvColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseColumns(list string) ([]string, error) {
+	var columns []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := csvColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+// resolveProfile returns the named profile. A profile from the config file
+// overrides the settings of the built-in one of the same name.
+func resolveProfile(name string, cfg *config) (outputProfile, error) {
+	builtin, isBuiltin := builtinProfiles[name]
+	custom, isCustom := cfg.Profiles[name]
+	if !isBuiltin && !isCustom {
+		return outputProfile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	p := builtin
+	if custom.Format != "" {
+		p.Format = custom.Format
+	}
+	if custom.Columns != nil {
+		p.Columns = custom.Columns
+	}
+	if custom.Stats != "" {
+		p.Stats = custom.Stats
+	}
+	if custom.Anonymize != "" {
+		p.Anonymize = custom.Anonymize
+	}
+	return p, nil
+}
+
+// applyProfile sets the flags of the -profile that were not given
+// explicitly, so that the rest of the run reads them like any other flag.
+func applyProfile(ctx *cli.Context, cfg *config) error {
+	name := ctx.GlobalString(profileFlag.Name)
+	if name == "" {
+		return nil
+	}
+	p, err := resolveProfile(name, cfg)
+	if err != nil {
+		return err
+	}
+	settings := [][2]string{
+		{formatFlag.Name, p.Format},
+		{columnsFlag.Name, strings.Join(p.Columns, ",")},
+		{anonymizeFlag.Name, p.Anonymize},
+	}
+	switch p.Stats {
+	case "", StatsBasic:
+	case StatsFull:
+		for _, flag := range []string{dependenciesFlag.Name, checkIndexesFlag.Name, indexStatsFlag.Name} {
+			settings = append(settings, [2]string{flag, "true"})
+		}
+		fallthrough
+	case StatsDeep:
+		settings = append(settings, [2]string{deepFlag.Name, "true"})
+	default:
+		return fmt.Errorf("profile %q: unknown stats %q", name, p.Stats)
+	}
+	for _, s := range settings {
+		if s[1] == "" || ctx.GlobalIsSet(s[0]) {
+			continue
+		}
+		if err := ctx.GlobalSet(s[0], s[1]); err != nil {
+			return fmt.Errorf("profile %q: %v: %v", name, s[0], err)
+		}
+	}
+	return nil
+}
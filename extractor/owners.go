@@ -0,0 +1,169 @@
+package extractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Unowned is the group of collections no owner rule matches.
+const Unowned = "(unowned)"
+
+var groupByFlag = cli.StringFlag{
+	Name: "group-by",
+	Usage: "Group the run report by \"owner\" or \"domain\" of the config owner rules. With {{.Owner}} in the -report path, " +
+		"one review packet is written per group instead",
+}
+
+// ownerRule assigns collections, or single fields with Fields, to an owning
+// team and domain. The first matching rule wins:
+//
+//	owners:
+//	  - collections: ["orders*", "payments"]
+//	    owner: payments-team
+//	    domain: commerce
+//	  - fields: ["users.billing.*"]
+//	    owner: payments-team
+type ownerRule struct {
+	Collections []string `yaml:"collections"`
+	// Fields are "collection.field" patterns owned apart from their
+	// collection.
+	Fields []string `yaml:"fields"`
+	Owner  string   `yaml:"owner"`
+	Domain string   `yaml:"domain"`
+}
+
+type ownerRules []ownerRule
+
+func (rules ownerRules) validate() error {
+	for i, r := range rules {
+		if r.Owner == "" && r.Domain == "" {
+			return fmt.Errorf("owner rule %d has neither owner nor domain", i+1)
+		}
+		if len(r.Collections) == 0 && len(r.Fields) == 0 {
+			return fmt.Errorf("owner rule %d matches neither collections nor fields", i+1)
+		}
+	}
+	return nil
+}
+
+func (rules ownerRules) collectionOwner(collection string) *ownerRule {
+	for i, r := range rules {
+		if len(r.Fields) == 0 && matchAny(r.Collections, collection) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func (rules ownerRules) fieldOwner(collection, field string) *ownerRule {
+	for i, r := range rules {
+		if matchAny(r.Fields, collection+"."+field) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// stamp records the owner of the collection in its stats, and on the fields
+// owned by someone else than their collection.
+func (rules ownerRules) stamp(collection string, colSchema docSchema, stats *collectionStats) {
+	if r := rules.collectionOwner(collection); r != nil {
+		stats.Owner, stats.Domain = r.Owner, r.Domain
+	}
+	for i := range colSchema {
+		f := &colSchema[i]
+		if r := rules.fieldOwner(collection, f.Name); r != nil && (r.Owner != stats.Owner || r.Domain != stats.Domain) {
+			f.Owner, f.Domain = r.Owner, r.Domain
+		}
+	}
+}
+
+// ownerGroup is the part of a run owned by one owner or domain.
+type ownerGroup struct {
+	Name        string   `json:"name"`
+	Collections []string `json:"collections,omitempty"`
+	// Fields are "collection.field" names owned in collections of other
+	// groups.
+	Fields   []string  `json:"fields,omitempty"`
+	Findings []finding `json:"findings,omitempty"`
+}
+
+func groupKey(groupBy, owner, domain string) string {
+	key := owner
+	if groupBy == "domain" {
+		key = domain
+	}
+	if key == "" {
+		return Unowned
+	}
+	return key
+}
+
+// groupRun splits the collections, fields and findings of a run by owner or
+// domain.
+func groupRun(groupBy string, schema map[string]docSchema, stats map[string]*collectionStats, runFindings []finding) []*ownerGroup {
+	groups := make(map[string]*ownerGroup)
+	group := func(name string) *ownerGroup {
+		g, ok := groups[name]
+		if !ok {
+			g = &ownerGroup{Name: name}
+			groups[name] = g
+		}
+		return g
+	}
+	collectionGroup := make(map[string]string)
+	fieldGroup := make(map[string]string)
+	for collection, fields := range schema {
+		name := Unowned
+		if s := stats[collection]; s != nil {
+			name = groupKey(groupBy, s.Owner, s.Domain)
+		}
+		collectionGroup[collection] = name
+		group(name).Collections = append(group(name).Collections, collection)
+		for _, f := range fields {
+			if f.Owner == "" && f.Domain == "" {
+				continue
+			}
+			if fieldName := groupKey(groupBy, f.Owner, f.Domain); fieldName != name {
+				fieldGroup[collection+"."+f.Name] = fieldName
+				group(fieldName).Fields = append(group(fieldName).Fields, collection+"."+f.Name)
+			}
+		}
+	}
+	for _, f := range runFindings {
+		name, ok := fieldGroup[f.Collection+"."+f.Field]
+		if !ok {
+			name = collectionGroup[f.Collection]
+		}
+		if name == "" {
+			name = Unowned
+		}
+		group(name).Findings = append(group(name).Findings, f)
+	}
+	result := make([]*ownerGroup, 0, len(groups))
+	for _, g := range groups {
+		sort.Strings(g.Collections)
+		sort.Strings(g.Fields)
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// owns reports whether the group holds the collection or the field.
+func (g *ownerGroup) owns(collection, field string) bool {
+	for _, c := range g.Collections {
+		if c == collection {
+			return true
+		}
+	}
+	for _, f := range g.Fields {
+		if f == collection+"."+field || strings.HasPrefix(f, collection+"."+field+".") {
+			return true
+		}
+	}
+	return false
+}
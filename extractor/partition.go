@@ -0,0 +1,185 @@
+package extractor
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// MinPartitionDocuments is the collection size from which full scans are
+	// split into _id ranges.
+	MinPartitionDocuments = 1000000
+	// PartitionSamplesPerRange is the number of sampled ids per range used to
+	// place the range boundaries.
+	PartitionSamplesPerRange = 20
+)
+
+var scanPartitionsFlag = cli.IntFlag{
+	Name: "scan-partitions",
+	Usage: fmt.Sprintf("Split full scans of collections with at least %v documents into this many _id ranges, "+
+		"read in parallel on separate connections", MinPartitionDocuments),
+	Value: 1,
+}
+
+// partitionable reports whether q reads the whole collection, so that it can
+// be split into ranges.
+func partitionable(q sampleQuery) bool {
+	return q.Limit == 0 && q.Pipeline == nil && q.Database == "" && q.Unwrap == ""
+}
+
+// idBoundaries picks up to n-1 _id values splitting the collection into ranges
+// of about equal size, from a random sample of ids. Range queries only match
+// values of one BSON type, so only ids of the most common type are used.
+func idBoundaries(c *mgo.Collection, n int) ([]interface{}, error) {
+	var ids []struct {
+		ID interface{} `bson:"_id"`
+	}
+	pipeline := []bson.M{
+		{"$sample": bson.M{"size": n * PartitionSamplesPerRange}},
+		{"$project": bson.M{"_id": 1}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+	if err := c.Pipe(pipeline).All(&ids); err != nil {
+		return nil, err
+	}
+	typeCounts := make(map[string]int)
+	common := ""
+	for _, id := range ids {
+		t := fmt.Sprintf("%T", id.ID)
+		typeCounts[t]++
+		if typeCounts[t] > typeCounts[common] {
+			common = t
+		}
+	}
+	var values []interface{}
+	for _, id := range ids {
+		if fmt.Sprintf("%T", id.ID) == common {
+			values = append(values, id.ID)
+		}
+	}
+	var bounds []interface{}
+	for i := 1; i < n && len(values) > 0; i++ {
+		bound := values[i*len(values)/n]
+		if len(bounds) > 0 {
+			if less, ok := compareIDs(bounds[len(bounds)-1], bound); ok && !less {
+				continue
+			}
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
+
+// partitionFilters turns filter into one filter per _id range. The first
+// range is open-ended with $not, so that it also reads ids of other types.
+func partitionFilters(filter bson.M, bounds []interface{}) []bson.M {
+	var filters []bson.M
+	for i := 0; i <= len(bounds); i++ {
+		var idRange bson.M
+		switch {
+		case i == 0:
+			idRange = bson.M{"$not": bson.M{"$gte": bounds[0]}}
+		case i == len(bounds):
+			idRange = bson.M{"$gte": bounds[i-1]}
+		default:
+			idRange = bson.M{"$gte": bounds[i-1], "$lt": bounds[i]}
+		}
+		part := bson.M{"_id": idRange}
+		if filter != nil {
+			part = bson.M{"$and": []bson.M{filter, part}}
+		}
+		filters = append(filters, part)
+	}
+	return filters
+}
+
+// partialSchema is the schema inferred from one range of a collection.
+type partialSchema struct {
+	schema  docSchema
+	sampled int
+	err     error
+}
+
+// scanPartitioned runs q over n _id ranges in parallel and merges the partial
+// schemas, returning the filters of the ranges too. It falls back to a single
+// scan when no boundaries can be found.
+func scanPartitioned(c *mgo.Collection, q sampleQuery, reader *sampleReader, n int) (docSchema, int, []bson.M, error) {
+	bounds, err := idBoundaries(c, n)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if len(bounds) == 0 {
+		colSchema, sampled, err := scanCollection(c, q, reader)
+		return colSchema, sampled, nil, err
+	}
+	filters := partitionFilters(q.Filter, bounds)
+	log.Printf("Scan collection %v in %v _id ranges\n", c.Name, len(filters))
+	parts := make([]partialSchema, len(filters))
+	var done sync.WaitGroup
+	for i, filter := range filters {
+		done.Add(1)
+		go func(i int, filter bson.M) {
+			defer done.Done()
+			session := c.Database.Session.Copy()
+			defer session.Close()
+			pq := q
+			pq.Filter = filter
+			part := &parts[i]
+			part.schema, part.sampled, part.err = scanCollection(c.With(session), pq, reader)
+		}(i, filter)
+	}
+	done.Wait()
+	colSchema := docSchema{}
+	fieldSet := newFieldSet(c.Name)
+	sampled := 0
+	for _, part := range parts {
+		if part.err != nil && part.err != mgo.ErrNotFound {
+			return nil, 0, nil, part.err
+		}
+		mergePartialSchema(&colSchema, fieldSet, part.schema, sampled)
+		sampled += part.sampled
+	}
+	return colSchema, sampled, filters, nil
+}
+
+// mergePartialSchema adds the fields of part, with their types, counts and
+// value profiles, to colSchema. The documents of part are numbered from
+// offset on.
+func mergePartialSchema(colSchema *docSchema, fieldSet *fieldSet, part docSchema, offset int) {
+	for _, f := range part {
+		i, ok := fieldSet.index[f.Name]
+		if !ok {
+			fieldSet.index[f.Name] = len(*colSchema)
+			part := f
+			f.presence, f.valuePresence = nil, nil
+			f.presence.merge(part.presence, offset)
+			f.mergeValuePresence(&part, offset)
+			*colSchema = append(*colSchema, f)
+			continue
+		}
+		field := &(*colSchema)[i]
+		field.presence.merge(f.presence, offset)
+		field.mergeValuePresence(&f, offset)
+		for _, t := range f.fieldTypes() {
+			field.addType(t)
+		}
+		field.Count += f.Count
+		field.mergeProvenance(&f)
+		field.mergeKeys(&f)
+		field.mergeTypeDocs(&f)
+		field.mergeTenantDocs(&f)
+		field.mergeElementTypes(&f)
+		switch {
+		case f.profile == nil:
+		case field.profile == nil:
+			field.profile = f.profile
+		default:
+			field.profile.merge(f.profile)
+		}
+	}
+}
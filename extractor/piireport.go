@@ -0,0 +1,78 @@
+package extractor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PIIReportFormat writes the inventory of the fields tagged by the
+// anonymize.fields config, as compliance reviews ask for.
+const PIIReportFormat = "pii-report"
+
+var piiReportHeader = []string{"collection", "field", "classification", "types", "coverage", "example", "owner", "retention"}
+
+// piiExample returns the most common value of a field, masked: values the
+// tag of the field keeps as they are are faked.
+func piiExample(collection string, f *docField) string {
+	if f.Values == nil || len(f.Values.Top) == 0 {
+		return ""
+	}
+	example := f.Values.Top[0].Value
+	if p := valueAnonymizer.profile(collection, f.Name); p.Method == AnonymizeKeep || p.Method == "" {
+		example = valueAnonymizer.fake(example)
+	}
+	return example
+}
+
+// exportPIIReport writes a CSV row per tagged field: its classification,
+// i.e. its tag, its coverage of the sampled documents, a masked example,
+// its owner and the retention noted on the profile of the tag.
+func exportPIIReport(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	if err := writer.Write(piiReportHeader); err != nil {
+		return err
+	}
+	for _, c := range m.Collections {
+		s := c.Stats
+		if s == nil {
+			s = &collectionStats{}
+		}
+		for i := range c.Fields {
+			field := &c.Fields[i]
+			tag := valueAnonymizer.tag(c.Name, field.Name)
+			if tag == "" {
+				continue
+			}
+			coverage := ""
+			if s.Sampled > 0 {
+				coverage = fmt.Sprintf("%.1f%%", 100*float64(field.Count)/float64(s.Sampled))
+			}
+			owner := field.Owner
+			if owner == "" {
+				owner = s.Owner
+			}
+			record := []string{
+				c.Name,
+				field.Name,
+				tag,
+				strings.Join(field.fieldTypes(), "|"),
+				coverage,
+				piiExample(c.Name, field),
+				owner,
+				valueAnonymizer.profiles[tag].Retention,
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,126 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// PlantUMLFormat writes a PlantUML class diagram of the collections and
+// their embedded documents.
+const PlantUMLFormat = "plantuml"
+
+// plantUMLTypes are the attribute types of the base types.
+var plantUMLTypes = map[string]string{
+	"INTEGER":  "Integer",
+	"DECIMAL":  "Decimal",
+	"STRING":   "String",
+	"BOOL":     "Boolean",
+	"TIME":     "DateTime",
+	"OBJECTID": "ObjectId",
+	"BINARY":   "Binary",
+	"DOCUMENT": "Document",
+	"ARRAY":    "Array",
+}
+
+// plantUMLWriter writes the classes of embedded documents after the class
+// holding them, like goStructWriter, and the compositions between them last.
+type plantUMLWriter struct {
+	source       bytes.Buffer
+	compositions bytes.Buffer
+	classes      map[string]bool
+	pending      []pendingStruct
+}
+
+// plantUMLType returns the attribute type of the property label of the
+// class owner, queuing the classes of its embedded documents under names
+// derived from name with a composition labelled by the property. Elements
+// of arrays are composed any number of times. Mixed types are listed.
+func (w *plantUMLWriter) plantUMLType(owner, name, label string, n *modelNode, multiplicity string) string {
+	types := n.Types
+	if len(types) != 1 {
+		names := make([]string, 0, len(types))
+		for _, t := range types {
+			alternative := &modelNode{Types: []string{t}}
+			switch t {
+			case "DOCUMENT":
+				alternative.Properties, alternative.Rest = n.Properties, n.Rest
+			case "ARRAY":
+				alternative.Items = n.Items
+			}
+			names = append(names, w.plantUMLType(owner, name, label, alternative, multiplicity))
+		}
+		return strings.Join(names, " | ")
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		if n.Properties == nil {
+			if n.Rest == nil {
+				return plantUMLTypes["DOCUMENT"]
+			}
+			return "Map<String, " + w.plantUMLType(owner, name+"Value", label, n.Rest, "*") + ">"
+		}
+		className := uniqueName(w.classes, name)
+		w.pending = append(w.pending, pendingStruct{name: className, node: n})
+		fmt.Fprintf(&w.compositions, "%v *-- %q %v : %v\n", owner, multiplicity, className, label)
+		return className
+	case "ARRAY":
+		if n.Items == nil {
+			return plantUMLTypes["ARRAY"]
+		}
+		return w.plantUMLType(owner, name+"Item", label, n.Items, "*") + "[]"
+	}
+	if t, ok := plantUMLTypes[types[0]]; ok {
+		return t
+	}
+	return "Object"
+}
+
+// writeClass writes the class of a document, _id first, with optional
+// properties marked [0..1].
+func (w *plantUMLWriter) writeClass(s pendingStruct, stereotype string) {
+	fmt.Fprintf(&w.source, "class %v <<%v>> {\n", s.name, stereotype)
+	for _, child := range s.node.Properties {
+		multiplicity := "1"
+		if !child.Required {
+			multiplicity = "0..1"
+		}
+		attribute := w.plantUMLType(s.name, s.name+goName(child.Name), child.Name, child, multiplicity)
+		if !child.Required {
+			attribute += " [0..1]"
+		}
+		fmt.Fprintf(&w.source, "  %v : %v\n", child.Name, attribute)
+	}
+	w.source.WriteString("}\n\n")
+}
+
+// plantUMLClasses returns a class diagram with a class per collection,
+// named after it, and a class per embedded document composed into the
+// class holding it.
+func plantUMLClasses(m *schemaModel) []byte {
+	w := &plantUMLWriter{classes: make(map[string]bool)}
+	for _, c := range m.Collections {
+		name := uniqueName(w.classes, goName(c.Name))
+		if name != c.Name {
+			fmt.Fprintf(&w.source, "' %v is the %v collection.\n", name, c.Name)
+		}
+		w.writeClass(pendingStruct{name: name, node: c.Document}, "collection")
+		for len(w.pending) > 0 {
+			s := w.pending[0]
+			w.pending = w.pending[1:]
+			w.writeClass(s, "embedded")
+		}
+	}
+	var source bytes.Buffer
+	source.WriteString("@startuml\n' Generated by extract_mgo from sampled documents.\n")
+	source.WriteString("hide empty methods\nhide circle\n\n")
+	source.Write(w.source.Bytes())
+	source.Write(w.compositions.Bytes())
+	source.WriteString("@enduml\n")
+	return source.Bytes()
+}
+
+func exportPlantUML(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, plantUMLClasses(m), 0644)
+}
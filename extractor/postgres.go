@@ -0,0 +1,136 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// PostgresDDLFormat writes a PostgreSQL CREATE TABLE statement per
+// collection.
+const PostgresDDLFormat = "postgres-ddl"
+
+// postgresTypes are the column types of the base types. ObjectIds are kept
+// as their hex strings.
+var postgresTypes = map[string]string{
+	"INTEGER":  "bigint",
+	"DECIMAL":  "numeric",
+	"STRING":   "text",
+	"BOOL":     "boolean",
+	"TIME":     "timestamptz",
+	"OBJECTID": "text",
+	"BINARY":   "bytea",
+}
+
+var (
+	plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	// postgresReserved are the reserved key words of PostgreSQL, which
+	// cannot name a table or column unquoted.
+	postgresReserved = map[string]bool{
+		"all": true, "analyse": true, "analyze": true, "and": true, "any": true, "array": true, "as": true, "asc": true,
+		"asymmetric": true, "both": true, "case": true, "cast": true, "check": true, "collate": true, "column": true,
+		"constraint": true, "create": true, "current_catalog": true, "current_date": true, "current_role": true,
+		"current_time": true, "current_timestamp": true, "current_user": true, "default": true, "deferrable": true,
+		"desc": true, "distinct": true, "do": true, "else": true, "end": true, "except": true, "false": true,
+		"fetch": true, "for": true, "foreign": true, "from": true, "grant": true, "group": true, "having": true,
+		"in": true, "initially": true, "intersect": true, "into": true, "lateral": true, "leading": true,
+		"limit": true, "localtime": true, "localtimestamp": true, "not": true, "null": true, "offset": true,
+		"on": true, "only": true, "or": true, "order": true, "placing": true, "primary": true, "references": true,
+		"returning": true, "select": true, "session_user": true, "some": true, "symmetric": true, "table": true,
+		"then": true, "to": true, "trailing": true, "true": true, "union": true, "unique": true, "user": true,
+		"using": true, "variadic": true, "when": true, "where": true, "window": true, "with": true,
+	}
+)
+
+// pgIdent quotes an identifier unless PostgreSQL takes it as is.
+func pgIdent(name string) string {
+	if plainIdentifier.MatchString(name) && !postgresReserved[name] {
+		return name
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// pgColumn is a column of a table and the field it holds.
+type pgColumn struct {
+	name, field, typ string
+	notNull          bool
+}
+
+// pgColumns returns the columns of a node, named after name. Embedded
+// documents with known fields are flattened into a column per field, named
+// like "address_city"; arrays, -dynamic documents and mixed types go into
+// jsonb columns.
+func pgColumns(name string, n *modelNode, notNull bool) []pgColumn {
+	if len(n.Types) == 1 && n.Types[0] == "DOCUMENT" && n.Properties != nil && n.Rest == nil && n.Path != "_id" {
+		var columns []pgColumn
+		for _, child := range n.Properties {
+			columns = append(columns, pgColumns(name+"_"+child.Name, child, notNull && child.Required)...)
+		}
+		return columns
+	}
+	column := pgColumn{name: name, field: n.Path, typ: "jsonb", notNull: notNull}
+	switch {
+	case len(n.Types) == 1 && postgresTypes[n.Types[0]] != "":
+		column.typ = postgresTypes[n.Types[0]]
+	case n.Numeric:
+		column.typ = "numeric"
+	}
+	return []pgColumn{column}
+}
+
+// tableColumns returns the columns of the table of a collection, with
+// unique names. Summarized -dynamic keys of the documents go into an extra
+// jsonb column.
+func tableColumns(c *collectionModel) []pgColumn {
+	var columns []pgColumn
+	for _, child := range c.Document.Properties {
+		columns = append(columns, pgColumns(child.Name, child, child.Required)...)
+	}
+	if c.Document.Rest != nil {
+		columns = append(columns, pgColumn{name: "extra", field: "*", typ: "jsonb"})
+	}
+	taken := make(map[string]bool)
+	for i := range columns {
+		columns[i].name = uniqueName(taken, columns[i].name)
+	}
+	return columns
+}
+
+// createTable returns the CREATE TABLE statement of a collection, keyed by
+// _id. Columns of fields missing from some sampled documents are nullable.
+func createTable(c *collectionModel) string {
+	columns := tableColumns(c)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "CREATE TABLE %v (\n", pgIdent(c.Name))
+	for i, col := range columns {
+		fmt.Fprintf(&b, "    %v %v", pgIdent(col.name), col.typ)
+		switch {
+		case col.field == "_id":
+			b.WriteString(" PRIMARY KEY")
+		case col.notNull:
+			b.WriteString(" NOT NULL")
+		}
+		if i < len(columns)-1 {
+			b.WriteString(",")
+		}
+		if col.field != col.name {
+			fmt.Fprintf(&b, " -- %v", col.field)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(");\n")
+	return b.String()
+}
+
+// exportPostgresDDL writes the CREATE TABLE statements of the collections.
+func exportPostgresDDL(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	var b bytes.Buffer
+	b.WriteString("-- Generated by extract_mgo from sampled documents.\n")
+	for _, c := range m.Collections {
+		b.WriteString("\n")
+		b.WriteString(createTable(c))
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
@@ -0,0 +1,133 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	collStatsFlag = cli.BoolFlag{
+		Name:  "collstats",
+		Usage: "Also require the collStats privilege",
+	}
+	listIndexesFlag = cli.BoolFlag{
+		Name:  "list-indexes",
+		Usage: "Also require the listIndexes privilege",
+	}
+
+	preflightCommand = cli.Command{
+		Name:   "preflight",
+		Usage:  "Verify connection, server version and privileges before a long run",
+		Flags:  []cli.Flag{collStatsFlag, listIndexesFlag},
+		Action: preflight,
+	}
+)
+
+type privilegeResource struct {
+	DB          *string `bson:"db"`
+	Collection  *string `bson:"collection"`
+	Cluster     bool    `bson:"cluster"`
+	AnyResource bool    `bson:"anyResource"`
+}
+
+type privilege struct {
+	Resource privilegeResource `bson:"resource"`
+	Actions  []string          `bson:"actions"`
+}
+
+type connectionStatus struct {
+	AuthInfo struct {
+		AuthenticatedUsers []struct {
+			User string `bson:"user"`
+			DB   string `bson:"db"`
+		} `bson:"authenticatedUsers"`
+		AuthenticatedUserPrivileges []privilege `bson:"authenticatedUserPrivileges"`
+	} `bson:"authInfo"`
+}
+
+// coversDatabase reports whether the resource grants actions on the
+// collections of dbName.
+func (r privilegeResource) coversDatabase(dbName string) bool {
+	if r.AnyResource {
+		return true
+	}
+	if r.Cluster || r.DB == nil || r.Collection == nil {
+		return false
+	}
+	return (*r.DB == "" || *r.DB == dbName) && *r.Collection == ""
+}
+
+func grantedActions(status *connectionStatus, dbName string) map[string]struct{} {
+	actions := make(map[string]struct{})
+	for _, p := range status.AuthInfo.AuthenticatedUserPrivileges {
+		if !p.Resource.coversDatabase(dbName) {
+			continue
+		}
+		for _, action := range p.Actions {
+			actions[action] = struct{}{}
+		}
+	}
+	return actions
+}
+
+func preflight(ctx *cli.Context) error {
+	cmdInfo := new(commandInfo)
+	cmdInfo.urls = databaseURLs(ctx)
+	session, err := connect(cmdInfo)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Connection failed: %v", err), 1)
+	}
+	defer session.Close()
+	fmt.Printf("Connection: ok\n")
+
+	buildInfo, err := session.BuildInfo()
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("buildInfo failed: %v", err), 1)
+	}
+	fmt.Printf("Server version: %v\n", buildInfo.Version)
+
+	required := []string{"listCollections", "find"}
+	if ctx.Bool(collStatsFlag.Name) {
+		required = append(required, "collStats")
+	}
+	if ctx.Bool(listIndexesFlag.Name) {
+		required = append(required, "listIndexes")
+	}
+
+	db := session.DB(cmdInfo.dbName)
+	var status connectionStatus
+	err = db.Run(bson.D{{Name: "connectionStatus", Value: 1}, {Name: "showPrivileges", Value: true}}, &status)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("connectionStatus failed: %v", err), 1)
+	}
+	if len(status.AuthInfo.AuthenticatedUsers) == 0 {
+		// Either access control is disabled or we are not authenticated;
+		// listing collections tells the two apart.
+		if _, err := db.CollectionNames(); err != nil {
+			return cli.NewExitError(fmt.Sprintf("Not authenticated and listCollections failed: %v", err), 1)
+		}
+		fmt.Printf("Access control: disabled, privileges are not enforced\n")
+		return nil
+	}
+	for _, user := range status.AuthInfo.AuthenticatedUsers {
+		fmt.Printf("Authenticated as: %v@%v\n", user.User, user.DB)
+	}
+
+	granted := grantedActions(&status, cmdInfo.dbName)
+	var missing []string
+	for _, action := range required {
+		if _, ok := granted[action]; ok {
+			fmt.Printf("Privilege %v on %v: ok\n", action, cmdInfo.dbName)
+		} else {
+			fmt.Printf("Privilege %v on %v: MISSING\n", action, cmdInfo.dbName)
+			missing = append(missing, action)
+		}
+	}
+	if len(missing) > 0 {
+		return cli.NewExitError(fmt.Sprintf("Missing privileges on %v: %v", cmdInfo.dbName, strings.Join(missing, ", ")), 1)
+	}
+	return nil
+}
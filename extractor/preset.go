@@ -0,0 +1,119 @@
+package extractor
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var presetFlag = cli.StringSliceFlag{
+	Name:  "preset",
+	Usage: "Exclude framework-internal fields and collections, e.g. \"meteor\", \"mongoose\" or \"parse\". Repeatable; more presets can be defined in the config file",
+}
+
+// preset describes framework conventions to hide from the schema. Patterns
+// are path.Match globs on field names and collection names.
+type preset struct {
+	Exclude            []string          `yaml:"exclude"`
+	ExcludeCollections []string          `yaml:"excludeCollections"`
+	Rename             map[string]string `yaml:"rename"`
+}
+
+var builtinPresets = map[string]preset{
+	"meteor": {
+		Exclude: []string{"services.resume.*", "services.password.*", "services.email.verificationTokens*"},
+		ExcludeCollections: []string{
+			"meteor_accounts_loginServiceConfiguration", "meteor_oauth_pendingCredentials",
+			"meteor_oauth_pendingRequestTokens", "meteor-migrations",
+		},
+	},
+	"mongoose": {
+		Exclude: []string{"__v"},
+	},
+	"parse": {
+		Exclude: []string{
+			"_rperm", "_rperm[]", "_wperm", "_wperm[]", "_acl", "_acl.*", "_hashed_password",
+			"_email_verify_token*", "_perishable_token*", "_tombstone", "_failed_login_count",
+			"_account_lockout_expires_at", "_password_changed_at", "_password_history*",
+		},
+		ExcludeCollections: []string{"_SCHEMA", "_Session", "_Hooks", "_GlobalConfig", "_JobStatus", "_PushStatus", "_Idempotency"},
+		Rename:             map[string]string{"_created_at": "createdAt", "_updated_at": "updatedAt"},
+	},
+}
+
+// resolvePresets combines the named presets. A preset from the config file
+// extends the built-in one of the same name.
+func resolvePresets(names []string, cfg *config) (*preset, error) {
+	result := &preset{Rename: make(map[string]string)}
+	for _, name := range names {
+		builtin, isBuiltin := builtinPresets[name]
+		custom, isCustom := cfg.Presets[name]
+		if !isBuiltin && !isCustom {
+			return nil, fmt.Errorf("unknown preset %q", name)
+		}
+		for _, p := range []preset{builtin, custom} {
+			result.Exclude = append(result.Exclude, p.Exclude...)
+			result.ExcludeCollections = append(result.ExcludeCollections, p.ExcludeCollections...)
+			for from, to := range p.Rename {
+				result.Rename[from] = to
+			}
+		}
+	}
+	for _, pattern := range append(result.Exclude, result.ExcludeCollections...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad preset pattern %q: %v", pattern, err)
+		}
+	}
+	return result, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skipsCollection reports whether the preset hides the whole collection.
+func (p *preset) skipsCollection(name string) bool {
+	return p != nil && matchAny(p.ExcludeCollections, name)
+}
+
+// apply drops excluded fields and renames normalized ones. Renamed fields
+// whose target exists already are merged into it.
+func (p *preset) apply(colSchema docSchema) docSchema {
+	if p == nil {
+		return colSchema
+	}
+	result := docSchema{}
+	index := make(map[string]int)
+	for _, f := range colSchema {
+		if matchAny(p.Exclude, f.Name) {
+			continue
+		}
+		for from, to := range p.Rename {
+			if f.Name == from || strings.HasPrefix(f.Name, from+".") || strings.HasPrefix(f.Name, from+"[]") {
+				f.Name = to + f.Name[len(from):]
+				break
+			}
+		}
+		if i, ok := index[f.Name]; ok {
+			for _, t := range f.fieldTypes() {
+				result[i].addType(t)
+			}
+			if f.Count > result[i].Count {
+				result[i].Count = f.Count
+			}
+			continue
+		}
+		index[f.Name] = len(result)
+		result = append(result, f)
+	}
+	sort.Sort(result)
+	return result
+}
@@ -0,0 +1,223 @@
+package extractor
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// PrivacySignificantDigits is the precision ranges and histogram positions
+// are rounded to when a privacy option is set.
+const PrivacySignificantDigits = 2
+
+var (
+	noiseEpsilonFlag = cli.Float64Flag{
+		Name: "noise-epsilon",
+		Usage: "Add Laplace noise of scale 1/epsilon to the published counts, in the manner of differential privacy. " +
+			"Smaller is noisier; 0 adds none",
+	}
+	roundCountsFlag = cli.IntFlag{
+		Name:  "round-counts",
+		Usage: "Round the published counts to a multiple of this number",
+	}
+	minCategoryFlag = cli.IntFlag{
+		Name:  "min-category",
+		Usage: "Leave out top values, histogram bins and tenants sampled fewer times than this",
+	}
+)
+
+// privacyPolicy blurs the statistics of the output so that they do not
+// reveal single documents. Ranges are rounded outwards and document ids are
+// left out whenever a policy is set.
+type privacyPolicy struct {
+	epsilon     float64
+	roundTo     int
+	minCategory int
+
+	lock sync.Mutex // guards rand, as findings are made concurrently
+	rand *rand.Rand
+}
+
+// findingPrivacy is the policy of the run, nil without one. Findings quote
+// their counts through it.
+var findingPrivacy *privacyPolicy
+
+// publishedCount returns a count as a finding may quote it.
+func publishedCount(n int) int {
+	if findingPrivacy == nil {
+		return n
+	}
+	return findingPrivacy.count(n)
+}
+
+// newPrivacyPolicy returns nil when no option is set.
+func newPrivacyPolicy(epsilon float64, roundTo, minCategory int) (*privacyPolicy, error) {
+	if epsilon < 0 || roundTo < 0 || minCategory < 0 {
+		return nil, fmt.Errorf("privacy options must not be negative")
+	}
+	if epsilon == 0 && roundTo <= 1 && minCategory == 0 {
+		return nil, nil
+	}
+	// The noise must not be predictable from the time of the run.
+	var seed [8]byte
+	if _, err := crand.Read(seed[:]); err != nil {
+		return nil, err
+	}
+	return &privacyPolicy{
+		epsilon:     epsilon,
+		roundTo:     roundTo,
+		minCategory: minCategory,
+		rand:        rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:])))),
+	}, nil
+}
+
+// laplace draws from the Laplace distribution centered on 0 with the given
+// scale.
+func (p *privacyPolicy) laplace(scale float64) float64 {
+	u := p.rand.Float64() - 0.5
+	if u < 0 {
+		return scale * math.Log(1+2*u)
+	}
+	return -scale * math.Log(1-2*u)
+}
+
+// count returns the published value of a count.
+func (p *privacyPolicy) count(n int) int {
+	v := float64(n)
+	if p.epsilon > 0 {
+		p.lock.Lock()
+		v += p.laplace(1 / p.epsilon)
+		p.lock.Unlock()
+	}
+	if p.roundTo > 1 {
+		v = math.Round(v/float64(p.roundTo)) * float64(p.roundTo)
+	}
+	if v < 0 {
+		return 0
+	}
+	return int(math.Round(v))
+}
+
+// roundSignificant rounds v to PrivacySignificantDigits with the rounding
+// function round, e.g. math.Floor to round a minimum outwards.
+func roundSignificant(v float64, round func(float64) float64) float64 {
+	if v == 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return v
+	}
+	exp := math.Floor(math.Log10(math.Abs(v))) - PrivacySignificantDigits + 1
+	if exp < 0 {
+		// Dividing by an exact power of ten keeps 1.2 from becoming
+		// 1.2000000000000002.
+		scale := math.Pow(10, -exp)
+		return round(v*scale) / scale
+	}
+	scale := math.Pow(10, exp)
+	return round(v/scale) * scale
+}
+
+// apply blurs the statistics of the schema in place.
+func (p *privacyPolicy) apply(schema map[string]docSchema, stats map[string]*collectionStats) {
+	for name, colSchema := range schema {
+		sampled := -1
+		if s := stats[name]; s != nil {
+			s.Documents = p.count(s.Documents)
+			s.Sampled = p.count(s.Sampled)
+			sampled = s.Sampled
+		}
+		p.applyTenants(colSchema)
+		for i := range colSchema {
+			f := &colSchema[i]
+			f.Count = p.count(f.Count)
+			if sampled >= 0 && f.Count > sampled {
+				f.Count = sampled
+			}
+			f.Provenance = nil
+			f.Keys = p.count(f.Keys)
+			for t, n := range f.KeyTypes {
+				f.KeyTypes[t] = p.count(n)
+			}
+			for t, n := range f.ElementTypes {
+				f.ElementTypes[t] = p.count(n)
+			}
+			if f.Values != nil {
+				p.applyValues(f.Values)
+			}
+			if f.Coercion != nil {
+				for j := range f.Coercion.Updates {
+					f.Coercion.Updates[j].Affected = p.count(f.Coercion.Updates[j].Affected)
+				}
+			}
+		}
+	}
+}
+
+// applyTenants blurs the per-tenant counts of -tenant-field. Tenants with
+// fewer sampled documents than -min-category are left out of every field,
+// and no field counts more documents of a tenant than the tenant has.
+func (p *privacyPolicy) applyTenants(colSchema docSchema) {
+	documents := make(map[string]int)
+	for _, f := range colSchema {
+		if f.Name == "_id" {
+			for t, n := range f.Tenants {
+				if n >= p.minCategory {
+					documents[t] = p.count(n)
+				}
+			}
+		}
+	}
+	for i := range colSchema {
+		f := &colSchema[i]
+		if f.Tenants == nil {
+			continue
+		}
+		tenants := make(map[string]int, len(f.Tenants))
+		for t, n := range f.Tenants {
+			max, ok := documents[t]
+			if !ok {
+				continue
+			}
+			if f.Name == "_id" {
+				tenants[t] = max
+				continue
+			}
+			if n = p.count(n); n > max {
+				n = max
+			}
+			tenants[t] = n
+		}
+		f.Tenants = tenants
+	}
+}
+
+func (p *privacyPolicy) applyValues(v *valueSummary) {
+	v.Distinct = p.count(v.Distinct)
+	top := v.Top[:0]
+	for _, c := range v.Top {
+		if c.Count < p.minCategory {
+			continue
+		}
+		top = append(top, valueCount{Value: c.Value, Count: p.count(c.Count)})
+	}
+	v.Top = top
+	if v.Min != nil {
+		min := roundSignificant(*v.Min, math.Floor)
+		v.Min = &min
+	}
+	if v.Max != nil {
+		max := roundSignificant(*v.Max, math.Ceil)
+		v.Max = &max
+	}
+	bins := v.Histogram[:0]
+	for _, b := range v.Histogram {
+		if b.Count < p.minCategory {
+			continue
+		}
+		bins = append(bins, histogramBin{Value: roundSignificant(b.Value, math.Round), Count: p.count(b.Count)})
+	}
+	v.Histogram = bins
+}
@@ -0,0 +1,242 @@
+package extractor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// fieldProfile accumulates observations about the values of a field while a
+// collection is sampled.
+type fieldProfile struct {
+	strings        int
+	numericStrings int
+	booleanStrings int
+	// inexactStrings are numeric strings a number would not give back, such
+	// as zip codes with leading zeros or ids too long for a double.
+	inexactStrings int
+
+	integers     int
+	epochSeconds int
+	epochMillis  int
+	// largeIntegers are integers a double cannot hold exactly.
+	largeIntegers int
+
+	folded      map[string]string // folded value to first original value
+	foldVariant [2]string         // two values equal once folded
+
+	objectIDStrings int      // strings of 24 hexadecimal digits
+	objectIDs       []string // distinct ones, up to MaxReferenceProbes
+
+	values *valueStats // -deep value counts
+}
+
+// Integers between these bounds look like epoch timestamps from 2000 to 2100.
+const (
+	MinEpochSeconds int64 = 946684800
+	MaxEpochSeconds int64 = 4102444800
+	MinEpochMillis        = MinEpochSeconds * 1000
+	MaxEpochMillis        = MaxEpochSeconds * 1000
+)
+
+func isNumericString(s string) bool {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return err == nil && !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// MaxExactDigits is the number of significant digits a double holds exactly.
+const MaxExactDigits = 15
+
+// isExactNumericString tells whether a numeric string survives conversion to
+// a double: no leading zeros and at most MaxExactDigits significant digits.
+func isExactNumericString(s string) bool {
+	s = strings.TrimLeft(strings.TrimSpace(s), "+-")
+	mantissa := s
+	if i := strings.IndexAny(s, "eE"); i != -1 {
+		mantissa = s[:i]
+	}
+	if len(mantissa) > 1 && mantissa[0] == '0' && mantissa[1] != '.' {
+		return false
+	}
+	digits := strings.TrimLeft(strings.Replace(mantissa, ".", "", 1), "0")
+	if strings.Contains(mantissa, ".") {
+		digits = strings.TrimRight(digits, "0")
+	}
+	return len(digits) <= MaxExactDigits
+}
+
+func isBooleanString(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "false", "1", "0":
+		return true
+	}
+	return false
+}
+
+// observe records a sampled value of the field, profiling it with -deep
+// when deep is set.
+func (field *docField) observe(value interface{}, deep bool) {
+	if field.profile == nil {
+		field.profile = new(fieldProfile)
+	}
+	p := field.profile
+	switch v := value.(type) {
+	case string:
+		p.strings++
+		if isNumericString(v) {
+			p.numericStrings++
+			if !isExactNumericString(v) {
+				p.inexactStrings++
+			}
+		}
+		if isBooleanString(v) {
+			p.booleanStrings++
+		}
+		if bson.IsObjectIdHex(v) {
+			p.observeObjectID(v)
+		}
+		p.observeFolded(v)
+	case int:
+		p.observeInteger(int64(v))
+	case int64:
+		p.observeInteger(v)
+	}
+	if valueProfiling != nil && deep {
+		if p.values == nil {
+			p.values = newValueStats(valueProfiling)
+		}
+		p.values.observe(value)
+	}
+}
+
+func (p *fieldProfile) observeInteger(v int64) {
+	p.integers++
+	if v > 1<<53 || v < -1<<53 {
+		p.largeIntegers++
+	}
+	switch {
+	case v >= MinEpochSeconds && v < MaxEpochSeconds:
+		p.epochSeconds++
+	case v >= MinEpochMillis && v < MaxEpochMillis:
+		p.epochMillis++
+	}
+}
+
+// merge adds the observations of other, gathered on another part of the
+// same collection.
+func (p *fieldProfile) merge(other *fieldProfile) {
+	p.strings += other.strings
+	p.numericStrings += other.numericStrings
+	p.booleanStrings += other.booleanStrings
+	p.inexactStrings += other.inexactStrings
+	p.integers += other.integers
+	p.largeIntegers += other.largeIntegers
+	p.epochSeconds += other.epochSeconds
+	p.epochMillis += other.epochMillis
+	if p.foldVariant[0] == "" && other.foldVariant[0] != "" {
+		p.foldVariant = other.foldVariant
+	}
+	for _, s := range other.folded {
+		p.observeFolded(s)
+	}
+	p.objectIDStrings += other.objectIDStrings
+	for _, id := range other.objectIDs {
+		p.addObjectID(id)
+	}
+	switch {
+	case other.values == nil:
+	case p.values == nil:
+		p.values = other.values
+	default:
+		p.values.merge(other.values)
+	}
+}
+
+// baseType strips the subtype from a type name, e.g. "STRING(NUMERIC)"
+// becomes "STRING".
+func baseType(typeName string) string {
+	if i := strings.Index(typeName, "("); i != -1 {
+		return typeName[:i]
+	}
+	return typeName
+}
+
+// classifyFields refines field types from the profiles gathered during
+// sampling and reports suggested type migrations as findings.
+func classifyFields(collection string, colSchema docSchema) {
+	for i := range colSchema {
+		f := &colSchema[i]
+		p := f.profile
+		if p == nil {
+			continue
+		}
+		if p.strings > 0 && containsString(f.fieldTypes(), "STRING") {
+			classifyStrings(collection, f, p)
+		}
+		if p.integers > 0 && containsString(f.fieldTypes(), "INTEGER") {
+			classifyIntegers(collection, f, p)
+		}
+	}
+}
+
+// refineType replaces a base type of the field by a subtype of it, in Type
+// and Types alike, so that readers of either agree.
+func (field *docField) refineType(base, refined string) {
+	if field.Type == base {
+		field.Type = refined
+	}
+	for i, t := range field.Types {
+		if t == base {
+			field.Types[i] = refined
+		}
+	}
+	sort.Strings(field.Types)
+}
+
+func classifyStrings(collection string, f *docField, p *fieldProfile) {
+	switch {
+	case p.booleanStrings == p.strings:
+		f.refineType("STRING", "STRING(BOOLEAN)")
+		addFinding(finding{
+			Collection: collection,
+			Field:      f.Name,
+			Kind:       "type-migration",
+			Message:    fmt.Sprintf("%v.%v: all %v sampled strings are boolean-like, consider migrating to BOOL", collection, f.Name, publishedCount(p.strings)),
+		})
+	case p.numericStrings == p.strings:
+		f.refineType("STRING", "STRING(NUMERIC)")
+		addFinding(finding{
+			Collection: collection,
+			Field:      f.Name,
+			Kind:       "type-migration",
+			Message:    fmt.Sprintf("%v.%v: all %v sampled strings are numeric, consider migrating to INTEGER or DECIMAL", collection, f.Name, publishedCount(p.strings)),
+		})
+	}
+}
+
+// classifyIntegers detects dates stored as epoch seconds or milliseconds, the
+// most common hidden date.
+func classifyIntegers(collection string, f *docField, p *fieldProfile) {
+	unit := ""
+	switch p.integers {
+	case p.epochSeconds:
+		f.refineType("INTEGER", "INTEGER(EPOCH_SECONDS)")
+		unit = "seconds"
+	case p.epochMillis:
+		f.refineType("INTEGER", "INTEGER(EPOCH_MILLIS)")
+		unit = "milliseconds"
+	default:
+		return
+	}
+	addFinding(finding{
+		Collection: collection,
+		Field:      f.Name,
+		Kind:       "type-migration",
+		Message: fmt.Sprintf("%v.%v: all %v sampled integers look like epoch %v between 2000 and 2100, consider migrating to TIME",
+			collection, f.Name, publishedCount(p.integers), unit),
+	})
+}
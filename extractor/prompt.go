@@ -0,0 +1,140 @@
+package extractor
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"golang.org/x/crypto/ssh/terminal"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var interactiveFlag = cli.BoolFlag{
+	Name:  "interactive",
+	Usage: "Build the connection string with an interactive wizard instead of -database",
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func isInteractive() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// prompt asks for a line of input, returning def when the answer is empty.
+func prompt(label, def string) string {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", label)
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatal(err)
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+// promptPassword asks for a password without echoing it.
+func promptPassword(label string) string {
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(password)
+}
+
+// databaseURLs returns the connection strings from -database, or runs the
+// wizard when -interactive is given.
+func databaseURLs(ctx *cli.Context) []string {
+	if urls := ctx.GlobalStringSlice(datatabseFlag.Name); len(urls) > 0 {
+		return urls
+	}
+	if ctx.GlobalBool(interactiveFlag.Name) {
+		if !isInteractive() {
+			log.Fatalf("%s requires a terminal!", interactiveFlag.Name)
+		}
+		return []string{buildURLInteractively()}
+	}
+	log.Fatalf("%s is mandatory!", datatabseFlag.Name)
+	return nil
+}
+
+func buildURLInteractively() string {
+	hosts := prompt("Hosts (host:port[,host:port])", "localhost:27017")
+	dbName := ""
+	for dbName == "" {
+		dbName = prompt("Database", "")
+	}
+	user := prompt("Username (empty for none)", "")
+	var options []string
+	connURL := "mongodb://"
+	if user != "" {
+		password := promptPassword("Password")
+		connURL += url.QueryEscape(user) + ":" + url.QueryEscape(password) + "@"
+		if source := prompt("Authentication database", dbName); source != dbName {
+			options = append(options, "authSource="+source)
+		}
+	}
+	if replicaSet := prompt("Replica set (empty for none)", ""); replicaSet != "" {
+		options = append(options, "replicaSet="+replicaSet)
+	}
+	connURL += hosts + "/" + dbName
+	if len(options) > 0 {
+		connURL += "?" + strings.Join(options, "&")
+	}
+	log.Printf("Using connection string %v\n", maskPassword(connURL))
+	return connURL
+}
+
+// maskPassword hides the password of a connection string for logging.
+func maskPassword(connURL string) string {
+	rest := strings.TrimPrefix(connURL, "mongodb://")
+	at := strings.Index(rest, "@")
+	if at == -1 {
+		return connURL
+	}
+	if colon := strings.Index(rest[:at], ":"); colon != -1 {
+		return "mongodb://" + rest[:colon] + ":****" + rest[at:]
+	}
+	return connURL
+}
+
+func isUnauthorized(err error) bool {
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == 13 {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "not authorized") || strings.Contains(msg, "requires authentication")
+}
+
+// ensureCredentials prompts for a username and password when the connection
+// string carries none and the server turns out to require them.
+func ensureCredentials(session *mgo.Session, dialInfo *mgo.DialInfo) {
+	if dialInfo.Username != "" || !isInteractive() {
+		return
+	}
+	_, err := session.DB(dialInfo.Database).CollectionNames()
+	if err == nil || !isUnauthorized(err) {
+		return
+	}
+	log.Printf("Server requires authentication for database %v\n", dialInfo.Database)
+	credential := &mgo.Credential{
+		Username:  prompt("Username", ""),
+		Password:  promptPassword("Password"),
+		Source:    dialInfo.Source,
+		Mechanism: dialInfo.Mechanism,
+	}
+	if err := session.Login(credential); err != nil {
+		log.Fatal(err)
+	}
+}
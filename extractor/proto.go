@@ -0,0 +1,208 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// ProtoFormat writes Protocol Buffers (proto3) message definitions of the
+// collections.
+const ProtoFormat = "proto"
+
+// Protocol Buffers well-known types standing in for BSON values.
+const (
+	protoTimestamp = "google.protobuf.Timestamp"
+	protoValue     = "google.protobuf.Value"
+	protoListValue = "google.protobuf.ListValue"
+	protoStruct    = "google.protobuf.Struct"
+)
+
+// protoScalarTypes are the proto types of the base types, as mgo decodes
+// them. ObjectIds are kept as their hex strings.
+var protoScalarTypes = map[string]string{
+	"INTEGER":  "int64",
+	"DECIMAL":  "double",
+	"STRING":   "string",
+	"BOOL":     "bool",
+	"OBJECTID": "string",
+	"BINARY":   "bytes",
+}
+
+// protoImports are the files declaring the well-known types.
+var protoImports = map[string]string{
+	protoTimestamp: "google/protobuf/timestamp.proto",
+	protoValue:     "google/protobuf/struct.proto",
+	protoListValue: "google/protobuf/struct.proto",
+	protoStruct:    "google/protobuf/struct.proto",
+}
+
+// Kinds of proto fields, which decide their label.
+const (
+	protoScalar = iota
+	protoMessage
+	protoRepeated
+	protoMap
+)
+
+// protoWriter writes messages, nesting the messages of embedded documents
+// in the message using them.
+type protoWriter struct {
+	source  bytes.Buffer
+	imports map[string]bool
+}
+
+// protoJSONName is the JSON name protoc derives from a field name.
+func protoJSONName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// protoType returns the type of a node and its kind. Embedded documents
+// with known fields become messages nested in the one being written, with
+// names derived from name, and -dynamic documents maps. Mixed types and
+// what proto cannot type, such as arrays of arrays, take the well-known
+// Value, ListValue and Struct types; integers mixed with decimals are
+// doubles.
+func (w *protoWriter) protoType(name string, n *modelNode, nested map[string]*modelNode, taken map[string]bool) (string, int) {
+	if n.Numeric {
+		return "double", protoScalar
+	}
+	types := n.Types
+	if len(types) != 1 {
+		return w.wellKnown(protoValue), protoMessage
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		switch {
+		case n.Properties != nil:
+			messageName := uniqueName(taken, goName(plainName(name)))
+			nested[messageName] = n
+			return messageName, protoMessage
+		case n.Rest != nil:
+			value, kind := w.protoType(name+"_value", n.Rest, nested, taken)
+			if kind == protoRepeated || kind == protoMap {
+				value = w.wellKnown(protoValue)
+			}
+			return "map<string, " + value + ">", protoMap
+		}
+		return w.wellKnown(protoStruct), protoMessage
+	case "ARRAY":
+		if n.Items == nil {
+			return w.wellKnown(protoValue), protoRepeated
+		}
+		item, kind := w.protoType(name+"_item", n.Items, nested, taken)
+		switch kind {
+		case protoRepeated:
+			item = w.wellKnown(protoListValue)
+		case protoMap:
+			item = w.wellKnown(protoStruct)
+		}
+		return item, protoRepeated
+	case "TIME":
+		return w.wellKnown(protoTimestamp), protoMessage
+	}
+	if t, ok := protoScalarTypes[types[0]]; ok {
+		return t, protoScalar
+	}
+	return w.wellKnown(protoValue), protoMessage
+}
+
+func (w *protoWriter) wellKnown(t string) string {
+	w.imports[protoImports[t]] = true
+	return t
+}
+
+// writeMessage writes the message of a document at the given depth. Fields
+// are numbered in order, _id first, skipping the numbers proto reserves;
+// optional scalars are marked optional.
+func (w *protoWriter) writeMessage(name string, n *modelNode, depth int) {
+	indent := strings.Repeat("  ", depth)
+	nested := make(map[string]*modelNode)
+	// Nested messages and fields share a scope.
+	taken := make(map[string]bool)
+	fieldNames := make([]string, len(n.Properties))
+	for i, child := range n.Properties {
+		fieldNames[i] = uniqueName(taken, plainName(child.Name))
+	}
+	var fields bytes.Buffer
+	number := 1
+	for i, child := range n.Properties {
+		fieldName := fieldNames[i]
+		typ, kind := w.protoType(child.Name, child, nested, taken)
+		label := ""
+		switch {
+		case kind == protoRepeated:
+			label = "repeated "
+		case kind == protoScalar && !child.Required:
+			label = "optional "
+		}
+		options := ""
+		if protoJSONName(fieldName) != child.Name {
+			options = fmt.Sprintf(" [json_name = %q]", child.Name)
+		}
+		fmt.Fprintf(&fields, "%v  %v%v %v = %d%v;\n", indent, label, typ, fieldName, number, options)
+		if number++; number == 19000 {
+			number = 20000
+		}
+	}
+	fmt.Fprintf(&w.source, "%vmessage %v {\n", indent, name)
+	names := make([]string, 0, len(nested))
+	for messageName := range nested {
+		names = append(names, messageName)
+	}
+	sort.Strings(names)
+	for _, messageName := range names {
+		w.writeMessage(messageName, nested[messageName], depth+1)
+		w.source.WriteString("\n")
+	}
+	w.source.Write(fields.Bytes())
+	fmt.Fprintf(&w.source, "%v}\n", indent)
+}
+
+// protoMessages returns a proto3 file declaring a message per collection,
+// named after the collection, in a package named after the database.
+func protoMessages(m *schemaModel) []byte {
+	w := &protoWriter{imports: make(map[string]bool)}
+	taken := make(map[string]bool)
+	for _, c := range m.Collections {
+		name := uniqueName(taken, goName(plainName(c.Name)))
+		fmt.Fprintf(&w.source, "\n// %v is a document of the %v collection.\n", name, c.Name)
+		w.writeMessage(name, c.Document, 0)
+	}
+	var source bytes.Buffer
+	source.WriteString("// Generated by extract_mgo from sampled documents.\n\n")
+	source.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&source, "package %v;\n", plainName(strings.ToLower(m.Database)))
+	if len(w.imports) > 0 {
+		imports := make([]string, 0, len(w.imports))
+		for path := range w.imports {
+			imports = append(imports, path)
+		}
+		sort.Strings(imports)
+		source.WriteString("\n")
+		for _, path := range imports {
+			fmt.Fprintf(&source, "import %q;\n", path)
+		}
+	}
+	source.Write(w.source.Bytes())
+	return source.Bytes()
+}
+
+func exportProto(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, protoMessages(m), 0644)
+}
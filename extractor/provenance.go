@@ -0,0 +1,54 @@
+package extractor
+
+import (
+	"reflect"
+
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var provenanceFlag = cli.IntFlag{
+	Name:  "provenance",
+	Usage: "Record up to this many _id values of the sampled documents exhibiting each type of a field, to look up conflicting documents. 0 records none",
+}
+
+// provenanceLimit is the number of document ids kept per field type.
+var provenanceLimit int
+
+func documentID(doc bson.D) interface{} {
+	for _, e := range doc {
+		if e.Name == "_id" {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+// recordProvenance remembers that the document with the given id has the
+// field with type typeName.
+func (field *docField) recordProvenance(typeName string, id interface{}) {
+	if provenanceLimit <= 0 || id == nil {
+		return
+	}
+	ids := field.Provenance[typeName]
+	if len(ids) >= provenanceLimit {
+		return
+	}
+	// Array elements repeat the type within one document.
+	if len(ids) > 0 && reflect.DeepEqual(ids[len(ids)-1], id) {
+		return
+	}
+	if field.Provenance == nil {
+		field.Provenance = make(map[string][]interface{})
+	}
+	field.Provenance[typeName] = append(ids, id)
+}
+
+// mergeProvenance adds the ids recorded on another part of the collection.
+func (field *docField) mergeProvenance(other *docField) {
+	for typeName, ids := range other.Provenance {
+		for _, id := range ids {
+			field.recordProvenance(typeName, id)
+		}
+	}
+}
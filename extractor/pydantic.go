@@ -0,0 +1,236 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PydanticFormat writes a Python module of Pydantic v2 models of the
+// collections.
+const PydanticFormat = "pydantic"
+
+// pydanticTypes are the Python types of the base types. ObjectIds are
+// validated into their hex strings by the PyObjectId type of the module.
+var pydanticTypes = map[string]string{
+	"INTEGER":  "int",
+	"DECIMAL":  "float",
+	"STRING":   "str",
+	"BOOL":     "bool",
+	"TIME":     "datetime",
+	"OBJECTID": "PyObjectId",
+	"BINARY":   "bytes",
+}
+
+var (
+	pythonNonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+	// pythonReserved are the keywords of Python and the attributes of
+	// BaseModel, which cannot name fields. pydantic also reserves the names
+	// starting with "model_".
+	pythonReserved = map[string]bool{
+		"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true, "async": true,
+		"await": true, "break": true, "class": true, "continue": true, "def": true, "del": true, "elif": true,
+		"else": true, "except": true, "finally": true, "for": true, "from": true, "global": true, "if": true,
+		"import": true, "in": true, "is": true, "lambda": true, "nonlocal": true, "not": true, "or": true,
+		"pass": true, "raise": true, "return": true, "try": true, "while": true, "with": true, "yield": true,
+		"construct": true, "copy": true, "dict": true, "from_orm": true, "json": true, "parse_file": true,
+		"parse_obj": true, "parse_raw": true, "schema": true, "schema_json": true, "update_forward_refs": true,
+		"validate": true,
+	}
+)
+
+// pyName turns a field name into an attribute name, e.g. "_id" into "id",
+// "first name" into "first_name" and "class" into "class_". Fields not
+// named so are aliased.
+func pyName(name string) string {
+	ident := strings.Trim(pythonNonIdentifier.ReplaceAllString(name, "_"), "_")
+	switch {
+	case ident == "" || (ident[0] >= '0' && ident[0] <= '9') || strings.HasPrefix(ident, "model_"):
+		return "f_" + ident
+	case pythonReserved[ident]:
+		return ident + "_"
+	}
+	return ident
+}
+
+// pydanticWriter writes the model classes, those of nested documents
+// before the class using them.
+type pydanticWriter struct {
+	source  bytes.Buffer
+	classes map[string]bool
+	// typing and pydantic are the names to import from them.
+	typing, pydantic map[string]bool
+	// objectID and datetime tell which definitions the module needs.
+	objectID, datetime bool
+}
+
+// pyType returns the type of a node, writing the classes it needs under
+// names derived from name. Integers mixed with decimals are floats, and
+// other mixed scalars unions.
+func (w *pydanticWriter) pyType(name string, n *modelNode) string {
+	if n.Numeric {
+		return "float"
+	}
+	types := n.Types
+	if len(types) != 1 {
+		var union []string
+		for _, t := range types {
+			if pydanticTypes[t] == "" {
+				w.typing["Any"] = true
+				return "Any"
+			}
+			union = append(union, w.scalarType(t))
+		}
+		if len(union) == 0 {
+			w.typing["Any"] = true
+			return "Any"
+		}
+		w.typing["Union"] = true
+		return "Union[" + strings.Join(union, ", ") + "]"
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		if n.Properties == nil {
+			w.typing["Dict"] = true
+			if n.Rest == nil {
+				w.typing["Any"] = true
+				return "Dict[str, Any]"
+			}
+			return "Dict[str, " + w.pyType(name+"Value", n.Rest) + "]"
+		}
+		className := uniqueName(w.classes, name)
+		w.writeClass(className, n, "")
+		return className
+	case "ARRAY":
+		w.typing["List"] = true
+		if n.Items == nil {
+			w.typing["Any"] = true
+			return "List[Any]"
+		}
+		return "List[" + w.pyType(name+"Item", n.Items) + "]"
+	}
+	if pydanticTypes[types[0]] == "" {
+		w.typing["Any"] = true
+		return "Any"
+	}
+	return w.scalarType(types[0])
+}
+
+func (w *pydanticWriter) scalarType(t string) string {
+	switch t {
+	case "OBJECTID":
+		w.objectID = true
+	case "TIME":
+		w.datetime = true
+	}
+	return pydanticTypes[t]
+}
+
+// writeClass writes the model of a document. Fields missing from some
+// documents holding it are Optional and default to None. Summarized
+// -dynamic keys are allowed as extra fields.
+func (w *pydanticWriter) writeClass(name string, n *modelNode, doc string) {
+	var body bytes.Buffer
+	if doc != "" {
+		fmt.Fprintf(&body, "    \"\"\"%v\"\"\"\n\n", strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(doc))
+	}
+	var config []string
+	attributes := make(map[string]bool)
+	aliased := false
+	for _, child := range n.Properties {
+		attr := uniqueName(attributes, pyName(child.Name))
+		typ := w.pyType(name+goName(child.Name), child)
+		var args []string
+		if !child.Required {
+			args = append(args, "None")
+			if typ != "Any" {
+				w.typing["Optional"] = true
+				typ = "Optional[" + typ + "]"
+			}
+		}
+		if attr != child.Name {
+			aliased = true
+			args = append(args, "alias="+strconv.Quote(child.Name))
+		}
+		switch {
+		case attr != child.Name:
+			w.pydantic["Field"] = true
+			fmt.Fprintf(&body, "    %v: %v = Field(%v)\n", attr, typ, strings.Join(args, ", "))
+		case len(args) > 0:
+			fmt.Fprintf(&body, "    %v: %v = None\n", attr, typ)
+		default:
+			fmt.Fprintf(&body, "    %v: %v\n", attr, typ)
+		}
+	}
+	if aliased {
+		config = append(config, "populate_by_name=True")
+	}
+	if n.Rest != nil {
+		config = append(config, `extra="allow"`)
+	}
+	if len(config) > 0 {
+		w.pydantic["ConfigDict"] = true
+		if len(n.Properties) > 0 {
+			body.WriteString("\n")
+		}
+		fmt.Fprintf(&body, "    model_config = ConfigDict(%v)\n", strings.Join(config, ", "))
+	}
+	if body.Len() == 0 {
+		body.WriteString("    pass\n")
+	}
+	fmt.Fprintf(&w.source, "\n\nclass %v(BaseModel):\n", name)
+	w.source.Write(body.Bytes())
+}
+
+// pythonImports lists the names of an import statement.
+func pythonImports(names map[string]bool) string {
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+// pydanticModels returns a Python module declaring a model per collection,
+// named after the collection, and the models of their nested documents.
+func pydanticModels(m *schemaModel) []byte {
+	w := &pydanticWriter{
+		classes:  map[string]bool{"BaseModel": true, "PyObjectId": true},
+		typing:   make(map[string]bool),
+		pydantic: map[string]bool{"BaseModel": true},
+	}
+	for _, c := range m.Collections {
+		w.writeClass(uniqueName(w.classes, goName(c.Name)), c.Document, fmt.Sprintf("A document of the %v collection.", c.Name))
+	}
+	var source bytes.Buffer
+	source.WriteString("# Generated by extract_mgo from sampled documents.\n\n")
+	if w.datetime {
+		source.WriteString("from datetime import datetime\n")
+	}
+	if w.objectID {
+		w.typing["Annotated"] = true
+		w.pydantic["BeforeValidator"] = true
+	}
+	if len(w.typing) > 0 {
+		fmt.Fprintf(&source, "from typing import %v\n", pythonImports(w.typing))
+	}
+	if w.datetime || len(w.typing) > 0 {
+		source.WriteString("\n")
+	}
+	fmt.Fprintf(&source, "from pydantic import %v\n", pythonImports(w.pydantic))
+	if w.objectID {
+		source.WriteString("\n# ObjectIds are validated into their hex strings.\n")
+		source.WriteString("PyObjectId = Annotated[str, BeforeValidator(str)]\n")
+	}
+	source.Write(w.source.Bytes())
+	return source.Bytes()
+}
+
+func exportPydantic(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, pydanticModels(m), 0644)
+}
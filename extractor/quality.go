@@ -0,0 +1,162 @@
+package extractor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// RareFieldCoverage is the coverage below which a field counts as rare.
+	RareFieldCoverage = 0.05
+	// AlmostRequiredCoverage is the coverage above which a field that is
+	// still missing from some documents looks like a required field with gaps.
+	AlmostRequiredCoverage = 0.9
+)
+
+// qualityScore rates the health of a collection schema from 0 to 100 and
+// tells how many fields drag it down for each reason.
+type qualityScore struct {
+	Score          float64 `json:"score"`
+	Conflicts      int     `json:"conflicts"`
+	Unknowns       int     `json:"unknowns"`
+	RareFields     int     `json:"rareFields"`
+	NamingIssues   int     `json:"namingIssues"`
+	AlmostRequired int     `json:"almostRequired"`
+}
+
+// scoreEntry is a line of the ranked scoreboard.
+type scoreEntry struct {
+	Collection string  `json:"collection"`
+	Score      float64 `json:"score"`
+}
+
+// nameStyle classifies a field name segment as "camel", "snake" or "" when
+// it is neutral, e.g. a single lower case word.
+func nameStyle(segment string) string {
+	switch {
+	case strings.Contains(strings.Trim(segment, "_"), "_"):
+		return "snake"
+	case strings.IndexFunc(segment, unicode.IsUpper) > 0:
+		return "camel"
+	}
+	return ""
+}
+
+func hasOddCharacters(segment string) bool {
+	return strings.IndexFunc(segment, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) != -1
+}
+
+// lastSegment returns the last name part of a field, e.g. "sku" for
+// "items[].sku".
+func lastSegment(name string) string {
+	name = strings.TrimSuffix(name, "[]")
+	if i := strings.LastIndex(name, "."); i != -1 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "[]")
+}
+
+// namingIssues reports fields whose names contain odd characters or break
+// the collection's dominant camelCase/snake_case convention.
+func namingIssues(collection string, colSchema docSchema) int {
+	styles := make(map[string]int)
+	for _, f := range colSchema {
+		if style := nameStyle(lastSegment(f.Name)); style != "" {
+			styles[style]++
+		}
+	}
+	dominant := "camel"
+	if styles["snake"] > styles["camel"] {
+		dominant = "snake"
+	}
+	issues := 0
+	for _, f := range colSchema {
+		if isIDField(f.Name) || f.summarizesKeys() {
+			continue
+		}
+		segment := lastSegment(f.Name)
+		var problem string
+		if hasOddCharacters(segment) {
+			problem = "contains characters other than letters, digits and underscores"
+		} else if style := nameStyle(segment); style != "" && style != dominant {
+			problem = fmt.Sprintf("is %v case while the collection mostly uses %v case", style, dominant)
+		}
+		if problem == "" {
+			continue
+		}
+		issues++
+		addFinding(finding{
+			Collection: collection,
+			Field:      f.Name,
+			Kind:       "naming",
+			Message:    fmt.Sprintf("%v.%v %v", collection, f.Name, problem),
+		})
+	}
+	return issues
+}
+
+// scoreCollection computes the quality score. Each issue kind weighs by the
+// share of fields it affects, so wide collections are not punished for
+// their size.
+func scoreCollection(collection string, colSchema docSchema, sampled int) *qualityScore {
+	q := &qualityScore{Score: 100}
+	if len(colSchema) == 0 || sampled == 0 {
+		return q
+	}
+	for _, f := range colSchema {
+		if len(f.Types) > 0 {
+			q.Conflicts++
+		}
+		for _, t := range f.fieldTypes() {
+			if baseType(t) == "UNKNOWN" {
+				q.Unknowns++
+				break
+			}
+		}
+		coverage := float64(f.Count) / float64(sampled)
+		switch {
+		case coverage < RareFieldCoverage:
+			q.RareFields++
+		case coverage >= AlmostRequiredCoverage && coverage < 1:
+			q.AlmostRequired++
+		}
+	}
+	q.NamingIssues = namingIssues(collection, colSchema)
+	fields := float64(len(colSchema))
+	penalty := 0.3*float64(q.Conflicts)/fields +
+		0.2*float64(q.Unknowns)/fields +
+		0.2*float64(q.RareFields)/fields +
+		0.15*float64(q.NamingIssues)/fields +
+		0.15*float64(q.AlmostRequired)/fields
+	q.Score = math.Round(100*(1-penalty)*10) / 10
+	return q
+}
+
+// scoreboard ranks collections from the lowest quality score up and returns
+// the average score as the overall health of the database.
+func scoreboard(stats map[string]*collectionStats) ([]scoreEntry, float64) {
+	board := []scoreEntry{}
+	total := 0.0
+	for name, s := range stats {
+		if s.Quality == nil {
+			continue
+		}
+		board = append(board, scoreEntry{Collection: name, Score: s.Quality.Score})
+		total += s.Quality.Score
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].Score != board[j].Score {
+			return board[i].Score < board[j].Score
+		}
+		return board[i].Collection < board[j].Collection
+	})
+	if len(board) == 0 {
+		return board, 100
+	}
+	return board, math.Round(total/float64(len(board))*10) / 10
+}
@@ -0,0 +1,26 @@
+package extractor
+
+import (
+	"fmt"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var rawTypesFlag = cli.BoolFlag{
+	Name: "raw-types",
+	Usage: "Record values of unrecognized types with the Go type mgo decodes them into, e.g. " +
+		"\"UNKNOWN(bson.MongoTimestamp)\", instead of a bare UNKNOWN",
+}
+
+// rawTypes is set by -raw-types.
+var rawTypes bool
+
+// unknownType returns the type name of a value of no recognized type: its
+// Go type as a subtype of UNKNOWN with -raw-types. Fields with differing raw
+// types collapse to UNKNOWN, like any subtypes.
+func unknownType(object interface{}) string {
+	if rawTypes {
+		return fmt.Sprintf("UNKNOWN(%T)", object)
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,147 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var readConcernFlag = cli.StringFlag{
+	Name: "read-concern",
+	Usage: "Read concern of sample reads: \"local\", \"majority\", or \"snapshot\", which reads every collection " +
+		"at one cluster time (MongoDB 5.0+ replica sets and sharded clusters) so relationships between collections " +
+		"are consistent. mgo has no logical sessions, so snapshot reads stand in for causally consistent sessions",
+}
+
+// sampleQuery describes the read a sampling strategy issues. It is either a
+// find (Filter, Sort, Limit) or an aggregation (Pipeline).
+type sampleQuery struct {
+	// Database and Collection redirect the read, e.g. to the oplog.
+	Database   string
+	Collection string
+	Filter     bson.M
+	Sort       []string // mgo sort keys such as "-_id"
+	Limit      int
+	Pipeline   []bson.M
+	// Unwrap names the field of each result holding the sampled document.
+	Unwrap string
+	// skip holds the value keys of the _ids of documents never to sample.
+	skip map[string]struct{}
+}
+
+// sampleReader executes sample queries with the configured read concern.
+type sampleReader struct {
+	readConcern string
+	clusterTime bson.MongoTimestamp
+}
+
+func newSampleReader(readConcern string) (*sampleReader, error) {
+	switch readConcern {
+	case "", "local", "majority", "snapshot":
+		return &sampleReader{readConcern: readConcern}, nil
+	}
+	return nil, fmt.Errorf("unknown read concern %q", readConcern)
+}
+
+// start applies the read concern to the session. Snapshot reads pin the
+// current cluster time for the rest of the run.
+func (r *sampleReader) start(session *mgo.Session, db *mgo.Database) error {
+	switch r.readConcern {
+	case "local", "majority":
+		session.SetSafe(&mgo.Safe{RMode: r.readConcern})
+	case "snapshot":
+		var result struct {
+			OperationTime bson.MongoTimestamp `bson:"operationTime"`
+		}
+		if err := db.Run(bson.D{{Name: "ping", Value: 1}}, &result); err != nil {
+			return err
+		}
+		if result.OperationTime == 0 {
+			return fmt.Errorf("snapshot read concern needs a replica set or sharded cluster")
+		}
+		r.clusterTime = result.OperationTime
+	}
+	return nil
+}
+
+func sortDocument(keys []string) bson.D {
+	var sort bson.D
+	for _, key := range keys {
+		switch {
+		case strings.HasPrefix(key, "-"):
+			sort = append(sort, bson.DocElem{Name: key[1:], Value: -1})
+		case strings.HasPrefix(key, "+"):
+			sort = append(sort, bson.DocElem{Name: key[1:], Value: 1})
+		default:
+			sort = append(sort, bson.DocElem{Name: key, Value: 1})
+		}
+	}
+	return sort
+}
+
+// snapshotIter runs the query as a command reading at the pinned cluster
+// time, which mgo's Find and Pipe cannot express.
+func (r *sampleReader) snapshotIter(c *mgo.Collection, q sampleQuery) *mgo.Iter {
+	cmd := append(q.command(c.Name), bson.DocElem{Name: "readConcern", Value: bson.M{"level": "snapshot", "atClusterTime": r.clusterTime}})
+	var result struct {
+		Cursor struct {
+			FirstBatch []bson.Raw `bson:"firstBatch"`
+			ID         int64      `bson:"id"`
+		} `bson:"cursor"`
+	}
+	err := c.Database.Run(cmd, &result)
+	return c.NewIter(c.Database.Session, result.Cursor.FirstBatch, result.Cursor.ID, err)
+}
+
+// run executes the query against c and calls handle for each document.
+func (r *sampleReader) run(c *mgo.Collection, q sampleQuery, handle func(doc bson.D)) error {
+	if q.Database != "" {
+		c = c.Database.Session.DB(q.Database).C(q.Collection)
+	}
+	var iter *mgo.Iter
+	switch {
+	case r.readConcern == "snapshot":
+		iter = r.snapshotIter(c, q)
+	case q.Pipeline != nil:
+		iter = c.Pipe(q.Pipeline).Iter()
+	default:
+		query := c.Find(q.Filter)
+		if len(q.Sort) > 0 {
+			query = query.Sort(q.Sort...)
+		}
+		if q.Limit > 0 {
+			query = query.Limit(q.Limit)
+		}
+		iter = query.Iter()
+	}
+	for {
+		var doc bson.D
+		if !iter.Next(&doc) {
+			break
+		}
+		if q.Unwrap != "" {
+			if doc = unwrapDocument(doc, q.Unwrap); doc == nil {
+				continue
+			}
+		}
+		if q.skips(doc) {
+			continue
+		}
+		handle(doc)
+	}
+	return iter.Close()
+}
+
+func unwrapDocument(doc bson.D, name string) bson.D {
+	for _, e := range doc {
+		if e.Name == name {
+			if inner, ok := e.Value.(bson.D); ok {
+				return inner
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// ReadOnlyAppName tags read-only connections in server logs and currentOp so
+// auditors can tell them apart.
+const ReadOnlyAppName = "extract_mgo-read-only"
+
+var assertReadOnlyFlag = cli.BoolFlag{
+	Name:  "assert-read-only",
+	Usage: "Refuse every option that writes to the cluster and connect with read-only settings, for change-control compliance",
+}
+
+// writeCapableOption is an option that makes the tool write to the cluster,
+// named as users give it.
+type writeCapableOption struct {
+	name    string
+	enabled func(cmdInfo *commandInfo) bool
+}
+
+// writeCapableOptions lists every option that writes to the cluster. New
+// write paths must be registered here.
+var writeCapableOptions = []writeCapableOption{
+	{
+		name:    "apply-validators without -" + dryRunFlag.Name,
+		enabled: func(cmdInfo *commandInfo) bool { return cmdInfo.applyValidators },
+	},
+}
+
+// checkReadOnly fails when -assert-read-only is combined with an option
+// that writes to the cluster.
+func checkReadOnly(cmdInfo *commandInfo) error {
+	if !cmdInfo.readOnly {
+		return nil
+	}
+	var refused []string
+	for _, option := range writeCapableOptions {
+		if option.enabled(cmdInfo) {
+			refused = append(refused, option.name)
+		}
+	}
+	if len(refused) > 0 {
+		return fmt.Errorf("-%v refuses write-capable options: %v", assertReadOnlyFlag.Name, strings.Join(refused, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// ReportSchemaVersion is the version of the run report format. Bump the
+// minor version for additions and the major version for breaking changes.
+const ReportSchemaVersion = "1.2"
+
+var (
+	reportFlag = cli.StringFlag{
+		Name:  "report",
+		Usage: "Write a versioned JSON run report with schema, stats, warnings, findings and the baseline diff",
+	}
+	baselineFlag = cli.StringFlag{
+		Name:  "baseline",
+		Usage: "Previous JSON schema file to diff against in the run report, and to compare values with -value-drift",
+	}
+)
+
+// runReport is the single artifact describing a whole extraction run.
+type runReport struct {
+	SchemaVersion  string                      `json:"schemaVersion"`
+	GeneratedAt    time.Time                   `json:"generatedAt"`
+	Database       string                      `json:"database"`
+	SampleStrategy string                      `json:"sampleStrategy"`
+	Schema         map[string]docSchema        `json:"schema"`
+	Stats          map[string]*collectionStats `json:"stats"`
+	Warnings       []warning                   `json:"warnings"`
+	Findings       []finding                   `json:"findings"`
+	Scoreboard     []scoreEntry                `json:"scoreboard"`
+	HealthScore    float64                     `json:"healthScore"`
+	Diff           *schemaDiff                 `json:"diff,omitempty"`
+	FederationDiff *schemaDiff                 `json:"federationDiff,omitempty"`
+	Groups         []*ownerGroup               `json:"groups,omitempty"`
+	Resources      *resourceUsage              `json:"resources"`
+}
+
+// newRunReport returns the report of the run, diffed against -baseline.
+func newRunReport(cmdInfo *commandInfo, schema map[string]docSchema, stats map[string]*collectionStats, federationDiff *schemaDiff) (*runReport, error) {
+	report := &runReport{
+		SchemaVersion:  ReportSchemaVersion,
+		GeneratedAt:    time.Now(),
+		Database:       cmdInfo.dbName,
+		SampleStrategy: cmdInfo.strategyName,
+		Schema:         schema,
+		Stats:          stats,
+		Warnings:       []warning{},
+		Findings:       []finding{},
+		FederationDiff: federationDiff,
+		Resources:      currentResourceUsage(),
+	}
+	report.Scoreboard, report.HealthScore = scoreboard(stats)
+	findingsLock.Lock()
+	report.Warnings = append(report.Warnings, warnings...)
+	report.Findings = append(report.Findings, findings...)
+	findingsLock.Unlock()
+	if cmdInfo.baseline != "" {
+		baseline, err := readBaseline(cmdInfo.baseline)
+		if err != nil {
+			return nil, err
+		}
+		report.Diff = diffSchema(cmdInfo.baseline, baseline, schema)
+	}
+	return report, nil
+}
+
+func exportReport(cmdInfo *commandInfo, schema map[string]docSchema, stats map[string]*collectionStats, federationDiff *schemaDiff) error {
+	report, err := newRunReport(cmdInfo, schema, stats, federationDiff)
+	if err != nil {
+		return err
+	}
+	if cmdInfo.groupBy == "" {
+		return writeReport(cmdInfo.report, report)
+	}
+	groups := groupRun(cmdInfo.groupBy, schema, stats, report.Findings)
+	if !strings.Contains(cmdInfo.report, ".Owner") {
+		report.Groups = groups
+		return writeReport(cmdInfo.report, report)
+	}
+	reportPath, err := parseOutputPath(cmdInfo.report)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		path, err := reportPath.expandVars(outputVars{Database: cmdInfo.dbName, Owner: g.Name, Format: JSONFormat})
+		if err != nil {
+			return err
+		}
+		if err := writeReport(path, report.forGroup(g)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeReport(path string, report *runReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// forGroup returns the review packet of one owner group: its collections,
+// the fields it owns elsewhere, and the related findings, warnings and diff.
+func (report *runReport) forGroup(g *ownerGroup) *runReport {
+	packet := *report
+	packet.Schema = make(map[string]docSchema)
+	packet.Stats = make(map[string]*collectionStats)
+	for _, c := range g.Collections {
+		packet.Schema[c] = report.Schema[c]
+		packet.Stats[c] = report.Stats[c]
+	}
+	for collection, fields := range report.Schema {
+		if _, ok := packet.Schema[collection]; ok {
+			continue
+		}
+		for _, f := range fields {
+			if g.owns(collection, f.Name) {
+				packet.Schema[collection] = append(packet.Schema[collection], f)
+			}
+		}
+	}
+	packet.Findings = append([]finding{}, g.Findings...)
+	packet.Warnings = []warning{}
+	for _, w := range report.Warnings {
+		if g.owns(w.Collection, w.Field) {
+			packet.Warnings = append(packet.Warnings, w)
+		}
+	}
+	packet.Scoreboard, packet.HealthScore = scoreboard(packet.Stats)
+	packet.Diff = report.Diff.forGroup(g)
+	packet.FederationDiff = report.FederationDiff.forGroup(g)
+	packet.Groups = []*ownerGroup{g}
+	return &packet
+}
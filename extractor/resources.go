@@ -0,0 +1,104 @@
+package extractor
+
+import (
+	"net"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/globalsign/mgo"
+)
+
+// ResourceSampleInterval is how often the memory of the process is sampled
+// for its peak.
+const ResourceSampleInterval = 500 * time.Millisecond
+
+// resourceUsage is what a run cost, to size the machines of scheduled runs.
+type resourceUsage struct {
+	// PeakMemoryBytes is the most memory obtained from the system, sampled
+	// every ResourceSampleInterval.
+	PeakMemoryBytes uint64 `json:"peakMemoryBytes"`
+	// ServerBytesRead counts the bytes received from the servers, including
+	// those of the wire protocol.
+	ServerBytesRead int64 `json:"serverBytesRead"`
+	// CPUSeconds is the user and system CPU time of the process.
+	CPUSeconds float64 `json:"cpuSeconds"`
+}
+
+var (
+	serverBytesRead int64
+	peakMemoryBytes uint64
+)
+
+// countingConn counts the bytes read from a server connection.
+type countingConn struct {
+	net.Conn
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&serverBytesRead, int64(n))
+	return n, err
+}
+
+// countingDialer wraps the dialer of a connection string so that the
+// connections it opens count what they read. A nil dial dials plain TCP, as
+// mgo does.
+func countingDialer(dial func(*mgo.ServerAddr) (net.Conn, error), timeout time.Duration) func(*mgo.ServerAddr) (net.Conn, error) {
+	return func(addr *mgo.ServerAddr) (net.Conn, error) {
+		var conn net.Conn
+		var err error
+		if dial != nil {
+			conn, err = dial(addr)
+		} else {
+			conn, err = net.DialTimeout("tcp", addr.TCPAddr().String(), timeout)
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				tcp.SetKeepAlive(true)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return countingConn{conn}, nil
+	}
+}
+
+// sampleMemory raises the peak memory to what the process holds now.
+func sampleMemory() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	for {
+		peak := atomic.LoadUint64(&peakMemoryBytes)
+		if stats.Sys <= peak || atomic.CompareAndSwapUint64(&peakMemoryBytes, peak, stats.Sys) {
+			return
+		}
+	}
+}
+
+// monitorResources samples the memory of the process until stop is called.
+func monitorResources() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ResourceSampleInterval)
+		defer ticker.Stop()
+		for {
+			sampleMemory()
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// currentResourceUsage returns what the run has used so far.
+func currentResourceUsage() *resourceUsage {
+	sampleMemory()
+	return &resourceUsage{
+		PeakMemoryBytes: atomic.LoadUint64(&peakMemoryBytes),
+		ServerBytesRead: atomic.LoadInt64(&serverBytesRead),
+		CPUSeconds:      cpuTime().Seconds(),
+	}
+}
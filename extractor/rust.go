@@ -0,0 +1,243 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RustFormat writes Rust structs of the collections, deriving serde's
+// Serialize and Deserialize for the bson crate.
+const RustFormat = "rust"
+
+// rustTypes are the Rust types of the base types.
+var rustTypes = map[string]string{
+	"INTEGER":  "i64",
+	"DECIMAL":  "f64",
+	"STRING":   "String",
+	"BOOL":     "bool",
+	"TIME":     "DateTime<Utc>",
+	"OBJECTID": "ObjectId",
+	"BINARY":   "Binary",
+}
+
+// rustUses are the paths of the names the structs may use.
+var rustUses = map[string]string{
+	"DateTime": "chrono::{DateTime, Utc}",
+	"ObjectId": "bson::oid::ObjectId",
+	"Binary":   "bson::Binary",
+	"Bson":     "bson::Bson",
+	"Document": "bson::Document",
+	"HashMap":  "std::collections::HashMap",
+}
+
+// rustReserved are the keywords of Rust, which cannot name a field.
+var rustReserved = map[string]bool{
+	"as": true, "async": true, "await": true, "break": true, "const": true, "continue": true, "crate": true,
+	"dyn": true, "else": true, "enum": true, "extern": true, "false": true, "fn": true, "for": true, "if": true,
+	"impl": true, "in": true, "let": true, "loop": true, "match": true, "mod": true, "move": true, "mut": true,
+	"pub": true, "ref": true, "return": true, "self": true, "static": true, "struct": true, "super": true,
+	"trait": true, "true": true, "type": true, "unsafe": true, "use": true, "where": true, "while": true,
+	"abstract": true, "become": true, "box": true, "do": true, "final": true, "macro": true, "override": true,
+	"priv": true, "try": true, "typeof": true, "unsized": true, "virtual": true, "yield": true,
+}
+
+// rustOptionalDateTime serializes the optional dates of the module as BSON
+// dates, which the bson crate only provides a helper for when required.
+const rustOptionalDateTime = `
+/// Serializes optional chrono dates as BSON dates.
+mod optional_bson_datetime {
+    use chrono::{DateTime, Utc};
+    use serde::{Deserialize, Deserializer, Serialize, Serializer};
+
+    pub fn serialize<S: Serializer>(value: &Option<DateTime<Utc>>, serializer: S) -> Result<S::Ok, S::Error> {
+        value.map(bson::DateTime::from_chrono).serialize(serializer)
+    }
+
+    pub fn deserialize<'de, D: Deserializer<'de>>(deserializer: D) -> Result<Option<DateTime<Utc>>, D::Error> {
+        Ok(Option::<bson::DateTime>::deserialize(deserializer)?.map(|d| d.to_chrono()))
+    }
+}
+`
+
+// rustName turns a field name into a snake_case field name, e.g.
+// "firstName" and "first name" into "first_name", "_id" into "id" and
+// "type" into "type_".
+func rustName(name string) string {
+	if name == "_id" {
+		return "id"
+	}
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			b.WriteRune('_')
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	ident := strings.Trim(b.String(), "_")
+	for strings.Contains(ident, "__") {
+		ident = strings.Replace(ident, "__", "_", -1)
+	}
+	switch {
+	case ident == "" || unicode.IsDigit([]rune(ident)[0]):
+		return "f_" + ident
+	case rustReserved[ident]:
+		return ident + "_"
+	}
+	return ident
+}
+
+// rustWriter writes the structs of the collections and, after each, those
+// of its nested documents.
+type rustWriter struct {
+	source  bytes.Buffer
+	uses    map[string]bool
+	types   map[string]bool
+	pending []pendingStruct
+	// optionalDateTime tells whether the module needs the helper of
+	// optional dates.
+	optionalDateTime bool
+}
+
+// use returns a name, adding the use declaration it needs.
+func (w *rustWriter) use(name string) string {
+	if path := rustUses[name]; path != "" {
+		w.uses[path] = true
+	}
+	return name
+}
+
+// rustType returns the Rust type of the node, queuing the structs it needs
+// under names derived from name. Mixed types are Bson values, except for
+// integers mixed with decimals. Dates within arrays and maps are
+// bson::DateTime, as serde cannot map chrono dates to BSON there.
+func (w *rustWriter) rustType(name string, n *modelNode, nested bool) string {
+	if n.Numeric {
+		return "f64"
+	}
+	types := n.Types
+	if len(types) != 1 {
+		return w.use("Bson")
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		if n.Properties == nil {
+			if n.Rest == nil {
+				return w.use("Document")
+			}
+			return w.use("HashMap") + "<String, " + w.rustType(name+"Value", n.Rest, true) + ">"
+		}
+		structName := uniqueName(w.types, name)
+		w.pending = append(w.pending, pendingStruct{name: structName, node: n})
+		return structName
+	case "ARRAY":
+		if n.Items == nil {
+			return "Vec<" + w.use("Bson") + ">"
+		}
+		return "Vec<" + w.rustType(name+"Item", n.Items, true) + ">"
+	case "TIME":
+		if nested {
+			return "bson::DateTime"
+		}
+	}
+	t, ok := rustTypes[types[0]]
+	if !ok {
+		return w.use("Bson")
+	}
+	w.use(strings.Split(t, "<")[0])
+	return t
+}
+
+// writeStruct writes the struct of a document. Fields missing from some
+// documents holding it are Options, skipped when None; summarized -dynamic
+// keys are flattened into a map.
+func (w *rustWriter) writeStruct(s pendingStruct) {
+	fields := make(map[string]bool)
+	fmt.Fprintf(&w.source, "#[derive(Debug, Clone, Serialize, Deserialize)]\npub struct %v {\n", s.name)
+	for _, child := range s.node.Properties {
+		name := uniqueName(fields, rustName(child.Name))
+		typ := w.rustType(s.name+goName(child.Name), child, false)
+		var attributes []string
+		if name != child.Name {
+			attributes = append(attributes, "rename = "+strconv.Quote(child.Name))
+		}
+		isTime := typ == "DateTime<Utc>"
+		if !child.Required {
+			typ = "Option<" + typ + ">"
+			attributes = append(attributes, "default", `skip_serializing_if = "Option::is_none"`)
+		}
+		switch {
+		case isTime && child.Required:
+			attributes = append(attributes, `with = "bson::serde_helpers::chrono_datetime_as_bson_datetime"`)
+		case isTime:
+			w.optionalDateTime = true
+			attributes = append(attributes, `with = "optional_bson_datetime"`)
+		}
+		if len(attributes) > 0 {
+			fmt.Fprintf(&w.source, "    #[serde(%v)]\n", strings.Join(attributes, ", "))
+		}
+		fmt.Fprintf(&w.source, "    pub %v: %v,\n", name, typ)
+	}
+	if s.node.Rest != nil {
+		name := uniqueName(fields, "extra")
+		fmt.Fprintf(&w.source, "    #[serde(flatten)]\n    pub %v: %v<String, %v>,\n", name, w.use("HashMap"),
+			w.rustType(s.name+"Extra", s.node.Rest, true))
+	}
+	w.source.WriteString("}\n\n")
+}
+
+// rustStructs returns a Rust module declaring a struct per collection,
+// named after the collection, and the structs of their nested documents.
+func rustStructs(m *schemaModel) []byte {
+	w := &rustWriter{uses: make(map[string]bool), types: make(map[string]bool)}
+	// Structs cannot take the names the module uses.
+	for name := range rustUses {
+		w.types[name] = true
+	}
+	for _, name := range []string{"Utc", "Serialize", "Deserialize"} {
+		w.types[name] = true
+	}
+	for _, c := range m.Collections {
+		name := uniqueName(w.types, goName(c.Name))
+		fmt.Fprintf(&w.source, "/// A document of the %v collection.\n", c.Name)
+		w.pending = append(w.pending, pendingStruct{name: name, node: c.Document})
+		for len(w.pending) > 0 {
+			s := w.pending[0]
+			w.pending = w.pending[1:]
+			w.writeStruct(s)
+		}
+	}
+	var source bytes.Buffer
+	source.WriteString("// Generated by extract_mgo from sampled documents.\n\n")
+	uses := []string{"serde::{Deserialize, Serialize}"}
+	for path := range w.uses {
+		uses = append(uses, path)
+	}
+	sort.Strings(uses)
+	for _, path := range uses {
+		fmt.Fprintf(&source, "use %v;\n", path)
+	}
+	if w.optionalDateTime {
+		source.WriteString(rustOptionalDateTime)
+	}
+	source.WriteString("\n")
+	source.Write(bytes.TrimSuffix(w.source.Bytes(), []byte("\n")))
+	return source.Bytes()
+}
+
+func exportRust(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, rustStructs(m), 0644)
+}
@@ -0,0 +1,209 @@
+package extractor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// sampledQuery is the read a collection was sampled with, kept in its stats
+// so that the sample can be re-run by hand to check or debug the schema.
+// Filters and pipelines are extended JSON.
+type sampledQuery struct {
+	Database   string          `json:"database"`
+	Collection string          `json:"collection"`
+	Filter     json.RawMessage `json:"filter,omitempty"`
+	Sort       []string        `json:"sort,omitempty"` // mgo sort keys such as "-_id"
+	Limit      int             `json:"limit,omitempty"`
+	Pipeline   json.RawMessage `json:"pipeline,omitempty"`
+	// ReadConcern is the level of -read-concern.
+	ReadConcern string `json:"readConcern,omitempty"`
+	// Unwrap names the field of each result holding the sampled document,
+	// and SkippedIDs counts the -exclude-ids dropped from the results rather
+	// than filtered out by the server.
+	Unwrap     string `json:"unwrap,omitempty"`
+	SkippedIDs int    `json:"skippedIds,omitempty"`
+	// Partitions are the filters of the _id ranges of -scan-partitions, read
+	// in parallel in place of Filter.
+	Partitions []json.RawMessage `json:"partitions,omitempty"`
+	// Shell holds the mongosh statements of the read, one per _id range.
+	Shell []string `json:"shell"`
+}
+
+// command returns the find or aggregate command of a query.
+func (q sampleQuery) command(collection string) bson.D {
+	if q.Pipeline != nil {
+		return bson.D{{Name: "aggregate", Value: collection}, {Name: "pipeline", Value: q.Pipeline}, {Name: "cursor", Value: bson.M{}}}
+	}
+	filter := q.Filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+	cmd := bson.D{{Name: "find", Value: collection}, {Name: "filter", Value: filter}}
+	if len(q.Sort) > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "sort", Value: sortDocument(q.Sort)})
+	}
+	if q.Limit > 0 {
+		cmd = append(cmd, bson.DocElem{Name: "limit", Value: q.Limit})
+	}
+	return cmd
+}
+
+// describe returns the query as run by the reader against c, with the
+// filters of the _id ranges it was split into, if any.
+func (r *sampleReader) describe(c *mgo.Collection, q sampleQuery, partitions []bson.M) *sampledQuery {
+	d := &sampledQuery{
+		Database:    c.Database.Name,
+		Collection:  c.Name,
+		Sort:        q.Sort,
+		Limit:       q.Limit,
+		ReadConcern: r.readConcern,
+		Unwrap:      q.Unwrap,
+	}
+	if q.Database != "" {
+		d.Database, d.Collection = q.Database, q.Collection
+		d.SkippedIDs = len(q.skip)
+	}
+	if q.Filter != nil {
+		d.Filter, _ = bson.MarshalJSON(q.Filter)
+	}
+	if q.Pipeline != nil {
+		d.Pipeline, _ = bson.MarshalJSON(q.Pipeline)
+	}
+	reads := []sampleQuery{q}
+	if len(partitions) > 0 {
+		reads = nil
+		for _, filter := range partitions {
+			data, _ := bson.MarshalJSON(filter)
+			d.Partitions = append(d.Partitions, data)
+			pq := q
+			pq.Filter = filter
+			reads = append(reads, pq)
+		}
+	}
+	for _, read := range reads {
+		d.Shell = append(d.Shell, r.shellStatement(d.Database, d.Collection, read))
+	}
+	return d
+}
+
+// shellStatement returns the mongosh statement of a read. Snapshot reads
+// run the command the reader runs, as the shell helpers cannot read at a
+// cluster time.
+func (r *sampleReader) shellStatement(database, collection string, q sampleQuery) string {
+	db := fmt.Sprintf("db.getSiblingDB(%v)", strconv.Quote(database))
+	if r.readConcern == "snapshot" {
+		cmd := append(q.command(collection), bson.DocElem{
+			Name: "readConcern", Value: bson.M{"level": "snapshot", "atClusterTime": r.clusterTime},
+		})
+		return fmt.Sprintf("%v.runCommand(%v)", db, shellValue(cmd))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v.getCollection(%v)", db, strconv.Quote(collection))
+	if q.Pipeline != nil {
+		fmt.Fprintf(&b, ".aggregate(%v", shellValue(q.Pipeline))
+		if r.readConcern != "" {
+			fmt.Fprintf(&b, ", {readConcern: {level: %v}}", strconv.Quote(r.readConcern))
+		}
+		b.WriteString(")")
+		return b.String()
+	}
+	filter := q.Filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+	fmt.Fprintf(&b, ".find(%v)", shellValue(filter))
+	if len(q.Sort) > 0 {
+		fmt.Fprintf(&b, ".sort(%v)", shellValue(sortDocument(q.Sort)))
+	}
+	if q.Limit > 0 {
+		fmt.Fprintf(&b, ".limit(%v)", q.Limit)
+	}
+	if r.readConcern != "" {
+		fmt.Fprintf(&b, ".readConcern(%v)", strconv.Quote(r.readConcern))
+	}
+	return b.String()
+}
+
+// shellValue writes a value as a mongosh literal, with the shell
+// constructors of the BSON types JSON lacks.
+func shellValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return shellInt(int64(v))
+	case int32:
+		return strconv.Itoa(int(v))
+	case int64:
+		return shellInt(v)
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Sprintf("Number(%q)", strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bson.ObjectId:
+		return fmt.Sprintf("ObjectId(%q)", v.Hex())
+	case time.Time:
+		return fmt.Sprintf("ISODate(%q)", v.UTC().Format("2006-01-02T15:04:05.000Z"))
+	case bson.MongoTimestamp:
+		return fmt.Sprintf("Timestamp({t: %d, i: %d})", uint64(v)>>32, uint32(v))
+	case bson.Binary:
+		return fmt.Sprintf("BinData(%d, %q)", v.Kind, base64.StdEncoding.EncodeToString(v.Data))
+	case []byte:
+		return fmt.Sprintf("BinData(0, %q)", base64.StdEncoding.EncodeToString(v))
+	case bson.D:
+		fields := make([]string, len(v))
+		for i, e := range v {
+			fields[i] = strconv.Quote(e.Name) + ": " + shellValue(e.Value)
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	case bson.M:
+		return shellValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fields := make([]string, len(names))
+		for i, name := range names {
+			fields[i] = strconv.Quote(name) + ": " + shellValue(v[name])
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		elements := make([]string, rv.Len())
+		for i := range elements {
+			elements[i] = shellValue(rv.Index(i).Interface())
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	}
+	data, err := bson.MarshalJSON(v)
+	if err != nil {
+		return strconv.Quote(fmt.Sprint(v))
+	}
+	return string(data)
+}
+
+// shellInt keeps integers beyond 32 bits 64-bit, as the shell reads plain
+// numbers as doubles.
+func shellInt(n int64) string {
+	if n >= math.MinInt32 && n <= math.MaxInt32 {
+		return strconv.FormatInt(n, 10)
+	}
+	return fmt.Sprintf("NumberLong(%q)", strconv.FormatInt(n, 10))
+}
@@ -0,0 +1,161 @@
+package extractor
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// SamplingStrategy selects the documents a collection schema is inferred
+// from by describing the query to run; sampleReader executes it.
+type SamplingStrategy interface {
+	Query(c *mgo.Collection, limit int) sampleQuery
+}
+
+type samplingStrategyInfo struct {
+	name        string
+	description string
+	create      func(cmdInfo *commandInfo) SamplingStrategy
+}
+
+// samplingStrategies lists the strategies selectable with -sample-strategy.
+// The first one is the default.
+var samplingStrategies = []samplingStrategyInfo{
+	{
+		name:        "newest",
+		description: "newest documents by _id (reverse natural order when _id is not an ObjectId, number or date); cheap via the _id index, but misses fields only old documents have",
+		create:      func(*commandInfo) SamplingStrategy { return newestStrategy{} },
+	},
+	{
+		name:        "random",
+		description: "random documents via $sample (MongoDB 3.2+); representative, but may scan the collection",
+		create:      func(*commandInfo) SamplingStrategy { return randomStrategy{} },
+	},
+	{
+		name:        "fullscan",
+		description: "every document, ignoring the sample size; complete, but reads the whole collection",
+		create:      func(*commandInfo) SamplingStrategy { return fullScanStrategy{} },
+	},
+	{
+		name:        "timewindow",
+		description: "newest documents written within -time-window, by -time-field (ObjectId _id by default); needs an index on that field",
+		create: func(cmdInfo *commandInfo) SamplingStrategy {
+			return timeWindowStrategy{field: cmdInfo.timeField, window: cmdInfo.timeWindow}
+		},
+	},
+	{
+		name:        "oplogtail",
+		description: "documents of the latest inserts in the oplog; shows what is written now, needs a replica set and read access to local",
+		create:      func(*commandInfo) SamplingStrategy { return oplogTailStrategy{} },
+	},
+}
+
+func samplingStrategyHelp() string {
+	var lines []string
+	for _, s := range samplingStrategies {
+		lines = append(lines, fmt.Sprintf("\"%v\": %v", s.name, s.description))
+	}
+	return strings.Join(lines, "; ")
+}
+
+var (
+	sampleStrategyFlag = cli.StringFlag{
+		Name:  "sample-strategy",
+		Usage: "How documents are sampled. " + samplingStrategyHelp(),
+		Value: samplingStrategies[0].name,
+	}
+	timeFieldFlag = cli.StringFlag{
+		Name:  "time-field",
+		Usage: "Field holding the write time for the \"timewindow\" strategy",
+		Value: "_id",
+	}
+	timeWindowFlag = cli.DurationFlag{
+		Name:  "time-window",
+		Usage: "Look-back period for the \"timewindow\" strategy",
+		Value: 24 * time.Hour,
+	}
+)
+
+func newSamplingStrategy(name string, cmdInfo *commandInfo) (SamplingStrategy, error) {
+	for _, s := range samplingStrategies {
+		if s.name == name {
+			return s.create(cmdInfo), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown sample strategy %q", name)
+}
+
+type newestStrategy struct{}
+
+// Query sorts by -_id when ids grow with insertion time. Otherwise (string,
+// UUID or compound ids) the -_id order says nothing about age, so it falls
+// back to reverse natural order.
+func (newestStrategy) Query(c *mgo.Collection, limit int) sampleQuery {
+	var doc struct {
+		ID interface{} `bson:"_id"`
+	}
+	err := c.Find(nil).Select(bson.M{"_id": 1}).Sort("$natural").One(&doc)
+	if err != nil || idSortsByAge(doc.ID) {
+		return sampleQuery{Sort: []string{"-_id"}, Limit: limit}
+	}
+	log.Printf("Collection %v has %T _id, sampling in reverse natural order instead of by -_id\n", c.Name, doc.ID)
+	return sampleQuery{Sort: []string{"-$natural"}, Limit: limit}
+}
+
+// idSortsByAge reports whether sorting by an _id of this kind puts newer
+// documents last.
+func idSortsByAge(id interface{}) bool {
+	switch id.(type) {
+	case bson.ObjectId, int, int64, float64, time.Time:
+		return true
+	}
+	return false
+}
+
+type randomStrategy struct{}
+
+func (randomStrategy) Query(c *mgo.Collection, limit int) sampleQuery {
+	return sampleQuery{Pipeline: []bson.M{{"$sample": bson.M{"size": limit}}}}
+}
+
+type fullScanStrategy struct{}
+
+func (fullScanStrategy) Query(c *mgo.Collection, limit int) sampleQuery {
+	return sampleQuery{}
+}
+
+type timeWindowStrategy struct {
+	field  string
+	window time.Duration
+}
+
+func (s timeWindowStrategy) Query(c *mgo.Collection, limit int) sampleQuery {
+	since := time.Now().Add(-s.window)
+	var lower interface{} = since
+	if s.field == "_id" {
+		lower = bson.NewObjectIdWithTime(since)
+	}
+	return sampleQuery{
+		Filter: bson.M{s.field: bson.M{"$gte": lower}},
+		Sort:   []string{"-" + s.field},
+		Limit:  limit,
+	}
+}
+
+type oplogTailStrategy struct{}
+
+func (oplogTailStrategy) Query(c *mgo.Collection, limit int) sampleQuery {
+	return sampleQuery{
+		Database:   "local",
+		Collection: "oplog.rs",
+		Filter:     bson.M{"ns": c.FullName, "op": "i"},
+		Sort:       []string{"-$natural"},
+		Limit:      limit,
+		Unwrap:     "o",
+	}
+}
@@ -0,0 +1,86 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// escapedFields remembers the fields warned about for their names or values, so
+// that each is reported once per collection, whatever the partitions it
+// was seen in.
+var escapedFields = struct {
+	sync.Mutex
+	fields map[string]bool
+}{fields: make(map[string]bool)}
+
+// escapeText writes the bytes of s that are not valid UTF-8 as \xNN and,
+// with controls, the control characters as \uNNNN, e.g. "a\tb" as
+// `a\u0009b`. Outputs then carry the text unchanged instead of replacing
+// the bytes with U+FFFD, or breaking lines and cells on the controls.
+func escapeText(s string, controls bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case controls && unicode.IsControl(r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// needsEscape tells whether escapeText would change s.
+func needsEscape(s string, controls bool) bool {
+	if !utf8.ValidString(s) {
+		return true
+	}
+	return controls && strings.IndexFunc(s, unicode.IsControl) != -1
+}
+
+// warnEscaped reports what was escaped, the name or the values, of a field
+// once per collection.
+func warnEscaped(collection, field, what, format string, args ...interface{}) {
+	key := collection + "\x00" + field + "\x00" + what
+	escapedFields.Lock()
+	seen := escapedFields.fields[key]
+	escapedFields.fields[key] = true
+	escapedFields.Unlock()
+	if !seen {
+		addWarning(collection, field, format, args...)
+	}
+}
+
+// fieldKey returns the name of a key of a document, escaped when it is not
+// valid UTF-8 or holds control characters.
+func fieldKey(collection, prefix, key string) string {
+	if !needsEscape(key, true) {
+		return key
+	}
+	escapedKey := escapeText(key, true)
+	name := escapedKey
+	if prefix != "" {
+		name = prefix + "." + escapedKey
+	}
+	warnEscaped(collection, name, "name", "the field name %v holds invalid UTF-8 or control characters, written escaped",
+		strconv.QuoteToASCII(key))
+	return escapedKey
+}
+
+// stringValue returns a sampled string, escaped when it is not valid UTF-8.
+// Control characters are data and kept.
+func stringValue(collection, field, s string) string {
+	if !needsEscape(s, false) {
+		return s
+	}
+	warnEscaped(collection, field, "value", "string values hold invalid UTF-8, written escaped as \\xNN")
+	return escapeText(s, false)
+}
@@ -0,0 +1,291 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	listenFlag = cli.StringFlag{
+		Name:  "listen",
+		Usage: "Address to serve on",
+		Value: ":8080",
+	}
+	reportsFlag = cli.StringSliceFlag{
+		Name:  "reports",
+		Usage: "Run report written by -report, or a glob pattern of them, e.g. \"reports/*.json\". Repeatable",
+	}
+
+	serveCommand = cli.Command{
+		Name: "serve",
+		Usage: "Serve a web UI for browsing run reports at /, and schema summaries and SVG badges for dashboards: " +
+			"/summary, /summary/<database> and /badge/<database>.svg. Reports are re-read when they change. " +
+			"With -approvals, drift is pending until approved: /api/pending/<database>, POST /api/approve/<database> " +
+			"by the bearer of a token of -approvers and the audit trail at /api/approvals/<database>. With -jobs, the databases of the jobs are extracted on " +
+			"demand by POST /api/extract/<job>/<database>[/<collection>] with the same tokens, -parallel at a time, and the queued, " +
+			"running and finished extractions listed at /api/extractions[/<id>]",
+		Flags:  []cli.Flag{listenFlag, reportsFlag, approvalsFlag, approversFlag, jobsFlag, parallelFlag, queueSizeFlag},
+		Action: serve,
+	}
+)
+
+// schemaSummary is the dashboard view of the latest run report of a database.
+type schemaSummary struct {
+	Database    string    `json:"database"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Collections int       `json:"collections"`
+	Fields      int       `json:"fields"`
+	HealthScore float64   `json:"healthScore"`
+	Findings    int       `json:"findings"`
+	// Drift tells whether the schema differs from the baseline; it is absent
+	// when the report has no baseline.
+	Drift *bool `json:"drift,omitempty"`
+	// Pending tells whether the schema differs from the published baseline
+	// of serve -approvals; it is absent without -approvals.
+	Pending *bool `json:"pending,omitempty"`
+}
+
+func summarizeReport(report *runReport) *schemaSummary {
+	summary := &schemaSummary{
+		Database:    report.Database,
+		GeneratedAt: report.GeneratedAt,
+		Collections: len(report.Schema),
+		HealthScore: report.HealthScore,
+		Findings:    len(report.Findings),
+	}
+	for _, fields := range report.Schema {
+		summary.Fields += len(fields)
+	}
+	if d := report.Diff; d != nil {
+		drift := len(d.AddedCollections) > 0 || len(d.RemovedCollections) > 0 || len(d.Collections) > 0
+		summary.Drift = &drift
+	}
+	return summary
+}
+
+// reportFile caches the summary and the schema of a report file until it
+// changes.
+type reportFile struct {
+	modTime time.Time
+	summary *schemaSummary
+	schema  map[string]docSchema
+}
+
+type summaryServer struct {
+	patterns []string
+	lock     sync.Mutex
+	files    map[string]*reportFile
+	// approvals is the directory of the published baselines, if any, and
+	// approvers the token digests of those allowed to approve.
+	approvals   string
+	approvers   map[string]string
+	approveLock sync.Mutex
+}
+
+// refresh returns the report files matching the patterns by path,
+// re-reading those that changed.
+func (s *summaryServer) refresh() (map[string]*reportFile, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	result := make(map[string]*reportFile)
+	for _, pattern := range s.patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			file := s.files[path]
+			if file == nil || !file.modTime.Equal(info.ModTime()) {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
+				report := new(runReport)
+				if err := json.Unmarshal(data, report); err != nil {
+					log.Printf("Skip %v: %v\n", path, err)
+					continue
+				}
+				file = &reportFile{modTime: info.ModTime(), summary: summarizeReport(report), schema: report.Schema}
+				s.files[path] = file
+			}
+			result[path] = file
+		}
+	}
+	return result, nil
+}
+
+// summaries returns the summary of the newest report of each database,
+// telling whether its changes are pending with -approvals.
+func (s *summaryServer) summaries() (map[string]*schemaSummary, error) {
+	files, err := s.refresh()
+	if err != nil {
+		return nil, err
+	}
+	newest := make(map[string]*reportFile)
+	for _, file := range files {
+		summary := file.summary
+		if prev, ok := newest[summary.Database]; !ok || summary.GeneratedAt.After(prev.summary.GeneratedAt) {
+			newest[summary.Database] = file
+		}
+	}
+	result := make(map[string]*schemaSummary)
+	for database, file := range newest {
+		result[database] = file.summary
+		if s.approvals == "" {
+			continue
+		}
+		diff, err := pendingChanges(s.approvals, database, file.schema)
+		if err != nil {
+			return nil, err
+		}
+		summary := *file.summary
+		pending := diff != nil
+		summary.Pending = &pending
+		result[database] = &summary
+	}
+	return result, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *summaryServer) handleSummary(w http.ResponseWriter, r *http.Request) {
+	summaries, err := s.summaries()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	database := strings.Trim(strings.TrimPrefix(r.URL.Path, "/summary"), "/")
+	if database != "" {
+		summary, ok := summaries[database]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, summary)
+		return
+	}
+	list := make([]*schemaSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		list = append(list, summary)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Database < list[j].Database })
+	writeJSON(w, list)
+}
+
+// Badge colors, as used by shields.io.
+const (
+	badgeGreen  = "#4c1"
+	badgeOrange = "#fe7d37"
+	badgeBlue   = "#007ec6"
+	badgeGrey   = "#9f9f9f"
+)
+
+// badgeSVG renders a flat two-part badge; text widths are estimated.
+func badgeSVG(label, message, color string) string {
+	labelWidth, messageWidth := 6*len(label)+10, 6*len(message)+10
+	width := labelWidth + messageWidth
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+		`<rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%d" y="14">%s</text><text x="%d" y="14">%s</text></g></svg>`,
+		width, html.EscapeString(label), html.EscapeString(message),
+		labelWidth, labelWidth, messageWidth, color,
+		labelWidth/2, html.EscapeString(label), labelWidth+messageWidth/2, html.EscapeString(message))
+}
+
+func (s *summaryServer) handleBadge(w http.ResponseWriter, r *http.Request) {
+	database := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/badge/"), ".svg")
+	summaries, err := s.summaries()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	label, message, color := "schema", "unknown", badgeGrey
+	if summary, ok := summaries[database]; ok {
+		message, color = fmt.Sprintf("%d fields", summary.Fields), badgeBlue
+		if summary.Drift != nil {
+			color = badgeGreen
+			if *summary.Drift {
+				message, color = "drift", badgeOrange
+			}
+		}
+		if summary.Pending != nil && *summary.Pending {
+			message, color = "pending approval", badgeOrange
+		}
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, badgeSVG(label, message, color))
+}
+
+func serve(ctx *cli.Context) error {
+	patterns := ctx.StringSlice(reportsFlag.Name)
+	if len(patterns) == 0 {
+		return cli.NewExitError(fmt.Sprintf("%s is mandatory!", reportsFlag.Name), 1)
+	}
+	s := &summaryServer{patterns: patterns, files: make(map[string]*reportFile), approvals: ctx.String(approvalsFlag.Name)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/summary", s.handleSummary)
+	mux.HandleFunc("/summary/", s.handleSummary)
+	mux.HandleFunc("/badge/", s.handleBadge)
+	mux.HandleFunc("/api/history/", s.handleHistory)
+	mux.HandleFunc("/api/report/", s.handleReport)
+	mux.HandleFunc("/api/diff/", s.handleDiff)
+	if s.approvals != "" || ctx.String(jobsFlag.Name) != "" {
+		path := ctx.String(approversFlag.Name)
+		if path == "" {
+			return cli.NewExitError(fmt.Sprintf("%s is mandatory with %s or %s!", approversFlag.Name, approvalsFlag.Name, jobsFlag.Name), 1)
+		}
+		approvers, err := loadApprovers(path)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Failed to load approvers: %v", err), 1)
+		}
+		s.approvers = approvers
+	}
+	if s.approvals != "" {
+		mux.HandleFunc("/api/pending/", s.handlePending)
+		mux.HandleFunc("/api/approve/", s.handleApprove)
+		mux.HandleFunc("/api/approvals/", s.handleApprovals)
+	}
+	if path := ctx.String(jobsFlag.Name); path != "" {
+		jobs, err := loadJobs(path)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Failed to load jobs: %v", err), 1)
+		}
+		parallel := jobs.Parallel
+		if ctx.IsSet(parallelFlag.Name) {
+			parallel = ctx.Int(parallelFlag.Name)
+		}
+		queue, err := newExtractionQueue(jobs, parallel, ctx.Int(queueSizeFlag.Name))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		queue.requesterOf = s.approverOf
+		mux.HandleFunc("/api/extract/", queue.handleExtract)
+		mux.HandleFunc("/api/extractions", queue.handleExtractions)
+		mux.HandleFunc("/api/extractions/", queue.handleExtractions)
+	}
+	mux.HandleFunc("/", handleUI)
+	log.Printf("Serving schema summaries on %v\n", ctx.String(listenFlag.Name))
+	return http.ListenAndServe(ctx.String(listenFlag.Name), mux)
+}
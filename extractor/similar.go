@@ -0,0 +1,235 @@
+package extractor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// MinShapeSimilarity is the share of fields two collections must have in
+	// common, with a common type, to count as copies of one shape.
+	MinShapeSimilarity = 0.9
+	// MinShapeFields is the number of fields besides _id a collection needs
+	// for its shape to be compared; smaller ones look alike by chance.
+	MinShapeFields = 3
+)
+
+var sharedModelsFlag = cli.BoolFlag{
+	Name: "shared-models",
+	Usage: "Write collections with near-identical schemas, e.g. orders_2023 and orders_2024, as one collection " +
+		"named after their common prefix, with the fields of all of them",
+}
+
+// shapeSimilarity returns the share of the fields of a and b, but _id, that
+// both have with a common base type.
+func shapeSimilarity(a, b map[string][]string) float64 {
+	shared, union := 0, len(b)
+	for name, types := range a {
+		other, ok := b[name]
+		if !ok {
+			union++
+			continue
+		}
+		for _, t := range types {
+			if containsString(other, t) {
+				shared++
+				break
+			}
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// shapeOf returns the base types of the fields of a collection, but _id.
+func shapeOf(colSchema docSchema) map[string][]string {
+	shape := make(map[string][]string, len(colSchema))
+	for _, f := range colSchema {
+		if f.Name == "_id" || f.summarizesKeys() {
+			continue
+		}
+		var types []string
+		for _, t := range f.fieldTypes() {
+			types = append(types, baseType(t))
+		}
+		shape[f.Name] = types
+	}
+	return shape
+}
+
+// shapeGroup is a set of collections with near-identical schemas.
+type shapeGroup struct {
+	collections []string // sorted
+	// similarity is the lowest similarity of two collections of the group.
+	similarity float64
+}
+
+// similarCollections groups the collections whose schemas are at least
+// MinShapeSimilarity alike, directly or through other collections of the
+// group.
+func similarCollections(schema map[string]docSchema) []shapeGroup {
+	var names []string
+	shapes := make(map[string]map[string][]string)
+	for name, colSchema := range schema {
+		if shape := shapeOf(colSchema); len(shape) >= MinShapeFields {
+			names = append(names, name)
+			shapes[name] = shape
+		}
+	}
+	sort.Strings(names)
+	group := make(map[string]int)
+	for i, name := range names {
+		group[name] = i
+	}
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			if group[a] == group[b] || shapeSimilarity(shapes[a], shapes[b]) < MinShapeSimilarity {
+				continue
+			}
+			from, to := group[b], group[a]
+			for name, g := range group {
+				if g == from {
+					group[name] = to
+				}
+			}
+		}
+	}
+	members := make(map[int][]string)
+	for _, name := range names {
+		members[group[name]] = append(members[group[name]], name)
+	}
+	var groups []shapeGroup
+	for _, name := range names {
+		collections := members[group[name]]
+		if len(collections) < 2 || collections[0] != name {
+			continue
+		}
+		g := shapeGroup{collections: collections, similarity: 1}
+		for i, a := range collections {
+			for _, b := range collections[i+1:] {
+				g.similarity = math.Min(g.similarity, shapeSimilarity(shapes[a], shapes[b]))
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// reportSimilarCollections reports the groups of collections with
+// near-identical schemas, which may be split by time or copies that could
+// be consolidated.
+func reportSimilarCollections(schema map[string]docSchema) {
+	for _, g := range similarCollections(schema) {
+		addFinding(finding{
+			Collection: g.collections[0],
+			Kind:       "similar-collections",
+			Message: fmt.Sprintf("%v have near-identical schemas (%.0f%% of fields shared); consider consolidating them "+
+				"into one collection", strings.Join(g.collections, ", "), 100*g.similarity),
+		})
+	}
+}
+
+// sharedName names the shared model of a group after the common prefix of
+// its collections, e.g. "orders" for orders_2023 and orders_backup, or after
+// its first collection when they have none or it names another collection.
+func sharedName(collections []string, schema map[string]docSchema) string {
+	prefix := collections[0]
+	for _, name := range collections[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	prefix = strings.TrimRight(prefix, "_-.0123456789")
+	if len(prefix) < 3 {
+		return collections[0]
+	}
+	if _, taken := schema[prefix]; taken && !containsString(collections, prefix) {
+		return collections[0]
+	}
+	return prefix
+}
+
+// mergeShape adds the fields of colSchema to merged, the fields of other
+// collections indexed by name, leaving colSchema as it is. Annotations
+// besides types and counts are those of the first collection with the
+// field.
+func mergeShape(merged docSchema, index map[string]int, colSchema docSchema) docSchema {
+	for _, f := range colSchema {
+		i, ok := index[f.Name]
+		if !ok {
+			i = len(merged)
+			index[f.Name] = i
+			field := f
+			field.Count, field.Keys = 0, 0
+			field.Provenance, field.KeyTypes, field.ElementTypes = nil, nil, nil
+			merged = append(merged, field)
+		}
+		field := &merged[i]
+		for _, t := range f.fieldTypes() {
+			field.addType(t)
+		}
+		field.Count += f.Count
+		field.mergeProvenance(&f)
+		field.mergeElementTypes(&f)
+		if f.ElementTypes != nil {
+			homogeneous := len(field.ElementTypes) == 1
+			field.Homogeneous = &homogeneous
+		}
+		for t, n := range f.KeyTypes {
+			if field.KeyTypes == nil {
+				field.KeyTypes = make(map[string]int)
+			}
+			field.KeyTypes[t] += n
+		}
+		if f.Keys > field.Keys {
+			field.Keys = f.Keys
+		}
+	}
+	return merged
+}
+
+// shareModels returns the schema and statistics with each group of similar
+// collections replaced by one collection holding the fields of all of them.
+func shareModels(schema map[string]docSchema, stats map[string]*collectionStats) (map[string]docSchema, map[string]*collectionStats) {
+	groups := similarCollections(schema)
+	if len(groups) == 0 {
+		return schema, stats
+	}
+	sharedSchema := make(map[string]docSchema, len(schema))
+	sharedStats := make(map[string]*collectionStats, len(stats))
+	for name, colSchema := range schema {
+		sharedSchema[name] = colSchema
+		sharedStats[name] = stats[name]
+	}
+	for _, g := range groups {
+		name := sharedName(g.collections, schema)
+		var merged docSchema
+		index := make(map[string]int)
+		total := new(collectionStats)
+		for _, collection := range g.collections {
+			merged = mergeShape(merged, index, schema[collection])
+			if s := stats[collection]; s != nil {
+				total.Documents += s.Documents
+				total.Sampled += s.Sampled
+				total.Excluded += s.Excluded
+			}
+			delete(sharedSchema, collection)
+			delete(sharedStats, collection)
+		}
+		sort.Sort(merged)
+		total.Fields = len(merged)
+		sharedSchema[name] = merged
+		sharedStats[name] = total
+	}
+	return sharedSchema, sharedStats
+}
@@ -0,0 +1,142 @@
+package extractor
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// HyperLogLogPrecision is the number of index bits of the distinct count
+// sketch, giving 4096 registers and about 1.6% standard error.
+const HyperLogLogPrecision = 12
+
+// hyperLogLog estimates the number of distinct values in constant memory.
+type hyperLogLog struct {
+	registers [1 << HyperLogLogPrecision]uint8
+}
+
+func hashValue(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	// FNV mixes the low bits poorly for short inputs.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
+
+func (h *hyperLogLog) add(value string) {
+	x := hashValue(value)
+	i := x >> (64 - HyperLogLogPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<HyperLogLogPrecision|1<<(HyperLogLogPrecision-1)) + 1)
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+func (h *hyperLogLog) estimate() int {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(estimate + 0.5)
+}
+
+// spaceSaving keeps approximate counts of the most frequent values with a
+// fixed number of counters. A value's count is overestimated by at most the
+// count of the counter it replaced.
+type spaceSaving struct {
+	capacity int
+	counts   map[string]int
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{capacity: capacity, counts: make(map[string]int, capacity)}
+}
+
+func (s *spaceSaving) add(value string, count int) {
+	if _, ok := s.counts[value]; ok || len(s.counts) < s.capacity {
+		s.counts[value] += count
+		return
+	}
+	minValue, minCount := "", math.MaxInt64
+	for v, c := range s.counts {
+		if c < minCount {
+			minValue, minCount = v, c
+		}
+	}
+	delete(s.counts, minValue)
+	s.counts[value] = minCount + count
+}
+
+func (s *spaceSaving) merge(other *spaceSaving) {
+	for v, c := range other.counts {
+		s.add(v, c)
+	}
+}
+
+// histogramBin is a centroid of a streaming histogram.
+type histogramBin struct {
+	Value float64 `json:"value"`
+	Count int     `json:"count"`
+}
+
+// streamingHistogram approximates the distribution of numbers with a fixed
+// number of bins, merging the two closest bins when a value does not fit
+// (Ben-Haim and Tom-Tov).
+type streamingHistogram struct {
+	maxBins int
+	bins    []histogramBin
+}
+
+func (h *streamingHistogram) add(value float64, count int) {
+	i := sort.Search(len(h.bins), func(i int) bool { return h.bins[i].Value >= value })
+	if i < len(h.bins) && h.bins[i].Value == value {
+		h.bins[i].Count += count
+		return
+	}
+	h.bins = append(h.bins, histogramBin{})
+	copy(h.bins[i+1:], h.bins[i:])
+	h.bins[i] = histogramBin{Value: value, Count: count}
+	if len(h.bins) <= h.maxBins {
+		return
+	}
+	closest := 0
+	for j := 1; j < len(h.bins)-1; j++ {
+		if h.bins[j+1].Value-h.bins[j].Value < h.bins[closest+1].Value-h.bins[closest].Value {
+			closest = j
+		}
+	}
+	a, b := h.bins[closest], h.bins[closest+1]
+	total := a.Count + b.Count
+	h.bins[closest] = histogramBin{
+		Value: (a.Value*float64(a.Count) + b.Value*float64(b.Count)) / float64(total),
+		Count: total,
+	}
+	h.bins = append(h.bins[:closest+1], h.bins[closest+2:]...)
+}
+
+func (h *streamingHistogram) merge(other *streamingHistogram) {
+	for _, bin := range other.bins {
+		h.add(bin.Value, bin.Count)
+	}
+}
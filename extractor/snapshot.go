@@ -0,0 +1,286 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// SnapshotStartTimeout bounds the startup of the mongod serving a
+	// snapshot, which recovers the storage engine first.
+	SnapshotStartTimeout = 5 * time.Minute
+	// SnapshotStopTimeout is how long mongod may take to shut down before
+	// it is killed.
+	SnapshotStopTimeout = 30 * time.Second
+	// BackupCursorKeepAlive is the interval of the getMore commands keeping
+	// the backup cursor open, well under the 10 minutes after which the
+	// server closes idle cursors.
+	BackupCursorKeepAlive = time.Minute
+)
+
+var (
+	snapshotDBPathFlag = cli.StringFlag{
+		Name: "snapshot-dbpath",
+		Usage: "Extract from the data files in this directory, e.g. a mounted filesystem snapshot, through a private " +
+			"mongod started in queryable backup mode, instead of querying the -url deployment",
+	}
+	backupCursorFlag = cli.BoolFlag{
+		Name: "backup-cursor",
+		Usage: "Copy a consistent checkpoint of the -url node into -snapshot-dbpath with $backupCursor (MongoDB " +
+			"Enterprise or Percona Server) first. The tool must run on the node's host to read its files",
+	}
+	mongodFlag = cli.StringFlag{
+		Name:  "mongod",
+		Usage: "mongod binary serving -snapshot-dbpath",
+		Value: "mongod",
+	}
+)
+
+// snapshotServer is a mongod serving a snapshot to the extraction only.
+type snapshotServer struct {
+	cmd    *exec.Cmd
+	output bytes.Buffer
+	url    string
+	exited chan error
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// startSnapshotServer starts mongod on dbPath, listening on the loopback
+// interface only, and waits until it accepts connections. The URL names the
+// database.
+func startSnapshotServer(mongod, dbPath, database string) (*snapshotServer, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshotServer{
+		url:    fmt.Sprintf("mongodb://127.0.0.1:%d/%v", port, database),
+		exited: make(chan error, 1),
+	}
+	// Queryable backup mode never writes to the data files.
+	s.cmd = exec.Command(mongod, "--dbpath", dbPath, "--port", strconv.Itoa(port), "--bind_ip", "127.0.0.1",
+		"--queryableBackupMode", "--nounixsocket")
+	s.cmd.Stdout = &s.output
+	s.cmd.Stderr = &s.output
+	if err := s.cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() { s.exited <- s.cmd.Wait() }()
+	deadline := time.Now().Add(SnapshotStartTimeout)
+	for {
+		session, err := mgo.DialWithTimeout(s.url+"?connect=direct", time.Second)
+		if err == nil {
+			session.Close()
+			return s, nil
+		}
+		select {
+		case err := <-s.exited:
+			return nil, fmt.Errorf("mongod exited: %v\n%s", err, tail(s.output.Bytes(), 2048))
+		case <-time.After(time.Second):
+		}
+		if time.Now().After(deadline) {
+			s.stop()
+			return nil, fmt.Errorf("mongod did not accept connections within %v", SnapshotStartTimeout)
+		}
+	}
+}
+
+func tail(data []byte, n int) []byte {
+	if len(data) > n {
+		return data[len(data)-n:]
+	}
+	return data
+}
+
+func (s *snapshotServer) stop() {
+	s.cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-s.exited:
+	case <-time.After(SnapshotStopTimeout):
+		s.cmd.Process.Kill()
+		<-s.exited
+	}
+}
+
+// backupFile is a file listed by $backupCursor.
+type backupFile struct {
+	Filename string `bson:"filename"`
+	FileSize int64  `bson:"fileSize"`
+}
+
+type backupCursorBatch struct {
+	Cursor struct {
+		ID         int64    `bson:"id"`
+		FirstBatch []bson.M `bson:"firstBatch"`
+		NextBatch  []bson.M `bson:"nextBatch"`
+	} `bson:"cursor"`
+}
+
+// copyBackup copies the checkpoint pinned by a backup cursor on the node of
+// session into dir. The files are read directly from the node's dbpath.
+func copyBackup(session *mgo.Session, dir string) error {
+	admin := session.DB("admin")
+	var batch backupCursorBatch
+	err := admin.Run(bson.D{
+		{Name: "aggregate", Value: 1},
+		{Name: "pipeline", Value: []bson.M{{"$backupCursor": bson.M{}}}},
+		{Name: "cursor", Value: bson.M{}},
+	}, &batch)
+	if err != nil {
+		return fmt.Errorf("$backupCursor: %v", err)
+	}
+	id := batch.Cursor.ID
+	defer admin.Run(bson.D{{Name: "killCursors", Value: "$cmd.aggregate"}, {Name: "cursors", Value: []int64{id}}}, nil)
+	getMore := func() ([]bson.M, error) {
+		var next backupCursorBatch
+		err := admin.Run(bson.D{{Name: "getMore", Value: id}, {Name: "collection", Value: "$cmd.aggregate"}}, &next)
+		return next.Cursor.NextBatch, err
+	}
+	// The first document holds the metadata, the others list files.
+	docs := batch.Cursor.FirstBatch
+	if len(docs) == 0 {
+		return fmt.Errorf("$backupCursor returned no metadata")
+	}
+	metadata, _ := docs[0]["metadata"].(bson.M)
+	dbPath, _ := metadata["dbpath"].(string)
+	if dbPath == "" {
+		return fmt.Errorf("$backupCursor metadata has no dbpath")
+	}
+	var files []backupFile
+	for _, doc := range docs[1:] {
+		var f backupFile
+		if err := bsonConvert(doc, &f); err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	// Files beyond the first batch are listed by getMore, which also keeps
+	// the cursor alive; an empty batch ends the list.
+	for {
+		more, err := getMore()
+		if err != nil {
+			return err
+		}
+		if len(more) == 0 {
+			break
+		}
+		for _, doc := range more {
+			var f backupFile
+			if err := bsonConvert(doc, &f); err != nil {
+				return err
+			}
+			files = append(files, f)
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(BackupCursorKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := getMore(); err != nil {
+					log.Printf("Keeping the backup cursor alive failed: %v\n", err)
+				}
+			}
+		}
+	}()
+	for _, f := range files {
+		rel, err := filepath.Rel(dbPath, f.Filename)
+		if err != nil {
+			return err
+		}
+		// Files kept outside the dbpath, such as a journal on another
+		// volume, would be written outside dir.
+		if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%v is outside the dbpath %v; copy the checkpoint by other means", f.Filename, dbPath)
+		}
+		if err := copyFilePrefix(f.Filename, filepath.Join(dir, rel), f.FileSize); err != nil {
+			return err
+		}
+	}
+	log.Printf("Copied %d files of the checkpoint of %v into %v\n", len(files), dbPath, dir)
+	return nil
+}
+
+func bsonConvert(in interface{}, out interface{}) error {
+	data, err := bson.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, out)
+}
+
+// copyFilePrefix copies the first size bytes of src, the part covered by the
+// checkpoint, to dst.
+func copyFilePrefix(src, dst string, size int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(out, in, size); err != nil && err != io.EOF {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// prepareSnapshot points the extraction at a private mongod serving the
+// -snapshot-dbpath directory, filled from a backup cursor first when asked.
+// The returned server must be stopped after the extraction.
+func prepareSnapshot(ctx *cli.Context, cmdInfo *commandInfo) (*snapshotServer, error) {
+	dir := ctx.GlobalString(snapshotDBPathFlag.Name)
+	dialInfo, err := mgo.ParseURL(cmdInfo.urls[0])
+	if err != nil {
+		return nil, err
+	}
+	if ctx.GlobalBool(backupCursorFlag.Name) {
+		session, err := connect(cmdInfo)
+		if err != nil {
+			return nil, err
+		}
+		err = copyBackup(session, dir)
+		session.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	server, err := startSnapshotServer(ctx.GlobalString(mongodFlag.Name), dir, dialInfo.Database)
+	if err != nil {
+		return nil, err
+	}
+	cmdInfo.snapshotURL = server.url
+	return server, nil
+}
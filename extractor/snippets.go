@@ -0,0 +1,172 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emmansun/extract-mgo-schema/mgoschema"
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// SnippetTopValues is the number of most common values a snippet lists.
+	SnippetTopValues = 20
+	// SnippetExamples is the number of documents fetched per type.
+	SnippetExamples = 3
+)
+
+var (
+	flaggedFlag = cli.StringFlag{
+		Name:  "flagged",
+		Usage: "Findings file written by -findings; select the fields it reports",
+	}
+
+	snippetsCommand = cli.Command{
+		Name: "snippets",
+		Usage: "Print mongosh snippets inspecting fields of a schema written by -format json: the type breakdown, " +
+			"the missing documents, the distinct values and example documents of each type",
+		ArgsUsage: "schema.json [collection.field ...]",
+		Description: "Fields are selected by globs on \"collection.field\", e.g. \"orders.lines[].*\", and by -flagged. " +
+			"Without either, every field of the schema is selected.",
+		Flags:  []cli.Flag{flaggedFlag},
+		Action: printSnippets,
+	}
+)
+
+// readFlagged returns the fields reported by a findings file, as
+// "collection.field".
+func readFlagged(file string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var list []finding
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+	flagged := make(map[string]bool)
+	for _, f := range list {
+		if f.Field != "" {
+			flagged[f.Collection+"."+f.Field] = true
+		}
+	}
+	return flagged, nil
+}
+
+// fieldSnippets returns the mongosh snippets of a field of a collection,
+// read through the coll expression. Arrays on the way to the field are
+// unwound, so that elements are counted one by one.
+func fieldSnippets(coll, collection string, f *docField) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %v.%v: %v\n", collection, f.Name, strings.Join(f.fieldTypes(), "|"))
+	if strings.Contains(f.Name, "*") {
+		b.WriteString("// Summarizes the keys of a -dynamic document, which cannot be queried by name.\n")
+		return b.String()
+	}
+	var unwind []bson.M
+	parts := strings.Split(f.Name, "[]")
+	prefix := ""
+	for _, part := range parts[:len(parts)-1] {
+		prefix += part
+		unwind = append(unwind, bson.M{"$unwind": "$" + prefix})
+	}
+	field := strings.Replace(f.Name, "[]", "", -1)
+	pipeline := func(stages ...bson.M) string {
+		return shellValue(append(append([]bson.M{}, unwind...), stages...))
+	}
+	b.WriteString("// types\n")
+	fmt.Fprintf(&b, "%v.aggregate(%v)\n", coll, pipeline(
+		bson.M{"$group": bson.D{{Name: "_id", Value: bson.M{"$type": "$" + field}}, {Name: "count", Value: bson.M{"$sum": 1}}}},
+		bson.M{"$sort": bson.M{"count": -1}},
+	))
+	b.WriteString("// documents without the field\n")
+	fmt.Fprintf(&b, "%v.countDocuments(%v)\n", coll, shellValue(bson.M{field: bson.M{"$exists": false}}))
+	b.WriteString("// distinct values\n")
+	fmt.Fprintf(&b, "%v.aggregate(%v)\n", coll, pipeline(
+		bson.M{"$group": bson.M{"_id": "$" + field}},
+		bson.M{"$count": "distinct"},
+	))
+	fmt.Fprintf(&b, "// %v most common values\n", SnippetTopValues)
+	fmt.Fprintf(&b, "%v.aggregate(%v)\n", coll, pipeline(
+		bson.M{"$group": bson.D{{Name: "_id", Value: "$" + field}, {Name: "count", Value: bson.M{"$sum": 1}}}},
+		bson.M{"$sort": bson.M{"count": -1}},
+		bson.M{"$limit": SnippetTopValues},
+	))
+	for _, t := range f.fieldTypes() {
+		aliases := bsonTypeAliases[baseType(t)]
+		if len(aliases) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "// examples of %v\n", t)
+		fmt.Fprintf(&b, "%v.find(%v, %v).limit(%v)\n", coll, shellValue(bson.M{field: bson.M{"$type": aliases}}),
+			shellValue(bson.M{field: 1}), SnippetExamples)
+	}
+	return b.String()
+}
+
+// printSnippets prints the snippets of the selected fields of a schema file.
+func printSnippets(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return cli.NewExitError("snippets needs a schema file", 1)
+	}
+	data, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if data, err = mgoschema.Upgrade(data); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	var file schemaFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	patterns := ctx.Args().Tail()
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return cli.NewExitError(fmt.Sprintf("%v: %v", pattern, err), 1)
+		}
+	}
+	var flagged map[string]bool
+	if file := ctx.String(flaggedFlag.Name); file != "" {
+		if flagged, err = readFlagged(file); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	names := make([]string, 0, len(file.Collections))
+	for name := range file.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	db := "db"
+	if file.Database != "" {
+		db = fmt.Sprintf("db.getSiblingDB(%v)", strconv.Quote(file.Database))
+	}
+	selected := 0
+	for _, name := range names {
+		coll := fmt.Sprintf("%v.getCollection(%v)", db, strconv.Quote(name))
+		for i := range file.Collections[name] {
+			f := &file.Collections[name][i]
+			key := name + "." + f.Name
+			if len(patterns) > 0 || flagged != nil {
+				if !flagged[key] && (len(patterns) == 0 || !matchesAny(patterns, key)) {
+					continue
+				}
+			}
+			if selected > 0 {
+				fmt.Println()
+			}
+			selected++
+			fmt.Print(fieldSnippets(coll, name, f))
+		}
+	}
+	if selected == 0 {
+		return cli.NewExitError("no field selected", 1)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// SnowflakeDDLFormat writes a Snowflake CREATE TABLE statement per
+// collection.
+const SnowflakeDDLFormat = "snowflake-ddl"
+
+// SnowflakeFlattenDepth is the depth of embedded documents flattened into
+// typed columns; deeper subtrees are kept whole in VARIANT columns.
+const SnowflakeFlattenDepth = 2
+
+// snowflakeTypes are the column types of the base types. ObjectIds are kept
+// as their hex strings, and dates, stored in UTC, with their time zone.
+var snowflakeTypes = map[string]string{
+	"INTEGER":  "NUMBER(38,0)",
+	"DECIMAL":  "FLOAT",
+	"STRING":   "VARCHAR",
+	"BOOL":     "BOOLEAN",
+	"TIME":     "TIMESTAMP_TZ",
+	"OBJECTID": "VARCHAR(24)",
+	"BINARY":   "BINARY",
+}
+
+var (
+	snowflakeIdentifier = regexp.MustCompile(`^[A-Z_][A-Z0-9_$]*$`)
+	// snowflakeReserved are the reserved keywords of Snowflake, which cannot
+	// name a table or column unquoted.
+	snowflakeReserved = map[string]bool{
+		"ACCOUNT": true, "ALL": true, "ALTER": true, "AND": true, "ANY": true, "AS": true, "BETWEEN": true,
+		"BY": true, "CASE": true, "CAST": true, "CHECK": true, "COLUMN": true, "CONNECT": true, "CONNECTION": true,
+		"CONSTRAINT": true, "CREATE": true, "CROSS": true, "CURRENT": true, "CURRENT_DATE": true,
+		"CURRENT_TIME": true, "CURRENT_TIMESTAMP": true, "CURRENT_USER": true, "DATABASE": true, "DELETE": true,
+		"DISTINCT": true, "DROP": true, "ELSE": true, "EXISTS": true, "FALSE": true, "FOLLOWING": true,
+		"FOR": true, "FROM": true, "FULL": true, "GRANT": true, "GROUP": true, "GSCLUSTER": true, "HAVING": true,
+		"ILIKE": true, "IN": true, "INCREMENT": true, "INNER": true, "INSERT": true, "INTERSECT": true,
+		"INTO": true, "IS": true, "ISSUE": true, "JOIN": true, "LATERAL": true, "LEFT": true, "LIKE": true,
+		"LOCALTIME": true, "LOCALTIMESTAMP": true, "MINUS": true, "NATURAL": true, "NOT": true, "NULL": true,
+		"OF": true, "ON": true, "OR": true, "ORDER": true, "ORGANIZATION": true, "QUALIFY": true, "REGEXP": true,
+		"REVOKE": true, "RIGHT": true, "RLIKE": true, "ROW": true, "ROWS": true, "SAMPLE": true, "SCHEMA": true,
+		"SELECT": true, "SET": true, "SOME": true, "START": true, "TABLE": true, "TABLESAMPLE": true,
+		"THEN": true, "TO": true, "TRIGGER": true, "TRUE": true, "TRY_CAST": true, "UNION": true,
+		"UNIQUE": true, "UPDATE": true, "USING": true, "VALUES": true, "VIEW": true, "WHEN": true,
+		"WHENEVER": true, "WHERE": true, "WITH": true,
+	}
+)
+
+// sfIdent uppercases an identifier as Snowflake folds unquoted ones, and
+// quotes it unless Snowflake takes it as is.
+func sfIdent(name string) string {
+	upper := strings.ToUpper(name)
+	if snowflakeIdentifier.MatchString(upper) && !snowflakeReserved[upper] {
+		return upper
+	}
+	return `"` + strings.Replace(upper, `"`, `""`, -1) + `"`
+}
+
+// sfString quotes a string literal.
+func sfString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// sfColumns returns the columns of a node, named after name. Embedded
+// documents with known fields are flattened into a column per field, named
+// like "address_city", down to SnowflakeFlattenDepth; deeper documents,
+// -dynamic documents and mixed types go into VARIANT columns, arrays into
+// ARRAY columns.
+func sfColumns(name string, n *modelNode, notNull bool, depth int) []pgColumn {
+	if len(n.Types) == 1 && n.Types[0] == "DOCUMENT" && n.Properties != nil && n.Rest == nil && n.Path != "_id" &&
+		depth < SnowflakeFlattenDepth {
+		var columns []pgColumn
+		for _, child := range n.Properties {
+			columns = append(columns, sfColumns(name+"_"+plainName(child.Name), child, notNull && child.Required, depth+1)...)
+		}
+		return columns
+	}
+	column := pgColumn{name: name, field: n.Path, typ: "VARIANT", notNull: notNull}
+	switch {
+	case len(n.Types) == 1 && n.Types[0] == "ARRAY":
+		column.typ = "ARRAY"
+	case len(n.Types) == 1 && snowflakeTypes[n.Types[0]] != "":
+		column.typ = snowflakeTypes[n.Types[0]]
+	case n.Numeric:
+		column.typ = "FLOAT"
+	}
+	return []pgColumn{column}
+}
+
+// createSnowflakeTable returns the CREATE TABLE statement of a collection,
+// keyed by _id. Columns of fields missing from some sampled documents are
+// nullable. Columns not named after the lowercase path of their field are
+// commented with it, for loading them with $1:path.
+func createSnowflakeTable(c *collectionModel) string {
+	var columns []pgColumn
+	for _, child := range c.Document.Properties {
+		columns = append(columns, sfColumns(plainName(child.Name), child, child.Required, 0)...)
+	}
+	if c.Document.Rest != nil {
+		columns = append(columns, pgColumn{name: "extra", field: "*", typ: "VARIANT"})
+	}
+	taken := make(map[string]bool)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %v (\n", sfIdent(c.Name))
+	for i, col := range columns {
+		name := uniqueName(taken, strings.ToUpper(col.name))
+		fmt.Fprintf(&b, "    %v %v", sfIdent(name), col.typ)
+		switch {
+		case col.field == "_id":
+			b.WriteString(" PRIMARY KEY")
+		case col.notNull:
+			b.WriteString(" NOT NULL")
+		}
+		if col.field != strings.ToLower(name) {
+			fmt.Fprintf(&b, " COMMENT %v", sfString(col.field))
+		}
+		if i < len(columns)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(")")
+	if c.Stats != nil {
+		fmt.Fprintf(&b, "\nCOMMENT = %v", sfString(fmt.Sprintf("%v documents, %v sampled", c.Stats.Documents, c.Stats.Sampled)))
+	}
+	b.WriteString(";\n")
+	return b.String()
+}
+
+// exportSnowflakeDDL writes the CREATE TABLE statements of the collections.
+func exportSnowflakeDDL(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	var b bytes.Buffer
+	b.WriteString("-- Generated by extract_mgo from sampled documents.\n")
+	for _, c := range m.Collections {
+		b.WriteString("\n")
+		b.WriteString(createSnowflakeTable(c))
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
@@ -0,0 +1,111 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// SparkFormat writes the Spark StructType of each collection, in the JSON
+// read by DataType.fromJson and StructType.fromJson in PySpark.
+const SparkFormat = "spark"
+
+// sparkTypes are the Spark SQL types of the base types. ObjectIds are their
+// hex strings, as the MongoDB Spark connector reads them.
+var sparkTypes = map[string]string{
+	"INTEGER":  "long",
+	"DECIMAL":  "double",
+	"STRING":   "string",
+	"BOOL":     "boolean",
+	"TIME":     "timestamp",
+	"OBJECTID": "string",
+	"BINARY":   "binary",
+}
+
+// sparkStruct is a Spark StructType.
+type sparkStruct struct {
+	Type   string        `json:"type"`
+	Fields []*sparkField `json:"fields"`
+}
+
+type sparkField struct {
+	Name     string      `json:"name"`
+	Type     interface{} `json:"type"`
+	Nullable bool        `json:"nullable"`
+	// Metadata is required by Spark, if empty.
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+type sparkArray struct {
+	Type         string      `json:"type"`
+	ElementType  interface{} `json:"elementType"`
+	ContainsNull bool        `json:"containsNull"`
+}
+
+type sparkMap struct {
+	Type              string      `json:"type"`
+	KeyType           string      `json:"keyType"`
+	ValueType         interface{} `json:"valueType"`
+	ValueContainsNull bool        `json:"valueContainsNull"`
+}
+
+// sparkStructOf returns the struct of the properties of a document, the
+// fields not in every document holding it nullable. Spark takes any field
+// name, so documents keep theirs.
+func sparkStructOf(n *modelNode) *sparkStruct {
+	s := &sparkStruct{Type: "struct", Fields: make([]*sparkField, 0, len(n.Properties))}
+	for _, child := range n.Properties {
+		s.Fields = append(s.Fields, &sparkField{
+			Name:     child.Name,
+			Type:     sparkType(child),
+			Nullable: !child.Required,
+			Metadata: map[string]interface{}{},
+		})
+	}
+	return s
+}
+
+// sparkType returns the Spark type of a node. Embedded documents with known
+// fields become structs, -dynamic documents maps, and mixed types strings,
+// as the connector reads conflicting types; integers mixed with decimals
+// are doubles.
+func sparkType(n *modelNode) interface{} {
+	types := n.Types
+	switch {
+	case n.Numeric:
+		return "double"
+	case len(types) != 1:
+		return "string"
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		switch {
+		case n.Properties != nil:
+			return sparkStructOf(n)
+		case n.Rest != nil:
+			return &sparkMap{Type: "map", KeyType: "string", ValueType: sparkType(n.Rest), ValueContainsNull: true}
+		}
+		return &sparkMap{Type: "map", KeyType: "string", ValueType: "string", ValueContainsNull: true}
+	case "ARRAY":
+		var element interface{} = "string"
+		if n.Items != nil {
+			element = sparkType(n.Items)
+		}
+		return &sparkArray{Type: "array", ElementType: element, ContainsNull: true}
+	}
+	if t, ok := sparkTypes[types[0]]; ok {
+		return t
+	}
+	return "string"
+}
+
+// exportSpark writes the StructType of the only collection of m.
+func exportSpark(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	for _, c := range m.Collections {
+		data, err := json.MarshalIndent(sparkStructOf(c.Document), "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package extractor
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	// MaxReferenceProbes is the number of distinct values of a string field
+	// looked up in the _id of other collections.
+	MaxReferenceProbes = 20
+	// MinReferenceHits is the share of the probed values a collection must
+	// hold for the field to be taken as a reference to it.
+	MinReferenceHits = 0.5
+	// ObjectIDRefPrefix starts the subtype of strings holding the ObjectIds
+	// of another collection, e.g. "STRING(OBJECTID-REF → users)".
+	ObjectIDRefPrefix = "OBJECTID-REF → "
+)
+
+func (p *fieldProfile) observeObjectID(s string) {
+	p.objectIDStrings++
+	p.addObjectID(s)
+}
+
+func (p *fieldProfile) addObjectID(s string) {
+	if len(p.objectIDs) >= MaxReferenceProbes || containsString(p.objectIDs, s) {
+		return
+	}
+	p.objectIDs = append(p.objectIDs, s)
+}
+
+// objectIDReference returns the collection a field holding ObjectIds as
+// strings was found to reference, if any.
+func objectIDReference(f *docField) string {
+	for _, t := range f.fieldTypes() {
+		if strings.HasPrefix(t, "STRING("+ObjectIDRefPrefix) {
+			return strings.TrimSuffix(strings.TrimPrefix(t, "STRING("+ObjectIDRefPrefix), ")")
+		}
+	}
+	return ""
+}
+
+// probeStringReferences looks up the values of the string fields whose
+// sampled values are all ObjectIds in hexadecimal in the _id of the other
+// collections with ObjectId ids, and types the fields found to reference one
+// STRING(OBJECTID-REF → <collection>). The collection the name of a field
+// points at is tried first.
+func probeStringReferences(db *mgo.Database, schema map[string]docSchema) {
+	var targets []string
+	collections := make(map[string]string)
+	for name, colSchema := range schema {
+		for _, f := range colSchema {
+			if f.Name == "_id" && f.Type == "OBJECTID" && len(f.Types) == 0 {
+				targets = append(targets, name)
+				collections[normalizedName(name)] = name
+			}
+		}
+	}
+	sort.Strings(targets)
+	for name, colSchema := range schema {
+		for i := range colSchema {
+			f := &colSchema[i]
+			p := f.profile
+			if f.Name == "_id" || f.Type != "STRING" || len(f.Types) > 0 ||
+				p == nil || p.strings == 0 || p.objectIDStrings != p.strings {
+				continue
+			}
+			ids := make([]bson.ObjectId, len(p.objectIDs))
+			for j, id := range p.objectIDs {
+				ids[j] = bson.ObjectIdHex(id)
+			}
+			guess := referencedCollection(f, collections)
+			candidates := []string{guess}
+			for _, target := range targets {
+				if target != guess {
+					candidates = append(candidates, target)
+				}
+			}
+			for _, target := range candidates {
+				if target == "" {
+					continue
+				}
+				hits, err := db.C(target).Find(bson.M{"_id": bson.M{"$in": ids}}).Count()
+				if err != nil {
+					addWarning(name, f.Name, "failed to look up its values in %v: %v", target, err)
+					break
+				}
+				if float64(hits) >= MinReferenceHits*float64(len(ids)) {
+					f.Type = fmt.Sprintf("STRING(%v%v)", ObjectIDRefPrefix, target)
+					log.Printf("Field %v.%v holds ObjectIds of %v as strings (%v of %v probed values found)\n",
+						name, f.Name, target, hits, len(ids))
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package extractor
+
+import (
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	onlyTagFlag = cli.StringSliceFlag{
+		Name: "only-tag",
+		Usage: "Write only the fields given one of these tags by the anonymize.fields config, e.g. pii, " +
+			"as for a PII inventory. Repeatable",
+	}
+	ownerFlag = cli.StringSliceFlag{
+		Name: "owner",
+		Usage: "Write only the collections and fields the owners config gives one of these owners or domains, " +
+			"as for the model pack of a team. Repeatable",
+	}
+)
+
+// schemaSubset is the part of the schema -only-tag and -owner write.
+type schemaSubset struct {
+	tags   []string
+	owners []string
+}
+
+// newSchemaSubset returns the subset of the flags, nil when they write the
+// whole schema.
+func newSchemaSubset(tags, owners []string) *schemaSubset {
+	if len(tags) == 0 && len(owners) == 0 {
+		return nil
+	}
+	return &schemaSubset{tags: tags, owners: owners}
+}
+
+// keeps tells whether a field is in the subset. Fields are owned by the
+// owner of their collection unless the config gives them their own.
+func (s *schemaSubset) keeps(collection string, f *docField, stats *collectionStats) bool {
+	if len(s.tags) > 0 && !containsString(s.tags, valueAnonymizer.tag(collection, f.Name)) {
+		return false
+	}
+	if len(s.owners) == 0 {
+		return true
+	}
+	owner, domain := f.Owner, f.Domain
+	if owner == "" && domain == "" && stats != nil {
+		owner, domain = stats.Owner, stats.Domain
+	}
+	return owner != "" && containsString(s.owners, owner) || domain != "" && containsString(s.owners, domain)
+}
+
+// apply returns the schema and statistics of the subset, leaving out the
+// collections with no field in it.
+func (s *schemaSubset) apply(schema map[string]docSchema, stats map[string]*collectionStats) (map[string]docSchema, map[string]*collectionStats) {
+	subsetSchema := make(map[string]docSchema)
+	subsetStats := make(map[string]*collectionStats)
+	for name, colSchema := range schema {
+		var kept docSchema
+		for i := range colSchema {
+			if s.keeps(name, &colSchema[i], stats[name]) {
+				kept = append(kept, colSchema[i])
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		subsetSchema[name] = kept
+		if st := stats[name]; st != nil {
+			subsetStat := *st
+			subsetStat.Fields = len(kept)
+			subsetStats[name] = &subsetStat
+		}
+	}
+	return subsetSchema, subsetStats
+}
@@ -0,0 +1,59 @@
+package extractor
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var tailFlag = cli.BoolFlag{
+	Name: "tail",
+	Usage: "Print each field to stdout as it is discovered, with its collection and type, and the new types of " +
+		"known fields, so that long exploratory runs show what they find as they go",
+}
+
+// fieldTail prints the fields and types as they are discovered; it is safe
+// for concurrent use. Fields found again by the scans of other partitions
+// are not printed twice.
+type fieldTail struct {
+	lock  sync.Mutex
+	out   io.Writer
+	start time.Time
+	types map[string]map[string]bool // types of each field, by collection and field
+}
+
+// liveTail is set by -tail.
+var liveTail *fieldTail
+
+func newFieldTail(out io.Writer) *fieldTail {
+	return &fieldTail{out: out, start: time.Now(), types: make(map[string]map[string]bool)}
+}
+
+// observe prints the field of a sampled document unless it was seen with
+// that type before.
+func (t *fieldTail) observe(collection, field, typeName string) {
+	if t == nil {
+		return
+	}
+	key := collection + "\x00" + field
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	types, known := t.types[key]
+	if types[typeName] {
+		return
+	}
+	if !known {
+		types = make(map[string]bool)
+		t.types[key] = types
+	}
+	types[typeName] = true
+	elapsed := time.Since(t.start).Seconds()
+	if known {
+		fmt.Fprintf(t.out, "[%7.1fs] %v: %v also %v\n", elapsed, collection, field, typeName)
+	} else {
+		fmt.Fprintf(t.out, "[%7.1fs] %v: %v %v\n", elapsed, collection, field, typeName)
+	}
+}
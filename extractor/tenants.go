@@ -0,0 +1,285 @@
+package extractor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// MaxTenants is the number of tenants told apart per collection; the
+	// documents of further tenants are counted under TenantOther.
+	MaxTenants  = 100
+	TenantOther = "(other)"
+	// MinTenantDocuments is the number of sampled documents a tenant must
+	// have for a field missing from all of them to count as absent for it.
+	MinTenantDocuments = 10
+	// MaxListedTenants is the number of tenants named by a finding.
+	MaxListedTenants = 5
+)
+
+var (
+	tenantFieldFlag = cli.StringFlag{
+		Name: "tenant-field",
+		Usage: "Field holding the tenant of a document, e.g. \"tenantId\" or \"owner.org\". Count the sampled " +
+			"documents of each tenant holding each field, and report the fields found only for some tenants",
+	}
+	tenantMatrixFlag = cli.StringFlag{
+		Name: "tenant-matrix",
+		Usage: "Write the tenant × field presence matrix of -tenant-field to this file: the share of the documents " +
+			"of each tenant holding each field as CSV, or the counts as JSON when the name ends in .json",
+	}
+)
+
+// tenantField is set by -tenant-field.
+var tenantField string
+
+// documentTenant returns the value of the -tenant-field of a document, ""
+// when it has none.
+func documentTenant(doc bson.D) string {
+	var value interface{} = doc
+	for _, name := range strings.Split(tenantField, ".") {
+		if typeOf(value) != "DOCUMENT" {
+			return ""
+		}
+		var found interface{}
+		for _, e := range asDocument(value) {
+			if e.Name == name {
+				found = e.Value
+				break
+			}
+		}
+		value = found
+	}
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bson.ObjectId:
+		return v.Hex()
+	}
+	if t := typeOf(value); t == "DOCUMENT" || t == "ARRAY" {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// tenantOf returns the tenant of the current document, TenantOther past
+// MaxTenants.
+func (fieldSet *fieldSet) tenantOf(doc bson.D) string {
+	if tenantField == "" {
+		return ""
+	}
+	tenant := documentTenant(doc)
+	if tenant == "" || fieldSet.tenants[tenant] {
+		return tenant
+	}
+	if fieldSet.tenants == nil {
+		fieldSet.tenants = make(map[string]bool)
+	}
+	if len(fieldSet.tenants) >= MaxTenants {
+		return TenantOther
+	}
+	fieldSet.tenants[tenant] = true
+	return tenant
+}
+
+// recordTenant counts a document of the tenant as holding the field.
+func (field *docField) recordTenant(tenant string) {
+	if tenant == "" {
+		return
+	}
+	if field.tenantDocs == nil {
+		field.tenantDocs = make(map[string]int)
+	}
+	field.tenantDocs[tenant]++
+}
+
+func (field *docField) mergeTenantDocs(other *docField) {
+	for t, n := range other.tenantDocs {
+		if field.tenantDocs == nil {
+			field.tenantDocs = make(map[string]int)
+		}
+		field.tenantDocs[t] += n
+	}
+}
+
+// listTenants names the first MaxListedTenants tenants.
+func listTenants(tenants []string) string {
+	if len(tenants) <= MaxListedTenants {
+		return strings.Join(tenants, ", ")
+	}
+	return fmt.Sprintf("%v and %v more", strings.Join(tenants[:MaxListedTenants], ", "), len(tenants)-MaxListedTenants)
+}
+
+// parentField returns the array or document holding a field, "" for
+// top-level fields.
+func parentField(name string) string {
+	if strings.HasSuffix(name, "[]") {
+		return strings.TrimSuffix(name, "[]")
+	}
+	if i := strings.LastIndex(name, "."); i > 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// reportedWith tells whether the closest tenant-specific field holding a
+// field is present for the same tenants.
+func reportedWith(present map[string]string, name, key string) bool {
+	for parent := parentField(name); parent != ""; parent = parentField(parent) {
+		if k, ok := present[parent]; ok {
+			return k == key
+		}
+	}
+	return false
+}
+
+// reportTenantFields sets the tenant counts of the fields, under their
+// anonymized names, and reports the fields present for some tenants only:
+// missing from every sampled document of tenants with at least
+// MinTenantDocuments of them. The documents of a tenant are those holding
+// _id. Fields found for the same tenants as the array or document holding
+// them are reported through it.
+func reportTenantFields(collection string, colSchema docSchema) {
+	var documents map[string]int
+	for _, f := range colSchema {
+		if f.Name == "_id" {
+			documents = f.tenantDocs
+		}
+	}
+	names := make(map[string]string, len(documents))
+	for t := range documents {
+		names[t] = t
+		if t != TenantOther {
+			name, ok := anonymize(collection, tenantField, t)
+			if !ok {
+				delete(names, t)
+				continue
+			}
+			names[t] = name
+		}
+	}
+	present := make(map[string]string)
+	for i := range colSchema {
+		f := &colSchema[i]
+		f.Tenants = make(map[string]int)
+		var with, without []string
+		for t, n := range documents {
+			name, ok := names[t]
+			if !ok {
+				continue
+			}
+			count := f.tenantDocs[t]
+			f.Tenants[name] = count
+			switch {
+			case count > 0:
+				with = append(with, name)
+			case n >= MinTenantDocuments:
+				without = append(without, name)
+			}
+		}
+		f.tenantDocs = nil
+		if f.Name == "_id" || f.Name == tenantField || len(with) == 0 || len(without) == 0 {
+			continue
+		}
+		sort.Strings(with)
+		key := strings.Join(with, "\x00")
+		present[f.Name] = key
+		if reportedWith(present, f.Name, key) {
+			continue
+		}
+		addFinding(finding{
+			Collection: collection,
+			Field:      f.Name,
+			Kind:       "tenant-specific-field",
+			Message: fmt.Sprintf("%v.%v appears only for tenants %v (%v of %v tenants)",
+				collection, f.Name, listTenants(with), len(with), len(with)+len(without)),
+		})
+	}
+}
+
+// tenantMatrix is the tenant × field presence matrix of a collection.
+type tenantMatrix struct {
+	Collection string `json:"collection"`
+	// Documents counts the sampled documents of each tenant.
+	Documents map[string]int   `json:"documents"`
+	Fields    []tenantFieldRow `json:"fields"`
+}
+
+type tenantFieldRow struct {
+	Field   string         `json:"field"`
+	Tenants map[string]int `json:"tenants"`
+}
+
+// exportTenantMatrix writes the tenant × field presence matrices of the
+// collections, as JSON when path ends in .json and as CSV otherwise.
+func exportTenantMatrix(path string, schema map[string]docSchema) error {
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	matrices := []tenantMatrix{}
+	seen := make(map[string]bool)
+	var tenants []string
+	for _, name := range names {
+		m := tenantMatrix{Collection: name, Fields: []tenantFieldRow{}}
+		for _, f := range schema[name] {
+			if f.Name == "_id" {
+				m.Documents = f.Tenants
+			}
+			m.Fields = append(m.Fields, tenantFieldRow{Field: f.Name, Tenants: f.Tenants})
+		}
+		for t := range m.Documents {
+			if !seen[t] {
+				seen[t] = true
+				tenants = append(tenants, t)
+			}
+		}
+		matrices = append(matrices, m)
+	}
+	sort.Strings(tenants)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err := json.MarshalIndent(matrices, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	if err := writer.Write(append([]string{"collection", "field"}, tenants...)); err != nil {
+		return err
+	}
+	for _, m := range matrices {
+		for _, row := range m.Fields {
+			record := []string{m.Collection, row.Field}
+			for _, t := range tenants {
+				cell := ""
+				if n := m.Documents[t]; n > 0 {
+					cell = fmt.Sprintf("%.1f%%", 100*float64(row.Tenants[t])/float64(n))
+				}
+				record = append(record, cell)
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,96 @@
+package extractor
+
+import (
+	"fmt"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// ttlIndex is a TTL index of a collection: its documents are deleted
+// ExpireAfterSeconds after the date in Field, or at that date when zero.
+type ttlIndex struct {
+	Index              string `json:"index"`
+	Field              string `json:"field"`
+	ExpireAfterSeconds int64  `json:"expireAfterSeconds"`
+	// PartialFilter limits the expiry to the documents matching it.
+	PartialFilter bson.M `json:"partialFilter,omitempty"`
+}
+
+// collectionTTL returns the TTL indexes of the collection. They are read
+// with listIndexes rather than mgo's Indexes, which cannot tell an
+// expireAfterSeconds of 0 from none.
+func collectionTTL(c *mgo.Collection) []ttlIndex {
+	var result struct {
+		Cursor struct {
+			FirstBatch []struct {
+				Name               string      `bson:"name"`
+				Key                bson.D      `bson:"key"`
+				ExpireAfterSeconds interface{} `bson:"expireAfterSeconds"`
+				PartialFilter      bson.M      `bson:"partialFilterExpression"`
+			} `bson:"firstBatch"`
+		} `bson:"cursor"`
+	}
+	if err := c.Database.Run(bson.D{{Name: "listIndexes", Value: c.Name}}, &result); err != nil {
+		addWarning(c.Name, "", "failed to list indexes: %v", err)
+		return nil
+	}
+	var list []ttlIndex
+	for _, index := range result.Cursor.FirstBatch {
+		// TTL indexes are single-field; the server ignores the option on
+		// compound ones.
+		if index.ExpireAfterSeconds == nil || len(index.Key) != 1 {
+			continue
+		}
+		var seconds int64
+		switch v := index.ExpireAfterSeconds.(type) {
+		case int:
+			seconds = int64(v)
+		case int64:
+			seconds = v
+		case float64:
+			seconds = int64(v)
+		default:
+			continue
+		}
+		list = append(list, ttlIndex{
+			Index:              index.Name,
+			Field:              index.Key[0].Name,
+			ExpireAfterSeconds: seconds,
+			PartialFilter:      index.PartialFilter,
+		})
+	}
+	return list
+}
+
+// ttlPeriod writes seconds in the largest unit dividing them, e.g. "30d"
+// for 2592000.
+func ttlPeriod(seconds int64) string {
+	for _, unit := range []struct {
+		suffix  string
+		seconds int64
+	}{{"d", 86400}, {"h", 3600}, {"m", 60}} {
+		if seconds%unit.seconds == 0 {
+			return fmt.Sprintf("%d%v", seconds/unit.seconds, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// expiry describes when the documents expire, in the language of t.
+func (ttl ttlIndex) expiry(t *translator) string {
+	if ttl.ExpireAfterSeconds == 0 {
+		return t.text("expiresAt", ttl.Field)
+	}
+	return t.text("expiresAfter", ttlPeriod(ttl.ExpireAfterSeconds), ttl.Field)
+}
+
+// ttlOf returns the TTL index on a field, or nil.
+func ttlOf(s *collectionStats, field string) *ttlIndex {
+	for i := range s.TTL {
+		if s.TTL[i].Field == fieldPath(field) {
+			return &s.TTL[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportOf returns the report of database generated at the given RFC 3339
+// time, or the newest one when at is empty.
+func (s *summaryServer) reportOf(database, at string) (*runReport, error) {
+	files, err := s.refresh()
+	if err != nil {
+		return nil, err
+	}
+	var want time.Time
+	if at != "" {
+		if want, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, err
+		}
+	}
+	var path string
+	var newest time.Time
+	for p, file := range files {
+		summary := file.summary
+		if summary.Database != database {
+			continue
+		}
+		if at == "" && (path == "" || summary.GeneratedAt.After(newest)) || at != "" && summary.GeneratedAt.Equal(want) {
+			path, newest = p, summary.GeneratedAt
+		}
+	}
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := new(runReport)
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return report, nil
+}
+
+// handleHistory lists the summaries of the reports of a database, newest
+// first.
+func (s *summaryServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	database := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/history"), "/")
+	files, err := s.refresh()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	history := []*schemaSummary{}
+	for _, file := range files {
+		if file.summary.Database == database {
+			history = append(history, file.summary)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].GeneratedAt.After(history[j].GeneratedAt) })
+	writeJSON(w, history)
+}
+
+// handleReport returns a full report, the newest one unless ?at= names its
+// generation time.
+func (s *summaryServer) handleReport(w http.ResponseWriter, r *http.Request) {
+	database := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/report"), "/")
+	report, err := s.reportOf(database, r.URL.Query().Get("at"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if report == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// handleDiff compares the schemas of two reports of a database, ?from= one
+// and ?to= another or the newest.
+func (s *summaryServer) handleDiff(w http.ResponseWriter, r *http.Request) {
+	database := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/diff"), "/")
+	from, err := s.reportOf(database, r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := s.reportOf(database, r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if from == nil || to == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, diffSchema(from.GeneratedAt.Format(time.RFC3339Nano), from.Schema, to.Schema))
+}
+
+func handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, uiPage)
+}
+
+// uiPage is the single-page UI of serve. It only reads the JSON endpoints
+// and builds the page with DOM calls, so values from reports are never
+// interpreted as markup.
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Schemas</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 0; color: #222; }
+header { background: #2d3e50; color: #fff; padding: 8px 16px; display: flex; gap: 16px; align-items: center; }
+header h1 { font-size: 18px; margin: 0; }
+main { display: flex; }
+nav { width: 260px; border-right: 1px solid #ddd; padding: 8px; height: calc(100vh - 52px); overflow: auto; }
+section { flex: 1; padding: 8px 16px; height: calc(100vh - 52px); overflow: auto; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 16px; }
+th, td { text-align: left; padding: 3px 8px; border-bottom: 1px solid #eee; font-size: 13px; }
+tr.link { cursor: pointer; } tr.link:hover, li:hover { background: #f0f4f8; }
+ul { list-style: none; padding: 0; margin: 0; }
+li { padding: 4px; cursor: pointer; font-size: 13px; }
+li.selected, tr.selected { background: #dbe7f3; }
+.bar { background: #e8e8e8; width: 120px; height: 10px; display: inline-block; }
+.bar span { background: #4c8ed9; height: 10px; display: block; }
+.added { color: #2a7d2a; } .removed { color: #b03030; } .changed { color: #a06000; }
+h2 { font-size: 16px; } small { color: #777; }
+</style>
+</head>
+<body>
+<header><h1>Schemas</h1><select id="database"></select><label>compare with <select id="compare"></select></label></header>
+<main><nav><h2>History</h2><ul id="history"></ul></nav><section id="content"></section></main>
+<script>
+"use strict";
+// diffs caches the diff requests by database and report pair; renders counts
+// the renders, so that a diff arriving after a newer one is dropped.
+var state = {database: "", at: "", report: null, collection: "", diffs: {}, renders: 0};
+
+function el(tag, attrs) {
+  var e = document.createElement(tag);
+  for (var k in attrs || {}) {
+    if (k === "text") e.textContent = attrs[k];
+    else if (k === "onclick") e.onclick = attrs[k];
+    else e.setAttribute(k, attrs[k]);
+  }
+  for (var i = 2; i < arguments.length; i++) if (arguments[i]) e.appendChild(arguments[i]);
+  return e;
+}
+
+function get(path) {
+  return fetch(path).then(function (r) {
+    if (!r.ok) throw new Error(path + ": " + r.status);
+    return r.json();
+  });
+}
+
+function table(headers, rows) {
+  var t = el("table", {}, el("tr", {}));
+  headers.forEach(function (h) { t.firstChild.appendChild(el("th", {text: h})); });
+  rows.forEach(function (r) { t.appendChild(r); });
+  return t;
+}
+
+function row(cells, onclick, selected) {
+  var tr = el("tr", onclick ? {"class": "link" + (selected ? " selected" : "")} : {});
+  if (onclick) tr.onclick = onclick;
+  cells.forEach(function (c) { tr.appendChild(c instanceof Node ? el("td", {}, c) : el("td", {text: c === undefined ? "" : String(c)})); });
+  return tr;
+}
+
+function coverage(count, sampled) {
+  var share = sampled ? count / sampled : 0;
+  var bar = el("span", {}, el("span", {"class": "bar"}, el("span", {style: "width:" + Math.round(share * 100) + "%"})));
+  bar.appendChild(document.createTextNode(" " + (share * 100).toFixed(1) + "%"));
+  return bar;
+}
+
+function types(f) { return (f.types && f.types.length ? f.types : [f.type]).join(" | "); }
+
+function loadDatabases() {
+  get("/summary").then(function (list) {
+    var select = document.getElementById("database");
+    list.forEach(function (s) { select.appendChild(el("option", {text: s.database, value: s.database})); });
+    select.onchange = function () { selectDatabase(select.value); };
+    if (list.length) selectDatabase(list[0].database);
+  });
+}
+
+function selectDatabase(database) {
+  state.database = database;
+  get("/api/history/" + encodeURIComponent(database)).then(function (history) {
+    var ul = document.getElementById("history"), compare = document.getElementById("compare");
+    ul.textContent = ""; compare.textContent = "";
+    compare.appendChild(el("option", {text: "-", value: ""}));
+    history.forEach(function (s) {
+      var label = new Date(s.generatedAt).toLocaleString();
+      ul.appendChild(el("li", {text: label + " · " + s.fields + " fields", "data-at": s.generatedAt,
+        onclick: function () { selectReport(s.generatedAt); }}));
+      compare.appendChild(el("option", {text: label, value: s.generatedAt}));
+    });
+    compare.onchange = render;
+    if (history.length) selectReport(history[0].generatedAt);
+  });
+}
+
+function selectReport(at) {
+  state.at = at; state.collection = "";
+  document.querySelectorAll("#history li").forEach(function (li) {
+    li.className = li.getAttribute("data-at") === at ? "selected" : "";
+  });
+  get("/api/report/" + encodeURIComponent(state.database) + "?at=" + encodeURIComponent(at)).then(function (report) {
+    state.report = report;
+    render();
+  });
+}
+
+function render() {
+  var report = state.report, content = document.getElementById("content");
+  if (!report) return;
+  var generation = ++state.renders;
+  report.findings = report.findings || [];
+  report.stats = report.stats || {};
+  content.textContent = "";
+  content.appendChild(el("h2", {text: report.database + " "}, el("small", {text: new Date(report.generatedAt).toLocaleString() +
+    " · health " + report.healthScore.toFixed(1) + " · " + report.findings.length + " findings"})));
+  var names = Object.keys(report.schema).sort();
+  content.appendChild(table(["Collection", "Documents", "Sampled", "Fields", "Quality"], names.map(function (name) {
+    var s = report.stats[name] || {};
+    return row([name, s.documents, s.sampled, report.schema[name].length, s.quality ? s.quality.score.toFixed(1) : ""],
+      function () { state.collection = name; render(); }, name === state.collection);
+  })));
+  var compare = document.getElementById("compare").value;
+  if (compare && compare !== state.at) {
+    var key = [state.database, compare, state.at].join("\n"), holder = el("div");
+    content.appendChild(holder);
+    if (!state.diffs[key]) {
+      var q = "?from=" + encodeURIComponent(compare) + "&to=" + encodeURIComponent(state.at);
+      state.diffs[key] = get("/api/diff/" + encodeURIComponent(state.database) + q).catch(function (err) {
+        delete state.diffs[key];
+        throw err;
+      });
+    }
+    state.diffs[key].then(function (diff) {
+      if (generation === state.renders) holder.appendChild(renderDiff(diff));
+    });
+  }
+  if (state.collection && report.schema[state.collection]) {
+    var sampled = (report.stats[state.collection] || {}).sampled;
+    content.appendChild(el("h2", {text: state.collection}));
+    content.appendChild(table(["Field", "Types", "Count", "Coverage"], report.schema[state.collection].map(function (f) {
+      return row([f.name, types(f), f.count, coverage(f.count, sampled)]);
+    })));
+    var findings = report.findings.filter(function (f) { return f.collection === state.collection; });
+    if (findings.length) {
+      content.appendChild(el("h2", {text: "Findings"}));
+      content.appendChild(table(["Kind", "Field", "Message"], findings.map(function (f) { return row([f.kind, f.field, f.message]); })));
+    }
+  }
+}
+
+function renderDiff(diff) {
+  var div = el("div", {}, el("h2", {text: "Changes since " + new Date(diff.baseline).toLocaleString()}));
+  var rows = [];
+  (diff.addedCollections || []).forEach(function (c) { rows.push(row([el("span", {"class": "added", text: "+ " + c}), "", "collection added"])); });
+  (diff.removedCollections || []).forEach(function (c) { rows.push(row([el("span", {"class": "removed", text: "- " + c}), "", "collection removed"])); });
+  (diff.collections || []).forEach(function (c) {
+    (c.addedFields || []).forEach(function (f) { rows.push(row([c.collection, el("span", {"class": "added", text: "+ " + f.name}), types(f)])); });
+    (c.removedFields || []).forEach(function (f) { rows.push(row([c.collection, el("span", {"class": "removed", text: "- " + f.name}), types(f)])); });
+    (c.changedFields || []).forEach(function (f) {
+      rows.push(row([c.collection, el("span", {"class": "changed", text: "~ " + f.name}), f.before.join(" | ") + " → " + f.after.join(" | ")]));
+    });
+  });
+  div.appendChild(rows.length ? table(["Collection", "Field", "Change"], rows) : el("p", {text: "No changes."}));
+  return div;
+}
+
+loadDatabases();
+</script>
+</body>
+</html>
+`
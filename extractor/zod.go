@@ -0,0 +1,159 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ZodFormat writes a TypeScript module of Zod schemas of the collections,
+// to validate documents at runtime.
+const ZodFormat = "zod"
+
+// zodTypes are the Zod schemas of the base types. ObjectIds and binary data
+// are the classes of the bson package, which the Node.js driver returns.
+var zodTypes = map[string]string{
+	"INTEGER":  "z.number().int()",
+	"DECIMAL":  "z.number()",
+	"STRING":   "z.string()",
+	"BOOL":     "z.boolean()",
+	"TIME":     "z.date()",
+	"OBJECTID": "z.instanceof(ObjectId)",
+	"BINARY":   "z.instanceof(Binary)",
+}
+
+// jsIdentifier matches the property names that need no quotes.
+var jsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// zodKey returns a property name of an object literal, quoted unless it is
+// an identifier.
+func zodKey(name string) string {
+	if jsIdentifier.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// zodWriter writes the schemas, those of nested documents before the schema
+// using them, as a const cannot be used before its declaration.
+type zodWriter struct {
+	source  bytes.Buffer
+	schemas map[string]bool
+	// bson are the classes to import from the bson package.
+	bson map[string]bool
+}
+
+// zodType returns the schema of a node, writing the schemas it needs under
+// names derived from name. Integers mixed with decimals are numbers, other
+// mixed scalars unions, and anything else unknown.
+func (w *zodWriter) zodType(name string, n *modelNode) string {
+	if n.Numeric {
+		return "z.number()"
+	}
+	types := n.Types
+	if len(types) != 1 {
+		var union []string
+		for _, t := range types {
+			if zodTypes[t] == "" {
+				return "z.unknown()"
+			}
+			union = append(union, w.scalarType(t))
+		}
+		if len(union) == 0 {
+			return "z.unknown()"
+		}
+		return "z.union([" + strings.Join(union, ", ") + "])"
+	}
+	switch types[0] {
+	case "DOCUMENT":
+		if n.Properties == nil {
+			if n.Rest == nil {
+				return "z.record(z.string(), z.unknown())"
+			}
+			return "z.record(z.string(), " + w.zodType(name+"Value", n.Rest) + ")"
+		}
+		schemaName := uniqueName(w.schemas, name)
+		w.writeSchema(schemaName, n, "")
+		return schemaName
+	case "ARRAY":
+		if n.Items == nil {
+			return "z.array(z.unknown())"
+		}
+		return "z.array(" + w.zodType(name+"Item", n.Items) + ")"
+	}
+	if zodTypes[types[0]] == "" {
+		return "z.unknown()"
+	}
+	return w.scalarType(types[0])
+}
+
+func (w *zodWriter) scalarType(t string) string {
+	switch t {
+	case "OBJECTID":
+		w.bson["ObjectId"] = true
+	case "BINARY":
+		w.bson["Binary"] = true
+	}
+	return zodTypes[t]
+}
+
+// writeSchema writes the object schema of a document and its inferred type.
+// Fields missing from some documents holding it are optional. Summarized
+// -dynamic keys are validated by a catchall, other unknown keys stripped as
+// Zod does.
+func (w *zodWriter) writeSchema(name string, n *modelNode, doc string) {
+	var body bytes.Buffer
+	for _, child := range n.Properties {
+		typ := w.zodType(name+goName(child.Name), child)
+		if !child.Required {
+			typ += ".optional()"
+		}
+		fmt.Fprintf(&body, "  %v: %v,\n", zodKey(child.Name), typ)
+	}
+	object := "z.object({})"
+	if body.Len() > 0 {
+		object = "z.object({\n" + body.String() + "})"
+	}
+	if n.Rest != nil {
+		object += ".catchall(" + w.zodType(name+"Value", n.Rest) + ")"
+	}
+	w.source.WriteString("\n")
+	if doc != "" {
+		fmt.Fprintf(&w.source, "/** %v */\n", doc)
+	}
+	fmt.Fprintf(&w.source, "export const %v = %v;\n", name, object)
+	fmt.Fprintf(&w.source, "export type %v = z.infer<typeof %v>;\n", name, name)
+}
+
+// zodSchemas returns a TypeScript module declaring a schema per collection,
+// named after the collection, and the schemas of their nested documents.
+func zodSchemas(m *schemaModel) []byte {
+	w := &zodWriter{
+		schemas: map[string]bool{"Binary": true, "ObjectId": true},
+		bson:    make(map[string]bool),
+	}
+	for _, c := range m.Collections {
+		w.writeSchema(uniqueName(w.schemas, goName(c.Name)), c.Document, fmt.Sprintf("A document of the %v collection.", c.Name))
+	}
+	var source bytes.Buffer
+	source.WriteString("// Generated by extract_mgo from sampled documents.\n\n")
+	if len(w.bson) > 0 {
+		classes := make([]string, 0, len(w.bson))
+		for class := range w.bson {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		fmt.Fprintf(&source, "import { %v } from \"bson\";\n", strings.Join(classes, ", "))
+	}
+	source.WriteString("import { z } from \"zod\";\n")
+	source.Write(w.source.Bytes())
+	return source.Bytes()
+}
+
+func exportZod(path string, m *schemaModel, cmdInfo *commandInfo) error {
+	return ioutil.WriteFile(path, zodSchemas(m), 0644)
+}
@@ -0,0 +1,182 @@
+// Package mgoschema reads the JSON schema files written by extract_mgo.
+//
+// Every file carries a formatVersion. Within a version, fields are only ever
+// added; removing, renaming or changing the meaning of a field bumps the
+// version and adds an upgrade step, so Read keeps returning files written by
+// older versions of the tool in the current format.
+package mgoschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// FormatVersion is the version of the files written by this version of the
+// tool. Version 1 files are the bare map of collection names to fields
+// written before the version was recorded.
+const FormatVersion = 2
+
+// Schema is the content of a schema file.
+type Schema struct {
+	FormatVersion int                `json:"formatVersion"`
+	Database      string             `json:"database,omitempty"`
+	Collections   map[string][]Field `json:"collections"`
+}
+
+// Field is a field of a collection. Nested fields are named with dots, array
+// elements with "[]", e.g. "items[].sku".
+type Field struct {
+	Name string `json:"name"`
+	// Type is the field type, e.g. "STRING" or "STRING(NUMERIC)". Mixed
+	// fields list every type in Types.
+	Type  string   `json:"type"`
+	Types []string `json:"types,omitempty"`
+	// Count is the number of sampled documents containing the field.
+	Count int `json:"count,omitempty"`
+	// Missed counts consecutive merge runs in which the field was not observed.
+	Missed       int          `json:"missed,omitempty"`
+	IndexUsage   []IndexUsage `json:"indexUsage,omitempty"`
+	Unique       bool         `json:"unique,omitempty"`
+	Monotonicity string       `json:"monotonicity,omitempty"`
+	Values       *Values      `json:"values,omitempty"`
+	// Owner and Domain are set on fields owned apart from their collection.
+	Owner  string `json:"owner,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	// Provenance lists, per type, _id values of sampled documents where the
+	// field has that type. ObjectIds are hex strings.
+	Provenance map[string][]interface{} `json:"provenance,omitempty"`
+	// KeyTypes and Keys are set on the "*" field summarizing the keys of a
+	// dynamic document: values by type and the estimated distinct keys.
+	KeyTypes map[string]int `json:"keyTypes,omitempty"`
+	Keys     int            `json:"keys,omitempty"`
+	// Conditions describe when an optional field appears, e.g.
+	// "required when status == \"refunded\"".
+	Conditions []string  `json:"conditions,omitempty"`
+	Coercion   *Coercion `json:"coercion,omitempty"`
+	// ElementTypes counts the sampled elements of an array by type, and
+	// Homogeneous tells whether they all have the same type.
+	ElementTypes map[string]int `json:"elementTypes,omitempty"`
+	Homogeneous  *bool          `json:"homogeneous,omitempty"`
+	// Sources are the databases the field was seen in when archives were
+	// sampled too: "live" and the names of archives.
+	Sources []string `json:"sources,omitempty"`
+	// Tenants counts the sampled documents of each tenant holding the field
+	// when a tenant field was given.
+	Tenants map[string]int `json:"tenants,omitempty"`
+}
+
+// Coercion is the suggested cleanup of a mixed-type field: the type to keep
+// and, per other type, the estimated documents holding it and the update
+// converting them.
+type Coercion struct {
+	Target  string `json:"target"`
+	Updates []struct {
+		From     string                   `json:"from"`
+		Affected int                      `json:"affected"`
+		Filter   map[string]interface{}   `json:"filter"`
+		Pipeline []map[string]interface{} `json:"pipeline"`
+	} `json:"updates"`
+}
+
+// IndexUsage is the $indexStats usage of an index on the field.
+type IndexUsage struct {
+	Index string    `json:"index"`
+	Ops   int64     `json:"ops"`
+	Since time.Time `json:"since"`
+}
+
+// Values is the value profile of a field sampled with -deep.
+type Values struct {
+	Distinct    int  `json:"distinct"`
+	Approximate bool `json:"approximate,omitempty"`
+	Top         []struct {
+		Value string `json:"value"`
+		Count int    `json:"count"`
+	} `json:"top,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	Histogram []struct {
+		Value float64 `json:"value"`
+		Count int     `json:"count"`
+	} `json:"histogram,omitempty"`
+}
+
+// upgrades[v] converts a version v+1 file into a version v+2 file.
+var upgrades = []func(data []byte) ([]byte, error){
+	upgradeV1,
+}
+
+// upgradeV1 wraps the bare collection map in the versioned envelope.
+func upgradeV1(data []byte) ([]byte, error) {
+	var collections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &collections); err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		FormatVersion int                        `json:"formatVersion"`
+		Collections   map[string]json.RawMessage `json:"collections"`
+	}{2, collections})
+}
+
+// version returns the format version of a schema file.
+func version(data []byte) (int, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return 0, err
+	}
+	raw, ok := probe["formatVersion"]
+	if !ok {
+		return 1, nil
+	}
+	var v int
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, fmt.Errorf("invalid formatVersion %s", raw)
+	}
+	return v, nil
+}
+
+// Upgrade converts a schema file of any known version to the current format.
+func Upgrade(data []byte) ([]byte, error) {
+	v, err := version(bytes.TrimSpace(data))
+	if err != nil {
+		return nil, err
+	}
+	if v < 1 || v > FormatVersion {
+		return nil, fmt.Errorf("unsupported schema format version %v, this version reads up to %v", v, FormatVersion)
+	}
+	for ; v < FormatVersion; v++ {
+		if data, err = upgrades[v-1](data); err != nil {
+			return nil, fmt.Errorf("upgrading from format version %v: %v", v, err)
+		}
+	}
+	return data, nil
+}
+
+// Read reads a schema file, upgrading it to the current format.
+func Read(r io.Reader) (*Schema, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = Upgrade(data); err != nil {
+		return nil, err
+	}
+	schema := new(Schema)
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// ReadFile reads the schema file at path, upgrading it to the current format.
+func ReadFile(path string) (*Schema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Read(bytes.NewReader(data))
+}
@@ -0,0 +1,41 @@
+package mgoschema
+
+// TypeHook teaches the extractor a domain-specific type, e.g. a binary
+// envelope format. Hooks take effect in the extractions of the program
+// registering them, through the extractor package.
+type TypeHook interface {
+	// OnValue is called with the path of every sampled value, named like
+	// Field names, and its decoded value: bson.D for documents,
+	// []interface{} for arrays, bson.Binary or []byte for binary data. It
+	// returns the type to report instead of the inferred one, e.g.
+	// "ENVELOPE", and false to leave the value to the next hook or to the
+	// tool. Values of an overridden type are not descended into.
+	OnValue(path string, value interface{}) (typ string, ok bool)
+}
+
+// TypeHookFunc adapts a function to the TypeHook interface.
+type TypeHookFunc func(path string, value interface{}) (string, bool)
+
+// OnValue calls f.
+func (f TypeHookFunc) OnValue(path string, value interface{}) (string, bool) {
+	return f(path, value)
+}
+
+var typeHooks []TypeHook
+
+// RegisterTypeHook adds a hook consulted for every sampled value, after
+// those registered before it. Hooks are registered before extracting and
+// are called from several goroutines at once.
+func RegisterTypeHook(h TypeHook) {
+	typeHooks = append(typeHooks, h)
+}
+
+// TypeOverride returns the type the first hook claiming the value gives it.
+func TypeOverride(path string, value interface{}) (string, bool) {
+	for _, h := range typeHooks {
+		if typ, ok := h.OnValue(path, value); ok {
+			return typ, true
+		}
+	}
+	return "", false
+}